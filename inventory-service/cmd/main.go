@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -11,13 +12,24 @@ import (
 	config "github.com/Nurda-zh/a1/inventory-service/configs"
 	delivery "github.com/Nurda-zh/a1/inventory-service/internal/delivery/http"
 	"github.com/Nurda-zh/a1/inventory-service/internal/delivery/http/handler"
+	"github.com/Nurda-zh/a1/inventory-service/internal/delivery/http/middleware"
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
 	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
 	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+	"github.com/Nurda-zh/a1/inventory-service/internal/worker"
+	"github.com/Nurda-zh/a1/pkg/auth"
+	"github.com/Nurda-zh/a1/pkg/idempotency"
+	"github.com/Nurda-zh/a1/pkg/webhook"
 )
 
 func main() {
 	cfg := config.LoadConfig()
 
+	verifier, err := newVerifier(cfg)
+	if err != nil {
+		log.Fatalf("auth: %v", err)
+	}
+
 	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.MongoURI))
 	if err != nil {
 		log.Fatal(err)
@@ -25,15 +37,133 @@ func main() {
 
 	db := client.Database(cfg.Database)
 
+	entity.DefaultCurrency = cfg.DefaultCurrency
+	migrated, err := repository.MigrateProductPrices(context.Background(), db, cfg.DefaultCurrency)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if migrated > 0 {
+		log.Printf("Migrated %d product prices to minor units", migrated)
+	}
+
+	rule := entity.AllocationRule(cfg.AllocationRule)
+	if !rule.Valid() {
+		log.Fatalf("Invalid ALLOCATION_RULE %q", cfg.AllocationRule)
+	}
+	whRepo := repository.NewWarehouseRepository(db)
+	if err := whRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	whUC := usecase.NewWarehouseUsecase(whRepo)
+	defaultWarehouse, err := whUC.EnsureDefault(context.Background(), cfg.DefaultWarehouse)
+	if err != nil {
+		log.Fatal(err)
+	}
+	entity.DefaultWarehouseID = defaultWarehouse.ID
+	located, err := repository.MigrateProductLocations(context.Background(), db, defaultWarehouse.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if located > 0 {
+		log.Printf("Moved stock of %d products to warehouse %s", located, defaultWarehouse.Code)
+	}
+	wh := handler.NewWarehouseHandler(whUC)
+
+	movRepo := repository.NewMovementRepository(db)
+	if err := movRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	opened, err := repository.MigrateStockLedger(context.Background(), db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opened > 0 {
+		log.Printf("Opened stock ledger for %d products", opened)
+	}
+	mh := handler.NewMovementHandler(usecase.NewMovementUsecase(movRepo, whRepo))
+
+	catRepo := repository.NewCategoryRepository(db)
+	if err := catRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	categorized, err := repository.MigrateProductCategories(context.Background(), db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if categorized > 0 {
+		log.Printf("Moved %d products from free-text categories to category slugs", categorized)
+	}
+	ch := handler.NewCategoryHandler(usecase.NewCategoryUsecase(catRepo))
+
 	repo := repository.NewProductRepository(db)
-	uc := usecase.NewProductUsecase(repo)
+	if err := repo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	uc := usecase.NewProductUsecase(repo, catRepo, whRepo, rule)
 	ph := handler.NewProductHandler(uc)
 
+	trRepo := repository.NewTransferRepository(db)
+	if err := trRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	th := handler.NewTransferHandler(usecase.NewTransferUsecase(trRepo, repo, whRepo))
+
+	resRepo := repository.NewReservationRepository(db)
+	if err := resRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	resUC := usecase.NewReservationUsecase(resRepo, whRepo, rule, cfg.ReservationTTL)
+	rh := handler.NewReservationHandler(resUC)
+
+	go worker.NewReservationSweeper(resUC, cfg.ReservationSweepInterval).Run(context.Background())
+
+	idemStore := idempotency.NewMongoStore(db.Collection("idempotency_keys"), 5*time.Second)
+	if err := idemStore.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	idempotent := idempotency.Middleware(idemStore, cfg.IdempotencyTTL)
+
+	whkRepo := repository.NewWebhookRepository(db)
+	if err := whkRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	whkUC := usecase.NewWebhookUsecase(whkRepo, movRepo, webhook.NewSender("inventory-service-webhooks", cfg.WebhookTimeout), cfg.WebhookMaxAttempts)
+	hh := handler.NewWebhookHandler(whkUC)
+	go worker.NewWebhookDispatcher(whkUC, cfg.WebhookPollInterval).Run(context.Background())
+
+	auditRepo := repository.NewAuditRepository(db)
+	if err := auditRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	ah := handler.NewAuditHandler(usecase.NewAuditUsecase(auditRepo))
+
 	r := gin.Default()
-	delivery.NewRouter(r, ph)
+	delivery.NewRouter(r, middleware.Authenticate(verifier, auditRepo), middleware.Authorize(auditRepo), idempotent, ph, rh, ch, mh, wh, th, hh, ah)
 
 	log.Println("Inventory service running on port " + cfg.ServerPort)
 	if err := r.Run(":" + cfg.ServerPort); err != nil {
 		log.Fatal(err)
 	}
 }
+
+func newVerifier(cfg *config.Config) (*auth.Verifier, error) {
+	keys := &auth.KeySet{}
+	if cfg.JWTHS256Secret != "" {
+		keys.AddHS256([]byte(cfg.JWTHS256Secret))
+	}
+	if cfg.JWTRS256PublicKeyFile != "" {
+		if err := keys.AddRS256PEMFile(cfg.JWTRS256PublicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.JWTJWKSFile != "" {
+		if err := keys.AddJWKSFile(cfg.JWTJWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	return auth.NewVerifier(auth.Config{
+		Keys:     keys,
+		Issuer:   cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+	})
+}
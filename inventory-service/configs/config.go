@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +13,36 @@ type Config struct {
 	MongoURI   string
 	Database   string
 	ServerPort string
+
+	DefaultCurrency string
+
+	// DefaultWarehouse is the code of the warehouse that receives stock
+	// without a location; AllocationRule picks warehouses for reservations.
+	DefaultWarehouse string
+	AllocationRule   string
+
+	ReservationTTL           time.Duration
+	ReservationSweepInterval time.Duration
+
+	// IdempotencyTTL is how long responses to requests sent with an
+	// Idempotency-Key are kept for replay.
+	IdempotencyTTL time.Duration
+
+	// WebhookMaxAttempts is how often a delivery is tried before it becomes
+	// a dead letter.
+	WebhookMaxAttempts  int
+	WebhookPollInterval time.Duration
+	WebhookTimeout      time.Duration
+
+	// Callers authenticate with JWT bearer tokens signed with the HS256
+	// secret, the RS256 public key in a PEM file or the keys of a JWKS file;
+	// at least one must be set. Their roles claim grants permissions, see
+	// entity.Allowed. Issuer and audience are checked when set.
+	JWTHS256Secret        string
+	JWTRS256PublicKeyFile string
+	JWTJWKSFile           string
+	JWTIssuer             string
+	JWTAudience           string
 }
 
 func LoadConfig() *Config {
@@ -23,6 +55,26 @@ func LoadConfig() *Config {
 		MongoURI:   getEnv("MONGO_URI", "mongodb://localhost:27017"),
 		Database:   getEnv("MONGO_DB", "inventory_db"),
 		ServerPort: getEnv("SERVER_PORT", "8080"),
+
+		DefaultCurrency: getEnv("DEFAULT_CURRENCY", "USD"),
+
+		DefaultWarehouse: getEnv("DEFAULT_WAREHOUSE", "main"),
+		AllocationRule:   getEnv("ALLOCATION_RULE", "priority"),
+
+		ReservationTTL:           getDuration("RESERVATION_TTL", 30*time.Minute),
+		ReservationSweepInterval: getDuration("RESERVATION_SWEEP_INTERVAL", 30*time.Second),
+
+		IdempotencyTTL: getDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		WebhookMaxAttempts:  getInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookPollInterval: getDuration("WEBHOOK_POLL_INTERVAL", time.Second),
+		WebhookTimeout:      getDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+
+		JWTHS256Secret:        getEnv("JWT_HS256_SECRET", ""),
+		JWTRS256PublicKeyFile: getEnv("JWT_RS256_PUBLIC_KEY_FILE", ""),
+		JWTJWKSFile:           getEnv("JWT_JWKS_FILE", ""),
+		JWTIssuer:             getEnv("JWT_ISSUER", ""),
+		JWTAudience:           getEnv("JWT_AUDIENCE", ""),
 	}
 	log.Println("Configuration loaded.")
 	return cfg
@@ -34,3 +86,31 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getDuration reads a positive duration. Zero and below fall back like any
+// invalid value: tickers panic on them and timeouts would fail every call.
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s=%q, using %s.", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+func getInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s=%q, using %d.", key, value, fallback)
+		return fallback
+	}
+	return n
+}
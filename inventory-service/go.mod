@@ -2,7 +2,10 @@ module github.com/Nurda-zh/a1/inventory-service
 
 go 1.23.4
 
-require github.com/gin-gonic/gin v1.10.1
+require (
+	github.com/Nurda-zh/a1/pkg v0.0.0
+	github.com/gin-gonic/gin v1.10.1
+)
 
 require (
 	github.com/golang/snappy v0.0.4 // indirect
@@ -45,3 +48,5 @@ require (
 	google.golang.org/protobuf v1.34.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/Nurda-zh/a1/pkg => ../pkg
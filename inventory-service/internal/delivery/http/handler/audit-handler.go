@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	uc usecase.AuditUsecase
+}
+
+func NewAuditHandler(uc usecase.AuditUsecase) *AuditHandler {
+	return &AuditHandler{uc: uc}
+}
+
+func (h *AuditHandler) ListDenials(c *gin.Context) {
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+			return
+		}
+		limit = n
+	}
+	entries, err := h.uc.ListDenials(c, c.Query("actor"), limit)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type CategoryHandler struct {
+	uc usecase.CategoryUsecase
+}
+
+func NewCategoryHandler(uc usecase.CategoryUsecase) *CategoryHandler {
+	return &CategoryHandler{uc: uc}
+}
+
+func (h *CategoryHandler) CreateCategory(c *gin.Context) {
+	var req entity.CreateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cat, err := h.uc.CreateCategory(c, &req)
+	if err != nil {
+		categoryError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, cat)
+}
+
+func (h *CategoryHandler) GetCategory(c *gin.Context) {
+	cat, err := h.uc.GetCategory(c, c.Param("id"))
+	if err != nil {
+		categoryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, cat)
+}
+
+func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
+	var req entity.UpdateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cat, err := h.uc.UpdateCategory(c, c.Param("id"), &req)
+	if err != nil {
+		categoryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, cat)
+}
+
+func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
+	if err := h.uc.DeleteCategory(c, c.Param("id")); err != nil {
+		categoryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted"})
+}
+
+func (h *CategoryHandler) ListCategories(c *gin.Context) {
+	categories, err := h.uc.ListCategories(c)
+	if err != nil {
+		categoryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, categories)
+}
+
+func categoryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrCategorySlugTaken), errors.Is(err, usecase.ErrCategoryInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidCategory):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+// scriptedCategories answers every call with err, or with a category named
+// after the request, and records the last id and request it was given.
+type scriptedCategories struct {
+	err    error
+	calls  int
+	id     string
+	create *entity.CreateCategoryRequest
+	update *entity.UpdateCategoryRequest
+}
+
+func (u *scriptedCategories) CreateCategory(ctx context.Context, req *entity.CreateCategoryRequest) (*entity.Category, error) {
+	u.calls++
+	u.create = req
+	if u.err != nil {
+		return nil, u.err
+	}
+	return &entity.Category{Name: req.Name, Slug: entity.Slugify(req.Name)}, nil
+}
+
+func (u *scriptedCategories) GetCategory(ctx context.Context, id string) (*entity.Category, error) {
+	u.calls++
+	u.id = id
+	if u.err != nil {
+		return nil, u.err
+	}
+	return &entity.Category{Name: "Tools", Slug: "tools"}, nil
+}
+
+func (u *scriptedCategories) UpdateCategory(ctx context.Context, id string, req *entity.UpdateCategoryRequest) (*entity.Category, error) {
+	u.calls++
+	u.id, u.update = id, req
+	if u.err != nil {
+		return nil, u.err
+	}
+	return &entity.Category{Name: *req.Name}, nil
+}
+
+func (u *scriptedCategories) DeleteCategory(ctx context.Context, id string) error {
+	u.calls++
+	u.id = id
+	return u.err
+}
+
+func (u *scriptedCategories) ListCategories(ctx context.Context) ([]entity.Category, error) {
+	u.calls++
+	if u.err != nil {
+		return nil, u.err
+	}
+	return []entity.Category{}, nil
+}
+
+var _ usecase.CategoryUsecase = (*scriptedCategories)(nil)
+
+func serveCategories(uc usecase.CategoryUsecase, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewCategoryHandler(uc)
+	r.POST("/categories", h.CreateCategory)
+	r.GET("/categories", h.ListCategories)
+	r.GET("/categories/:id", h.GetCategory)
+	r.PATCH("/categories/:id", h.UpdateCategory)
+	r.DELETE("/categories/:id", h.DeleteCategory)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestCategoryRoutes(t *testing.T) {
+	uc := &scriptedCategories{}
+
+	w := serveCategories(uc, http.MethodPost, "/categories", `{"name":"Power Tools","parent_id":"p1"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d: %s", w.Code, w.Body)
+	}
+	var created entity.Category
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Slug != "power-tools" {
+		t.Errorf("create: body %s", w.Body)
+	}
+	if uc.create.ParentID != "p1" {
+		t.Errorf("create: parent = %q, want p1", uc.create.ParentID)
+	}
+
+	w = serveCategories(uc, http.MethodPatch, "/categories/c1", `{"name":"Drills"}`)
+	if w.Code != http.StatusOK || uc.id != "c1" {
+		t.Fatalf("update: status = %d for %q: %s", w.Code, uc.id, w.Body)
+	}
+	// fields left out of the body stay nil so the usecase leaves them alone
+	if uc.update.Slug != nil || uc.update.ParentID != nil {
+		t.Errorf("update: request = %+v, want only the name", uc.update)
+	}
+
+	if w = serveCategories(uc, http.MethodGet, "/categories", ""); w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("list: status %d body %s, want an empty array", w.Code, w.Body)
+	}
+	if w = serveCategories(uc, http.MethodGet, "/categories/c2", ""); w.Code != http.StatusOK || uc.id != "c2" {
+		t.Errorf("get: status = %d for %q", w.Code, uc.id)
+	}
+	if w = serveCategories(uc, http.MethodDelete, "/categories/c3", ""); w.Code != http.StatusOK || uc.id != "c3" {
+		t.Errorf("delete: status = %d for %q", w.Code, uc.id)
+	}
+}
+
+func TestCategoryBadBodies(t *testing.T) {
+	tests := []struct {
+		method, target, body string
+	}{
+		{http.MethodPost, "/categories", `{"slug":"tools"}`},
+		{http.MethodPost, "/categories", `{"name":`},
+		{http.MethodPatch, "/categories/c1", `{"name":1}`},
+	}
+	for _, tt := range tests {
+		uc := &scriptedCategories{}
+		w := serveCategories(uc, tt.method, tt.target, tt.body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: status = %d, want 400", tt.method, tt.body, w.Code)
+		}
+		if uc.calls != 0 {
+			t.Errorf("%s %s: the usecase was called", tt.method, tt.body)
+		}
+	}
+}
+
+func TestCategoryErrors(t *testing.T) {
+	errs := []struct {
+		err  error
+		want int
+	}{
+		{usecase.ErrCategoryNotFound, http.StatusNotFound},
+		{usecase.ErrCategorySlugTaken, http.StatusConflict},
+		{usecase.ErrCategoryInUse, http.StatusConflict},
+		{usecase.ErrInvalidCategory, http.StatusBadRequest},
+		{errors.New("connection reset"), http.StatusInternalServerError},
+	}
+	routes := []struct {
+		method, target, body string
+	}{
+		{http.MethodPost, "/categories", `{"name":"Tools"}`},
+		{http.MethodGet, "/categories", ""},
+		{http.MethodGet, "/categories/c1", ""},
+		{http.MethodPatch, "/categories/c1", `{"name":"Tools"}`},
+		{http.MethodDelete, "/categories/c1", ""},
+	}
+	for _, r := range routes {
+		for _, e := range errs {
+			w := serveCategories(&scriptedCategories{err: e.err}, r.method, r.target, r.body)
+			if w.Code != e.want {
+				t.Errorf("%s %s with %v: status = %d, want %d", r.method, r.target, e.err, w.Code, e.want)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] != e.err.Error() {
+				t.Errorf("%s %s with %v: body %s", r.method, r.target, e.err, w.Body)
+			}
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/pkg/etag"
+	"github.com/gin-gonic/gin"
+)
+
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", etag.Format(version))
+}
+
+// requireIfMatch reads the version a write is conditioned on from If-Match and
+// answers the request itself when it cannot be used, see etag.StatusCode.
+func requireIfMatch(c *gin.Context) (int64, bool) {
+	version, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.JSON(etag.StatusCode(err), gin.H{"error": err.Error()})
+		return 0, false
+	}
+	if version == etag.Any {
+		return entity.AnyVersion, true
+	}
+	return version, true
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type MovementHandler struct {
+	uc usecase.MovementUsecase
+}
+
+func NewMovementHandler(uc usecase.MovementUsecase) *MovementHandler {
+	return &MovementHandler{uc: uc}
+}
+
+func (h *MovementHandler) RecordMovement(c *gin.Context) {
+	var req entity.StockMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m, err := h.uc.RecordMovement(c, c.Param("id"), &req)
+	if err != nil {
+		movementError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, m)
+}
+
+// ListMovements reads the query:
+//
+//	from, to  RFC 3339 time or YYYY-MM-DD date; from inclusive, to exclusive
+//	reason    only movements with this reason code
+//	cursor    next_cursor from the previous page
+//	limit     page size, 1..100
+func (h *MovementHandler) ListMovements(c *gin.Context) {
+	filter, err := parseMovementFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := h.uc.ListMovements(c, c.Param("id"), filter)
+	if err != nil {
+		movementError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *MovementHandler) CheckConsistency(c *gin.Context) {
+	check, err := h.uc.CheckConsistency(c, c.Param("id"))
+	if err != nil {
+		movementError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, check)
+}
+
+func parseMovementFilter(c *gin.Context) (entity.MovementFilter, error) {
+	f := entity.MovementFilter{
+		Reason: entity.MovementReason(c.Query("reason")),
+		Cursor: c.Query("cursor"),
+	}
+	var err error
+	if f.From, err = timeParam(c, "from"); err != nil {
+		return f, err
+	}
+	if f.To, err = timeParam(c, "to"); err != nil {
+		return f, err
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 {
+			return f, errors.New("limit must be a positive integer")
+		}
+		f.Limit = limit
+	}
+	return f, nil
+}
+
+// timeParam parses an RFC 3339 time or a plain date (midnight UTC); it is nil
+// when the parameter is absent.
+func timeParam(c *gin.Context, param string) (*time.Time, error) {
+	v := c.Query(param)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		if t, err = time.Parse(time.DateOnly, v); err != nil {
+			return nil, fmt.Errorf("%s must be an RFC 3339 time or YYYY-MM-DD date", param)
+		}
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+func movementError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidMovement):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInsufficientStock):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		productError(c, err)
+	}
+}
@@ -1,10 +1,16 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/jsonpatch"
 	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+	"github.com/Nurda-zh/a1/pkg/money"
 	"github.com/gin-gonic/gin"
 )
 
@@ -23,9 +29,10 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 	if err := h.uc.CreateProduct(c, &p); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		productError(c, err)
 		return
 	}
+	setETag(c, p.Version)
 	c.JSON(http.StatusCreated, p)
 }
 
@@ -33,40 +40,205 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 	id := c.Param("id")
 	p, err := h.uc.GetProduct(c, id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		productError(c, err)
 		return
 	}
+	setETag(c, p.Version)
 	c.JSON(http.StatusOK, p)
 }
 
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	id := c.Param("id")
-	var p entity.Product
-	if err := c.ShouldBindJSON(&p); err != nil {
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+	patch, err := c.GetRawData()
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.uc.UpdateProduct(c, id, &p); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	updated, err := h.uc.PatchProduct(c, id, c.ContentType(), patch, version)
+	if err != nil {
+		productError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Product updated"})
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, updated)
 }
 
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	id := c.Param("id")
-	if err := h.uc.DeleteProduct(c, id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+	if err := h.uc.DeleteProduct(c, id, version); err != nil {
+		productError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted"})
 }
 
+// ListProducts answers with a bare array of products, as it always has. The
+// paging travels in headers: X-Total-Count counts every match, and
+// X-Next-Cursor and a Link with rel="next" lead to the next page unless this
+// is the last one.
 func (h *ProductHandler) ListProducts(c *gin.Context) {
-	products, err := h.uc.ListProducts(c)
+	filter, err := parseProductFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := h.uc.ListProducts(c, filter)
+	if err != nil {
+		productError(c, err)
+		return
+	}
+	c.Header("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	if page.NextCursor != "" {
+		next := *c.Request.URL
+		q := next.Query()
+		q.Set("cursor", page.NextCursor)
+		next.RawQuery = q.Encode()
+		c.Header("X-Next-Cursor", page.NextCursor)
+		c.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+	if page.Items == nil {
+		page.Items = []entity.Product{}
+	}
+	c.JSON(http.StatusOK, page.Items)
+}
+
+func (h *ProductHandler) BatchGetProducts(c *gin.Context) {
+	var req entity.BatchGetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	products, missing, err := h.uc.GetProductsByIDs(c, req.IDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, products)
+	if missing == nil {
+		missing = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": products, "missing": missing})
+}
+
+func (h *ProductHandler) ReserveStock(c *gin.Context) {
+	var req entity.ReserveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	failures, err := h.uc.ReserveStock(c, req.Items)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInsufficientStock):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "failures": failures})
+		case errors.Is(err, usecase.ErrInvalidReservation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Stock reserved", "items": req.Items})
+}
+
+// parseProductFilter reads the GET /products query:
+//
+//	name      name prefix
+//	category  category slug, includes subcategories
+//	min_price, max_price  decimal amounts in major units, inclusive
+//	currency  restricts to prices in this currency
+//	in_stock  true to hide products with nothing available
+//	sort      id (default), name, price or stock
+//	order     asc (default) or desc
+//	cursor    X-Next-Cursor of the previous page
+//	limit     page size, 1..100
+func parseProductFilter(c *gin.Context) (entity.ProductFilter, error) {
+	f := entity.ProductFilter{
+		NamePrefix: c.Query("name"),
+		Category:   c.Query("category"),
+		Currency:   strings.ToUpper(c.Query("currency")),
+		Sort:       c.Query("sort"),
+		Cursor:     c.Query("cursor"),
+	}
+	currency := f.Currency
+	if currency == "" {
+		currency = entity.DefaultCurrency
+	}
+	var err error
+	if f.MinPrice, err = priceParam(c, "min_price", currency); err != nil {
+		return f, err
+	}
+	if f.MaxPrice, err = priceParam(c, "max_price", currency); err != nil {
+		return f, err
+	}
+	if v := c.Query("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, fmt.Errorf("in_stock: %w", err)
+		}
+		f.InStockOnly = inStock
+	}
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		f.Desc = true
+	default:
+		return f, errors.New("order must be asc or desc")
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 {
+			return f, errors.New("limit must be a positive integer")
+		}
+		f.Limit = limit
+	}
+	return f, nil
+}
+
+// priceParam parses a decimal price query parameter into minor units; it is
+// nil when the parameter is absent.
+func priceParam(c *gin.Context, param, currency string) (*int64, error) {
+	v := c.Query(param)
+	if v == "" {
+		return nil, nil
+	}
+	m, err := money.Parse(v, currency)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", param, err)
+	}
+	return &m.Amount, nil
+}
+
+func productError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrUnknownCategory), errors.Is(err, usecase.ErrInvalidQuery),
+		errors.Is(err, usecase.ErrInvalidWarehouse):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrForbidden):
+		// reported so the denial is audited
+		_ = c.Error(err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrVersionConflict):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidPatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, entity.ErrInvalidProduct), errors.Is(err, money.ErrInvalidAmount):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrPatchTestFailed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrUnsupportedPatch):
+		c.Header("Accept-Patch", jsonpatch.MergePatchType+", "+jsonpatch.JSONPatchType)
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
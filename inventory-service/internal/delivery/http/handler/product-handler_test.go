@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+// pagedProducts serves ListProducts from a fixed page; the other methods
+// are not used.
+type pagedProducts struct {
+	usecase.ProductUsecase
+	page   entity.ProductPage
+	filter entity.ProductFilter
+}
+
+func (u *pagedProducts) ListProducts(ctx context.Context, filter entity.ProductFilter) (*entity.ProductPage, error) {
+	u.filter = filter
+	page := u.page
+	return &page, nil
+}
+
+func listProducts(t *testing.T, uc *pagedProducts, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/products", NewProductHandler(uc).ListProducts)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestListProductsKeepsTheArray(t *testing.T) {
+	uc := &pagedProducts{page: entity.ProductPage{
+		Items:      []entity.Product{{Name: "a"}, {Name: "b"}},
+		NextCursor: "c2",
+		Total:      5,
+	}}
+	w := listProducts(t, uc, "/products?category=tools&limit=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var items []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+		t.Fatalf("body is not an array: %s", w.Body)
+	}
+	if len(items) != 2 || items[0]["name"] != "a" {
+		t.Errorf("items = %v", items)
+	}
+	if got := w.Header().Get("X-Total-Count"); got != "5" {
+		t.Errorf("X-Total-Count = %q", got)
+	}
+	if got := w.Header().Get("X-Next-Cursor"); got != "c2" {
+		t.Errorf("X-Next-Cursor = %q", got)
+	}
+	if got, want := w.Header().Get("Link"), `</products?category=tools&cursor=c2&limit=2>; rel="next"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+
+	// following the link asks for the next page with the same filter
+	listProducts(t, uc, "/products?category=tools&cursor=c2&limit=2")
+	if uc.filter.Cursor != "c2" || uc.filter.Category != "tools" || uc.filter.Limit != 2 {
+		t.Errorf("filter = %+v", uc.filter)
+	}
+}
+
+func TestListProductsLastPage(t *testing.T) {
+	w := listProducts(t, &pagedProducts{}, "/products")
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Fatalf("status %d body %s, want an empty array", w.Code, w.Body)
+	}
+	if w.Header().Get("X-Next-Cursor") != "" || w.Header().Get("Link") != "" {
+		t.Errorf("last page links on: %v", w.Header())
+	}
+}
+
+// versionedProducts serves PatchProduct and DeleteProduct with err and records
+// the version they were asked for; the other methods are not used.
+type versionedProducts struct {
+	usecase.ProductUsecase
+	err     error
+	version *int64
+}
+
+func (u *versionedProducts) PatchProduct(ctx context.Context, id string, mediaType string, patch []byte, version int64) (*entity.Product, error) {
+	u.version = &version
+	if u.err != nil {
+		return nil, u.err
+	}
+	return &entity.Product{Version: version + 1}, nil
+}
+
+func (u *versionedProducts) DeleteProduct(ctx context.Context, id string, version int64) error {
+	u.version = &version
+	return u.err
+}
+
+func TestWritesNeedAStrongIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		err     error
+		want    int
+	}{
+		{"missing", "", nil, http.StatusPreconditionRequired},
+		{"weak tag", `W/"3"`, nil, http.StatusPreconditionFailed},
+		{"stale tag", `"2"`, usecase.ErrVersionConflict, http.StatusPreconditionFailed},
+		{"malformed", "3", nil, http.StatusBadRequest},
+		{"current tag", `"3"`, nil, http.StatusOK},
+		{"any version", "*", nil, http.StatusOK},
+	}
+	for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+		for _, tt := range tests {
+			t.Run(method+" "+tt.name, func(t *testing.T) {
+				uc := &versionedProducts{err: tt.err}
+				gin.SetMode(gin.TestMode)
+				r := gin.New()
+				h := NewProductHandler(uc)
+				r.PATCH("/products/:id", h.UpdateProduct)
+				r.DELETE("/products/:id", h.DeleteProduct)
+				req := httptest.NewRequest(method, "/products/p1", strings.NewReader(`{"name":"b"}`))
+				req.Header.Set("Content-Type", "application/merge-patch+json")
+				if tt.ifMatch != "" {
+					req.Header.Set("If-Match", tt.ifMatch)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != tt.want {
+					t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+				}
+				asked := uc.version != nil
+				if wantAsked := tt.want == http.StatusOK || tt.err != nil; asked != wantAsked {
+					t.Fatalf("usecase asked = %v, want %v", asked, wantAsked)
+				}
+				if tt.ifMatch == "*" && *uc.version != entity.AnyVersion {
+					t.Errorf("If-Match: * asked for version %d", *uc.version)
+				}
+				if method == http.MethodPatch && tt.want == http.StatusOK && w.Header().Get("ETag") == "" {
+					t.Errorf("no ETag on the updated product")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type ReservationHandler struct {
+	uc usecase.ReservationUsecase
+}
+
+func NewReservationHandler(uc usecase.ReservationUsecase) *ReservationHandler {
+	return &ReservationHandler{uc: uc}
+}
+
+func (h *ReservationHandler) CreateReservation(c *gin.Context) {
+	var req entity.CreateReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	res, failures, err := h.uc.CreateReservation(c, &req)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInsufficientStock) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "failures": failures})
+			return
+		}
+		reservationError(c, err)
+		return
+	}
+	c.Header("Location", "/reservations/"+res.ID.Hex())
+	c.JSON(http.StatusCreated, res)
+}
+
+func (h *ReservationHandler) GetReservation(c *gin.Context) {
+	res, err := h.uc.GetReservation(c, c.Param("id"))
+	if err != nil {
+		reservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// ListReservations lists the reservations placed under ?reference=.
+func (h *ReservationHandler) ListReservations(c *gin.Context) {
+	res, err := h.uc.ListReservations(c, c.Query("reference"))
+	if err != nil {
+		reservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *ReservationHandler) AmendReservation(c *gin.Context) {
+	var req entity.AmendReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	res, failures, err := h.uc.AmendReservation(c, c.Param("id"), &req)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInsufficientStock) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "failures": failures})
+			return
+		}
+		reservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *ReservationHandler) CommitReservation(c *gin.Context) {
+	res, err := h.uc.CommitReservation(c, c.Param("id"))
+	if err != nil {
+		reservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *ReservationHandler) ReleaseReservation(c *gin.Context) {
+	res, err := h.uc.ReleaseReservation(c, c.Param("id"))
+	if err != nil {
+		reservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// ReturnReservation accepts an empty body to return everything.
+func (h *ReservationHandler) ReturnReservation(c *gin.Context) {
+	var req entity.ReturnReservationRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	res, err := h.uc.ReturnReservation(c, c.Param("id"), &req)
+	if err != nil {
+		reservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func reservationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrReservationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrReservationClosed), errors.Is(err, usecase.ErrReservationExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidReservation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TransferHandler struct {
+	uc usecase.TransferUsecase
+}
+
+func NewTransferHandler(uc usecase.TransferUsecase) *TransferHandler {
+	return &TransferHandler{uc: uc}
+}
+
+func (h *TransferHandler) CreateTransfer(c *gin.Context) {
+	var req entity.CreateTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	t, err := h.uc.CreateTransfer(c, &req)
+	if err != nil {
+		transferError(c, err)
+		return
+	}
+	c.Header("Location", "/transfers/"+t.ID.Hex())
+	c.JSON(http.StatusCreated, t)
+}
+
+func (h *TransferHandler) GetTransfer(c *gin.Context) {
+	t, err := h.uc.GetTransfer(c, c.Param("id"))
+	if err != nil {
+		transferError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// ListTransfers reads the query:
+//
+//	status        only transfers in this status
+//	warehouse_id  transfers from or to this warehouse
+//	limit         at most this many, newest first, 1..100
+func (h *TransferHandler) ListTransfers(c *gin.Context) {
+	filter := entity.TransferFilter{Status: entity.TransferStatus(c.Query("status"))}
+	if v := c.Query("warehouse_id"); v != "" {
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid warehouse_id"})
+			return
+		}
+		filter.WarehouseID = id
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		filter.Limit = limit
+	}
+	transfers, err := h.uc.ListTransfers(c, filter)
+	if err != nil {
+		transferError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, transfers)
+}
+
+func (h *TransferHandler) CancelTransfer(c *gin.Context) {
+	t, err := h.uc.CancelTransfer(c, c.Param("id"))
+	if err != nil {
+		transferError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func (h *TransferHandler) DispatchTransfer(c *gin.Context) {
+	t, err := h.uc.DispatchTransfer(c, c.Param("id"))
+	if err != nil {
+		transferError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// ReceiveTransfer accepts an empty body to receive everything outstanding.
+func (h *TransferHandler) ReceiveTransfer(c *gin.Context) {
+	var req entity.ReceiveTransferRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	t, err := h.uc.ReceiveTransfer(c, c.Param("id"), &req)
+	if err != nil {
+		transferError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func transferError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrTransferNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrTransferState), errors.Is(err, usecase.ErrInsufficientStock):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidTransfer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
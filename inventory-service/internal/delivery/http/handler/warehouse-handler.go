@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type WarehouseHandler struct {
+	uc usecase.WarehouseUsecase
+}
+
+func NewWarehouseHandler(uc usecase.WarehouseUsecase) *WarehouseHandler {
+	return &WarehouseHandler{uc: uc}
+}
+
+func (h *WarehouseHandler) CreateWarehouse(c *gin.Context) {
+	var req entity.CreateWarehouseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	w, err := h.uc.CreateWarehouse(c, &req)
+	if err != nil {
+		warehouseError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, w)
+}
+
+func (h *WarehouseHandler) GetWarehouse(c *gin.Context) {
+	w, err := h.uc.GetWarehouse(c, c.Param("id"))
+	if err != nil {
+		warehouseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+func (h *WarehouseHandler) UpdateWarehouse(c *gin.Context) {
+	var req entity.UpdateWarehouseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	w, err := h.uc.UpdateWarehouse(c, c.Param("id"), &req)
+	if err != nil {
+		warehouseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+func (h *WarehouseHandler) DeleteWarehouse(c *gin.Context) {
+	if err := h.uc.DeleteWarehouse(c, c.Param("id")); err != nil {
+		warehouseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Warehouse deleted"})
+}
+
+func (h *WarehouseHandler) ListWarehouses(c *gin.Context) {
+	warehouses, err := h.uc.ListWarehouses(c)
+	if err != nil {
+		warehouseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, warehouses)
+}
+
+func warehouseError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrWarehouseNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrWarehouseCodeTaken), errors.Is(err, usecase.ErrWarehouseInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidWarehouse):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
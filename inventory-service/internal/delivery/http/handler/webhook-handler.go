@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	uc usecase.WebhookUsecase
+}
+
+func NewWebhookHandler(uc usecase.WebhookUsecase) *WebhookHandler {
+	return &WebhookHandler{uc: uc}
+}
+
+func (h *WebhookHandler) CreateSubscription(c *gin.Context) {
+	var req entity.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s, err := h.uc.CreateSubscription(c, &req)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.Header("Location", "/webhooks/"+s.ID.Hex())
+	c.JSON(http.StatusCreated, s)
+}
+
+func (h *WebhookHandler) ListSubscriptions(c *gin.Context) {
+	subs, err := h.uc.ListSubscriptions(c)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subs)
+}
+
+func (h *WebhookHandler) GetSubscription(c *gin.Context) {
+	s, err := h.uc.GetSubscription(c, c.Param("id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func (h *WebhookHandler) DeleteSubscription(c *gin.Context) {
+	if err := h.uc.DeleteSubscription(c, c.Param("id")); err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook subscription deleted"})
+}
+
+func (h *WebhookHandler) ListDeadLetters(c *gin.Context) {
+	letters, err := h.uc.ListDeadLetters(c, c.Query("subscription_id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, letters)
+}
+
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	d, err := h.uc.Redeliver(c, c.Param("id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, d)
+}
+
+func webhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrWebhookNotFound), errors.Is(err, usecase.ErrDeadLetterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidWebhook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
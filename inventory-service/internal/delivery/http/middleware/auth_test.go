@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+	"github.com/Nurda-zh/a1/pkg/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// memAudit keeps recorded entries; the other methods are not used.
+type memAudit struct {
+	repository.AuditRepository
+	entries []entity.AuditEntry
+}
+
+func (a *memAudit) Record(ctx context.Context, e *entity.AuditEntry) error {
+	a.entries = append(a.entries, *e)
+	return nil
+}
+
+func mint(t *testing.T, secret string, roles ...string) string {
+	t.Helper()
+	m, err := auth.NewMinter(auth.MintConfig{Secret: []byte(secret), Subject: "u1", Roles: roles, TTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := m.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestDenialsAreAudited(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	keys := &auth.KeySet{}
+	keys.AddHS256([]byte(secret))
+	v, err := auth.NewVerifier(auth.Config{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+		actor  string
+		perm   entity.Permission
+	}{
+		{"missing token", "", http.StatusUnauthorized, "", ""},
+		{"not a bearer token", "Basic dTE6cHc=", http.StatusUnauthorized, "", ""},
+		{"forged token", "Bearer " + mint(t, "fedcba9876543210fedcba9876543210", "admin"), http.StatusUnauthorized, "", ""},
+		{"malformed token", "Bearer not.a.jwt", http.StatusUnauthorized, "", ""},
+		{"missing permission", "Bearer " + mint(t, secret), http.StatusForbidden, "u1", entity.PermAdjustStock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audit := &memAudit{}
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.POST("/stock", Authenticate(v, audit), Authorize(audit)(entity.PermAdjustStock), func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/stock", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if len(audit.entries) != 1 {
+				t.Fatalf("audited %d entries, want 1", len(audit.entries))
+			}
+			e := audit.entries[0]
+			if e.Actor != tt.actor || e.Permission != tt.perm || e.Method != http.MethodPost || e.Path != "/stock" || e.Reason == "" {
+				t.Errorf("entry = %+v", e)
+			}
+		})
+	}
+}
@@ -2,13 +2,70 @@ package http
 
 import (
 	"github.com/Nurda-zh/a1/inventory-service/internal/delivery/http/handler"
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
 	"github.com/gin-gonic/gin"
 )
 
-func NewRouter(r *gin.Engine, ph *handler.ProductHandler) {
-	r.POST("/products", ph.CreateProduct)
-	r.GET("/products/:id", ph.GetProduct)
-	r.PATCH("/products/:id", ph.UpdateProduct)
-	r.DELETE("/products/:id", ph.DeleteProduct)
-	r.GET("/products", ph.ListProducts)
+// NewRouter registers every route behind authenticate, each requiring the
+// permission require checks; idempotent guards the creating routes that
+// honour Idempotency-Key.
+func NewRouter(r *gin.Engine, authenticate gin.HandlerFunc, require func(entity.Permission) gin.HandlerFunc, idempotent gin.HandlerFunc, ph *handler.ProductHandler, rh *handler.ReservationHandler, ch *handler.CategoryHandler, mh *handler.MovementHandler, wh *handler.WarehouseHandler, th *handler.TransferHandler, hh *handler.WebhookHandler, ah *handler.AuditHandler) {
+	// handlers pass *gin.Context on as context.Context; let it reach the
+	// request context that middleware fills in
+	r.ContextWithFallback = true
+	r.Use(authenticate)
+
+	read := require(entity.PermReadCatalog)
+	stock := require(entity.PermAdjustStock)
+	catalog := require(entity.PermEditCatalog)
+	admin := require(entity.PermAdminister)
+
+	r.POST("/products", catalog, idempotent, ph.CreateProduct)
+	r.GET("/products/:id", read, ph.GetProduct)
+	// only stock edits; changing anything else needs catalog:write, which
+	// the usecase checks
+	r.PATCH("/products/:id", stock, ph.UpdateProduct)
+	r.DELETE("/products/:id", catalog, ph.DeleteProduct)
+	r.GET("/products", read, ph.ListProducts)
+	r.POST("/products/batch", read, ph.BatchGetProducts)
+	r.POST("/products/reserve", stock, ph.ReserveStock)
+	r.POST("/products/:id/movements", stock, mh.RecordMovement)
+	r.GET("/products/:id/movements", read, mh.ListMovements)
+	r.GET("/products/:id/stock/consistency", read, mh.CheckConsistency)
+
+	r.POST("/categories", catalog, ch.CreateCategory)
+	r.GET("/categories", read, ch.ListCategories)
+	r.GET("/categories/:id", read, ch.GetCategory)
+	r.PATCH("/categories/:id", catalog, ch.UpdateCategory)
+	r.DELETE("/categories/:id", catalog, ch.DeleteCategory)
+
+	r.POST("/warehouses", catalog, wh.CreateWarehouse)
+	r.GET("/warehouses", read, wh.ListWarehouses)
+	r.GET("/warehouses/:id", read, wh.GetWarehouse)
+	r.PATCH("/warehouses/:id", catalog, wh.UpdateWarehouse)
+	r.DELETE("/warehouses/:id", catalog, wh.DeleteWarehouse)
+
+	r.POST("/transfers", stock, th.CreateTransfer)
+	r.GET("/transfers", read, th.ListTransfers)
+	r.GET("/transfers/:id", read, th.GetTransfer)
+	r.POST("/transfers/:id/cancel", stock, th.CancelTransfer)
+	r.POST("/transfers/:id/dispatch", stock, th.DispatchTransfer)
+	r.POST("/transfers/:id/receive", stock, th.ReceiveTransfer)
+
+	r.POST("/reservations", stock, rh.CreateReservation)
+	r.GET("/reservations", read, rh.ListReservations)
+	r.GET("/reservations/:id", read, rh.GetReservation)
+	r.POST("/reservations/:id/amend", stock, rh.AmendReservation)
+	r.POST("/reservations/:id/commit", stock, rh.CommitReservation)
+	r.POST("/reservations/:id/release", stock, rh.ReleaseReservation)
+	r.POST("/reservations/:id/return", stock, rh.ReturnReservation)
+
+	r.POST("/webhooks", admin, hh.CreateSubscription)
+	r.GET("/webhooks", admin, hh.ListSubscriptions)
+	r.GET("/webhooks/dead-letters", admin, hh.ListDeadLetters)
+	r.POST("/webhooks/dead-letters/:id/redeliver", admin, hh.Redeliver)
+	r.GET("/webhooks/:id", admin, hh.GetSubscription)
+	r.DELETE("/webhooks/:id", admin, hh.DeleteSubscription)
+
+	r.GET("/audit/denials", admin, ah.ListDenials)
 }
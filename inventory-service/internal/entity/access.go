@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Roles a caller's token may carry in its roles claim.
+const (
+	RoleViewer       = "viewer"
+	RoleStockClerk   = "stock-clerk"
+	RoleCatalogAdmin = "catalog-admin"
+)
+
+// Permission is something a route or a change needs the caller to be
+// allowed.
+type Permission string
+
+const (
+	// PermReadCatalog covers reading products, stock, warehouses, transfers
+	// and reservations.
+	PermReadCatalog Permission = "catalog:read"
+	// PermAdjustStock covers changing how much stock there is and where:
+	// movements, reservations, transfers and stock edits of a product.
+	PermAdjustStock Permission = "stock:write"
+	// PermEditCatalog covers creating, deleting and editing products,
+	// including their prices, categories and warehouses.
+	PermEditCatalog Permission = "catalog:write"
+	// PermAdminister covers webhook subscriptions and the audit log.
+	PermAdminister Permission = "admin"
+)
+
+// rolePermissions is the permission matrix: what each role is allowed.
+var rolePermissions = map[string][]Permission{
+	RoleViewer:       {PermReadCatalog},
+	RoleStockClerk:   {PermReadCatalog, PermAdjustStock},
+	RoleCatalogAdmin: {PermReadCatalog, PermAdjustStock, PermEditCatalog, PermAdminister},
+}
+
+// Allowed reports whether any of roles grants p. Unknown roles grant nothing.
+func Allowed(roles []string, p Permission) bool {
+	for _, r := range roles {
+		for _, granted := range rolePermissions[r] {
+			if granted == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AuditEntry records a request that was refused for lack of a permission, or
+// for lack of a valid token, in which case it has no Actor or Roles.
+type AuditEntry struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Actor      string             `bson:"actor" json:"actor"`
+	Roles      []string           `bson:"roles" json:"roles"`
+	Method     string             `bson:"method" json:"method"`
+	Path       string             `bson:"path" json:"path"`
+	Permission Permission         `bson:"permission,omitempty" json:"permission,omitempty"`
+	Reason     string             `bson:"reason" json:"reason"`
+	At         time.Time          `bson:"at" json:"at"`
+}
@@ -1,6 +1,53 @@
 package entity
 
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Category is a node in the category tree. Products refer to a category by
+// its Slug. Ancestors lists the ids from the root down to the parent, so a
+// subtree is every category whose Ancestors contain the root's id.
 type Category struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name      string               `bson:"name" json:"name"`
+	Slug      string               `bson:"slug" json:"slug"`
+	ParentID  *primitive.ObjectID  `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	Ancestors []primitive.ObjectID `bson:"ancestors" json:"ancestors"`
+	CreatedAt time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+type CreateCategoryRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Slug     string `json:"slug"`
+	ParentID string `json:"parent_id"`
+}
+
+// UpdateCategoryRequest only changes the fields that are present. An empty
+// parent_id moves the category to the root.
+type UpdateCategoryRequest struct {
+	Name     *string `json:"name"`
+	Slug     *string `json:"slug"`
+	ParentID *string `json:"parent_id"`
+}
+
+// Slugify lowercases s and joins its letters and digits with dashes, e.g.
+// "Home & Garden" becomes "home-garden".
+func Slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
 }
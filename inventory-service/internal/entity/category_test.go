@@ -0,0 +1,25 @@
+package entity
+
+import "testing"
+
+// Slugify also turns the free-text categories of old products into slugs,
+// so it must be stable for the values they carry.
+func TestSlugify(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Electronics", "electronics"},
+		{"electronics", "electronics"},
+		{"Home & Garden", "home-garden"},
+		{"  Home  &  Garden  ", "home-garden"},
+		{"home-garden", "home-garden"},
+		{"Books/Comics", "books-comics"},
+		{"4K TVs!", "4k-tvs"},
+		{"--sale--", "sale"},
+		{"&&&", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Slugify(tt.in); got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package entity
+
+import "github.com/Nurda-zh/a1/pkg/money"
+
+// DefaultCurrency is assumed when a price arrives without a currency and for
+// documents written before prices carried one. Set from config at startup.
+var DefaultCurrency = "USD"
+
+// Money is the price representation shared with order-service.
+type Money = money.Money
@@ -1,11 +1,142 @@
 package entity
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Nurda-zh/a1/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Product struct {
 	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Name     string             `bson:"name" json:"name"`
 	Category string             `bson:"category" json:"category"`
-	Price    float64            `bson:"price" json:"price"`
-	Stock    int                `bson:"stock" json:"stock"`
+	Price    Money              `bson:"price" json:"-"`           // see MarshalJSON
+	Stock    int                `bson:"stock" json:"stock"`       // on hand, over all locations
+	Reserved int                `bson:"reserved" json:"reserved"` // held by open reservations
+	// Locations breaks Stock and Reserved down by warehouse.
+	Locations []StockLocation `bson:"locations" json:"locations"`
+	// Version counts catalog edits and guards them against lost updates.
+	// Stock movements from reservations do not change it.
+	Version int64 `bson:"version" json:"version"`
+}
+
+// AnyVersion skips the version check, as for "If-Match: *".
+const AnyVersion int64 = -1
+
+var ErrInvalidProduct = errors.New("invalid product")
+
+// Validate checks the catalog fields a client may set.
+func (p Product) Validate() error {
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidProduct)
+	case p.Price.Amount < 0:
+		return fmt.Errorf("%w: price cannot be negative", ErrInvalidProduct)
+	case len(p.Price.Currency) != 3:
+		return fmt.Errorf("%w: currency must be a 3 letter ISO code", ErrInvalidProduct)
+	case p.Stock < 0:
+		return fmt.Errorf("%w: stock cannot be negative", ErrInvalidProduct)
+	case p.Stock < p.Reserved:
+		return fmt.Errorf("%w: stock cannot drop below the %d reserved", ErrInvalidProduct, p.Reserved)
+	}
+	return nil
+}
+
+// ProductPatch lists the fields a PATCH changes; nil fields are left alone.
+// Stock moves by a delta so concurrent reservation commits are not lost.
+type ProductPatch struct {
+	Name       *string
+	Category   *string
+	Price      *Money
+	StockDelta int
+}
+
+func (p ProductPatch) IsEmpty() bool {
+	return p.Name == nil && p.Category == nil && p.Price == nil && p.StockDelta == 0
+}
+
+// Available is the on-hand stock that is not held by an open reservation.
+func (p Product) Available() int {
+	return p.Stock - p.Reserved
+}
+
+// MarshalJSON keeps price as a decimal number in major units, as clients have
+// always read it, with the currency next to it.
+func (p Product) MarshalJSON() ([]byte, error) {
+	type product Product
+	return json.Marshal(struct {
+		product
+		Price     json.Number `json:"price"`
+		Currency  string      `json:"currency"`
+		Available int         `json:"available"`
+	}{product(p), json.Number(p.Price.Decimal()), p.Price.Currency, p.Available()})
+}
+
+// UnmarshalJSON reads price the way MarshalJSON writes it. A missing currency
+// keeps the product's current one, or DefaultCurrency for a new product.
+func (p *Product) UnmarshalJSON(data []byte) error {
+	type product Product
+	aux := struct {
+		*product
+		Price    json.Number `json:"price"`
+		Currency string      `json:"currency"`
+	}{product: (*product)(p)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	currency := aux.Currency
+	if currency == "" {
+		currency = p.Price.Currency
+	}
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	if aux.Price == "" {
+		p.Price.Currency = currency
+		return nil
+	}
+	price, err := money.Parse(string(aux.Price), currency)
+	if err != nil {
+		return err
+	}
+	p.Price = price
+	return nil
+}
+
+type BatchGetRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=200"`
+}
+
+// ProductFilter narrows and orders ListProducts. Empty fields do not filter.
+type ProductFilter struct {
+	NamePrefix  string
+	Category    string   // slug; matches the category and its subtree
+	Categories  []string // resolved slugs of Category's subtree
+	Currency    string
+	MinPrice    *int64 // minor units, inclusive
+	MaxPrice    *int64 // minor units, inclusive
+	InStockOnly bool   // available stock above zero
+
+	Sort   string // one of the ProductSort* fields
+	Desc   bool
+	Cursor string // NextCursor of the previous page
+	Limit  int64
+}
+
+const (
+	ProductSortID    = "id"
+	ProductSortName  = "name"
+	ProductSortPrice = "price"
+	ProductSortStock = "stock"
+)
+
+// ProductPage is one page of ListProducts. Total counts every match of the
+// filter, not only this page; NextCursor is empty on the last page.
+type ProductPage struct {
+	Items      []Product `json:"items"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	Total      int64     `json:"total"`
 }
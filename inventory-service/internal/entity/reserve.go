@@ -0,0 +1,99 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReserveItem struct {
+	ProductID string `bson:"product_id" json:"product_id" binding:"required"`
+	Quantity  int    `bson:"quantity" json:"quantity" binding:"required,gt=0"`
+	// WarehouseID pins the item to one warehouse instead of letting the
+	// allocation rule choose.
+	WarehouseID string `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+}
+
+type ReserveRequest struct {
+	Items []ReserveItem `json:"items" binding:"required,min=1,dive"`
+}
+
+// ReserveFailure explains why a single item of a reservation could not be
+// satisfied. Available is the stock seen at the time of the attempt.
+type ReserveFailure struct {
+	ProductID string `json:"product_id"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+	Reason    string `json:"reason"`
+}
+
+type ReservationStatus string
+
+const (
+	ReservationHeld      ReservationStatus = "held"
+	ReservationCommitted ReservationStatus = "committed"
+	ReservationReleased  ReservationStatus = "released"
+	ReservationExpired   ReservationStatus = "expired"
+	ReservationReturned  ReservationStatus = "returned"
+)
+
+// Reservation is a temporary hold on stock. While held, its quantities count
+// towards Product.Reserved; committing turns the hold into a stock decrement,
+// releasing or expiring gives it back. A committed reservation can still be
+// returned, in parts, which puts its quantities back on hand; it is returned
+// once nothing is left.
+type Reservation struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Reference string             `bson:"reference,omitempty" json:"reference,omitempty"` // caller's id, e.g. an order
+	Items     []ReserveItem      `bson:"items" json:"items"`
+	// Allocations says which warehouses the items are held at. Holds placed
+	// before warehouses existed have none and are held at the default one.
+	Allocations []Allocation        `bson:"allocations,omitempty" json:"allocations,omitempty"`
+	Returns     []ReservationReturn `bson:"returns,omitempty" json:"returns,omitempty"`
+	Status      ReservationStatus   `bson:"status" json:"status"`
+	ExpiresAt   time.Time           `bson:"expires_at" json:"expires_at"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+type CreateReservationRequest struct {
+	Reference  string        `json:"reference"`
+	Items      []ReserveItem `json:"items" binding:"required,min=1,dive"`
+	TTLSeconds int           `json:"ttl_seconds" binding:"omitempty,gt=0"`
+}
+
+// AmendReservationRequest replaces the items of a held reservation.
+type AmendReservationRequest struct {
+	Items []ReserveItem `json:"items" binding:"required,min=1,dive"`
+}
+
+// ReservationReturn is stock of a committed reservation put back on hand, at
+// the warehouses it was sold from.
+type ReservationReturn struct {
+	Reference   string       `bson:"reference,omitempty" json:"reference,omitempty"`
+	Allocations []Allocation `bson:"allocations" json:"allocations"`
+	CreatedAt   time.Time    `bson:"created_at" json:"created_at"`
+}
+
+// Returned tells whether a return with reference was already applied.
+func (r *Reservation) Returned(reference string) bool {
+	for _, ret := range r.Returns {
+		if ret.Reference == reference {
+			return true
+		}
+	}
+	return false
+}
+
+// ReturnReservationRequest gives back part of a committed reservation, or
+// everything not returned yet when Items is empty. A repeated Reference is
+// applied once.
+type ReturnReservationRequest struct {
+	Reference string       `json:"reference"`
+	Items     []ReturnItem `json:"items" binding:"dive"`
+}
+
+type ReturnItem struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,gt=0"`
+}
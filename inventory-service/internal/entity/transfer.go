@@ -0,0 +1,69 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TransferStatus string
+
+const (
+	TransferDraft             TransferStatus = "draft"
+	TransferInTransit         TransferStatus = "in_transit"
+	TransferPartiallyReceived TransferStatus = "partially_received"
+	TransferReceived          TransferStatus = "received"
+	TransferCancelled         TransferStatus = "cancelled"
+)
+
+// Transfer moves stock from one warehouse to another. Dispatch takes the
+// lines out of the source; each receipt puts what arrived into the
+// destination. In between the goods are in transit and count nowhere.
+type Transfer struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SourceID      primitive.ObjectID `bson:"source_id" json:"source_id"`
+	DestinationID primitive.ObjectID `bson:"destination_id" json:"destination_id"`
+	Lines         []TransferLine     `bson:"lines" json:"lines"`
+	Status        TransferStatus     `bson:"status" json:"status"`
+	Note          string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+	DispatchedAt  *time.Time         `bson:"dispatched_at,omitempty" json:"dispatched_at,omitempty"`
+	ReceivedAt    *time.Time         `bson:"received_at,omitempty" json:"received_at,omitempty"` // when the last line arrived
+}
+
+type TransferLine struct {
+	ProductID string `bson:"product_id" json:"product_id" binding:"required"`
+	Quantity  int    `bson:"quantity" json:"quantity" binding:"required,gt=0"`
+	Received  int    `bson:"received" json:"received"`
+}
+
+// Outstanding is what was dispatched but has not arrived yet.
+func (l TransferLine) Outstanding() int {
+	return l.Quantity - l.Received
+}
+
+type CreateTransferRequest struct {
+	SourceID      string         `json:"source_id" binding:"required"`
+	DestinationID string         `json:"destination_id" binding:"required"`
+	Lines         []TransferLine `json:"lines" binding:"required,min=1,dive"`
+	Note          string         `json:"note"`
+}
+
+// ReceiveTransferRequest lists what arrived. No lines means everything still
+// outstanding arrived.
+type ReceiveTransferRequest struct {
+	Lines []ReceiptLine `json:"lines" binding:"dive"`
+}
+
+type ReceiptLine struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,gt=0"`
+}
+
+// TransferFilter narrows ListTransfers; WarehouseID matches either end.
+type TransferFilter struct {
+	Status      TransferStatus
+	WarehouseID primitive.ObjectID
+	Limit       int64
+}
@@ -0,0 +1,164 @@
+package entity
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultWarehouseID receives stock that arrives without a location, such as
+// a product's initial stock or a stock edit through PATCH. It is set at
+// startup from the DEFAULT_WAREHOUSE code.
+var DefaultWarehouseID primitive.ObjectID
+
+// Warehouse is a location stock is kept and shipped from. Reservations are
+// filled from active warehouses, lowest Priority first.
+type Warehouse struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Code      string             `bson:"code" json:"code"`
+	Name      string             `bson:"name" json:"name"`
+	Priority  int                `bson:"priority" json:"priority"`
+	Active    bool               `bson:"active" json:"active"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type CreateWarehouseRequest struct {
+	Code     string `json:"code" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	Priority int    `json:"priority"`
+	Active   *bool  `json:"active"` // defaults to true
+}
+
+// UpdateWarehouseRequest only changes the fields that are present.
+type UpdateWarehouseRequest struct {
+	Name     *string `json:"name"`
+	Priority *int    `json:"priority"`
+	Active   *bool   `json:"active"`
+}
+
+// StockLocation is a product's stock at one warehouse. Product.Stock and
+// Product.Reserved are the sums over its locations.
+type StockLocation struct {
+	WarehouseID primitive.ObjectID `bson:"warehouse_id" json:"warehouse_id"`
+	Stock       int                `bson:"stock" json:"stock"`
+	Reserved    int                `bson:"reserved" json:"reserved"`
+}
+
+func (l StockLocation) Available() int {
+	return l.Stock - l.Reserved
+}
+
+func (l StockLocation) MarshalJSON() ([]byte, error) {
+	type location StockLocation
+	return json.Marshal(struct {
+		location
+		Available int `json:"available"`
+	}{location(l), l.Available()})
+}
+
+// Location returns p's stock at warehouse, zero if it has none there.
+func (p Product) Location(warehouse primitive.ObjectID) StockLocation {
+	for _, l := range p.Locations {
+		if l.WarehouseID == warehouse {
+			return l
+		}
+	}
+	return StockLocation{WarehouseID: warehouse}
+}
+
+// Allocation is the part of a reserved item taken from one warehouse.
+type Allocation struct {
+	ProductID   string             `bson:"product_id" json:"product_id"`
+	WarehouseID primitive.ObjectID `bson:"warehouse_id" json:"warehouse_id"`
+	Quantity    int                `bson:"quantity" json:"quantity"`
+}
+
+type AllocationRule string
+
+const (
+	// AllocatePriority takes what it can from each warehouse in priority
+	// order, splitting an item when one warehouse is not enough.
+	AllocatePriority AllocationRule = "priority"
+	// AllocateMostAvailable takes from the warehouses with the most available
+	// stock first, which keeps splits rare.
+	AllocateMostAvailable AllocationRule = "most_available"
+	// AllocateSingle ships every item from one warehouse, the first in
+	// priority order that can cover it, and never splits.
+	AllocateSingle AllocationRule = "single"
+)
+
+func (r AllocationRule) Valid() bool {
+	switch r {
+	case AllocatePriority, AllocateMostAvailable, AllocateSingle:
+		return true
+	}
+	return false
+}
+
+// Allocator picks the warehouses a reservation draws from. Order lists the
+// active warehouses, highest priority first; stock elsewhere is not offered.
+type Allocator struct {
+	Rule  AllocationRule
+	Order []primitive.ObjectID
+}
+
+// Allocate splits qty of p across warehouses by a.Rule, or only takes from
+// pinned when it is set. It returns nil when qty cannot be covered.
+func (a Allocator) Allocate(p *Product, qty int, pinned primitive.ObjectID) []Allocation {
+	candidates := a.candidates(p, pinned)
+	if a.Rule == AllocateMostAvailable {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Available() > candidates[j].Available()
+		})
+	}
+	if a.Rule == AllocateSingle {
+		for _, l := range candidates {
+			if l.Available() >= qty {
+				return []Allocation{{ProductID: p.ID.Hex(), WarehouseID: l.WarehouseID, Quantity: qty}}
+			}
+		}
+		return nil
+	}
+
+	var out []Allocation
+	remaining := qty
+	for _, l := range candidates {
+		if remaining == 0 {
+			break
+		}
+		take := min(l.Available(), remaining)
+		if take <= 0 {
+			continue
+		}
+		out = append(out, Allocation{ProductID: p.ID.Hex(), WarehouseID: l.WarehouseID, Quantity: take})
+		remaining -= take
+	}
+	if remaining > 0 {
+		return nil
+	}
+	return out
+}
+
+// Available is the stock of p that Allocate may draw from.
+func (a Allocator) Available(p *Product, pinned primitive.ObjectID) int {
+	n := 0
+	for _, l := range a.candidates(p, pinned) {
+		n += max(l.Available(), 0)
+	}
+	return n
+}
+
+// candidates lists p's locations at the eligible warehouses in priority order.
+func (a Allocator) candidates(p *Product, pinned primitive.ObjectID) []StockLocation {
+	var out []StockLocation
+	for _, w := range a.Order {
+		if !pinned.IsZero() && w != pinned {
+			continue
+		}
+		out = append(out, p.Location(w))
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	whA = primitive.ObjectID{1}
+	whB = primitive.ObjectID{2}
+	whC = primitive.ObjectID{3}
+)
+
+// stocked returns a product with stock[i] on hand and reserved[i] held at
+// warehouse i of whA, whB, whC.
+func stocked(stock, reserved [3]int) *Product {
+	p := &Product{ID: primitive.ObjectID{9}}
+	for i, w := range []primitive.ObjectID{whA, whB, whC} {
+		p.Locations = append(p.Locations, StockLocation{WarehouseID: w, Stock: stock[i], Reserved: reserved[i]})
+	}
+	return p
+}
+
+func TestAllocate(t *testing.T) {
+	order := []primitive.ObjectID{whA, whB, whC}
+	pid := primitive.ObjectID{9}.Hex()
+	take := func(w primitive.ObjectID, n int) Allocation {
+		return Allocation{ProductID: pid, WarehouseID: w, Quantity: n}
+	}
+	tests := []struct {
+		name   string
+		rule   AllocationRule
+		order  []primitive.ObjectID
+		p      *Product
+		qty    int
+		pinned primitive.ObjectID
+		want   []Allocation
+	}{
+		{"priority from the first warehouse", AllocatePriority, order,
+			stocked([3]int{5, 5, 5}, [3]int{}), 3, primitive.NilObjectID,
+			[]Allocation{take(whA, 3)}},
+		{"priority splits in priority order", AllocatePriority, order,
+			stocked([3]int{2, 1, 5}, [3]int{}), 6, primitive.NilObjectID,
+			[]Allocation{take(whA, 2), take(whB, 1), take(whC, 3)}},
+		{"priority skips what is reserved", AllocatePriority, order,
+			stocked([3]int{4, 4, 0}, [3]int{4, 1, 0}), 3, primitive.NilObjectID,
+			[]Allocation{take(whB, 3)}},
+		{"priority skips oversold locations", AllocatePriority, order,
+			stocked([3]int{1, 4, 0}, [3]int{3, 0, 0}), 4, primitive.NilObjectID,
+			[]Allocation{take(whB, 4)}},
+		{"priority shortfall", AllocatePriority, order,
+			stocked([3]int{2, 1, 1}, [3]int{}), 5, primitive.NilObjectID,
+			nil},
+		{"priority follows the warehouse order given", AllocatePriority, []primitive.ObjectID{whC, whA},
+			stocked([3]int{5, 5, 1}, [3]int{}), 3, primitive.NilObjectID,
+			[]Allocation{take(whC, 1), take(whA, 2)}},
+		{"inactive warehouses are not offered", AllocatePriority, []primitive.ObjectID{whA},
+			stocked([3]int{1, 9, 9}, [3]int{}), 2, primitive.NilObjectID,
+			nil},
+
+		{"most available takes the fullest first", AllocateMostAvailable, order,
+			stocked([3]int{2, 7, 4}, [3]int{}), 5, primitive.NilObjectID,
+			[]Allocation{take(whB, 5)}},
+		{"most available splits fullest first", AllocateMostAvailable, order,
+			stocked([3]int{2, 7, 4}, [3]int{0, 3, 0}), 7, primitive.NilObjectID,
+			[]Allocation{take(whB, 4), take(whC, 3)}},
+		{"most available breaks ties by priority", AllocateMostAvailable, order,
+			stocked([3]int{3, 3, 3}, [3]int{}), 4, primitive.NilObjectID,
+			[]Allocation{take(whA, 3), take(whB, 1)}},
+		{"most available shortfall", AllocateMostAvailable, order,
+			stocked([3]int{2, 7, 4}, [3]int{}), 14, primitive.NilObjectID,
+			nil},
+
+		{"single takes the first that covers it", AllocateSingle, order,
+			stocked([3]int{2, 6, 9}, [3]int{}), 5, primitive.NilObjectID,
+			[]Allocation{take(whB, 5)}},
+		{"single never splits", AllocateSingle, order,
+			stocked([3]int{3, 3, 3}, [3]int{}), 4, primitive.NilObjectID,
+			nil},
+		{"single counts holds", AllocateSingle, order,
+			stocked([3]int{6, 6, 0}, [3]int{2, 0, 0}), 5, primitive.NilObjectID,
+			[]Allocation{take(whB, 5)}},
+
+		{"pinned only takes from its warehouse", AllocatePriority, order,
+			stocked([3]int{9, 2, 9}, [3]int{}), 2, whB,
+			[]Allocation{take(whB, 2)}},
+		{"pinned shortfall does not fall back", AllocateMostAvailable, order,
+			stocked([3]int{9, 2, 9}, [3]int{}), 3, whB,
+			nil},
+		{"product without stock at a warehouse", AllocatePriority, order,
+			&Product{ID: primitive.ObjectID{9}, Locations: []StockLocation{{WarehouseID: whC, Stock: 4}}}, 4, primitive.NilObjectID,
+			[]Allocation{take(whC, 4)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Allocator{Rule: tt.rule, Order: tt.order}
+			got := a.Allocate(tt.p, tt.qty, tt.pinned)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate = %+v, want %+v", got, tt.want)
+			}
+			if got != nil {
+				n := 0
+				for _, g := range got {
+					n += g.Quantity
+				}
+				if n != tt.qty {
+					t.Errorf("allocated %d, want %d", n, tt.qty)
+				}
+			}
+		})
+	}
+}
+
+func TestAllocatorAvailable(t *testing.T) {
+	p := stocked([3]int{5, 1, 8}, [3]int{2, 3, 0})
+	a := Allocator{Rule: AllocatePriority, Order: []primitive.ObjectID{whA, whB}}
+	if got := a.Available(p, primitive.NilObjectID); got != 3 {
+		t.Errorf("Available = %d, want 3: oversold and inactive warehouses count for nothing", got)
+	}
+	if got := a.Available(p, whA); got != 3 {
+		t.Errorf("Available pinned to A = %d, want 3", got)
+	}
+	if got := a.Available(p, whC); got != 0 {
+		t.Errorf("Available pinned to inactive C = %d, want 0", got)
+	}
+}
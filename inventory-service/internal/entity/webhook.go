@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Nurda-zh/a1/pkg/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventStockChanged is sent for every stock movement. Its data is the
+// StockMovement.
+const EventStockChanged = "stock.changed"
+
+// WebhookAllEvents subscribes to every event type.
+const WebhookAllEvents = webhook.AllEvents
+
+// WebhookSubscription asks for events of EventTypes to be POSTed to URL.
+// Secret keys the signature of every delivery; it is only shown when the
+// subscription is created.
+type WebhookSubscription struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	URL        string             `bson:"url" json:"url"`
+	EventTypes []string           `bson:"event_types" json:"event_types"`
+	Secret     string             `bson:"secret" json:"secret,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// CreateWebhookRequest registers a subscription. A secret is generated when
+// none is given.
+type CreateWebhookRequest struct {
+	URL        string   `json:"url" binding:"required,url"`
+	EventTypes []string `json:"event_types" binding:"required,min=1"`
+	Secret     string   `json:"secret"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliveryDelivered WebhookDeliveryStatus = "delivered"
+	// DeliveryDead marks a delivery that ran out of attempts and was moved
+	// to the dead letters.
+	DeliveryDead WebhookDeliveryStatus = "dead"
+)
+
+// WebhookDelivery is one event on its way to one subscription. Payload is
+// the exact body that is signed and sent.
+type WebhookDelivery struct {
+	ID             primitive.ObjectID    `bson:"_id,omitempty" json:"id"`
+	SubscriptionID primitive.ObjectID    `bson:"subscription_id" json:"subscription_id"`
+	EventID        string                `bson:"event_id" json:"event_id"`
+	EventType      string                `bson:"event_type" json:"event_type"`
+	Payload        json.RawMessage       `bson:"payload" json:"payload"`
+	Status         WebhookDeliveryStatus `bson:"status" json:"status"`
+	Attempts       int                   `bson:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time             `bson:"next_attempt_at" json:"next_attempt_at"`
+	LastError      string                `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	LastStatusCode int                   `bson:"last_status_code,omitempty" json:"last_status_code,omitempty"`
+	CreatedAt      time.Time             `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time             `bson:"updated_at" json:"updated_at"`
+	DeliveredAt    *time.Time            `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+}
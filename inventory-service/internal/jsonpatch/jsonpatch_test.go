@@ -0,0 +1,282 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// sameJSON compares two documents ignoring key order and whitespace.
+func sameJSON(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	a, err := decode(got)
+	if err != nil {
+		t.Fatalf("result is not JSON: %s", got)
+	}
+	b, err := decode([]byte(want))
+	if err != nil {
+		t.Fatalf("bad want %s: %v", want, err)
+	}
+	return equal(a, b)
+}
+
+// The examples of RFC 6902 Appendix A, and the corners of RFC 6901
+// pointers the appendix does not reach.
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{"A.1 add an object member",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz","value":"qux"}]`,
+			`{"baz":"qux","foo":"bar"}`, nil},
+		{"A.2 add an array element",
+			`{"foo":["bar","baz"]}`,
+			`[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			`{"foo":["bar","qux","baz"]}`, nil},
+		{"A.3 remove an object member",
+			`{"baz":"qux","foo":"bar"}`,
+			`[{"op":"remove","path":"/baz"}]`,
+			`{"foo":"bar"}`, nil},
+		{"A.4 remove an array element",
+			`{"foo":["bar","qux","baz"]}`,
+			`[{"op":"remove","path":"/foo/1"}]`,
+			`{"foo":["bar","baz"]}`, nil},
+		{"A.5 replace a value",
+			`{"baz":"qux","foo":"bar"}`,
+			`[{"op":"replace","path":"/baz","value":"boo"}]`,
+			`{"baz":"boo","foo":"bar"}`, nil},
+		{"A.6 move a value",
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"A.7 move an array element",
+			`{"foo":["all","grass","cows","eat"]}`,
+			`[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`, nil},
+		{"A.8 test a value: success",
+			`{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"A.9 test a value: error",
+			`{"baz":"qux"}`,
+			`[{"op":"test","path":"/baz","value":"bar"}]`,
+			"", ErrTestFailed},
+		{"A.10 add a nested member object",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			`{"foo":"bar","child":{"grandchild":{}}}`, nil},
+		{"A.11 ignore unrecognized elements",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+			`{"foo":"bar","baz":"qux"}`, nil},
+		{"A.12 add to a nonexistent target",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			"", ErrInvalidPatch},
+		{"A.14 ~ escape ordering",
+			`{"/":9,"~1":10}`,
+			`[{"op":"test","path":"/~01","value":10}]`,
+			`{"/":9,"~1":10}`, nil},
+		{"A.15 compare strings and numbers",
+			`{"/":9,"~1":10}`,
+			`[{"op":"test","path":"/~01","value":"10"}]`,
+			"", ErrTestFailed},
+		{"A.16 add an array value",
+			`{"foo":["bar"]}`,
+			`[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			`{"foo":["bar",["abc","def"]]}`, nil},
+
+		{"- appends",
+			`{"foo":[1,2]}`,
+			`[{"op":"add","path":"/foo/-","value":3},{"op":"add","path":"/foo/-","value":4}]`,
+			`{"foo":[1,2,3,4]}`, nil},
+		{"- only names a place to add",
+			`{"foo":[1,2]}`,
+			`[{"op":"remove","path":"/foo/-"}]`,
+			"", ErrInvalidPatch},
+		{"index one past the end appends",
+			`{"foo":[1,2]}`,
+			`[{"op":"add","path":"/foo/2","value":3}]`,
+			`{"foo":[1,2,3]}`, nil},
+		{"index beyond the end",
+			`{"foo":[1,2]}`,
+			`[{"op":"add","path":"/foo/3","value":3}]`,
+			"", ErrInvalidPatch},
+		{"leading zero index",
+			`{"foo":[1,2]}`,
+			`[{"op":"replace","path":"/foo/01","value":3}]`,
+			"", ErrInvalidPatch},
+		{"index 0 is no leading zero",
+			`{"foo":[1,2]}`,
+			`[{"op":"replace","path":"/foo/0","value":3}]`,
+			`{"foo":[3,2]}`, nil},
+		{"negative index",
+			`{"foo":[1,2]}`,
+			`[{"op":"remove","path":"/foo/-1"}]`,
+			"", ErrInvalidPatch},
+		{"~1 escapes a slash",
+			`{"a/b":1}`,
+			`[{"op":"replace","path":"/a~1b","value":2}]`,
+			`{"a/b":2}`, nil},
+		{"~0 escapes a tilde",
+			`{"m~n":1}`,
+			`[{"op":"remove","path":"/m~0n"}]`,
+			`{}`, nil},
+		{"empty key",
+			`{"":1}`,
+			`[{"op":"replace","path":"/","value":2}]`,
+			`{"":2}`, nil},
+		{"pointer without leading slash",
+			`{"foo":1}`,
+			`[{"op":"remove","path":"foo"}]`,
+			"", ErrInvalidPatch},
+		{"move into its own child",
+			`{"a":{"b":{}}}`,
+			`[{"op":"move","from":"/a","path":"/a/b/c"}]`,
+			"", ErrInvalidPatch},
+		{"move to a sibling sharing a prefix",
+			`{"a":1,"ab":{}}`,
+			`[{"op":"move","from":"/a","path":"/ab/a"}]`,
+			`{"ab":{"a":1}}`, nil},
+		{"move onto itself",
+			`{"a":1}`,
+			`[{"op":"move","from":"/a","path":"/a"}]`,
+			`{"a":1}`, nil},
+		{"copy is deep",
+			`{"a":{"x":1}}`,
+			`[{"op":"copy","from":"/a","path":"/b"},{"op":"replace","path":"/b/x","value":2}]`,
+			`{"a":{"x":1},"b":{"x":2}}`, nil},
+		{"test compares numbers by value",
+			`{"price":"12.50","n":1}`,
+			`[{"op":"test","path":"/n","value":1.0},{"op":"test","path":"/n","value":1e0}]`,
+			`{"price":"12.50","n":1}`, nil},
+		{"test tells numbers apart",
+			`{"n":1}`,
+			`[{"op":"test","path":"/n","value":1.000001}]`,
+			"", ErrTestFailed},
+		{"test compares objects regardless of key order",
+			`{"o":{"a":1,"b":[true,null]}}`,
+			`[{"op":"test","path":"/o","value":{"b":[true,null],"a":1}}]`,
+			`{"o":{"a":1,"b":[true,null]}}`, nil},
+		{"explicit null value is added",
+			`{"a":1}`,
+			`[{"op":"add","path":"/b","value":null}]`,
+			`{"a":1,"b":null}`, nil},
+		{"explicit null value replaces",
+			`{"a":1}`,
+			`[{"op":"replace","path":"/a","value":null}]`,
+			`{"a":null}`, nil},
+		{"explicit null value is tested",
+			`{"a":null}`,
+			`[{"op":"test","path":"/a","value":null}]`,
+			`{"a":null}`, nil},
+		{"missing value",
+			`{"a":1}`,
+			`[{"op":"add","path":"/b"}]`,
+			"", ErrInvalidPatch},
+		{"replace a missing member",
+			`{"a":1}`,
+			`[{"op":"replace","path":"/b","value":2}]`,
+			"", ErrInvalidPatch},
+		{"replace the whole document",
+			`{"a":1}`,
+			`[{"op":"replace","path":"","value":[1]}]`,
+			`[1]`, nil},
+		{"unknown op",
+			`{"a":1}`,
+			`[{"op":"merge","path":"/a","value":2}]`,
+			"", ErrInvalidPatch},
+		{"a failing operation undoes the earlier ones",
+			`{"a":1}`,
+			`[{"op":"replace","path":"/a","value":2},{"op":"test","path":"/a","value":1}]`,
+			"", ErrTestFailed},
+		{"not a patch",
+			`{"a":1}`,
+			`{"op":"remove","path":"/a"}`,
+			"", ErrInvalidPatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := []byte(tt.doc)
+			got, err := Apply(doc, []byte(tt.patch))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if !bytes.Equal(doc, []byte(tt.doc)) {
+					t.Errorf("doc was changed to %s", doc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameJSON(t, got, tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// The examples of RFC 7396 Appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+
+		// decimal prices come back exactly as sent
+		{`{"price":12.50}`, `{"price":19.999999999999999999}`, `{"price":19.999999999999999999}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.patch, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameJSON(t, got, tt.want) {
+				t.Errorf("MergePatch(%s, %s) = %s, want %s", tt.doc, tt.patch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatchKeepsNumbersVerbatim(t *testing.T) {
+	got, err := MergePatch([]byte(`{"price":12.50,"stock":3}`), []byte(`{"stock":4}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(got, &m); err != nil {
+		t.Fatal(err)
+	}
+	if string(m["price"]) != "12.50" {
+		t.Errorf("price = %s, want 12.50", m["price"])
+	}
+}
+
+func TestMergePatchRejectsInvalidPatch(t *testing.T) {
+	if _, err := MergePatch([]byte(`{}`), []byte(`{"a":`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("err = %v, want ErrInvalidPatch", err)
+	}
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// auditRetention is how long denied requests are kept.
+const auditRetention = 90 * 24 * time.Hour
+
+type AuditRepository interface {
+	EnsureIndexes(ctx context.Context) error
+	Record(ctx context.Context, e *entity.AuditEntry) error
+	// ListDenied returns up to limit entries, newest first, optionally only
+	// those of actor.
+	ListDenied(ctx context.Context, actor string, limit int64) ([]entity.AuditEntry, error)
+}
+
+type auditRepository struct {
+	col *mongo.Collection
+}
+
+func NewAuditRepository(db *mongo.Database) AuditRepository {
+	return &auditRepository{col: db.Collection("audit_log")}
+}
+
+func (r *auditRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, err := r.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(auditRetention.Seconds())),
+		},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "at", Value: -1}}},
+	})
+	return err
+}
+
+func (r *auditRepository) Record(ctx context.Context, e *entity.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := r.col.InsertOne(ctx, e)
+	return err
+}
+
+func (r *auditRepository) ListDenied(ctx context.Context, actor string, limit int64) ([]entity.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	filter := bson.M{}
+	if actor != "" {
+		filter["actor"] = actor
+	}
+	cur, err := r.col.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "at", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	entries := []entity.AuditEntry{}
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
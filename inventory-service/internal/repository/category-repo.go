@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCategoryNotFound  = errors.New("category not found")
+	ErrCategorySlugTaken = errors.New("category slug already exists")
+	ErrCategoryInUse     = errors.New("category has products or subcategories")
+)
+
+type CategoryRepository interface {
+	EnsureIndexes(ctx context.Context) error
+	Create(ctx context.Context, c *entity.Category) error
+	GetByID(ctx context.Context, id string) (*entity.Category, error)
+	GetBySlug(ctx context.Context, slug string) (*entity.Category, error)
+	Update(ctx context.Context, old, updated *entity.Category) error
+	Delete(ctx context.Context, c *entity.Category) error
+	List(ctx context.Context) ([]entity.Category, error)
+	Descendants(ctx context.Context, id primitive.ObjectID) ([]entity.Category, error)
+}
+
+type categoryRepository struct {
+	db       *mongo.Database
+	col      *mongo.Collection
+	products *mongo.Collection
+}
+
+func NewCategoryRepository(db *mongo.Database) CategoryRepository {
+	return &categoryRepository{
+		db:       db,
+		col:      db.Collection("categories"),
+		products: db.Collection("products"),
+	}
+}
+
+func (r *categoryRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, err := r.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "ancestors", Value: 1}}},
+	})
+	return err
+}
+
+func (r *categoryRepository) Create(ctx context.Context, c *entity.Category) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	c.ID = primitive.NewObjectID()
+	_, err := r.col.InsertOne(ctx, c)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrCategorySlugTaken
+	}
+	return err
+}
+
+func (r *categoryRepository) GetByID(ctx context.Context, id string) (*entity.Category, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrCategoryNotFound
+	}
+	return r.findOne(ctx, bson.M{"_id": objID})
+}
+
+func (r *categoryRepository) GetBySlug(ctx context.Context, slug string) (*entity.Category, error) {
+	return r.findOne(ctx, bson.M{"slug": slug})
+}
+
+func (r *categoryRepository) findOne(ctx context.Context, filter bson.M) (*entity.Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var c entity.Category
+	if err := r.col.FindOne(ctx, filter).Decode(&c); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Update saves updated in one transaction together with what follows from it:
+// products move along with a slug change, and when the category moves in the
+// tree every descendant's ancestors are rewritten.
+func (r *categoryRepository) Update(ctx context.Context, old, updated *entity.Category) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	err := withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		res, err := r.col.ReplaceOne(sc, bson.M{"_id": old.ID}, updated)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrCategoryNotFound
+		}
+		if updated.Slug != old.Slug {
+			if _, err := r.products.UpdateMany(sc,
+				bson.M{"category": old.Slug},
+				bson.M{"$set": bson.M{"category": updated.Slug}},
+			); err != nil {
+				return err
+			}
+		}
+		if !sameAncestors(old.Ancestors, updated.Ancestors) {
+			return r.reparentDescendants(sc, updated)
+		}
+		return nil
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrCategorySlugTaken
+	}
+	return err
+}
+
+// reparentDescendants replaces the part of each descendant's ancestors above
+// moved with moved's new ancestors.
+func (r *categoryRepository) reparentDescendants(sc mongo.SessionContext, moved *entity.Category) error {
+	descendants, err := r.Descendants(sc, moved.ID)
+	if err != nil {
+		return err
+	}
+	for _, d := range descendants {
+		if _, err := r.col.UpdateOne(sc, bson.M{"_id": d.ID},
+			bson.M{"$set": bson.M{"ancestors": movedAncestors(moved, d.Ancestors), "updated_at": moved.UpdatedAt}},
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// movedAncestors returns the ancestors of a descendant of moved, given its
+// current ones, once moved sits at its new place.
+func movedAncestors(moved *entity.Category, ancestors []primitive.ObjectID) []primitive.ObjectID {
+	var below []primitive.ObjectID
+	for i, a := range ancestors {
+		if a == moved.ID {
+			below = ancestors[i:]
+			break
+		}
+	}
+	return append(append([]primitive.ObjectID{}, moved.Ancestors...), below...)
+}
+
+// Delete removes c unless products or subcategories still point at it. The
+// checks and the delete share a transaction.
+func (r *categoryRepository) Delete(ctx context.Context, c *entity.Category) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		children, err := r.col.CountDocuments(sc, bson.M{"parent_id": c.ID}, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		products, err := r.products.CountDocuments(sc, bson.M{"category": c.Slug}, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if children > 0 || products > 0 {
+			return ErrCategoryInUse
+		}
+		res, err := r.col.DeleteOne(sc, bson.M{"_id": c.ID})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return ErrCategoryNotFound
+		}
+		return nil
+	})
+}
+
+func (r *categoryRepository) List(ctx context.Context) ([]entity.Category, error) {
+	return r.find(ctx, bson.M{})
+}
+
+// Descendants returns every category below id, at any depth.
+func (r *categoryRepository) Descendants(ctx context.Context, id primitive.ObjectID) ([]entity.Category, error) {
+	return r.find(ctx, bson.M{"ancestors": id})
+}
+
+func (r *categoryRepository) find(ctx context.Context, filter bson.M) ([]entity.Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	cur, err := r.col.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	categories := []entity.Category{}
+	if err := cur.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func sameAncestors(a, b []primitive.ObjectID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMovedAncestors(t *testing.T) {
+	var (
+		tools  = primitive.ObjectID{20}
+		power  = primitive.ObjectID{21}
+		drills = primitive.ObjectID{22}
+		garden = primitive.ObjectID{24}
+		sheds  = primitive.ObjectID{25}
+	)
+	ids := func(ids ...primitive.ObjectID) []primitive.ObjectID {
+		return append([]primitive.ObjectID{}, ids...)
+	}
+	// tools > power > drills > bits; power moves and takes drills and bits along
+	tests := []struct {
+		name      string
+		to        []primitive.ObjectID
+		ancestors []primitive.ObjectID
+		want      []primitive.ObjectID
+	}{
+		{"child, under another root", ids(garden), ids(tools, power), ids(garden, power)},
+		{"grandchild, under another root", ids(garden), ids(tools, power, drills), ids(garden, power, drills)},
+		{"grandchild, to the root", ids(), ids(tools, power, drills), ids(power, drills)},
+		{"child, deeper down", ids(garden, sheds), ids(tools, power), ids(garden, sheds, power)},
+		{"grandchild, deeper down", ids(garden, sheds), ids(tools, power, drills), ids(garden, sheds, power, drills)},
+	}
+	for _, tt := range tests {
+		moved := &entity.Category{ID: power, Ancestors: tt.to}
+		before := ids(tt.ancestors...)
+		got := movedAncestors(moved, tt.ancestors)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ancestors = %v, want %v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(tt.ancestors, before) {
+			t.Errorf("%s: the descendant's ancestors were changed in place", tt.name)
+		}
+		if !sameAncestors(moved.Ancestors, tt.to) {
+			t.Errorf("%s: the moved category's ancestors were changed", tt.name)
+		}
+	}
+}
+
+func TestSameAncestors(t *testing.T) {
+	a, b := primitive.ObjectID{20}, primitive.ObjectID{21}
+	tests := []struct {
+		x, y []primitive.ObjectID
+		want bool
+	}{
+		{nil, []primitive.ObjectID{}, true},
+		{[]primitive.ObjectID{a, b}, []primitive.ObjectID{a, b}, true},
+		{[]primitive.ObjectID{a, b}, []primitive.ObjectID{b, a}, false},
+		{[]primitive.ObjectID{a}, []primitive.ObjectID{a, b}, false},
+	}
+	for _, tt := range tests {
+		if got := sameAncestors(tt.x, tt.y); got != tt.want {
+			t.Errorf("sameAncestors(%v, %v) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/pkg/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrateProductPrices rewrites products whose price is still a bare number
+// (major units, float) into the {amount, currency} minor-unit form. It only
+// touches unmigrated documents, so running it on every start is safe.
+func MigrateProductPrices(ctx context.Context, db *mongo.Database, currency string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	scale := money.Pow10(money.MinorUnitExponent(currency))
+	res, err := db.Collection("products").UpdateMany(ctx,
+		bson.M{"price": bson.M{"$type": "number"}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"price": bson.M{
+				"amount":   bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{"$price", scale}}, 0}}},
+				"currency": currency,
+			},
+		}}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// MigrateProductCategories turns the free-text categories of products from
+// before the category tree into slugs, creating a root category named after
+// the text for every slug that has none. A value without letters or digits
+// has no slug and is left as it is. Values that already are a category's
+// slug are left alone, so running it on every start is safe.
+func MigrateProductCategories(ctx context.Context, db *mongo.Database) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	products, categories := db.Collection("products"), db.Collection("categories")
+	values, err := products.Distinct(ctx, "category", bson.M{"category": bson.M{"$type": "string", "$ne": ""}})
+	if err != nil {
+		return 0, err
+	}
+	slugs, err := categories.Distinct(ctx, "slug", bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[string]bool, len(slugs))
+	for _, s := range slugs {
+		if s, ok := s.(string); ok {
+			known[s] = true
+		}
+	}
+
+	var migrated int64
+	for _, v := range values {
+		text, ok := v.(string)
+		if !ok || known[text] {
+			continue
+		}
+		slug := entity.Slugify(text)
+		if slug == "" {
+			continue
+		}
+		if !known[slug] {
+			now := time.Now().UTC()
+			_, err := categories.UpdateOne(ctx,
+				bson.M{"slug": slug},
+				bson.M{"$setOnInsert": bson.M{
+					"name":       strings.TrimSpace(text),
+					"slug":       slug,
+					"ancestors":  bson.A{},
+					"created_at": now,
+					"updated_at": now,
+				}},
+				options.Update().SetUpsert(true),
+			)
+			// another replica inserting the same slug first is fine
+			if err != nil && !mongo.IsDuplicateKeyError(err) {
+				return migrated, err
+			}
+			known[slug] = true
+		}
+		if slug == text {
+			continue
+		}
+		res, err := products.UpdateMany(ctx,
+			bson.M{"category": text},
+			bson.M{"$set": bson.M{"category": slug}, "$inc": bson.M{"version": 1}},
+		)
+		if err != nil {
+			return migrated, err
+		}
+		migrated += res.ModifiedCount
+	}
+	return migrated, nil
+}
+
+// openingIndex lets a product's ledger be opened once per location. Replicas
+// starting together may both see a product without movements; the second
+// one's openings then fail on the index and are dropped.
+var openingIndex = mongo.IndexModel{
+	Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "warehouse_id", Value: 1}},
+	Options: options.Index().
+		SetName("opening_once").
+		SetUnique(true).
+		SetPartialFilterExpression(bson.M{"reason": entity.MovementOpening}),
+}
+
+// MigrateStockLedger gives every product without ledger entries an opening
+// movement for its current stock and reserved, so products created before
+// the ledger reconcile. Products that have movements are left alone. It is
+// safe to run on several replicas at once.
+func MigrateStockLedger(ctx context.Context, db *mongo.Database) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	movements := db.Collection("stock_movements")
+	if err := dropDuplicateOpenings(ctx, movements); err != nil {
+		return 0, err
+	}
+	if _, err := movements.Indexes().CreateOne(ctx, openingIndex); err != nil {
+		return 0, err
+	}
+	cur, err := db.Collection("products").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from": "stock_movements",
+			"let":  bson.M{"pid": "$_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$product_id", "$$pid"}}}},
+				bson.M{"$limit": 1},
+			},
+			"as": "movements",
+		}}},
+		{{Key: "$match", Value: bson.M{"movements": bson.M{"$size": 0}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	var migrated int64
+	for cur.Next(ctx) {
+		var p entity.Product
+		if err := cur.Decode(&p); err != nil {
+			return migrated, err
+		}
+		_, err := movements.InsertMany(ctx, openingMovements(&p), options.InsertMany().SetOrdered(false))
+		if onlyDuplicates(err) {
+			continue // another replica opened it first
+		}
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, cur.Err()
+}
+
+// openingMovements opens the ledger of p with one movement per location,
+// balances running up to its totals.
+func openingMovements(p *entity.Product) []interface{} {
+	locations := p.Locations
+	if len(locations) == 0 {
+		locations = []entity.StockLocation{{Stock: p.Stock, Reserved: p.Reserved}}
+	}
+	var docs []interface{}
+	var stock, reserved int
+	for _, l := range locations {
+		stock += l.Stock
+		reserved += l.Reserved
+		docs = append(docs, entity.StockMovement{
+			ID:              primitive.NewObjectID(),
+			ProductID:       p.ID,
+			WarehouseID:     l.WarehouseID,
+			Reason:          entity.MovementOpening,
+			Actor:           entity.SystemActor,
+			Delta:           l.Stock,
+			ReservedDelta:   l.Reserved,
+			Balance:         stock,
+			ReservedBalance: reserved,
+			LocationBalance: l.Stock,
+			CreatedAt:       time.Now().UTC(),
+		})
+	}
+	return docs
+}
+
+// dropDuplicateOpenings keeps the first opening of every product location.
+// Replicas that started together before openingIndex existed could open a
+// ledger twice, and the index cannot be built over the duplicates.
+func dropDuplicateOpenings(ctx context.Context, movements *mongo.Collection) error {
+	cur, err := movements.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"reason": entity.MovementOpening}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"product_id": "$product_id", "warehouse_id": "$warehouse_id"},
+			"ids": bson.M{"$push": "$_id"},
+		}}},
+		{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	var extra []primitive.ObjectID
+	for cur.Next(ctx) {
+		var group struct {
+			IDs []primitive.ObjectID `bson:"ids"`
+		}
+		if err := cur.Decode(&group); err != nil {
+			return err
+		}
+		extra = append(extra, group.IDs[1:]...)
+	}
+	if err := cur.Err(); err != nil || len(extra) == 0 {
+		return err
+	}
+	_, err = movements.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": extra}})
+	return err
+}
+
+// MigrateProductLocations puts the stock and reserved of products from before
+// warehouses into a single location at warehouse. Products that already have
+// locations are left alone.
+func MigrateProductLocations(ctx context.Context, db *mongo.Database, warehouse primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	res, err := db.Collection("products").UpdateMany(ctx,
+		bson.M{"locations": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"locations": bson.A{bson.M{
+				"warehouse_id": warehouse,
+				"stock":        bson.M{"$ifNull": bson.A{"$stock", 0}},
+				"reserved":     bson.M{"$ifNull": bson.A{"$reserved", 0}},
+			}},
+		}}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
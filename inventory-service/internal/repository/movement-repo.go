@@ -0,0 +1,401 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+type MovementRepository interface {
+	EnsureIndexes(ctx context.Context) error
+	// Record applies m.Delta to the product's stock at m.WarehouseID and
+	// appends m.
+	Record(ctx context.Context, productID string, m *entity.StockMovement) (*entity.Product, error)
+	// Recount sets the product's stock at m.WarehouseID to counted and
+	// appends m with the difference as its delta.
+	Recount(ctx context.Context, productID string, counted int, m *entity.StockMovement) (*entity.Product, error)
+	List(ctx context.Context, filter entity.MovementFilter) (*entity.MovementPage, error)
+	// Reconcile recomputes a product's quantities from its movements.
+	Reconcile(ctx context.Context, productID string) (*entity.StockConsistency, error)
+	// ListUnnotified returns up to limit movements not yet queued for
+	// webhook subscribers, oldest first.
+	ListUnnotified(ctx context.Context, limit int64) ([]entity.StockMovement, error)
+	MarkNotified(ctx context.Context, ids []primitive.ObjectID) error
+}
+
+type movementRepository struct {
+	db     *mongo.Database
+	col    *mongo.Collection
+	ledger stockLedger
+}
+
+func NewMovementRepository(db *mongo.Database) MovementRepository {
+	return &movementRepository{
+		db:     db,
+		col:    db.Collection("stock_movements"),
+		ledger: newStockLedger(db),
+	}
+}
+
+func (r *movementRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, err := r.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		// only the few movements still to notify are indexed
+		{
+			Keys:    bson.D{{Key: "notified", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"notified": false}),
+		},
+	})
+	return err
+}
+
+func (r *movementRepository) Record(ctx context.Context, productID string, m *entity.StockMovement) (*entity.Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, ErrProductNotFound
+	}
+	filter := bson.M{"_id": objID}
+	if m.Delta < 0 {
+		filter["$expr"] = availableAtLeast(-m.Delta)
+	}
+	var p *entity.Product
+	err = withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		var err error
+		p, err = r.ledger.apply(sc, filter, bson.M{}, m)
+		if err == mongo.ErrNoDocuments {
+			return r.ledger.missOrShort(sc, objID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Recount reads the stock and writes the correction in one transaction, so a
+// concurrent change makes the transaction retry rather than be overwritten.
+func (r *movementRepository) Recount(ctx context.Context, productID string, counted int, m *entity.StockMovement) (*entity.Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, ErrProductNotFound
+	}
+	var p *entity.Product
+	err = withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		var current entity.Product
+		if err := r.ledger.products.FindOne(sc, bson.M{"_id": objID}).Decode(&current); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrProductNotFound
+			}
+			return err
+		}
+		loc := current.Location(m.WarehouseID)
+		if counted < loc.Reserved {
+			return ErrInsufficientStock
+		}
+		m.Delta = counted - loc.Stock
+		var err error
+		p, err = r.ledger.apply(sc, bson.M{"_id": objID}, bson.M{}, m)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (r *movementRepository) List(ctx context.Context, filter entity.MovementFilter) (*entity.MovementPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	query := bson.M{"product_id": filter.ProductID}
+	if filter.Reason != "" {
+		query["reason"] = filter.Reason
+	}
+	if filter.From != nil || filter.To != nil {
+		created := bson.M{}
+		if filter.From != nil {
+			created["$gte"] = *filter.From
+		}
+		if filter.To != nil {
+			created["$lt"] = *filter.To
+		}
+		query["created_at"] = created
+	}
+	if filter.Cursor != "" {
+		after, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		query["_id"] = bson.M{"$lt": after}
+	}
+
+	// ObjectIDs grow with time, so _id order is insertion order
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(filter.Limit + 1)
+	cur, err := r.col.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	movements := []entity.StockMovement{}
+	if err := cur.All(ctx, &movements); err != nil {
+		return nil, err
+	}
+	page := &entity.MovementPage{Items: movements}
+	if int64(len(movements)) > filter.Limit {
+		page.Items = movements[:filter.Limit]
+		page.NextCursor = page.Items[len(page.Items)-1].ID.Hex()
+	}
+	return page, nil
+}
+
+// Reconcile reads the product and sums its movements in one transaction, so
+// both come from the same snapshot.
+func (r *movementRepository) Reconcile(ctx context.Context, productID string) (*entity.StockConsistency, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, ErrProductNotFound
+	}
+	var check entity.StockConsistency
+	err = withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		var p entity.Product
+		if err := r.ledger.products.FindOne(sc, bson.M{"_id": objID}).Decode(&p); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrProductNotFound
+			}
+			return err
+		}
+		cur, err := r.col.Aggregate(sc, mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"product_id": objID}}},
+			{{Key: "$group", Value: bson.M{
+				"_id":      nil,
+				"stock":    bson.M{"$sum": "$delta"},
+				"reserved": bson.M{"$sum": "$reserved_delta"},
+				"count":    bson.M{"$sum": 1},
+			}}},
+		})
+		if err != nil {
+			return err
+		}
+		defer cur.Close(sc)
+		var totals []struct {
+			Stock    int   `bson:"stock"`
+			Reserved int   `bson:"reserved"`
+			Count    int64 `bson:"count"`
+		}
+		if err := cur.All(sc, &totals); err != nil {
+			return err
+		}
+		check = entity.StockConsistency{ProductID: p.ID, Stock: p.Stock, Reserved: p.Reserved}
+		if len(totals) > 0 {
+			check.LedgerStock = totals[0].Stock
+			check.LedgerReserved = totals[0].Reserved
+			check.Movements = totals[0].Count
+		}
+		check.Consistent = check.Stock == check.LedgerStock && check.Reserved == check.LedgerReserved
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &check, nil
+}
+
+func (r *movementRepository) ListUnnotified(ctx context.Context, limit int64) ([]entity.StockMovement, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit)
+	cur, err := r.col.Find(ctx, bson.M{"notified": false}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	movements := []entity.StockMovement{}
+	if err := cur.All(ctx, &movements); err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
+
+func (r *movementRepository) MarkNotified(ctx context.Context, ids []primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, err := r.col.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$set": bson.M{"notified": true}})
+	return err
+}
+
+// stockLedger is shared by every repository that changes stock or reserved.
+// Each change goes through apply inside the caller's transaction, so the
+// product and its ledger never disagree.
+type stockLedger struct {
+	products  *mongo.Collection
+	movements *mongo.Collection
+}
+
+func newStockLedger(db *mongo.Database) stockLedger {
+	return stockLedger{
+		products:  db.Collection("products"),
+		movements: db.Collection("stock_movements"),
+	}
+}
+
+// apply adds m's deltas to the product matched by filter, together with the
+// rest of update, and appends m with the resulting balances. When m names a
+// warehouse the deltas also go to that location, which must keep enough
+// available stock for anything m takes away. A nil m only runs update. It
+// returns mongo.ErrNoDocuments when filter matches nothing.
+func (l stockLedger) apply(sc mongo.SessionContext, filter, update bson.M, m *entity.StockMovement) (*entity.Product, error) {
+	if movesLocation(m) {
+		if err := l.ensureLocation(sc, filter["_id"], m.WarehouseID); err != nil {
+			return nil, err
+		}
+	}
+	filter, update, opts := ledgerUpdate(filter, update, m)
+	var p entity.Product
+	if err := l.products.FindOneAndUpdate(sc, filter, update, opts).Decode(&p); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return &p, nil
+	}
+	if err := l.record(sc, &p, m); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// movesLocation tells whether m changes the quantities of a warehouse.
+func movesLocation(m *entity.StockMovement) bool {
+	return m != nil && !m.WarehouseID.IsZero() && (m.Delta != 0 || m.ReservedDelta != 0)
+}
+
+// ledgerUpdate builds the product write of apply. It works on copies, since
+// the transaction may run apply again.
+func ledgerUpdate(filter, update bson.M, m *entity.StockMovement) (bson.M, bson.M, *options.FindOneAndUpdateOptions) {
+	filter, update = copyM(filter), copyM(update)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if m != nil {
+		inc := bson.M{}
+		if v, ok := update["$inc"].(bson.M); ok {
+			inc = copyM(v)
+		}
+		if m.Delta != 0 {
+			inc["stock"] = m.Delta
+		}
+		if m.ReservedDelta != 0 {
+			inc["reserved"] = m.ReservedDelta
+		}
+		if movesLocation(m) {
+			if m.Delta != 0 {
+				inc["locations.$[loc].stock"] = m.Delta
+			}
+			if m.ReservedDelta != 0 {
+				inc["locations.$[loc].reserved"] = m.ReservedDelta
+			}
+			opts.SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"loc.warehouse_id": m.WarehouseID}}})
+			if drop := m.ReservedDelta - m.Delta; drop > 0 {
+				addExpr(filter, locationAvailableAtLeast(m.WarehouseID, drop))
+			}
+		}
+		if len(inc) > 0 {
+			update["$inc"] = inc
+		}
+	}
+	if len(update) == 0 {
+		// a recount that found the book balance right is still recorded
+		update = bson.M{"$inc": bson.M{"stock": 0}}
+	}
+	return filter, update, opts
+}
+
+// ensureLocation adds an empty location for warehouse to the product with id
+// unless it has one.
+func (l stockLedger) ensureLocation(sc mongo.SessionContext, id interface{}, warehouse primitive.ObjectID) error {
+	_, err := l.products.UpdateOne(sc,
+		bson.M{"_id": id, "locations.warehouse_id": bson.M{"$ne": warehouse}},
+		bson.M{"$push": bson.M{"locations": entity.StockLocation{WarehouseID: warehouse}}},
+	)
+	return err
+}
+
+// record appends m for p, whose quantities already include m.
+func (l stockLedger) record(sc mongo.SessionContext, p *entity.Product, m *entity.StockMovement) error {
+	m.ID = primitive.NewObjectID()
+	m.ProductID = p.ID
+	m.Balance = p.Stock
+	m.ReservedBalance = p.Reserved
+	if !m.WarehouseID.IsZero() {
+		m.LocationBalance = p.Location(m.WarehouseID).Stock
+	}
+	if m.Actor == "" {
+		m.Actor = entity.ActorFrom(sc)
+	}
+	m.CreatedAt = time.Now().UTC()
+	_, err := l.movements.InsertOne(sc, m)
+	return err
+}
+
+// missOrShort explains why a stock decrease matched nothing.
+func (l stockLedger) missOrShort(sc mongo.SessionContext, objID primitive.ObjectID) error {
+	n, err := l.products.CountDocuments(sc, bson.M{"_id": objID}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrProductNotFound
+	}
+	return ErrInsufficientStock
+}
+
+// locationAvailableAtLeast is an $expr matching products whose stock minus
+// reserved at warehouse covers qty. A missing location never matches.
+func locationAvailableAtLeast(warehouse primitive.ObjectID, qty int) bson.M {
+	return bson.M{"$let": bson.M{
+		"vars": bson.M{"loc": bson.M{"$arrayElemAt": bson.A{
+			bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$locations", bson.A{}}},
+				"cond":  bson.M{"$eq": bson.A{"$$this.warehouse_id", warehouse}},
+			}},
+			0,
+		}}},
+		"in": bson.M{"$gte": bson.A{
+			bson.M{"$subtract": bson.A{"$$loc.stock", "$$loc.reserved"}},
+			qty,
+		}},
+	}}
+}
+
+// addExpr ands expr into filter's $expr.
+func addExpr(filter bson.M, expr bson.M) {
+	if existing, ok := filter["$expr"]; ok {
+		filter["$expr"] = bson.M{"$and": bson.A{existing, expr}}
+		return
+	}
+	filter["$expr"] = expr
+}
+
+func copyM(m bson.M) bson.M {
+	out := make(bson.M, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
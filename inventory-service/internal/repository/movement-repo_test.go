@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// onlyDuplicates decides whether an unordered insert lost only to rows that
+// exist already, as webhook deliveries and ledger openings do on a rerun.
+func TestOnlyDuplicates(t *testing.T) {
+	dup := mongo.BulkWriteError{WriteError: mongo.WriteError{Code: duplicateKeyCode}}
+	other := mongo.BulkWriteError{WriteError: mongo.WriteError{Code: 121}}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no error", nil, false},
+		{"duplicates", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{dup, dup}}, true},
+		{"a duplicate and another failure", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{dup, other}}, false},
+		{"write concern", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{dup}, WriteConcernError: &mongo.WriteConcernError{Code: 64}}, false},
+		{"not a bulk write", errors.New("connection reset"), false},
+	}
+	for _, tt := range tests {
+		if got := onlyDuplicates(tt.err); got != tt.want {
+			t.Errorf("%s: onlyDuplicates = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// indexKey returns the key doc is stored under in a unique index, or false
+// when the index's partial filter leaves doc out.
+func indexKey(t *testing.T, index mongo.IndexModel, doc interface{}) (string, bool) {
+	t.Helper()
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if filter, ok := index.Options.PartialFilterExpression.(bson.M); ok {
+		for k, v := range filter {
+			if fmt.Sprint(fields[k]) != fmt.Sprint(v) {
+				return "", false
+			}
+		}
+	}
+	key := ""
+	for _, k := range index.Keys.(bson.D) {
+		key += fmt.Sprintf("%s=%v ", k.Key, fields[k.Key])
+	}
+	return key, true
+}
+
+// insertUnordered plays an unordered InsertMany into a collection holding
+// the keys in stored under index.
+func insertUnordered(t *testing.T, index mongo.IndexModel, stored map[string]bool, docs []interface{}) error {
+	t.Helper()
+	var bulk mongo.BulkWriteException
+	for i, doc := range docs {
+		key, ok := indexKey(t, index, doc)
+		if !ok {
+			continue
+		}
+		if stored[key] {
+			bulk.WriteErrors = append(bulk.WriteErrors, mongo.BulkWriteError{WriteError: mongo.WriteError{Index: i, Code: duplicateKeyCode}})
+			continue
+		}
+		stored[key] = true
+	}
+	if len(bulk.WriteErrors) > 0 {
+		return bulk
+	}
+	return nil
+}
+
+// MigrateStockLedger run by two replicas at once opens each ledger once: the
+// openings of the second collide on openingIndex and it moves on.
+func TestOpeningIndexMakesLedgerMigrationIdempotent(t *testing.T) {
+	if opts := openingIndex.Options; opts.Unique == nil || !*opts.Unique || opts.Name == nil || *opts.Name != "opening_once" {
+		t.Fatalf("openingIndex options = %+v, want a unique index named opening_once", opts)
+	}
+	products := map[string]*entity.Product{
+		"with locations": {ID: primitive.NewObjectID(), Stock: 7, Locations: []entity.StockLocation{
+			{WarehouseID: primitive.NewObjectID(), Stock: 5, Reserved: 1},
+			{WarehouseID: primitive.NewObjectID(), Stock: 2},
+		}},
+		"from before warehouses": {ID: primitive.NewObjectID(), Stock: 3, Reserved: 2},
+	}
+	for name, p := range products {
+		t.Run(name, func(t *testing.T) {
+			stored := map[string]bool{}
+			first := openingMovements(p)
+			if err := insertUnordered(t, openingIndex, stored, first); err != nil {
+				t.Fatalf("first replica: %v", err)
+			}
+			if len(stored) != len(first) {
+				t.Fatalf("%d openings share index keys: %v", len(first), stored)
+			}
+			err := insertUnordered(t, openingIndex, stored, openingMovements(p))
+			var bulk mongo.BulkWriteException
+			if !errors.As(err, &bulk) || len(bulk.WriteErrors) != len(first) {
+				t.Fatalf("second replica: err = %v, want every opening to collide", err)
+			}
+			if !onlyDuplicates(err) {
+				t.Errorf("second replica's collisions are not taken as opened")
+			}
+
+			// other movements of the same location are not limited
+			receipt := entity.StockMovement{ProductID: p.ID, Reason: entity.MovementReceipt, Delta: 1}
+			if _, ok := indexKey(t, openingIndex, receipt); ok {
+				t.Errorf("openingIndex covers %s movements", receipt.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort field")
+)
+
+// productSortFields maps the public sort names onto document fields. Every
+// sort is made total by _id as a tie breaker, which is what keyset cursors
+// rely on.
+var productSortFields = map[string]string{
+	entity.ProductSortID:    "_id",
+	entity.ProductSortName:  "name",
+	entity.ProductSortPrice: "price.amount",
+	entity.ProductSortStock: "stock",
+}
+
+// productCursor is the position after the last item of a page. Sort and Desc
+// are echoed so a cursor cannot be replayed against a different ordering.
+type productCursor struct {
+	Sort  string      `json:"s"`
+	Desc  bool        `json:"d,omitempty"`
+	Value interface{} `json:"v,omitempty"`
+	ID    string      `json:"id"`
+}
+
+func encodeProductCursor(c productCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeProductCursor(s string) (productCursor, error) {
+	var c productCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	// numbers come back as json.Number; turn them into the stored type
+	if n, ok := c.Value.(json.Number); ok {
+		v, err := n.Int64()
+		if err != nil {
+			return c, ErrInvalidCursor
+		}
+		c.Value = v
+	}
+	return c, nil
+}
+
+// productFilterQuery builds the match for filter, without the cursor.
+func productFilterQuery(filter entity.ProductFilter) bson.M {
+	f := bson.M{}
+	if filter.NamePrefix != "" {
+		// anchored and case-sensitive so the name index can serve it
+		f["name"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(filter.NamePrefix)}
+	}
+	if filter.Categories != nil {
+		f["category"] = bson.M{"$in": filter.Categories}
+	}
+	if filter.Currency != "" {
+		f["price.currency"] = filter.Currency
+	}
+	if filter.MinPrice != nil || filter.MaxPrice != nil {
+		price := bson.M{}
+		if filter.MinPrice != nil {
+			price["$gte"] = *filter.MinPrice
+		}
+		if filter.MaxPrice != nil {
+			price["$lte"] = *filter.MaxPrice
+		}
+		f["price.amount"] = price
+	}
+	if filter.InStockOnly {
+		// the stock bound lets an index narrow the scan before the $expr
+		f["stock"] = bson.M{"$gt": 0}
+		f["$expr"] = bson.M{"$gt": bson.A{
+			bson.M{"$subtract": bson.A{"$stock", bson.M{"$ifNull": bson.A{"$reserved", 0}}}},
+			0,
+		}}
+	}
+	return f
+}
+
+// productSeekQuery matches the documents that sort after cursor.
+func productSeekQuery(field string, desc bool, cursor productCursor) (bson.M, error) {
+	id, err := primitive.ObjectIDFromHex(cursor.ID)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	op := "$gt"
+	if desc {
+		op = "$lt"
+	}
+	if field == "_id" {
+		return bson.M{"_id": bson.M{op: id}}, nil
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: cursor.Value}},
+		bson.M{field: cursor.Value, "_id": bson.M{op: id}},
+	}}, nil
+}
+
+// productSortValue reads the value of the sort field from p for a cursor.
+func productSortValue(sort string, p entity.Product) interface{} {
+	switch sort {
+	case entity.ProductSortName:
+		return p.Name
+	case entity.ProductSortPrice:
+		return p.Price.Amount
+	case entity.ProductSortStock:
+		return int64(p.Stock)
+	default:
+		return nil
+	}
+}
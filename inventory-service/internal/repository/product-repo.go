@@ -2,37 +2,93 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ProductRepository interface {
+	EnsureIndexes(ctx context.Context) error
 	Create(ctx context.Context, product *entity.Product) error
 	GetByID(ctx context.Context, id string) (*entity.Product, error)
-	Update(ctx context.Context, id string, product *entity.Product) error
-	Delete(ctx context.Context, id string) error
-	List(ctx context.Context) ([]entity.Product, error)
+	Patch(ctx context.Context, id string, patch entity.ProductPatch, version int64) (*entity.Product, error)
+	Delete(ctx context.Context, id string, version int64) error
+	List(ctx context.Context, filter entity.ProductFilter) (*entity.ProductPage, error)
+	GetByIDs(ctx context.Context, ids []primitive.ObjectID) ([]entity.Product, error)
+	Reserve(ctx context.Context, items []entity.ReserveItem, alloc entity.Allocator) ([]entity.ReserveFailure, error)
 }
 
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrVersionConflict = errors.New("version mismatch")
+)
+
+// errAbortReserve rolls back the reservation transaction once a shortfall is found.
+var errAbortReserve = errors.New("reservation aborted")
+
 type productRepository struct {
-	col *mongo.Collection
+	db     *mongo.Database
+	col    *mongo.Collection
+	ledger stockLedger
 }
 
 func NewProductRepository(db *mongo.Database) ProductRepository {
 	return &productRepository{
-		col: db.Collection("products"),
+		db:     db,
+		col:    db.Collection("products"),
+		ledger: newStockLedger(db),
 	}
 }
 
+// EnsureIndexes creates the indexes backing ListProducts filters and sorts.
+// Each sort index ends in _id to match the cursor's tie breaker.
+func (r *productRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	_, err := r.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "price.amount", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "stock", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "category", Value: 1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+	return err
+}
+
+// Create inserts product and records the initial stock of each of its
+// locations as a receipt.
 func (r *productRepository) Create(ctx context.Context, product *entity.Product) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	_, err := r.col.InsertOne(ctx, product)
-	return err
+	product.ID = primitive.NewObjectID()
+	product.Version = 1
+	return withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		if _, err := r.col.InsertOne(sc, product); err != nil {
+			return err
+		}
+		// balances run up location by location
+		snapshot := *product
+		snapshot.Stock = 0
+		for _, l := range product.Locations {
+			if l.Stock == 0 {
+				continue
+			}
+			snapshot.Stock += l.Stock
+			if err := r.ledger.record(sc, &snapshot, &entity.StockMovement{
+				Reason:      entity.MovementReceipt,
+				WarehouseID: l.WarehouseID,
+				Delta:       l.Stock,
+				Note:        "initial stock",
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (r *productRepository) GetByID(ctx context.Context, id string) (*entity.Product, error) {
@@ -40,51 +96,344 @@ func (r *productRepository) GetByID(ctx context.Context, id string) (*entity.Pro
 	defer cancel()
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return nil, ErrProductNotFound
 	}
 	var product entity.Product
 	err = r.col.FindOne(ctx, bson.M{"_id": objID}).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrProductNotFound
+	}
 	return &product, err
 }
 
-func (r *productRepository) Update(ctx context.Context, id string, product *entity.Product) error {
+// Patch writes only the fields set in patch if the stored version still
+// equals version, bumps the version and returns the stored result. A stock
+// decrease also requires enough unreserved stock to remain. Stock changes are
+// recorded as adjustments at the default warehouse.
+func (r *productRepository) Patch(ctx context.Context, id string, patch entity.ProductPatch, version int64) (*entity.Product, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
+		return nil, ErrProductNotFound
+	}
+
+	set := bson.M{}
+	if patch.Name != nil {
+		set["name"] = *patch.Name
+	}
+	if patch.Category != nil {
+		set["category"] = *patch.Category
+	}
+	if patch.Price != nil {
+		set["price"] = *patch.Price
+	}
+	filter := versionFilter(objID, version)
+	if patch.StockDelta < 0 {
+		filter["$expr"] = availableAtLeast(-patch.StockDelta)
+	}
+
+	var updated *entity.Product
+	err = withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		update := bson.M{"$inc": bson.M{"version": 1}}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		var m *entity.StockMovement
+		if patch.StockDelta != 0 {
+			m = &entity.StockMovement{
+				Reason:      entity.MovementAdjustment,
+				WarehouseID: entity.DefaultWarehouseID,
+				Delta:       patch.StockDelta,
+				Note:        "product edit",
+			}
+		}
+		var err error
+		updated, err = r.ledger.apply(sc, filter, update, m)
+		if err == mongo.ErrNoDocuments {
+			return r.missOrConflict(sc, objID)
+		}
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	_, err = r.col.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": product})
-	return err
+	return updated, nil
 }
 
-func (r *productRepository) Delete(ctx context.Context, id string) error {
+func (r *productRepository) Delete(ctx context.Context, id string, version int64) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrProductNotFound
+	}
+	res, err := r.col.DeleteOne(ctx, versionFilter(objID, version))
 	if err != nil {
 		return err
 	}
-	_, err = r.col.DeleteOne(ctx, bson.M{"_id": objID})
-	return err
+	if res.DeletedCount == 0 {
+		return r.missOrConflict(ctx, objID)
+	}
+	return nil
 }
 
-func (r *productRepository) List(ctx context.Context) ([]entity.Product, error) {
+// versionFilter matches the product at the given version. Products written
+// before versioning have no version field and count as version 0.
+func versionFilter(objID primitive.ObjectID, version int64) bson.M {
+	switch version {
+	case entity.AnyVersion:
+		return bson.M{"_id": objID}
+	case 0:
+		return bson.M{"_id": objID, "$or": bson.A{
+			bson.M{"version": 0},
+			bson.M{"version": bson.M{"$exists": false}},
+		}}
+	default:
+		return bson.M{"_id": objID, "version": version}
+	}
+}
+
+// missOrConflict explains why a versioned write matched nothing.
+func (r *productRepository) missOrConflict(ctx context.Context, objID primitive.ObjectID) error {
+	n, err := r.col.CountDocuments(ctx, bson.M{"_id": objID}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrProductNotFound
+	}
+	return ErrVersionConflict
+}
+
+func (r *productRepository) List(ctx context.Context, filter entity.ProductFilter) (*entity.ProductPage, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	cur, err := r.col.Find(ctx, bson.M{})
+
+	sortName := filter.Sort
+	if sortName == "" {
+		sortName = entity.ProductSortID
+	}
+	field, ok := productSortFields[sortName]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	dir := 1
+	if filter.Desc {
+		dir = -1
+	}
+
+	match := productFilterQuery(filter)
+	total, err := r.col.CountDocuments(ctx, match)
+	if err != nil {
+		return nil, err
+	}
+
+	query := match
+	if filter.Cursor != "" {
+		cursor, err := decodeProductCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != sortName || cursor.Desc != filter.Desc {
+			return nil, ErrInvalidCursor
+		}
+		seek, err := productSeekQuery(field, filter.Desc, cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = bson.M{"$and": bson.A{match, seek}}
+	}
+
+	sort := bson.D{{Key: field, Value: dir}}
+	if field != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: dir})
+	}
+	// one extra document tells whether there is a next page
+	opts := options.Find().SetSort(sort).SetLimit(filter.Limit + 1)
+	cur, err := r.col.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	products := []entity.Product{}
+	if err := cur.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	page := &entity.ProductPage{Items: products, Total: total}
+	if int64(len(products)) > filter.Limit {
+		page.Items = products[:filter.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = encodeProductCursor(productCursor{
+			Sort:  sortName,
+			Desc:  filter.Desc,
+			Value: productSortValue(sortName, last),
+			ID:    last.ID.Hex(),
+		})
+	}
+	return page, nil
+}
+
+func (r *productRepository) GetByIDs(ctx context.Context, ids []primitive.ObjectID) ([]entity.Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	cur, err := r.col.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
 	if err != nil {
 		return nil, err
 	}
 	defer cur.Close(ctx)
 
 	var products []entity.Product
-	for cur.Next(ctx) {
+	if err := cur.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// Reserve decrements stock for every item inside a single transaction,
+// taking it from the warehouses alloc picks. If any item is missing or short,
+// nothing is written and the failures are returned.
+func (r *productRepository) Reserve(ctx context.Context, items []entity.ReserveItem, alloc entity.Allocator) ([]entity.ReserveFailure, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var failures []entity.ReserveFailure
+	err := withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		var allocations []entity.Allocation
+		var err error
+		allocations, failures, err = allocateItems(items, alloc, findProduct(sc, r.col))
+		if err != nil {
+			return err
+		}
+		if len(failures) > 0 {
+			return errAbortReserve
+		}
+		for _, a := range allocations {
+			if err := applyAllocation(sc, r.ledger, a, entity.StockMovement{
+				Reason: entity.MovementSale,
+				Delta:  -a.Quantity,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errAbortReserve) {
+		return failures, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// productLoader returns the product with id, or mongo.ErrNoDocuments.
+type productLoader func(id primitive.ObjectID) (*entity.Product, error)
+
+// findProduct loads products from col.
+func findProduct(ctx context.Context, col *mongo.Collection) productLoader {
+	return func(id primitive.ObjectID) (*entity.Product, error) {
 		var p entity.Product
-		if err := cur.Decode(&p); err != nil {
+		if err := col.FindOne(ctx, bson.M{"_id": id}).Decode(&p); err != nil {
 			return nil, err
 		}
-		products = append(products, p)
+		return &p, nil
 	}
-	return products, nil
+}
+
+// allocateItems loads every product referenced by items and splits each item
+// across warehouses with alloc, reporting the items that cannot be covered
+// from available stock. Items of the same product see what earlier ones took.
+func allocateItems(items []entity.ReserveItem, alloc entity.Allocator, load productLoader) ([]entity.Allocation, []entity.ReserveFailure, error) {
+	var allocations []entity.Allocation
+	var failures []entity.ReserveFailure
+	products := make(map[primitive.ObjectID]*entity.Product)
+	for _, it := range items {
+		fail := func(reason string, available int) {
+			failures = append(failures, entity.ReserveFailure{ProductID: it.ProductID, Requested: it.Quantity, Available: available, Reason: reason})
+		}
+		objID, err := primitive.ObjectIDFromHex(it.ProductID)
+		if err != nil {
+			fail("invalid product id", 0)
+			continue
+		}
+		var pinned primitive.ObjectID
+		if it.WarehouseID != "" {
+			if pinned, err = primitive.ObjectIDFromHex(it.WarehouseID); err != nil || !containsObjectID(alloc.Order, pinned) {
+				fail("warehouse unavailable", 0)
+				continue
+			}
+		}
+		p, ok := products[objID]
+		if !ok {
+			p, err = load(objID)
+			if err == mongo.ErrNoDocuments {
+				fail("product not found", 0)
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			products[objID] = p
+		}
+		picked := alloc.Allocate(p, it.Quantity, pinned)
+		if picked == nil {
+			fail("insufficient stock", alloc.Available(p, pinned))
+			continue
+		}
+		for _, a := range picked {
+			for i := range p.Locations {
+				if p.Locations[i].WarehouseID == a.WarehouseID {
+					p.Locations[i].Reserved += a.Quantity
+				}
+			}
+		}
+		allocations = append(allocations, picked...)
+	}
+	return allocations, failures, nil
+}
+
+// applyAllocation applies m, built for a, to a's product and warehouse. The
+// caller's transaction read the stock a was computed from, so a miss means
+// it changed underneath and the transaction must not commit.
+func applyAllocation(sc mongo.SessionContext, ledger stockLedger, a entity.Allocation, m entity.StockMovement) error {
+	filter, err := allocationMovement(a, &m)
+	if err != nil {
+		return err
+	}
+	_, err = ledger.apply(sc, filter, bson.M{}, &m)
+	if err == mongo.ErrNoDocuments {
+		return errors.New("stock changed during reservation")
+	}
+	return err
+}
+
+// allocationMovement points m at a's warehouse and returns the filter of
+// a's product.
+func allocationMovement(a entity.Allocation, m *entity.StockMovement) (bson.M, error) {
+	productID, err := primitive.ObjectIDFromHex(a.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	m.WarehouseID = a.WarehouseID
+	return bson.M{"_id": productID}, nil
+}
+
+func containsObjectID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// availableAtLeast is an $expr matching products whose stock minus reserved
+// covers qty. Documents written before holds existed have no reserved field.
+func availableAtLeast(qty int) bson.M {
+	return bson.M{"$gte": bson.A{
+		bson.M{"$subtract": bson.A{"$stock", bson.M{"$ifNull": bson.A{"$reserved", 0}}}},
+		qty,
+	}}
 }
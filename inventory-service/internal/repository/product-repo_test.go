@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	whA      = primitive.ObjectID{1}
+	whB      = primitive.ObjectID{2}
+	whClosed = primitive.ObjectID{3}
+	widget   = primitive.ObjectID{10}
+	gadget   = primitive.ObjectID{11}
+	missing  = primitive.ObjectID{12}
+)
+
+// catalog serves copies of its products, as the database would, and counts
+// the loads.
+type catalog struct {
+	products map[primitive.ObjectID]entity.Product
+	loads    int
+	err      error
+}
+
+func (c *catalog) load(id primitive.ObjectID) (*entity.Product, error) {
+	c.loads++
+	if c.err != nil {
+		return nil, c.err
+	}
+	p, ok := c.products[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	p.Locations = append([]entity.StockLocation(nil), p.Locations...)
+	return &p, nil
+}
+
+func newCatalog() *catalog {
+	return &catalog{products: map[primitive.ObjectID]entity.Product{
+		widget: {ID: widget, Locations: []entity.StockLocation{
+			{WarehouseID: whA, Stock: 3},
+			{WarehouseID: whB, Stock: 5, Reserved: 1},
+			{WarehouseID: whClosed, Stock: 50},
+		}},
+		gadget: {ID: gadget, Locations: []entity.StockLocation{
+			{WarehouseID: whB, Stock: 2},
+		}},
+	}}
+}
+
+func TestAllocateItems(t *testing.T) {
+	take := func(p, w primitive.ObjectID, n int) entity.Allocation {
+		return entity.Allocation{ProductID: p.Hex(), WarehouseID: w, Quantity: n}
+	}
+	short := func(p primitive.ObjectID, requested, available int, reason string) entity.ReserveFailure {
+		return entity.ReserveFailure{ProductID: p.Hex(), Requested: requested, Available: available, Reason: reason}
+	}
+	item := func(p primitive.ObjectID, n int) entity.ReserveItem {
+		return entity.ReserveItem{ProductID: p.Hex(), Quantity: n}
+	}
+	pinned := func(p, w primitive.ObjectID, n int) entity.ReserveItem {
+		return entity.ReserveItem{ProductID: p.Hex(), Quantity: n, WarehouseID: w.Hex()}
+	}
+	tests := []struct {
+		name  string
+		rule  entity.AllocationRule
+		items []entity.ReserveItem
+		want  []entity.Allocation
+		fails []entity.ReserveFailure
+	}{
+		{"priority covers from the first warehouse", entity.AllocatePriority,
+			[]entity.ReserveItem{item(widget, 2), item(gadget, 2)},
+			[]entity.Allocation{take(widget, whA, 2), take(gadget, whB, 2)}, nil},
+		{"priority splits", entity.AllocatePriority,
+			[]entity.ReserveItem{item(widget, 6)},
+			[]entity.Allocation{take(widget, whA, 3), take(widget, whB, 3)}, nil},
+		{"most available", entity.AllocateMostAvailable,
+			[]entity.ReserveItem{item(widget, 4)},
+			[]entity.Allocation{take(widget, whB, 4)}, nil},
+		{"most available splits", entity.AllocateMostAvailable,
+			[]entity.ReserveItem{item(widget, 6)},
+			[]entity.Allocation{take(widget, whB, 4), take(widget, whA, 2)}, nil},
+		{"single", entity.AllocateSingle,
+			[]entity.ReserveItem{item(widget, 4)},
+			[]entity.Allocation{take(widget, whB, 4)}, nil},
+		{"single will not split", entity.AllocateSingle,
+			[]entity.ReserveItem{item(widget, 5)},
+			nil, []entity.ReserveFailure{short(widget, 5, 7, "insufficient stock")}},
+		{"shortfall reports what the active warehouses have", entity.AllocatePriority,
+			[]entity.ReserveItem{item(widget, 8)},
+			nil, []entity.ReserveFailure{short(widget, 8, 7, "insufficient stock")}},
+		{"later items see what earlier ones took", entity.AllocatePriority,
+			[]entity.ReserveItem{item(widget, 5), item(widget, 2), item(widget, 1)},
+			[]entity.Allocation{take(widget, whA, 3), take(widget, whB, 2), take(widget, whB, 2)},
+			[]entity.ReserveFailure{short(widget, 1, 0, "insufficient stock")}},
+		{"pinned", entity.AllocatePriority,
+			[]entity.ReserveItem{pinned(widget, whB, 3)},
+			[]entity.Allocation{take(widget, whB, 3)}, nil},
+		{"pinned shortfall", entity.AllocatePriority,
+			[]entity.ReserveItem{pinned(widget, whA, 4)},
+			nil, []entity.ReserveFailure{short(widget, 4, 3, "insufficient stock")}},
+		{"pinned to an inactive warehouse", entity.AllocatePriority,
+			[]entity.ReserveItem{pinned(widget, whClosed, 1)},
+			nil, []entity.ReserveFailure{short(widget, 1, 0, "warehouse unavailable")}},
+		{"pinned to a bad warehouse id", entity.AllocatePriority,
+			[]entity.ReserveItem{{ProductID: widget.Hex(), Quantity: 1, WarehouseID: "nope"}},
+			nil, []entity.ReserveFailure{short(widget, 1, 0, "warehouse unavailable")}},
+		{"unknown and invalid products", entity.AllocatePriority,
+			[]entity.ReserveItem{item(missing, 1), {ProductID: "nope", Quantity: 1}, item(gadget, 1)},
+			[]entity.Allocation{take(gadget, whB, 1)},
+			[]entity.ReserveFailure{short(missing, 1, 0, "product not found"), {ProductID: "nope", Requested: 1, Reason: "invalid product id"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCatalog()
+			alloc := entity.Allocator{Rule: tt.rule, Order: []primitive.ObjectID{whA, whB}}
+			got, fails, err := allocateItems(tt.items, alloc, c.load)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocations = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(fails, tt.fails) {
+				t.Errorf("failures = %+v, want %+v", fails, tt.fails)
+			}
+		})
+	}
+}
+
+func TestAllocateItemsLoadsEachProductOnce(t *testing.T) {
+	c := newCatalog()
+	alloc := entity.Allocator{Rule: entity.AllocatePriority, Order: []primitive.ObjectID{whA, whB}}
+	items := []entity.ReserveItem{{ProductID: widget.Hex(), Quantity: 1}, {ProductID: widget.Hex(), Quantity: 1}}
+	if _, _, err := allocateItems(items, alloc, c.load); err != nil {
+		t.Fatal(err)
+	}
+	if c.loads != 1 {
+		t.Errorf("loaded %d times, want 1", c.loads)
+	}
+}
+
+func TestAllocateItemsStopsOnLoadError(t *testing.T) {
+	c := newCatalog()
+	c.err = errors.New("connection reset")
+	alloc := entity.Allocator{Rule: entity.AllocatePriority, Order: []primitive.ObjectID{whA}}
+	_, _, err := allocateItems([]entity.ReserveItem{{ProductID: widget.Hex(), Quantity: 1}}, alloc, c.load)
+	if !errors.Is(err, c.err) {
+		t.Errorf("err = %v, want the load error", err)
+	}
+}
+
+// TestAllocationWrites checks the product update applyAllocation hands the
+// ledger for each movement a reservation makes.
+func TestAllocationWrites(t *testing.T) {
+	a := entity.Allocation{ProductID: widget.Hex(), WarehouseID: whB, Quantity: 3}
+	tests := []struct {
+		name    string
+		m       entity.StockMovement
+		wantInc bson.M
+		guard   bool // whether the location must keep the quantity available
+	}{
+		{"hold", entity.StockMovement{Reason: entity.MovementReservation, ReservedDelta: 3},
+			bson.M{"reserved": 3, "locations.$[loc].reserved": 3}, true},
+		{"release", entity.StockMovement{ReservedDelta: -3},
+			bson.M{"reserved": -3, "locations.$[loc].reserved": -3}, false},
+		{"commit", entity.StockMovement{Delta: -3, ReservedDelta: -3},
+			bson.M{"stock": -3, "reserved": -3, "locations.$[loc].stock": -3, "locations.$[loc].reserved": -3}, false},
+		{"direct sale", entity.StockMovement{Delta: -3},
+			bson.M{"stock": -3, "locations.$[loc].stock": -3}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.m
+			filter, err := allocationMovement(a, &m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.WarehouseID != whB {
+				t.Errorf("movement warehouse = %v, want the allocation's", m.WarehouseID)
+			}
+			if !movesLocation(&m) {
+				t.Error("the location would not be created before the write")
+			}
+			f, update, opts := ledgerUpdate(filter, bson.M{}, &m)
+			if f["_id"] != widget {
+				t.Errorf("filter = %v, want the allocation's product", f)
+			}
+			if !reflect.DeepEqual(update, bson.M{"$inc": tt.wantInc}) {
+				t.Errorf("update = %v, want $inc %v", update, tt.wantInc)
+			}
+			wantFilters := &options.ArrayFilters{Filters: []interface{}{bson.M{"loc.warehouse_id": whB}}}
+			if !reflect.DeepEqual(opts.ArrayFilters, wantFilters) {
+				t.Errorf("array filters = %+v, want %+v", opts.ArrayFilters, wantFilters)
+			}
+			expr, guarded := f["$expr"]
+			if guarded != tt.guard {
+				t.Fatalf("filter = %v, guarded %v, want %v", f, guarded, tt.guard)
+			}
+			if guarded && !reflect.DeepEqual(expr, locationAvailableAtLeast(whB, 3)) {
+				t.Errorf("guard = %v", expr)
+			}
+			if _, ok := filter["$expr"]; ok {
+				t.Error("ledgerUpdate changed the caller's filter")
+			}
+		})
+	}
+}
+
+func TestAllocationMovementRejectsBadProduct(t *testing.T) {
+	var m entity.StockMovement
+	if _, err := allocationMovement(entity.Allocation{ProductID: "nope", WarehouseID: whA, Quantity: 1}, &m); err == nil {
+		t.Error("want an error for a bad product id")
+	}
+}
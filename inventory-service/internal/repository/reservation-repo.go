@@ -0,0 +1,446 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrReservationClosed   = errors.New("reservation is no longer held")
+	ErrOverReturn          = errors.New("return exceeds what was committed")
+)
+
+type ReservationRepository interface {
+	EnsureIndexes(ctx context.Context) error
+	Create(ctx context.Context, res *entity.Reservation, alloc entity.Allocator) ([]entity.ReserveFailure, error)
+	GetByID(ctx context.Context, id string) (*entity.Reservation, error)
+	// ListByReference returns the reservations placed under reference,
+	// oldest first.
+	ListByReference(ctx context.Context, reference string) ([]entity.Reservation, error)
+	Amend(ctx context.Context, id string, items []entity.ReserveItem, alloc entity.Allocator) (*entity.Reservation, []entity.ReserveFailure, error)
+	Commit(ctx context.Context, id string) (*entity.Reservation, error)
+	Release(ctx context.Context, id string, final entity.ReservationStatus) (*entity.Reservation, error)
+	// Return gives back items of a committed reservation; nil items give
+	// back everything not returned yet.
+	Return(ctx context.Context, id, reference string, items []entity.ReturnItem) (*entity.Reservation, error)
+	ListExpired(ctx context.Context, now time.Time, limit int64) ([]entity.Reservation, error)
+}
+
+type reservationRepository struct {
+	db       *mongo.Database
+	col      *mongo.Collection
+	products *mongo.Collection
+	ledger   stockLedger
+}
+
+func NewReservationRepository(db *mongo.Database) ReservationRepository {
+	return &reservationRepository{
+		db:       db,
+		col:      db.Collection("reservations"),
+		products: db.Collection("products"),
+		ledger:   newStockLedger(db),
+	}
+}
+
+func (r *reservationRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, err := r.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+		{Keys: bson.D{{Key: "reference", Value: 1}}},
+	})
+	return err
+}
+
+// Create places the hold and raises reserved on every product, at the
+// warehouses alloc picks, in one transaction. On shortfall nothing is written
+// and the failures are returned.
+func (r *reservationRepository) Create(ctx context.Context, res *entity.Reservation, alloc entity.Allocator) ([]entity.ReserveFailure, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var failures []entity.ReserveFailure
+	err := withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		var err error
+		res.Allocations, failures, err = allocateItems(res.Items, alloc, findProduct(sc, r.products))
+		if err != nil {
+			return err
+		}
+		if len(failures) > 0 {
+			return errAbortReserve
+		}
+		res.ID = primitive.NewObjectID()
+		for _, a := range res.Allocations {
+			if err := applyAllocation(sc, r.ledger, a, entity.StockMovement{
+				Reason:        entity.MovementReservation,
+				Reference:     res.ID.Hex(),
+				ReservedDelta: a.Quantity,
+			}); err != nil {
+				return err
+			}
+		}
+		_, err = r.col.InsertOne(sc, res)
+		return err
+	})
+	if errors.Is(err, errAbortReserve) {
+		return failures, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (r *reservationRepository) GetByID(ctx context.Context, id string) (*entity.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrReservationNotFound
+	}
+	var res entity.Reservation
+	if err := r.col.FindOne(ctx, bson.M{"_id": objID}).Decode(&res); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrReservationNotFound
+		}
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (r *reservationRepository) ListByReference(ctx context.Context, reference string) ([]entity.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	cur, err := r.col.Find(ctx, bson.M{"reference": reference}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []entity.Reservation{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Amend replaces the items of a held reservation in one transaction: its
+// holds are released and the new items allocated as on Create, so stock the
+// reservation already holds counts as available to it. On shortfall nothing
+// changes and the failures are returned.
+func (r *reservationRepository) Amend(ctx context.Context, id string, items []entity.ReserveItem, alloc entity.Allocator) (*entity.Reservation, []entity.ReserveFailure, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil, ErrReservationNotFound
+	}
+
+	var res entity.Reservation
+	var failures []entity.ReserveFailure
+	err = withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		res = entity.Reservation{}
+		if err := r.col.FindOne(sc, bson.M{"_id": objID}).Decode(&res); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrReservationNotFound
+			}
+			return err
+		}
+		if res.Status != entity.ReservationHeld {
+			return ErrReservationClosed
+		}
+		for _, a := range heldAllocations(&res) {
+			productID, err := primitive.ObjectIDFromHex(a.ProductID)
+			if err != nil {
+				return err
+			}
+			_, err = r.ledger.apply(sc, bson.M{"_id": productID}, bson.M{}, &entity.StockMovement{
+				Reason:        entity.MovementRelease,
+				WarehouseID:   a.WarehouseID,
+				Reference:     res.ID.Hex(),
+				Note:          "amended",
+				ReservedDelta: -a.Quantity,
+			})
+			if err != nil && err != mongo.ErrNoDocuments {
+				return err
+			}
+		}
+
+		var err error
+		res.Allocations, failures, err = allocateItems(items, alloc, findProduct(sc, r.products))
+		if err != nil {
+			return err
+		}
+		if len(failures) > 0 {
+			return errAbortReserve
+		}
+		for _, a := range res.Allocations {
+			if err := applyAllocation(sc, r.ledger, a, entity.StockMovement{
+				Reason:        entity.MovementReservation,
+				Reference:     res.ID.Hex(),
+				ReservedDelta: a.Quantity,
+			}); err != nil {
+				return err
+			}
+		}
+		res.Items = items
+		res.UpdatedAt = time.Now().UTC()
+		_, err = r.col.ReplaceOne(sc, bson.M{"_id": objID}, &res)
+		return err
+	})
+	if errors.Is(err, errAbortReserve) {
+		return nil, failures, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &res, nil, nil
+}
+
+// Commit turns a held reservation into a permanent decrement of on-hand stock.
+// Committing an already committed reservation is a no-op.
+func (r *reservationRepository) Commit(ctx context.Context, id string) (*entity.Reservation, error) {
+	return r.close(ctx, id, entity.ReservationCommitted, func(qty int) entity.StockMovement {
+		return entity.StockMovement{Reason: entity.MovementSale, Delta: -qty, ReservedDelta: -qty}
+	})
+}
+
+// Release returns held quantities to available stock and marks the
+// reservation with final (released or expired). Releasing a reservation that
+// was already released or expired is a no-op.
+func (r *reservationRepository) Release(ctx context.Context, id string, final entity.ReservationStatus) (*entity.Reservation, error) {
+	return r.close(ctx, id, final, func(qty int) entity.StockMovement {
+		return entity.StockMovement{Reason: entity.MovementRelease, ReservedDelta: -qty, Note: string(final)}
+	})
+}
+
+// Return puts quantities of a committed reservation back on hand at the
+// warehouses they were sold from, as when a paid order is cancelled or
+// refunded. The reservation reads as returned once nothing is left. Returning
+// a returned reservation in full, or repeating a reference, is a no-op.
+func (r *reservationRepository) Return(ctx context.Context, id, reference string, items []entity.ReturnItem) (*entity.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrReservationNotFound
+	}
+
+	var res entity.Reservation
+	err = withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		res = entity.Reservation{}
+		if err := r.col.FindOne(sc, bson.M{"_id": objID}).Decode(&res); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrReservationNotFound
+			}
+			return err
+		}
+		if reference != "" && res.Returned(reference) {
+			return nil
+		}
+		switch res.Status {
+		case entity.ReservationCommitted:
+		case entity.ReservationReturned:
+			if items == nil {
+				return nil
+			}
+			return ErrOverReturn
+		default:
+			return ErrReservationClosed
+		}
+
+		left, give, err := returnAllocations(&res, items)
+		if err != nil {
+			return err
+		}
+		for _, a := range give {
+			productID, err := primitive.ObjectIDFromHex(a.ProductID)
+			if err != nil {
+				return err
+			}
+			// a product deleted since the sale has nothing left to update
+			_, err = r.ledger.apply(sc, bson.M{"_id": productID}, bson.M{}, &entity.StockMovement{
+				Reason:      entity.MovementReturn,
+				WarehouseID: a.WarehouseID,
+				Reference:   res.ID.Hex(),
+				Note:        reference,
+				Delta:       a.Quantity,
+			})
+			if err != nil && err != mongo.ErrNoDocuments {
+				return err
+			}
+		}
+
+		now := time.Now().UTC()
+		res.Returns = append(res.Returns, entity.ReservationReturn{Reference: reference, Allocations: give, CreatedAt: now})
+		if left == 0 {
+			res.Status = entity.ReservationReturned
+		}
+		res.UpdatedAt = now
+		_, err = r.col.ReplaceOne(sc, bson.M{"_id": objID}, &res)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// returnAllocations splits items over the warehouses res was sold from, net
+// of earlier returns, and reports how much is left to return afterwards. Nil
+// items take everything not returned yet.
+func returnAllocations(res *entity.Reservation, items []entity.ReturnItem) (int, []entity.Allocation, error) {
+	type key struct {
+		productID   string
+		warehouseID primitive.ObjectID
+	}
+	returned := make(map[key]int)
+	for _, ret := range res.Returns {
+		for _, a := range ret.Allocations {
+			returned[key{a.ProductID, a.WarehouseID}] += a.Quantity
+		}
+	}
+	var open []entity.Allocation
+	remaining := 0
+	for _, a := range heldAllocations(res) {
+		k := key{a.ProductID, a.WarehouseID}
+		done := min(returned[k], a.Quantity)
+		returned[k] -= done
+		if a.Quantity > done {
+			a.Quantity -= done
+			open = append(open, a)
+			remaining += a.Quantity
+		}
+	}
+	if items == nil {
+		return 0, open, nil
+	}
+
+	want := make(map[string]int, len(items))
+	for _, it := range items {
+		want[it.ProductID] += it.Quantity
+	}
+	var give []entity.Allocation
+	for _, a := range open {
+		if q := min(want[a.ProductID], a.Quantity); q > 0 {
+			want[a.ProductID] -= q
+			remaining -= q
+			a.Quantity = q
+			give = append(give, a)
+		}
+	}
+	for productID, q := range want {
+		if q > 0 {
+			return 0, nil, fmt.Errorf("%w: %d more of product %s than is left", ErrOverReturn, q, productID)
+		}
+	}
+	return remaining, give, nil
+}
+
+// close moves a held reservation to final and, in the same transaction,
+// applies the movement built by movement to every item's product.
+func (r *reservationRepository) close(ctx context.Context, id string, final entity.ReservationStatus, movement func(qty int) entity.StockMovement) (*entity.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrReservationNotFound
+	}
+
+	var res entity.Reservation
+	err = withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err := r.col.FindOneAndUpdate(sc,
+			bson.M{"_id": objID, "status": entity.ReservationHeld},
+			bson.M{"$set": bson.M{"status": final, "updated_at": time.Now().UTC()}},
+			opts,
+		).Decode(&res)
+		if err == mongo.ErrNoDocuments {
+			return r.checkClosed(sc, objID, final, &res)
+		}
+		if err != nil {
+			return err
+		}
+		for _, a := range heldAllocations(&res) {
+			productID, err := primitive.ObjectIDFromHex(a.ProductID)
+			if err != nil {
+				return err
+			}
+			m := movement(a.Quantity)
+			m.WarehouseID = a.WarehouseID
+			m.Reference = res.ID.Hex()
+			// a product deleted while held has nothing left to update
+			_, err = r.ledger.apply(sc, bson.M{"_id": productID}, bson.M{}, &m)
+			if err != nil && err != mongo.ErrNoDocuments {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// heldAllocations returns where res holds stock. Holds placed before
+// warehouses existed are at the default warehouse, where the migration put
+// their products' reserved quantities.
+func heldAllocations(res *entity.Reservation) []entity.Allocation {
+	if len(res.Allocations) > 0 {
+		return res.Allocations
+	}
+	out := make([]entity.Allocation, 0, len(res.Items))
+	for _, it := range res.Items {
+		out = append(out, entity.Allocation{ProductID: it.ProductID, WarehouseID: entity.DefaultWarehouseID, Quantity: it.Quantity})
+	}
+	return out
+}
+
+// checkClosed decides what a failed held->final transition means: not found,
+// a repeat of the same request, or a conflicting one.
+func (r *reservationRepository) checkClosed(sc mongo.SessionContext, objID primitive.ObjectID, final entity.ReservationStatus, res *entity.Reservation) error {
+	if err := r.col.FindOne(sc, bson.M{"_id": objID}).Decode(res); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrReservationNotFound
+		}
+		return err
+	}
+	switch {
+	case res.Status == final:
+		return nil
+	case final != entity.ReservationCommitted && res.Status != entity.ReservationCommitted:
+		// released and expired both mean the stock is already back
+		return nil
+	default:
+		return ErrReservationClosed
+	}
+}
+
+func (r *reservationRepository) ListExpired(ctx context.Context, now time.Time, limit int64) ([]entity.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	opts := options.Find().SetLimit(limit).SetSort(bson.D{{Key: "expires_at", Value: 1}})
+	cur, err := r.col.Find(ctx, bson.M{
+		"status":     entity.ReservationHeld,
+		"expires_at": bson.M{"$lte": now},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []entity.Reservation
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+)
+
+func TestHeldAllocations(t *testing.T) {
+	placed := &entity.Reservation{
+		Items:       []entity.ReserveItem{{ProductID: widget.Hex(), Quantity: 4}},
+		Allocations: []entity.Allocation{{ProductID: widget.Hex(), WarehouseID: whA, Quantity: 3}, {ProductID: widget.Hex(), WarehouseID: whB, Quantity: 1}},
+	}
+	if got := heldAllocations(placed); !reflect.DeepEqual(got, placed.Allocations) {
+		t.Errorf("heldAllocations = %+v, want its allocations", got)
+	}
+
+	// holds from before warehouses are at the default one
+	legacy := &entity.Reservation{Items: []entity.ReserveItem{{ProductID: widget.Hex(), Quantity: 4}, {ProductID: gadget.Hex(), Quantity: 1}}}
+	want := []entity.Allocation{
+		{ProductID: widget.Hex(), WarehouseID: entity.DefaultWarehouseID, Quantity: 4},
+		{ProductID: gadget.Hex(), WarehouseID: entity.DefaultWarehouseID, Quantity: 1},
+	}
+	if got := heldAllocations(legacy); !reflect.DeepEqual(got, want) {
+		t.Errorf("heldAllocations = %+v, want %+v", got, want)
+	}
+}
+
+func TestReturnAllocations(t *testing.T) {
+	sold := func(returns ...entity.ReservationReturn) *entity.Reservation {
+		return &entity.Reservation{
+			Status: entity.ReservationCommitted,
+			Allocations: []entity.Allocation{
+				{ProductID: widget.Hex(), WarehouseID: whA, Quantity: 3},
+				{ProductID: widget.Hex(), WarehouseID: whB, Quantity: 2},
+				{ProductID: gadget.Hex(), WarehouseID: whB, Quantity: 1},
+			},
+			Returns: returns,
+		}
+	}
+	earlier := entity.ReservationReturn{Reference: "r1", Allocations: []entity.Allocation{{ProductID: widget.Hex(), WarehouseID: whA, Quantity: 2}}}
+
+	tests := []struct {
+		name  string
+		res   *entity.Reservation
+		items []entity.ReturnItem
+		left  int
+		give  []entity.Allocation
+		err   error
+	}{
+		{
+			name: "everything",
+			res:  sold(),
+			give: sold().Allocations,
+		},
+		{
+			name: "everything after a partial return",
+			res:  sold(earlier),
+			give: []entity.Allocation{
+				{ProductID: widget.Hex(), WarehouseID: whA, Quantity: 1},
+				{ProductID: widget.Hex(), WarehouseID: whB, Quantity: 2},
+				{ProductID: gadget.Hex(), WarehouseID: whB, Quantity: 1},
+			},
+		},
+		{
+			name:  "part, spread over the warehouses it was sold from",
+			res:   sold(),
+			items: []entity.ReturnItem{{ProductID: widget.Hex(), Quantity: 4}},
+			left:  2,
+			give: []entity.Allocation{
+				{ProductID: widget.Hex(), WarehouseID: whA, Quantity: 3},
+				{ProductID: widget.Hex(), WarehouseID: whB, Quantity: 1},
+			},
+		},
+		{
+			name:  "the rest",
+			res:   sold(earlier),
+			items: []entity.ReturnItem{{ProductID: widget.Hex(), Quantity: 3}, {ProductID: gadget.Hex(), Quantity: 1}},
+			left:  0,
+			give: []entity.Allocation{
+				{ProductID: widget.Hex(), WarehouseID: whA, Quantity: 1},
+				{ProductID: widget.Hex(), WarehouseID: whB, Quantity: 2},
+				{ProductID: gadget.Hex(), WarehouseID: whB, Quantity: 1},
+			},
+		},
+		{
+			name:  "more than is left",
+			res:   sold(earlier),
+			items: []entity.ReturnItem{{ProductID: widget.Hex(), Quantity: 4}},
+			err:   ErrOverReturn,
+		},
+		{
+			name:  "a product that was not sold",
+			res:   sold(),
+			items: []entity.ReturnItem{{ProductID: missing.Hex(), Quantity: 1}},
+			err:   ErrOverReturn,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left, give, err := returnAllocations(tt.res, tt.items)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if left != tt.left || !reflect.DeepEqual(give, tt.give) {
+				t.Errorf("returnAllocations = %d, %+v, want %d, %+v", left, give, tt.left, tt.give)
+			}
+		})
+	}
+}
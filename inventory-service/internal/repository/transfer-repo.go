@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrTransferNotFound = errors.New("transfer not found")
+	ErrTransferState    = errors.New("transfer is not in a state that allows this")
+	ErrOverReceipt      = errors.New("receipt exceeds the quantity in transit")
+)
+
+type TransferRepository interface {
+	EnsureIndexes(ctx context.Context) error
+	Create(ctx context.Context, t *entity.Transfer) error
+	GetByID(ctx context.Context, id string) (*entity.Transfer, error)
+	List(ctx context.Context, filter entity.TransferFilter) ([]entity.Transfer, error)
+	Cancel(ctx context.Context, id string) (*entity.Transfer, error)
+	Dispatch(ctx context.Context, id string) (*entity.Transfer, error)
+	// Receive books receipt into the destination. A nil receipt receives
+	// everything outstanding.
+	Receive(ctx context.Context, id string, receipt []entity.ReceiptLine) (*entity.Transfer, error)
+}
+
+type transferRepository struct {
+	db     *mongo.Database
+	col    *mongo.Collection
+	ledger stockLedger
+}
+
+func NewTransferRepository(db *mongo.Database) TransferRepository {
+	return &transferRepository{
+		db:     db,
+		col:    db.Collection("transfers"),
+		ledger: newStockLedger(db),
+	}
+}
+
+func (r *transferRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, err := r.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "source_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "destination_id", Value: 1}, {Key: "_id", Value: -1}}},
+	})
+	return err
+}
+
+func (r *transferRepository) Create(ctx context.Context, t *entity.Transfer) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	t.ID = primitive.NewObjectID()
+	_, err := r.col.InsertOne(ctx, t)
+	return err
+}
+
+func (r *transferRepository) GetByID(ctx context.Context, id string) (*entity.Transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrTransferNotFound
+	}
+	var t entity.Transfer
+	if err := r.col.FindOne(ctx, bson.M{"_id": objID}).Decode(&t); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrTransferNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *transferRepository) List(ctx context.Context, filter entity.TransferFilter) ([]entity.Transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	query := bson.M{}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if !filter.WarehouseID.IsZero() {
+		query["$or"] = bson.A{
+			bson.M{"source_id": filter.WarehouseID},
+			bson.M{"destination_id": filter.WarehouseID},
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(filter.Limit)
+	cur, err := r.col.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	transfers := []entity.Transfer{}
+	if err := cur.All(ctx, &transfers); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+// Cancel drops a transfer that has not been dispatched yet.
+func (r *transferRepository) Cancel(ctx context.Context, id string) (*entity.Transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrTransferNotFound
+	}
+	var t entity.Transfer
+	err = r.col.FindOneAndUpdate(ctx,
+		bson.M{"_id": objID, "status": entity.TransferDraft},
+		bson.M{"$set": bson.M{"status": entity.TransferCancelled, "updated_at": time.Now().UTC()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return nil, r.missOrState(ctx, objID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Dispatch takes every line out of the source warehouse and puts the
+// transfer in transit, all in one transaction. A line the source cannot
+// cover fails the whole dispatch.
+func (r *transferRepository) Dispatch(ctx context.Context, id string) (*entity.Transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrTransferNotFound
+	}
+	var t entity.Transfer
+	err = withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		now := time.Now().UTC()
+		err := r.col.FindOneAndUpdate(sc,
+			bson.M{"_id": objID, "status": entity.TransferDraft},
+			bson.M{"$set": bson.M{"status": entity.TransferInTransit, "dispatched_at": now, "updated_at": now}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&t)
+		if err == mongo.ErrNoDocuments {
+			return r.missOrState(sc, objID)
+		}
+		if err != nil {
+			return err
+		}
+		for _, l := range t.Lines {
+			productID, err := primitive.ObjectIDFromHex(l.ProductID)
+			if err != nil {
+				return err
+			}
+			_, err = r.ledger.apply(sc, bson.M{"_id": productID}, bson.M{}, &entity.StockMovement{
+				Reason:      entity.MovementTransferOut,
+				WarehouseID: t.SourceID,
+				Reference:   t.ID.Hex(),
+				Delta:       -l.Quantity,
+			})
+			if err == mongo.ErrNoDocuments {
+				err = r.ledger.missOrShort(sc, productID)
+				return fmt.Errorf("%w: product %s", err, l.ProductID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Receive reads the transfer and books the receipt in one transaction, so
+// two receipts racing for the same line cannot both take its outstanding
+// quantity.
+func (r *transferRepository) Receive(ctx context.Context, id string, receipt []entity.ReceiptLine) (*entity.Transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrTransferNotFound
+	}
+	var t entity.Transfer
+	err = withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		t = entity.Transfer{}
+		if err := r.col.FindOne(sc, bson.M{"_id": objID}).Decode(&t); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrTransferNotFound
+			}
+			return err
+		}
+		if t.Status != entity.TransferInTransit && t.Status != entity.TransferPartiallyReceived {
+			return ErrTransferState
+		}
+
+		arrived, err := receiptQuantities(&t, receipt)
+		if err != nil {
+			return err
+		}
+		done := true
+		for i := range t.Lines {
+			l := &t.Lines[i]
+			if qty := arrived[l.ProductID]; qty > 0 {
+				productID, err := primitive.ObjectIDFromHex(l.ProductID)
+				if err != nil {
+					return err
+				}
+				_, err = r.ledger.apply(sc, bson.M{"_id": productID}, bson.M{}, &entity.StockMovement{
+					Reason:      entity.MovementTransferIn,
+					WarehouseID: t.DestinationID,
+					Reference:   t.ID.Hex(),
+					Delta:       qty,
+				})
+				if err == mongo.ErrNoDocuments {
+					return fmt.Errorf("%w: %s", ErrProductNotFound, l.ProductID)
+				}
+				if err != nil {
+					return err
+				}
+				l.Received += qty
+			}
+			if l.Outstanding() > 0 {
+				done = false
+			}
+		}
+
+		now := time.Now().UTC()
+		t.Status = entity.TransferPartiallyReceived
+		if done {
+			t.Status = entity.TransferReceived
+			t.ReceivedAt = &now
+		}
+		t.UpdatedAt = now
+		_, err = r.col.ReplaceOne(sc, bson.M{"_id": objID}, &t)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// receiptQuantities totals receipt per product and checks it against what is
+// outstanding on t. A nil receipt takes everything outstanding.
+func receiptQuantities(t *entity.Transfer, receipt []entity.ReceiptLine) (map[string]int, error) {
+	outstanding := make(map[string]int, len(t.Lines))
+	for _, l := range t.Lines {
+		outstanding[l.ProductID] += l.Outstanding()
+	}
+	if receipt == nil {
+		return outstanding, nil
+	}
+	arrived := make(map[string]int, len(receipt))
+	for _, rl := range receipt {
+		arrived[rl.ProductID] += rl.Quantity
+	}
+	for productID, qty := range arrived {
+		if qty > outstanding[productID] {
+			return nil, fmt.Errorf("%w: %d of product %s, %d outstanding", ErrOverReceipt, qty, productID, outstanding[productID])
+		}
+	}
+	return arrived, nil
+}
+
+// missOrState explains why a status transition matched nothing.
+func (r *transferRepository) missOrState(ctx context.Context, objID primitive.ObjectID) error {
+	n, err := r.col.CountDocuments(ctx, bson.M{"_id": objID}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTransferNotFound
+	}
+	return ErrTransferState
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+)
+
+func TestReceiptQuantities(t *testing.T) {
+	transfer := &entity.Transfer{Lines: []entity.TransferLine{
+		{ProductID: widget.Hex(), Quantity: 5, Received: 2},
+		{ProductID: gadget.Hex(), Quantity: 1},
+	}}
+	tests := []struct {
+		name    string
+		receipt []entity.ReceiptLine
+		want    map[string]int
+		err     error
+	}{
+		{"everything outstanding", nil, map[string]int{widget.Hex(): 3, gadget.Hex(): 1}, nil},
+		{"part", []entity.ReceiptLine{{ProductID: widget.Hex(), Quantity: 1}}, map[string]int{widget.Hex(): 1}, nil},
+		{"lines of one product add up", []entity.ReceiptLine{{ProductID: widget.Hex(), Quantity: 1}, {ProductID: widget.Hex(), Quantity: 2}}, map[string]int{widget.Hex(): 3}, nil},
+		{"more than is outstanding", []entity.ReceiptLine{{ProductID: widget.Hex(), Quantity: 2}, {ProductID: widget.Hex(), Quantity: 2}}, nil, ErrOverReceipt},
+		{"a product not on the transfer", []entity.ReceiptLine{{ProductID: missing.Hex(), Quantity: 1}}, nil, ErrOverReceipt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := receiptQuantities(transfer, tt.receipt)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("receiptQuantities = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrWarehouseNotFound  = errors.New("warehouse not found")
+	ErrWarehouseCodeTaken = errors.New("warehouse code already exists")
+	ErrWarehouseInUse     = errors.New("warehouse still holds stock or has open transfers")
+)
+
+type WarehouseRepository interface {
+	EnsureIndexes(ctx context.Context) error
+	Create(ctx context.Context, w *entity.Warehouse) error
+	GetByID(ctx context.Context, id string) (*entity.Warehouse, error)
+	GetByCode(ctx context.Context, code string) (*entity.Warehouse, error)
+	Update(ctx context.Context, w *entity.Warehouse) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// List returns warehouses in allocation order: by priority, then code.
+	List(ctx context.Context, activeOnly bool) ([]entity.Warehouse, error)
+}
+
+type warehouseRepository struct {
+	db       *mongo.Database
+	col      *mongo.Collection
+	products *mongo.Collection
+}
+
+func NewWarehouseRepository(db *mongo.Database) WarehouseRepository {
+	return &warehouseRepository{
+		db:       db,
+		col:      db.Collection("warehouses"),
+		products: db.Collection("products"),
+	}
+}
+
+func (r *warehouseRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, err := r.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		return err
+	}
+	// Delete looks for products stocked at a warehouse
+	_, err = r.products.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "locations.warehouse_id", Value: 1}},
+	})
+	return err
+}
+
+func (r *warehouseRepository) Create(ctx context.Context, w *entity.Warehouse) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	w.ID = primitive.NewObjectID()
+	_, err := r.col.InsertOne(ctx, w)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrWarehouseCodeTaken
+	}
+	return err
+}
+
+func (r *warehouseRepository) GetByID(ctx context.Context, id string) (*entity.Warehouse, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrWarehouseNotFound
+	}
+	return r.findOne(ctx, bson.M{"_id": objID})
+}
+
+func (r *warehouseRepository) GetByCode(ctx context.Context, code string) (*entity.Warehouse, error) {
+	return r.findOne(ctx, bson.M{"code": code})
+}
+
+func (r *warehouseRepository) findOne(ctx context.Context, filter bson.M) (*entity.Warehouse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var w entity.Warehouse
+	if err := r.col.FindOne(ctx, filter).Decode(&w); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrWarehouseNotFound
+		}
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r *warehouseRepository) Update(ctx context.Context, w *entity.Warehouse) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	res, err := r.col.ReplaceOne(ctx, bson.M{"_id": w.ID}, w)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrWarehouseNotFound
+	}
+	return nil
+}
+
+// Delete removes the warehouse unless a product still has stock or holds
+// there or a transfer from or to it is still open. Empty locations left
+// behind are dropped in the same transaction.
+func (r *warehouseRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		stocked, err := r.products.CountDocuments(sc, bson.M{"locations": bson.M{"$elemMatch": bson.M{
+			"warehouse_id": id,
+			"$or":          bson.A{bson.M{"stock": bson.M{"$ne": 0}}, bson.M{"reserved": bson.M{"$ne": 0}}},
+		}}}, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		open, err := r.db.Collection("transfers").CountDocuments(sc, bson.M{
+			"$or":    bson.A{bson.M{"source_id": id}, bson.M{"destination_id": id}},
+			"status": bson.M{"$in": bson.A{entity.TransferDraft, entity.TransferInTransit, entity.TransferPartiallyReceived}},
+		}, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if stocked > 0 || open > 0 {
+			return ErrWarehouseInUse
+		}
+		if _, err := r.products.UpdateMany(sc,
+			bson.M{"locations.warehouse_id": id},
+			bson.M{"$pull": bson.M{"locations": bson.M{"warehouse_id": id}}},
+		); err != nil {
+			return err
+		}
+		res, err := r.col.DeleteOne(sc, bson.M{"_id": id})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return ErrWarehouseNotFound
+		}
+		return nil
+	})
+}
+
+func (r *warehouseRepository) List(ctx context.Context, activeOnly bool) ([]entity.Warehouse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	filter := bson.M{}
+	if activeOnly {
+		filter["active"] = true
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "code", Value: 1}})
+	cur, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	warehouses := []entity.Warehouse{}
+	if err := cur.All(ctx, &warehouses); err != nil {
+		return nil, err
+	}
+	return warehouses, nil
+}
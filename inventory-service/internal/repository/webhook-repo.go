@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrWebhookNotFound    = errors.New("webhook subscription not found")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+const duplicateKeyCode = 11000
+
+// deliveredTTL is how long delivered deliveries are kept for inspection.
+const deliveredTTL = 7 * 24 * time.Hour
+
+type WebhookRepository interface {
+	EnsureIndexes(ctx context.Context) error
+	CreateSubscription(ctx context.Context, s *entity.WebhookSubscription) error
+	GetSubscription(ctx context.Context, id string) (*entity.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error)
+	// DeleteSubscription drops the subscription and its queued deliveries.
+	DeleteSubscription(ctx context.Context, id string) error
+	// SubscriptionsFor returns the subscriptions that want eventType.
+	SubscriptionsFor(ctx context.Context, eventType string) ([]entity.WebhookSubscription, error)
+
+	// Enqueue queues deliveries, skipping any already queued for the same
+	// subscription and event.
+	Enqueue(ctx context.Context, deliveries []entity.WebhookDelivery) error
+	// ClaimDue takes the longest due pending delivery and hides it from
+	// other claims until lease runs out. It returns nil when none is due.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*entity.WebhookDelivery, error)
+	// SaveAttempt stores the outcome of an attempt on d: its status,
+	// attempts, next attempt and last error and status code.
+	SaveAttempt(ctx context.Context, d *entity.WebhookDelivery) error
+	// DeadLetter moves d out of the queue into the dead letters.
+	DeadLetter(ctx context.Context, d *entity.WebhookDelivery) error
+	// ListDeadLetters lists the newest dead letters, of one subscription
+	// unless subscriptionID is empty.
+	ListDeadLetters(ctx context.Context, subscriptionID string, limit int64) ([]entity.WebhookDelivery, error)
+	// Redeliver moves a dead letter back into the queue, due now and with a
+	// fresh set of attempts.
+	Redeliver(ctx context.Context, id string) (*entity.WebhookDelivery, error)
+}
+
+type webhookRepository struct {
+	db          *mongo.Database
+	subs        *mongo.Collection
+	deliveries  *mongo.Collection
+	deadLetters *mongo.Collection
+}
+
+func NewWebhookRepository(db *mongo.Database) WebhookRepository {
+	return &webhookRepository{
+		db:          db,
+		subs:        db.Collection("webhook_subscriptions"),
+		deliveries:  db.Collection("webhook_deliveries"),
+		deadLetters: db.Collection("webhook_dead_letters"),
+	}
+}
+
+func (r *webhookRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, err := r.subs.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "event_types", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.deliveries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "subscription_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "delivered_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(deliveredTTL.Seconds())),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.deadLetters.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "subscription_id", Value: 1}, {Key: "updated_at", Value: -1}},
+	})
+	return err
+}
+
+func (r *webhookRepository) CreateSubscription(ctx context.Context, s *entity.WebhookSubscription) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	now := time.Now().UTC()
+	s.ID = primitive.NewObjectID()
+	s.CreatedAt = now
+	s.UpdatedAt = now
+	_, err := r.subs.InsertOne(ctx, s)
+	return err
+}
+
+func (r *webhookRepository) GetSubscription(ctx context.Context, id string) (*entity.WebhookSubscription, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var s entity.WebhookSubscription
+	if err := r.subs.FindOne(ctx, bson.M{"_id": objID}).Decode(&s); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *webhookRepository) ListSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	return r.findSubscriptions(ctx, bson.M{})
+}
+
+func (r *webhookRepository) SubscriptionsFor(ctx context.Context, eventType string) ([]entity.WebhookSubscription, error) {
+	return r.findSubscriptions(ctx, bson.M{"event_types": bson.M{"$in": bson.A{eventType, entity.WebhookAllEvents}}})
+}
+
+func (r *webhookRepository) findSubscriptions(ctx context.Context, filter bson.M) ([]entity.WebhookSubscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	cur, err := r.subs.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	subs := []entity.WebhookSubscription{}
+	if err := cur.All(ctx, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrWebhookNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		res, err := r.subs.DeleteOne(sc, bson.M{"_id": objID})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return ErrWebhookNotFound
+		}
+		_, err = r.deliveries.DeleteMany(sc, bson.M{"subscription_id": objID, "status": entity.DeliveryPending})
+		return err
+	})
+}
+
+func (r *webhookRepository) Enqueue(ctx context.Context, deliveries []entity.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	docs := make([]interface{}, 0, len(deliveries))
+	for i := range deliveries {
+		deliveries[i].ID = primitive.NewObjectID()
+		docs = append(docs, &deliveries[i])
+	}
+	_, err := r.deliveries.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if onlyDuplicates(err) {
+		return nil
+	}
+	return err
+}
+
+// onlyDuplicates tells whether err is a bulk insert error every part of
+// which is a duplicate key.
+func onlyDuplicates(err error) bool {
+	var bulk mongo.BulkWriteException
+	if !errors.As(err, &bulk) || bulk.WriteConcernError != nil {
+		return false
+	}
+	for _, we := range bulk.WriteErrors {
+		if we.Code != duplicateKeyCode {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *webhookRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*entity.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var d entity.WebhookDelivery
+	err := r.deliveries.FindOneAndUpdate(ctx,
+		bson.M{"status": entity.DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&d)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *webhookRepository) SaveAttempt(ctx context.Context, d *entity.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	d.UpdatedAt = time.Now().UTC()
+	_, err := r.deliveries.UpdateOne(ctx, bson.M{"_id": d.ID}, bson.M{"$set": bson.M{
+		"status":           d.Status,
+		"attempts":         d.Attempts,
+		"next_attempt_at":  d.NextAttemptAt,
+		"last_error":       d.LastError,
+		"last_status_code": d.LastStatusCode,
+		"delivered_at":     d.DeliveredAt,
+		"updated_at":       d.UpdatedAt,
+	}})
+	return err
+}
+
+func (r *webhookRepository) DeadLetter(ctx context.Context, d *entity.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	d.Status = entity.DeliveryDead
+	d.UpdatedAt = time.Now().UTC()
+	return withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		if _, err := r.deliveries.DeleteOne(sc, bson.M{"_id": d.ID}); err != nil {
+			return err
+		}
+		_, err := r.deadLetters.ReplaceOne(sc, bson.M{"_id": d.ID}, d, options.Replace().SetUpsert(true))
+		return err
+	})
+}
+
+func (r *webhookRepository) ListDeadLetters(ctx context.Context, subscriptionID string, limit int64) ([]entity.WebhookDelivery, error) {
+	filter := bson.M{}
+	if subscriptionID != "" {
+		objID, err := primitive.ObjectIDFromHex(subscriptionID)
+		if err != nil {
+			return []entity.WebhookDelivery{}, nil
+		}
+		filter["subscription_id"] = objID
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}).SetLimit(limit)
+	cur, err := r.deadLetters.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []entity.WebhookDelivery{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *webhookRepository) Redeliver(ctx context.Context, id string) (*entity.WebhookDelivery, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrDeadLetterNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var d entity.WebhookDelivery
+	err = withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		d = entity.WebhookDelivery{}
+		if err := r.deadLetters.FindOneAndDelete(sc, bson.M{"_id": objID}).Decode(&d); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrDeadLetterNotFound
+			}
+			return err
+		}
+		now := time.Now().UTC()
+		d.Status = entity.DeliveryPending
+		d.Attempts = 0
+		d.NextAttemptAt = now
+		d.UpdatedAt = now
+		_, err := r.deliveries.InsertOne(sc, &d)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
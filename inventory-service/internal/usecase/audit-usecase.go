@@ -0,0 +1,38 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+type AuditUsecase interface {
+	// ListDenials returns the newest refused requests, optionally only those
+	// of actor. A limit of 0 means the default.
+	ListDenials(ctx context.Context, actor string, limit int) ([]entity.AuditEntry, error)
+}
+
+type auditUsecase struct {
+	repo repository.AuditRepository
+}
+
+func NewAuditUsecase(r repository.AuditRepository) AuditUsecase {
+	return &auditUsecase{repo: r}
+}
+
+func (u *auditUsecase) ListDenials(ctx context.Context, actor string, limit int) ([]entity.AuditEntry, error) {
+	if limit == 0 {
+		limit = defaultAuditLimit
+	}
+	if limit < 0 || limit > maxAuditLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, maxAuditLimit)
+	}
+	return u.repo.ListDenied(ctx, actor, int64(limit))
+}
@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrCategoryNotFound  = errors.New("category not found")
+	ErrCategorySlugTaken = errors.New("category slug already exists")
+	ErrCategoryInUse     = errors.New("category has products or subcategories")
+	ErrInvalidCategory   = errors.New("invalid category")
+	ErrUnknownCategory   = errors.New("unknown category")
+)
+
+type CategoryUsecase interface {
+	CreateCategory(ctx context.Context, req *entity.CreateCategoryRequest) (*entity.Category, error)
+	GetCategory(ctx context.Context, id string) (*entity.Category, error)
+	UpdateCategory(ctx context.Context, id string, req *entity.UpdateCategoryRequest) (*entity.Category, error)
+	DeleteCategory(ctx context.Context, id string) error
+	ListCategories(ctx context.Context) ([]entity.Category, error)
+}
+
+type categoryUsecase struct {
+	repo repository.CategoryRepository
+}
+
+func NewCategoryUsecase(r repository.CategoryRepository) CategoryUsecase {
+	return &categoryUsecase{repo: r}
+}
+
+func (u *categoryUsecase) CreateCategory(ctx context.Context, req *entity.CreateCategoryRequest) (*entity.Category, error) {
+	slug := req.Slug
+	if slug == "" {
+		slug = req.Name
+	}
+	slug = entity.Slugify(slug)
+	if slug == "" {
+		return nil, ErrInvalidCategory
+	}
+
+	now := time.Now().UTC()
+	c := &entity.Category{
+		Name:      req.Name,
+		Slug:      slug,
+		Ancestors: []primitive.ObjectID{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if req.ParentID != "" {
+		parent, err := u.repo.GetByID(ctx, req.ParentID)
+		if err != nil {
+			return nil, parentErr(err)
+		}
+		c.ParentID = &parent.ID
+		c.Ancestors = append(append(c.Ancestors, parent.Ancestors...), parent.ID)
+	}
+	if err := u.repo.Create(ctx, c); err != nil {
+		return nil, mapCategoryErr(err)
+	}
+	return c, nil
+}
+
+func (u *categoryUsecase) GetCategory(ctx context.Context, id string) (*entity.Category, error) {
+	c, err := u.repo.GetByID(ctx, id)
+	return c, mapCategoryErr(err)
+}
+
+func (u *categoryUsecase) UpdateCategory(ctx context.Context, id string, req *entity.UpdateCategoryRequest) (*entity.Category, error) {
+	old, err := u.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, mapCategoryErr(err)
+	}
+	updated := *old
+	if req.Name != nil {
+		if *req.Name == "" {
+			return nil, ErrInvalidCategory
+		}
+		updated.Name = *req.Name
+	}
+	if req.Slug != nil {
+		updated.Slug = entity.Slugify(*req.Slug)
+		if updated.Slug == "" {
+			return nil, ErrInvalidCategory
+		}
+	}
+	if req.ParentID != nil {
+		updated.ParentID = nil
+		updated.Ancestors = []primitive.ObjectID{}
+		if *req.ParentID != "" {
+			parent, err := u.repo.GetByID(ctx, *req.ParentID)
+			if err != nil {
+				return nil, parentErr(err)
+			}
+			// a category cannot move under itself or its own subtree
+			if parent.ID == old.ID || containsID(parent.Ancestors, old.ID) {
+				return nil, ErrInvalidCategory
+			}
+			updated.ParentID = &parent.ID
+			updated.Ancestors = append(append(updated.Ancestors, parent.Ancestors...), parent.ID)
+		}
+	}
+	updated.UpdatedAt = time.Now().UTC()
+	if err := u.repo.Update(ctx, old, &updated); err != nil {
+		return nil, mapCategoryErr(err)
+	}
+	return &updated, nil
+}
+
+func (u *categoryUsecase) DeleteCategory(ctx context.Context, id string) error {
+	c, err := u.repo.GetByID(ctx, id)
+	if err != nil {
+		return mapCategoryErr(err)
+	}
+	return mapCategoryErr(u.repo.Delete(ctx, c))
+}
+
+func (u *categoryUsecase) ListCategories(ctx context.Context) ([]entity.Category, error) {
+	return u.repo.List(ctx)
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// parentErr reports a missing parent as a bad request rather than a missing
+// category.
+func parentErr(err error) error {
+	if errors.Is(err, repository.ErrCategoryNotFound) {
+		return ErrInvalidCategory
+	}
+	return err
+}
+
+func mapCategoryErr(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrCategoryNotFound):
+		return ErrCategoryNotFound
+	case errors.Is(err, repository.ErrCategorySlugTaken):
+		return ErrCategorySlugTaken
+	case errors.Is(err, repository.ErrCategoryInUse):
+		return ErrCategoryInUse
+	default:
+		return err
+	}
+}
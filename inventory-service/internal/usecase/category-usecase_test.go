@@ -0,0 +1,310 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memCategories keeps slugs unique and refuses to delete a category with
+// children or products, like the category repository. products holds the
+// slugs products are filed under. The other methods are not used.
+type memCategories struct {
+	repository.CategoryRepository
+	byID     map[primitive.ObjectID]entity.Category
+	products map[string]bool
+}
+
+func newCategories() *memCategories {
+	return &memCategories{byID: make(map[primitive.ObjectID]entity.Category), products: make(map[string]bool)}
+}
+
+func (r *memCategories) slugTaken(c *entity.Category) bool {
+	for id, other := range r.byID {
+		if other.Slug == c.Slug && id != c.ID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memCategories) Create(ctx context.Context, c *entity.Category) error {
+	c.ID = primitive.NewObjectID()
+	if r.slugTaken(c) {
+		return repository.ErrCategorySlugTaken
+	}
+	r.byID[c.ID] = *c
+	return nil
+}
+
+func (r *memCategories) GetByID(ctx context.Context, id string) (*entity.Category, error) {
+	objID, _ := primitive.ObjectIDFromHex(id)
+	c, ok := r.byID[objID]
+	if !ok {
+		return nil, repository.ErrCategoryNotFound
+	}
+	return &c, nil
+}
+
+func (r *memCategories) Update(ctx context.Context, old, updated *entity.Category) error {
+	if _, ok := r.byID[old.ID]; !ok {
+		return repository.ErrCategoryNotFound
+	}
+	if r.slugTaken(updated) {
+		return repository.ErrCategorySlugTaken
+	}
+	r.byID[old.ID] = *updated
+	return nil
+}
+
+func (r *memCategories) Delete(ctx context.Context, c *entity.Category) error {
+	for _, other := range r.byID {
+		if other.ParentID != nil && *other.ParentID == c.ID {
+			return repository.ErrCategoryInUse
+		}
+	}
+	if r.products[c.Slug] {
+		return repository.ErrCategoryInUse
+	}
+	delete(r.byID, c.ID)
+	return nil
+}
+
+// tree creates tools > power tools > drills and garden at the root.
+func tree(t *testing.T, uc CategoryUsecase) (tools, power, drills, garden *entity.Category) {
+	t.Helper()
+	create := func(name, parent string) *entity.Category {
+		c, err := uc.CreateCategory(context.Background(), &entity.CreateCategoryRequest{Name: name, ParentID: parent})
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		return c
+	}
+	tools = create("Tools", "")
+	power = create("Power Tools", tools.ID.Hex())
+	drills = create("Drills", power.ID.Hex())
+	garden = create("Garden", "")
+	return tools, power, drills, garden
+}
+
+func TestCreateCategory(t *testing.T) {
+	repo := newCategories()
+	uc := NewCategoryUsecase(repo)
+	tools, power, drills, _ := tree(t, uc)
+
+	if power.Slug != "power-tools" {
+		t.Errorf("slug = %q, want it made from the name", power.Slug)
+	}
+	if tools.ParentID != nil || len(tools.Ancestors) != 0 {
+		t.Errorf("root has parent %v and ancestors %v", tools.ParentID, tools.Ancestors)
+	}
+	if drills.ParentID == nil || *drills.ParentID != power.ID {
+		t.Errorf("parent = %v, want %v", drills.ParentID, power.ID)
+	}
+	if want := []primitive.ObjectID{tools.ID, power.ID}; !reflect.DeepEqual(drills.Ancestors, want) {
+		t.Errorf("ancestors = %v, want %v", drills.Ancestors, want)
+	}
+
+	tests := []struct {
+		name string
+		req  entity.CreateCategoryRequest
+		slug string
+		err  error
+	}{
+		{"explicit slug", entity.CreateCategoryRequest{Name: "Saws", Slug: "Hand Saws"}, "hand-saws", nil},
+		{"slug without letters", entity.CreateCategoryRequest{Name: "Sale", Slug: "&&&"}, "", ErrInvalidCategory},
+		{"name without letters", entity.CreateCategoryRequest{Name: "!!!"}, "", ErrInvalidCategory},
+		{"unknown parent", entity.CreateCategoryRequest{Name: "Bits", ParentID: primitive.NewObjectID().Hex()}, "", ErrInvalidCategory},
+		{"malformed parent", entity.CreateCategoryRequest{Name: "Bits", ParentID: "nope"}, "", ErrInvalidCategory},
+		{"slug taken", entity.CreateCategoryRequest{Name: "TOOLS"}, "", ErrCategorySlugTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := uc.CreateCategory(context.Background(), &tt.req)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil && c.Slug != tt.slug {
+				t.Errorf("slug = %q, want %q", c.Slug, tt.slug)
+			}
+		})
+	}
+	if len(repo.byID) != 5 {
+		t.Errorf("%d categories stored, want 5", len(repo.byID))
+	}
+}
+
+func TestUpdateCategory(t *testing.T) {
+	str := func(s string) *string { return &s }
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		req  func(tools, power, drills, garden *entity.Category) (string, entity.UpdateCategoryRequest)
+		err  error
+		want func(tools, power, drills, garden *entity.Category) entity.Category
+	}{
+		{
+			name: "rename keeps the slug",
+			req: func(_, power, _, _ *entity.Category) (string, entity.UpdateCategoryRequest) {
+				return power.ID.Hex(), entity.UpdateCategoryRequest{Name: str("Power tools & accessories")}
+			},
+			want: func(_, power, _, _ *entity.Category) entity.Category {
+				power.Name = "Power tools & accessories"
+				return *power
+			},
+		},
+		{
+			name: "new slug",
+			req: func(_, power, _, _ *entity.Category) (string, entity.UpdateCategoryRequest) {
+				return power.ID.Hex(), entity.UpdateCategoryRequest{Slug: str("Electric Tools")}
+			},
+			want: func(_, power, _, _ *entity.Category) entity.Category {
+				power.Slug = "electric-tools"
+				return *power
+			},
+		},
+		{
+			name: "move under another parent",
+			req: func(_, power, _, garden *entity.Category) (string, entity.UpdateCategoryRequest) {
+				return power.ID.Hex(), entity.UpdateCategoryRequest{ParentID: str(garden.ID.Hex())}
+			},
+			want: func(_, power, _, garden *entity.Category) entity.Category {
+				power.ParentID = &garden.ID
+				power.Ancestors = []primitive.ObjectID{garden.ID}
+				return *power
+			},
+		},
+		{
+			name: "move to the root",
+			req: func(_, _, drills, _ *entity.Category) (string, entity.UpdateCategoryRequest) {
+				return drills.ID.Hex(), entity.UpdateCategoryRequest{ParentID: str("")}
+			},
+			want: func(_, _, drills, _ *entity.Category) entity.Category {
+				drills.ParentID = nil
+				drills.Ancestors = []primitive.ObjectID{}
+				return *drills
+			},
+		},
+		{
+			name: "empty name",
+			req: func(tools, _, _, _ *entity.Category) (string, entity.UpdateCategoryRequest) {
+				return tools.ID.Hex(), entity.UpdateCategoryRequest{Name: str("")}
+			},
+			err: ErrInvalidCategory,
+		},
+		{
+			name: "slug without letters",
+			req: func(tools, _, _, _ *entity.Category) (string, entity.UpdateCategoryRequest) {
+				return tools.ID.Hex(), entity.UpdateCategoryRequest{Slug: str("---")}
+			},
+			err: ErrInvalidCategory,
+		},
+		{
+			name: "slug taken",
+			req: func(tools, _, _, _ *entity.Category) (string, entity.UpdateCategoryRequest) {
+				return tools.ID.Hex(), entity.UpdateCategoryRequest{Slug: str("garden")}
+			},
+			err: ErrCategorySlugTaken,
+		},
+		{
+			name: "under itself",
+			req: func(tools, _, _, _ *entity.Category) (string, entity.UpdateCategoryRequest) {
+				return tools.ID.Hex(), entity.UpdateCategoryRequest{ParentID: str(tools.ID.Hex())}
+			},
+			err: ErrInvalidCategory,
+		},
+		{
+			name: "under its own subtree",
+			req: func(tools, _, drills, _ *entity.Category) (string, entity.UpdateCategoryRequest) {
+				return tools.ID.Hex(), entity.UpdateCategoryRequest{ParentID: str(drills.ID.Hex())}
+			},
+			err: ErrInvalidCategory,
+		},
+		{
+			name: "unknown parent",
+			req: func(tools, _, _, _ *entity.Category) (string, entity.UpdateCategoryRequest) {
+				return tools.ID.Hex(), entity.UpdateCategoryRequest{ParentID: str(primitive.NewObjectID().Hex())}
+			},
+			err: ErrInvalidCategory,
+		},
+		{
+			name: "unknown category",
+			req: func(_, _, _, _ *entity.Category) (string, entity.UpdateCategoryRequest) {
+				return primitive.NewObjectID().Hex(), entity.UpdateCategoryRequest{Name: str("Anything")}
+			},
+			err: ErrCategoryNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newCategories()
+			uc := NewCategoryUsecase(repo)
+			tools, power, drills, garden := tree(t, uc)
+			id, req := tt.req(tools, power, drills, garden)
+			before := make(map[primitive.ObjectID]entity.Category)
+			for k, v := range repo.byID {
+				before[k] = v
+			}
+
+			got, err := uc.UpdateCategory(ctx, id, &req)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if !reflect.DeepEqual(repo.byID, before) {
+					t.Error("a refused update changed the tree")
+				}
+				return
+			}
+			want := tt.want(tools, power, drills, garden)
+			if got.UpdatedAt.Before(want.UpdatedAt) {
+				t.Errorf("updated at %v, want it moved on from %v", got.UpdatedAt, want.UpdatedAt)
+			}
+			want.UpdatedAt = got.UpdatedAt
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("got %+v, want %+v", *got, want)
+			}
+			if stored := repo.byID[got.ID]; !reflect.DeepEqual(stored, want) {
+				t.Errorf("stored %+v, want %+v", stored, want)
+			}
+		})
+	}
+}
+
+func TestDeleteCategory(t *testing.T) {
+	repo := newCategories()
+	uc := NewCategoryUsecase(repo)
+	tools, power, drills, garden := tree(t, uc)
+	repo.products[garden.Slug] = true
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		id   string
+		err  error
+	}{
+		{"has subcategories", tools.ID.Hex(), ErrCategoryInUse},
+		{"has products", garden.ID.Hex(), ErrCategoryInUse},
+		{"leaf", drills.ID.Hex(), nil},
+		{"emptied parent", power.ID.Hex(), nil},
+		{"already deleted", drills.ID.Hex(), ErrCategoryNotFound},
+		{"malformed id", "nope", ErrCategoryNotFound},
+	}
+	for _, tt := range tests {
+		if err := uc.DeleteCategory(ctx, tt.id); !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+	if _, err := uc.GetCategory(ctx, power.ID.Hex()); !errors.Is(err, ErrCategoryNotFound) {
+		t.Errorf("get deleted: err = %v, want ErrCategoryNotFound", err)
+	}
+	if len(repo.byID) != 2 {
+		t.Errorf("%d categories left, want tools and garden", len(repo.byID))
+	}
+}
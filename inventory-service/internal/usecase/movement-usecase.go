@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidMovement = errors.New("invalid stock movement")
+
+type MovementUsecase interface {
+	RecordMovement(ctx context.Context, productID string, req *entity.StockMovementRequest) (*entity.StockMovement, error)
+	ListMovements(ctx context.Context, productID string, filter entity.MovementFilter) (*entity.MovementPage, error)
+	CheckConsistency(ctx context.Context, productID string) (*entity.StockConsistency, error)
+}
+
+type movementUsecase struct {
+	repo       repository.MovementRepository
+	warehouses repository.WarehouseRepository
+}
+
+func NewMovementUsecase(r repository.MovementRepository, warehouses repository.WarehouseRepository) MovementUsecase {
+	return &movementUsecase{repo: r, warehouses: warehouses}
+}
+
+// RecordMovement applies a manual movement at one warehouse. Receipts and
+// returns add stock, adjustments move it either way and a recount replaces it
+// with the counted quantity. Holds and sales only come from reservations.
+func (u *movementUsecase) RecordMovement(ctx context.Context, productID string, req *entity.StockMovementRequest) (*entity.StockMovement, error) {
+	warehouse, err := resolveWarehouse(ctx, u.warehouses, req.WarehouseID)
+	if err != nil {
+		return nil, err
+	}
+	m := &entity.StockMovement{
+		Reason:      req.Reason,
+		WarehouseID: warehouse,
+		Reference:   req.Reference,
+		Note:        req.Note,
+		Delta:       req.Quantity,
+	}
+	switch req.Reason {
+	case entity.MovementReceipt, entity.MovementReturn:
+		if req.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: %s quantity must be positive", ErrInvalidMovement, req.Reason)
+		}
+		_, err = u.repo.Record(ctx, productID, m)
+	case entity.MovementAdjustment:
+		if req.Quantity == 0 {
+			return nil, fmt.Errorf("%w: adjustment quantity cannot be zero", ErrInvalidMovement)
+		}
+		_, err = u.repo.Record(ctx, productID, m)
+	case entity.MovementRecount:
+		if req.Quantity < 0 {
+			return nil, fmt.Errorf("%w: counted quantity cannot be negative", ErrInvalidMovement)
+		}
+		_, err = u.repo.Recount(ctx, productID, req.Quantity, m)
+	default:
+		return nil, fmt.Errorf("%w: reason %q cannot be recorded manually", ErrInvalidMovement, req.Reason)
+	}
+	if err != nil {
+		return nil, mapMovementErr(err)
+	}
+	return m, nil
+}
+
+func (u *movementUsecase) ListMovements(ctx context.Context, productID string, filter entity.MovementFilter) (*entity.MovementPage, error) {
+	objID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, ErrProductNotFound
+	}
+	filter.ProductID = objID
+	if filter.Limit <= 0 {
+		filter.Limit = defaultPageSize
+	}
+	if filter.Limit > maxPageSize {
+		filter.Limit = maxPageSize
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+	page, err := u.repo.List(ctx, filter)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	return page, err
+}
+
+func (u *movementUsecase) CheckConsistency(ctx context.Context, productID string) (*entity.StockConsistency, error) {
+	check, err := u.repo.Reconcile(ctx, productID)
+	return check, mapMovementErr(err)
+}
+
+func mapMovementErr(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrInsufficientStock):
+		return ErrInsufficientStock
+	default:
+		return mapProductErr(err)
+	}
+}
@@ -1,44 +1,376 @@
 package usecase
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 
 	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/jsonpatch"
 	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+	"github.com/Nurda-zh/a1/pkg/auth"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInsufficientStock  = errors.New("insufficient stock")
+	ErrInvalidReservation = errors.New("invalid reservation")
+	ErrInvalidQuery       = errors.New("invalid query")
+	ErrProductNotFound    = errors.New("product not found")
+	ErrVersionConflict    = errors.New("product was modified concurrently")
+	ErrInvalidPatch       = errors.New("invalid patch")
+	ErrPatchTestFailed    = errors.New("patch test operation failed")
+	ErrUnsupportedPatch   = errors.New("unsupported patch media type")
+	ErrForbidden          = errors.New("forbidden")
+)
+
+// readOnlyProductFields may appear in a patched document but not change.
+// Locations change through stock movements only.
+var readOnlyProductFields = []string{"id", "reserved", "available", "locations", "version"}
+
+// requiredProductFields must still be present after a patch.
+var requiredProductFields = []string{"name", "price", "currency", "stock"}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
 )
 
 type ProductUsecase interface {
 	CreateProduct(ctx context.Context, p *entity.Product) error
 	GetProduct(ctx context.Context, id string) (*entity.Product, error)
-	UpdateProduct(ctx context.Context, id string, p *entity.Product) error
-	DeleteProduct(ctx context.Context, id string) error
-	ListProducts(ctx context.Context) ([]entity.Product, error)
+	PatchProduct(ctx context.Context, id string, mediaType string, patch []byte, version int64) (*entity.Product, error)
+	DeleteProduct(ctx context.Context, id string, version int64) error
+	ListProducts(ctx context.Context, filter entity.ProductFilter) (*entity.ProductPage, error)
+	GetProductsByIDs(ctx context.Context, ids []string) ([]entity.Product, []string, error)
+	ReserveStock(ctx context.Context, items []entity.ReserveItem) ([]entity.ReserveFailure, error)
 }
 
 type productUsecase struct {
-	repo repository.ProductRepository
+	repo       repository.ProductRepository
+	categories repository.CategoryRepository
+	warehouses repository.WarehouseRepository
+	rule       entity.AllocationRule
 }
 
-func NewProductUsecase(r repository.ProductRepository) ProductUsecase {
-	return &productUsecase{repo: r}
+func NewProductUsecase(r repository.ProductRepository, categories repository.CategoryRepository, warehouses repository.WarehouseRepository, rule entity.AllocationRule) ProductUsecase {
+	return &productUsecase{repo: r, categories: categories, warehouses: warehouses, rule: rule}
 }
 
+// CreateProduct stocks the product at the locations it lists, or puts all of
+// Stock into the default warehouse when it lists none.
 func (u *productUsecase) CreateProduct(ctx context.Context, p *entity.Product) error {
+	p.Reserved = 0
+	if err := u.checkLocations(ctx, p); err != nil {
+		return err
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if err := u.checkCategory(ctx, p.Category); err != nil {
+		return err
+	}
 	return u.repo.Create(ctx, p)
 }
 
+// checkLocations validates a new product's locations and sets Stock to
+// their sum.
+func (u *productUsecase) checkLocations(ctx context.Context, p *entity.Product) error {
+	if len(p.Locations) == 0 {
+		p.Locations = []entity.StockLocation{}
+		if p.Stock != 0 {
+			p.Locations = append(p.Locations, entity.StockLocation{WarehouseID: entity.DefaultWarehouseID, Stock: p.Stock})
+		}
+		return nil
+	}
+	seen := make(map[primitive.ObjectID]bool, len(p.Locations))
+	p.Stock = 0
+	for i, l := range p.Locations {
+		if _, err := resolveWarehouse(ctx, u.warehouses, l.WarehouseID.Hex()); err != nil {
+			return err
+		}
+		if seen[l.WarehouseID] {
+			return fmt.Errorf("%w: warehouse %s listed twice", entity.ErrInvalidProduct, l.WarehouseID.Hex())
+		}
+		if l.Stock < 0 {
+			return fmt.Errorf("%w: stock cannot be negative", entity.ErrInvalidProduct)
+		}
+		seen[l.WarehouseID] = true
+		p.Locations[i].Reserved = 0
+		p.Stock += l.Stock
+	}
+	return nil
+}
+
 func (u *productUsecase) GetProduct(ctx context.Context, id string) (*entity.Product, error) {
-	return u.repo.GetByID(ctx, id)
+	p, err := u.repo.GetByID(ctx, id)
+	return p, mapProductErr(err)
+}
+
+// PatchProduct applies a JSON Merge Patch (RFC 7396), or a JSON Patch (RFC
+// 6902) when mediaType says so, to the product's JSON representation. The
+// result is validated and only the fields that actually changed are written.
+// It only succeeds while the stored product is still at version, see
+// entity.AnyVersion to skip the check. Callers that may only adjust stock get
+// ErrForbidden when the patch changes anything else.
+func (u *productUsecase) PatchProduct(ctx context.Context, id string, mediaType string, patch []byte, version int64) (*entity.Product, error) {
+	current, err := u.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, mapProductErr(err)
+	}
+	if version != entity.AnyVersion && current.Version != version {
+		return nil, ErrVersionConflict
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	var patched []byte
+	switch mediaType {
+	case jsonpatch.MergePatchType, "application/json", "":
+		patched, err = jsonpatch.MergePatch(doc, patch)
+	case jsonpatch.JSONPatchType:
+		patched, err = jsonpatch.Apply(doc, patch)
+	default:
+		return nil, ErrUnsupportedPatch
+	}
+	switch {
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		return nil, ErrPatchTestFailed
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	next, err := decodePatchedProduct(doc, patched)
+	if err != nil {
+		return nil, err
+	}
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+
+	var change entity.ProductPatch
+	if next.Name != current.Name {
+		change.Name = &next.Name
+	}
+	if next.Category != current.Category {
+		change.Category = &next.Category
+	}
+	if next.Price != current.Price {
+		change.Price = &next.Price
+	}
+	change.StockDelta = next.Stock - current.Stock
+	if (change.Name != nil || change.Category != nil || change.Price != nil) && !allowed(ctx, entity.PermEditCatalog) {
+		return nil, fmt.Errorf("%w: only stock may be changed without %s", ErrForbidden, entity.PermEditCatalog)
+	}
+	if change.Category != nil {
+		if err := u.checkCategory(ctx, next.Category); err != nil {
+			return nil, err
+		}
+	}
+	// stock edits land at the default warehouse, which must cover a decrease
+	if loc := current.Location(entity.DefaultWarehouseID); change.StockDelta < -loc.Available() {
+		return nil, fmt.Errorf("%w: only %d available at the default warehouse; use stock movements for other locations",
+			entity.ErrInvalidProduct, loc.Available())
+	}
+	if change.IsEmpty() {
+		return current, nil
+	}
+
+	updated, err := u.repo.Patch(ctx, id, change, current.Version)
+	return updated, mapProductErr(err)
+}
+
+// allowed reports whether the caller in ctx has p. Work without a caller,
+// which the service starts itself, is always allowed.
+func allowed(ctx context.Context, p entity.Permission) bool {
+	principal, ok := auth.FromContext(ctx)
+	return !ok || entity.Allowed(principal.Roles, p)
+}
+
+// decodePatchedProduct turns the patched document back into a product,
+// rejecting changes to read-only fields and removal of required ones.
+func decodePatchedProduct(original, patched []byte) (*entity.Product, error) {
+	var before, after map[string]json.RawMessage
+	if err := json.Unmarshal(original, &before); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return nil, fmt.Errorf("%w: result is not a JSON object", ErrInvalidPatch)
+	}
+	for _, field := range readOnlyProductFields {
+		if !bytes.Equal(before[field], after[field]) {
+			return nil, fmt.Errorf("%w: %s is read-only", entity.ErrInvalidProduct, field)
+		}
+	}
+	for _, field := range requiredProductFields {
+		if v, ok := after[field]; !ok || string(v) == "null" {
+			return nil, fmt.Errorf("%w: %s is required", entity.ErrInvalidProduct, field)
+		}
+	}
+	var next entity.Product
+	if err := json.Unmarshal(patched, &next); err != nil {
+		return nil, fmt.Errorf("%w: %v", entity.ErrInvalidProduct, err)
+	}
+	return &next, nil
+}
+
+func (u *productUsecase) DeleteProduct(ctx context.Context, id string, version int64) error {
+	return mapProductErr(u.repo.Delete(ctx, id, version))
+}
+
+// ListProducts returns one page of products matching filter. A category
+// filter also matches every category below it.
+func (u *productUsecase) ListProducts(ctx context.Context, filter entity.ProductFilter) (*entity.ProductPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultPageSize
+	}
+	if filter.Limit > maxPageSize {
+		filter.Limit = maxPageSize
+	}
+	if filter.Category != "" {
+		slugs, err := u.categorySubtree(ctx, filter.Category)
+		if err != nil {
+			return nil, err
+		}
+		filter.Categories = slugs
+	}
+	page, err := u.repo.List(ctx, filter)
+	if errors.Is(err, repository.ErrInvalidCursor) || errors.Is(err, repository.ErrInvalidSort) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	return page, err
 }
 
-func (u *productUsecase) UpdateProduct(ctx context.Context, id string, p *entity.Product) error {
-	return u.repo.Update(ctx, id, p)
+// categorySubtree returns slug and the slugs of all its descendants.
+func (u *productUsecase) categorySubtree(ctx context.Context, slug string) ([]string, error) {
+	root, err := u.categories.GetBySlug(ctx, slug)
+	if err != nil {
+		if errors.Is(err, repository.ErrCategoryNotFound) {
+			return nil, ErrUnknownCategory
+		}
+		return nil, err
+	}
+	descendants, err := u.categories.Descendants(ctx, root.ID)
+	if err != nil {
+		return nil, err
+	}
+	slugs := []string{root.Slug}
+	for _, c := range descendants {
+		slugs = append(slugs, c.Slug)
+	}
+	return slugs, nil
+}
+
+// checkCategory accepts an empty category (uncategorized) or the slug of an
+// existing one.
+func (u *productUsecase) checkCategory(ctx context.Context, slug string) error {
+	if slug == "" {
+		return nil
+	}
+	if _, err := u.categories.GetBySlug(ctx, slug); err != nil {
+		if errors.Is(err, repository.ErrCategoryNotFound) {
+			return ErrUnknownCategory
+		}
+		return err
+	}
+	return nil
+}
+
+// GetProductsByIDs returns the products found, in the order they were asked
+// for, and the ids that did not match any product.
+func (u *productUsecase) GetProductsByIDs(ctx context.Context, ids []string) ([]entity.Product, []string, error) {
+	var missing []string
+	objIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			missing = append(missing, id)
+			continue
+		}
+		objIDs = append(objIDs, objID)
+	}
+	if len(objIDs) == 0 {
+		return []entity.Product{}, missing, nil
+	}
+
+	found, err := u.repo.GetByIDs(ctx, objIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[primitive.ObjectID]entity.Product, len(found))
+	for _, p := range found {
+		byID[p.ID] = p
+	}
+	products := make([]entity.Product, 0, len(found))
+	for _, objID := range objIDs {
+		p, ok := byID[objID]
+		if !ok {
+			missing = append(missing, objID.Hex())
+			continue
+		}
+		products = append(products, p)
+	}
+	return products, missing, nil
+}
+
+// ReserveStock permanently decrements stock, all-or-nothing: either every item
+// is decremented or none is, in which case ErrInsufficientStock is returned
+// along with per-item failures. Use a reservation for a hold that can be undone.
+func (u *productUsecase) ReserveStock(ctx context.Context, items []entity.ReserveItem) ([]entity.ReserveFailure, error) {
+	merged, err := mergeReserveItems(items)
+	if err != nil {
+		return nil, err
+	}
+
+	alloc, err := newAllocator(ctx, u.warehouses, u.rule)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := u.repo.Reserve(ctx, merged, alloc)
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		return failures, ErrInsufficientStock
+	}
+	return nil, nil
 }
 
-func (u *productUsecase) DeleteProduct(ctx context.Context, id string) error {
-	return u.repo.Delete(ctx, id)
+// mergeReserveItems validates items and folds duplicate product lines, for
+// the same warehouse or none, together so stock checks see the full requested
+// quantity.
+func mergeReserveItems(items []entity.ReserveItem) ([]entity.ReserveItem, error) {
+	if len(items) == 0 {
+		return nil, ErrInvalidReservation
+	}
+	merged := make([]entity.ReserveItem, 0, len(items))
+	index := make(map[entity.ReserveItem]int, len(items))
+	for _, it := range items {
+		if it.ProductID == "" || it.Quantity <= 0 {
+			return nil, ErrInvalidReservation
+		}
+		key := entity.ReserveItem{ProductID: it.ProductID, WarehouseID: it.WarehouseID}
+		if i, ok := index[key]; ok {
+			merged[i].Quantity += it.Quantity
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, it)
+	}
+	return merged, nil
 }
 
-func (u *productUsecase) ListProducts(ctx context.Context) ([]entity.Product, error) {
-	return u.repo.List(ctx)
+func mapProductErr(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrProductNotFound):
+		return ErrProductNotFound
+	case errors.Is(err, repository.ErrVersionConflict):
+		return ErrVersionConflict
+	default:
+		return err
+	}
 }
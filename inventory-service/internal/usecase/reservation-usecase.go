@@ -0,0 +1,197 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+)
+
+var (
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrReservationClosed   = errors.New("reservation is no longer held")
+	ErrReservationExpired  = errors.New("reservation expired")
+)
+
+// maxReservationTTL caps client supplied TTLs so a hold cannot pin stock for days.
+const maxReservationTTL = 24 * time.Hour
+
+// sweepBatch is how many expired holds ReleaseExpired loads at a time.
+const sweepBatch = 100
+
+type ReservationUsecase interface {
+	CreateReservation(ctx context.Context, req *entity.CreateReservationRequest) (*entity.Reservation, []entity.ReserveFailure, error)
+	GetReservation(ctx context.Context, id string) (*entity.Reservation, error)
+	// ListReservations returns the reservations placed under reference, so a
+	// caller that lost the answer to a create can find its hold.
+	ListReservations(ctx context.Context, reference string) ([]entity.Reservation, error)
+	AmendReservation(ctx context.Context, id string, req *entity.AmendReservationRequest) (*entity.Reservation, []entity.ReserveFailure, error)
+	CommitReservation(ctx context.Context, id string) (*entity.Reservation, error)
+	ReleaseReservation(ctx context.Context, id string) (*entity.Reservation, error)
+	ReturnReservation(ctx context.Context, id string, req *entity.ReturnReservationRequest) (*entity.Reservation, error)
+	ReleaseExpired(ctx context.Context) (int, error)
+}
+
+type reservationUsecase struct {
+	repo       repository.ReservationRepository
+	warehouses repository.WarehouseRepository
+	rule       entity.AllocationRule
+	defaultTTL time.Duration
+}
+
+func NewReservationUsecase(r repository.ReservationRepository, warehouses repository.WarehouseRepository, rule entity.AllocationRule, defaultTTL time.Duration) ReservationUsecase {
+	return &reservationUsecase{repo: r, warehouses: warehouses, rule: rule, defaultTTL: defaultTTL}
+}
+
+func (u *reservationUsecase) CreateReservation(ctx context.Context, req *entity.CreateReservationRequest) (*entity.Reservation, []entity.ReserveFailure, error) {
+	items, err := mergeReserveItems(req.Items)
+	if err != nil {
+		return nil, nil, err
+	}
+	ttl := u.defaultTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > maxReservationTTL {
+		ttl = maxReservationTTL
+	}
+
+	now := time.Now().UTC()
+	res := &entity.Reservation{
+		Reference: req.Reference,
+		Items:     items,
+		Status:    entity.ReservationHeld,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	alloc, err := newAllocator(ctx, u.warehouses, u.rule)
+	if err != nil {
+		return nil, nil, err
+	}
+	failures, err := u.repo.Create(ctx, res, alloc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(failures) > 0 {
+		return nil, failures, ErrInsufficientStock
+	}
+	return res, nil, nil
+}
+
+func (u *reservationUsecase) GetReservation(ctx context.Context, id string) (*entity.Reservation, error) {
+	res, err := u.repo.GetByID(ctx, id)
+	return res, mapReservationErr(err)
+}
+
+func (u *reservationUsecase) ListReservations(ctx context.Context, reference string) ([]entity.Reservation, error) {
+	if reference == "" {
+		return nil, fmt.Errorf("%w: reference is required", ErrInvalidReservation)
+	}
+	return u.repo.ListByReference(ctx, reference)
+}
+
+// AmendReservation replaces the items of a held reservation, keeping its
+// expiry. Like commit it refuses holds that are past their expiry.
+func (u *reservationUsecase) AmendReservation(ctx context.Context, id string, req *entity.AmendReservationRequest) (*entity.Reservation, []entity.ReserveFailure, error) {
+	items, err := mergeReserveItems(req.Items)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := u.checkExpiry(ctx, id); err != nil {
+		return nil, nil, err
+	}
+	alloc, err := newAllocator(ctx, u.warehouses, u.rule)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, failures, err := u.repo.Amend(ctx, id, items, alloc)
+	if err != nil {
+		return nil, nil, mapReservationErr(err)
+	}
+	if len(failures) > 0 {
+		return nil, failures, ErrInsufficientStock
+	}
+	return res, nil, nil
+}
+
+// CommitReservation refuses holds past their expiry even if the sweeper has not
+// reached them yet, and releases them on the spot.
+func (u *reservationUsecase) CommitReservation(ctx context.Context, id string) (*entity.Reservation, error) {
+	if err := u.checkExpiry(ctx, id); err != nil {
+		return nil, err
+	}
+	res, err := u.repo.Commit(ctx, id)
+	return res, mapReservationErr(err)
+}
+
+// checkExpiry releases a hold that is past its expiry but not swept yet and
+// reports ErrReservationExpired for it.
+func (u *reservationUsecase) checkExpiry(ctx context.Context, id string) error {
+	res, err := u.repo.GetByID(ctx, id)
+	if err != nil {
+		return mapReservationErr(err)
+	}
+	if res.Status == entity.ReservationHeld && !res.ExpiresAt.After(time.Now()) {
+		if _, err := u.repo.Release(ctx, id, entity.ReservationExpired); err != nil {
+			return mapReservationErr(err)
+		}
+		return ErrReservationExpired
+	}
+	return nil
+}
+
+func (u *reservationUsecase) ReleaseReservation(ctx context.Context, id string) (*entity.Reservation, error) {
+	res, err := u.repo.Release(ctx, id, entity.ReservationReleased)
+	return res, mapReservationErr(err)
+}
+
+func (u *reservationUsecase) ReturnReservation(ctx context.Context, id string, req *entity.ReturnReservationRequest) (*entity.Reservation, error) {
+	var items []entity.ReturnItem
+	if len(req.Items) > 0 {
+		items = req.Items
+	}
+	res, err := u.repo.Return(ctx, id, req.Reference, items)
+	return res, mapReservationErr(err)
+}
+
+// ReleaseExpired returns every expired hold to stock and reports how many
+// were released.
+func (u *reservationUsecase) ReleaseExpired(ctx context.Context) (int, error) {
+	released := 0
+	for {
+		expired, err := u.repo.ListExpired(ctx, time.Now().UTC(), sweepBatch)
+		if err != nil {
+			return released, err
+		}
+		for _, res := range expired {
+			if _, err := u.repo.Release(ctx, res.ID.Hex(), entity.ReservationExpired); err != nil {
+				if errors.Is(err, repository.ErrReservationClosed) {
+					// committed between the listing and the release
+					continue
+				}
+				return released, err
+			}
+			released++
+		}
+		if len(expired) < sweepBatch {
+			return released, nil
+		}
+	}
+}
+
+func mapReservationErr(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrReservationNotFound):
+		return ErrReservationNotFound
+	case errors.Is(err, repository.ErrReservationClosed):
+		return ErrReservationClosed
+	case errors.Is(err, repository.ErrOverReturn):
+		return fmt.Errorf("%w: %v", ErrInvalidReservation, err)
+	default:
+		return err
+	}
+}
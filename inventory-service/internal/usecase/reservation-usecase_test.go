@@ -0,0 +1,277 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memReservations holds stock like the reservation repository does: a hold
+// takes from available, committing keeps it taken and releasing gives it
+// back. The other methods are not used.
+type memReservations struct {
+	repository.ReservationRepository
+	available map[string]int
+	byID      map[primitive.ObjectID]*entity.Reservation
+	// beforeClose runs before a hold is closed, to race the close.
+	beforeClose func(id string)
+}
+
+func newMemReservations(available map[string]int) *memReservations {
+	return &memReservations{available: available, byID: map[primitive.ObjectID]*entity.Reservation{}}
+}
+
+func (r *memReservations) Create(ctx context.Context, res *entity.Reservation, alloc entity.Allocator) ([]entity.ReserveFailure, error) {
+	var failures []entity.ReserveFailure
+	for _, it := range res.Items {
+		if it.Quantity > r.available[it.ProductID] {
+			failures = append(failures, entity.ReserveFailure{ProductID: it.ProductID, Requested: it.Quantity, Available: r.available[it.ProductID], Reason: "insufficient stock"})
+		}
+	}
+	if len(failures) > 0 {
+		return failures, nil
+	}
+	for _, it := range res.Items {
+		r.available[it.ProductID] -= it.Quantity
+	}
+	res.ID = primitive.NewObjectID()
+	stored := *res
+	r.byID[res.ID] = &stored
+	return nil, nil
+}
+
+func (r *memReservations) GetByID(ctx context.Context, id string) (*entity.Reservation, error) {
+	objID, _ := primitive.ObjectIDFromHex(id)
+	res, ok := r.byID[objID]
+	if !ok {
+		return nil, repository.ErrReservationNotFound
+	}
+	cp := *res
+	return &cp, nil
+}
+
+func (r *memReservations) Commit(ctx context.Context, id string) (*entity.Reservation, error) {
+	return r.close(id, entity.ReservationCommitted)
+}
+
+func (r *memReservations) Release(ctx context.Context, id string, final entity.ReservationStatus) (*entity.Reservation, error) {
+	return r.close(id, final)
+}
+
+func (r *memReservations) close(id string, final entity.ReservationStatus) (*entity.Reservation, error) {
+	if r.beforeClose != nil {
+		r.beforeClose(id)
+	}
+	objID, _ := primitive.ObjectIDFromHex(id)
+	res, ok := r.byID[objID]
+	switch {
+	case !ok:
+		return nil, repository.ErrReservationNotFound
+	case res.Status == entity.ReservationHeld:
+		res.Status = final
+		if final != entity.ReservationCommitted {
+			for _, it := range res.Items {
+				r.available[it.ProductID] += it.Quantity
+			}
+		}
+	case res.Status == final:
+	case final != entity.ReservationCommitted && res.Status != entity.ReservationCommitted:
+	default:
+		return nil, repository.ErrReservationClosed
+	}
+	cp := *res
+	return &cp, nil
+}
+
+func (r *memReservations) ListExpired(ctx context.Context, now time.Time, limit int64) ([]entity.Reservation, error) {
+	var out []entity.Reservation
+	for _, res := range r.byID {
+		if res.Status == entity.ReservationHeld && !res.ExpiresAt.After(now) {
+			out = append(out, *res)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ExpiresAt.Before(out[j].ExpiresAt) })
+	if int64(len(out)) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// expire moves the expiry of a hold into the past.
+func (r *memReservations) expire(id primitive.ObjectID) {
+	r.byID[id].ExpiresAt = time.Now().Add(-time.Second)
+}
+
+// noWarehouses allocates by rule alone; the other methods are not used.
+type noWarehouses struct {
+	repository.WarehouseRepository
+}
+
+func (noWarehouses) List(ctx context.Context, activeOnly bool) ([]entity.Warehouse, error) {
+	return nil, nil
+}
+
+func newReservations(available map[string]int) (*memReservations, ReservationUsecase) {
+	repo := newMemReservations(available)
+	return repo, NewReservationUsecase(repo, noWarehouses{}, entity.AllocationRule(""), 15*time.Minute)
+}
+
+func hold(t *testing.T, uc ReservationUsecase, items ...entity.ReserveItem) *entity.Reservation {
+	t.Helper()
+	res, failures, err := uc.CreateReservation(context.Background(), &entity.CreateReservationRequest{Reference: "order_1", Items: items})
+	if err != nil {
+		t.Fatalf("hold: %v %v", err, failures)
+	}
+	return res
+}
+
+func TestCreateReservation(t *testing.T) {
+	repo, uc := newReservations(map[string]int{"p1": 5, "p2": 1})
+	before := time.Now()
+	res := hold(t, uc, entity.ReserveItem{ProductID: "p1", Quantity: 2}, entity.ReserveItem{ProductID: "p1", Quantity: 1}, entity.ReserveItem{ProductID: "p2", Quantity: 1})
+	if res.Status != entity.ReservationHeld || len(res.Items) != 2 || res.Items[0].Quantity != 3 {
+		t.Fatalf("held %+v, want p1 merged to 3", res)
+	}
+	if ttl := res.ExpiresAt.Sub(before); ttl < 15*time.Minute || ttl > 16*time.Minute {
+		t.Errorf("expires in %v, want the default 15m", ttl)
+	}
+	if repo.available["p1"] != 2 || repo.available["p2"] != 0 {
+		t.Errorf("available = %v", repo.available)
+	}
+
+	// short stock holds nothing and says what is missing
+	_, failures, err := uc.CreateReservation(context.Background(), &entity.CreateReservationRequest{Items: []entity.ReserveItem{{ProductID: "p1", Quantity: 1}, {ProductID: "p2", Quantity: 1}}})
+	if !errors.Is(err, ErrInsufficientStock) || len(failures) != 1 || failures[0].ProductID != "p2" {
+		t.Fatalf("err = %v, failures = %+v", err, failures)
+	}
+	if repo.available["p1"] != 2 {
+		t.Errorf("p1 available = %d, a failed hold took stock", repo.available["p1"])
+	}
+
+	// client TTLs are capped
+	res, _, err = uc.CreateReservation(context.Background(), &entity.CreateReservationRequest{TTLSeconds: 7 * 24 * 3600, Items: []entity.ReserveItem{{ProductID: "p1", Quantity: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := time.Until(res.ExpiresAt); ttl > maxReservationTTL {
+		t.Errorf("expires in %v, want at most %v", ttl, maxReservationTTL)
+	}
+
+	for _, items := range [][]entity.ReserveItem{nil, {{ProductID: "p1"}}, {{Quantity: 1}}} {
+		if _, _, err := uc.CreateReservation(context.Background(), &entity.CreateReservationRequest{Items: items}); !errors.Is(err, ErrInvalidReservation) {
+			t.Errorf("items %+v: err = %v, want ErrInvalidReservation", items, err)
+		}
+	}
+}
+
+func TestCommitAndReleaseReservation(t *testing.T) {
+	ctx := context.Background()
+	repo, uc := newReservations(map[string]int{"p1": 5})
+	committed := hold(t, uc, entity.ReserveItem{ProductID: "p1", Quantity: 2})
+	released := hold(t, uc, entity.ReserveItem{ProductID: "p1", Quantity: 1})
+	if repo.available["p1"] != 2 {
+		t.Fatalf("available = %d, want 2", repo.available["p1"])
+	}
+
+	if res, err := uc.CommitReservation(ctx, committed.ID.Hex()); err != nil || res.Status != entity.ReservationCommitted {
+		t.Fatalf("commit: %v %+v", err, res)
+	}
+	if res, err := uc.ReleaseReservation(ctx, released.ID.Hex()); err != nil || res.Status != entity.ReservationReleased {
+		t.Fatalf("release: %v %+v", err, res)
+	}
+	if repo.available["p1"] != 3 {
+		t.Errorf("available = %d, want the released 1 back and the committed 2 gone", repo.available["p1"])
+	}
+
+	// repeats are no-ops, crossing over is refused
+	if _, err := uc.CommitReservation(ctx, committed.ID.Hex()); err != nil {
+		t.Errorf("commit again: %v", err)
+	}
+	if _, err := uc.ReleaseReservation(ctx, released.ID.Hex()); err != nil {
+		t.Errorf("release again: %v", err)
+	}
+	if _, err := uc.ReleaseReservation(ctx, committed.ID.Hex()); !errors.Is(err, ErrReservationClosed) {
+		t.Errorf("release committed: err = %v, want ErrReservationClosed", err)
+	}
+	if _, err := uc.CommitReservation(ctx, released.ID.Hex()); !errors.Is(err, ErrReservationClosed) {
+		t.Errorf("commit released: err = %v, want ErrReservationClosed", err)
+	}
+	if repo.available["p1"] != 3 {
+		t.Errorf("available = %d after repeats, want 3", repo.available["p1"])
+	}
+
+	if _, err := uc.CommitReservation(ctx, primitive.NewObjectID().Hex()); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("commit unknown: err = %v, want ErrReservationNotFound", err)
+	}
+}
+
+func TestCommitReleasesAnExpiredHold(t *testing.T) {
+	repo, uc := newReservations(map[string]int{"p1": 5})
+	res := hold(t, uc, entity.ReserveItem{ProductID: "p1", Quantity: 2})
+	repo.expire(res.ID)
+
+	if _, err := uc.CommitReservation(context.Background(), res.ID.Hex()); !errors.Is(err, ErrReservationExpired) {
+		t.Fatalf("err = %v, want ErrReservationExpired", err)
+	}
+	if got := repo.byID[res.ID].Status; got != entity.ReservationExpired {
+		t.Errorf("status = %s, want expired", got)
+	}
+	if repo.available["p1"] != 5 {
+		t.Errorf("available = %d, want the hold back", repo.available["p1"])
+	}
+	// later attempts see the hold as gone
+	if _, err := uc.CommitReservation(context.Background(), res.ID.Hex()); !errors.Is(err, ErrReservationClosed) {
+		t.Errorf("commit again: err = %v, want ErrReservationClosed", err)
+	}
+}
+
+func TestReleaseExpired(t *testing.T) {
+	repo, uc := newReservations(map[string]int{"p1": 1000})
+	var expired []primitive.ObjectID
+	for i := 0; i < sweepBatch+20; i++ {
+		res := hold(t, uc, entity.ReserveItem{ProductID: "p1", Quantity: 1})
+		repo.expire(res.ID)
+		expired = append(expired, res.ID)
+	}
+	live := hold(t, uc, entity.ReserveItem{ProductID: "p1", Quantity: 1})
+	// one expired hold is committed between the listing and its release
+	raced := expired[len(expired)-1]
+	repo.beforeClose = func(id string) {
+		if id == raced.Hex() && repo.byID[raced].Status == entity.ReservationHeld {
+			repo.byID[raced].Status = entity.ReservationCommitted
+		}
+	}
+
+	n, err := uc.ReleaseExpired(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(expired)-1 {
+		t.Errorf("released %d, want %d", n, len(expired)-1)
+	}
+	for _, id := range expired[:len(expired)-1] {
+		if got := repo.byID[id].Status; got != entity.ReservationExpired {
+			t.Fatalf("hold %s is %s, want expired", id.Hex(), got)
+		}
+	}
+	if got := repo.byID[raced].Status; got != entity.ReservationCommitted {
+		t.Errorf("raced hold is %s, want committed", got)
+	}
+	if got := repo.byID[live.ID].Status; got != entity.ReservationHeld {
+		t.Errorf("live hold is %s, want held", got)
+	}
+	if repo.available["p1"] != 1000-2 {
+		t.Errorf("available = %d, want all but the live and the committed hold", repo.available["p1"])
+	}
+
+	// nothing left to sweep
+	if n, err := uc.ReleaseExpired(context.Background()); err != nil || n != 0 {
+		t.Errorf("second sweep released %d, %v", n, err)
+	}
+}
@@ -0,0 +1,150 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrTransferNotFound = errors.New("transfer not found")
+	ErrTransferState    = errors.New("transfer is not in a state that allows this")
+	ErrInvalidTransfer  = errors.New("invalid transfer")
+)
+
+type TransferUsecase interface {
+	CreateTransfer(ctx context.Context, req *entity.CreateTransferRequest) (*entity.Transfer, error)
+	GetTransfer(ctx context.Context, id string) (*entity.Transfer, error)
+	ListTransfers(ctx context.Context, filter entity.TransferFilter) ([]entity.Transfer, error)
+	CancelTransfer(ctx context.Context, id string) (*entity.Transfer, error)
+	DispatchTransfer(ctx context.Context, id string) (*entity.Transfer, error)
+	ReceiveTransfer(ctx context.Context, id string, req *entity.ReceiveTransferRequest) (*entity.Transfer, error)
+}
+
+type transferUsecase struct {
+	repo       repository.TransferRepository
+	products   repository.ProductRepository
+	warehouses repository.WarehouseRepository
+}
+
+func NewTransferUsecase(r repository.TransferRepository, products repository.ProductRepository, warehouses repository.WarehouseRepository) TransferUsecase {
+	return &transferUsecase{repo: r, products: products, warehouses: warehouses}
+}
+
+// CreateTransfer drafts a transfer between two different warehouses. Lines
+// for the same product are folded together; stock is only checked on
+// dispatch.
+func (u *transferUsecase) CreateTransfer(ctx context.Context, req *entity.CreateTransferRequest) (*entity.Transfer, error) {
+	source, err := u.warehouse(ctx, req.SourceID)
+	if err != nil {
+		return nil, err
+	}
+	destination, err := u.warehouse(ctx, req.DestinationID)
+	if err != nil {
+		return nil, err
+	}
+	if source.ID == destination.ID {
+		return nil, fmt.Errorf("%w: source and destination are the same warehouse", ErrInvalidTransfer)
+	}
+
+	var lines []entity.TransferLine
+	index := make(map[string]int, len(req.Lines))
+	ids := make([]primitive.ObjectID, 0, len(req.Lines))
+	for _, l := range req.Lines {
+		if l.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidTransfer)
+		}
+		if i, ok := index[l.ProductID]; ok {
+			lines[i].Quantity += l.Quantity
+			continue
+		}
+		objID, err := primitive.ObjectIDFromHex(l.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown product %s", ErrInvalidTransfer, l.ProductID)
+		}
+		index[l.ProductID] = len(lines)
+		ids = append(ids, objID)
+		lines = append(lines, entity.TransferLine{ProductID: l.ProductID, Quantity: l.Quantity})
+	}
+	found, err := u.products.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) != len(ids) {
+		return nil, fmt.Errorf("%w: unknown product", ErrInvalidTransfer)
+	}
+
+	now := time.Now().UTC()
+	t := &entity.Transfer{
+		SourceID:      source.ID,
+		DestinationID: destination.ID,
+		Lines:         lines,
+		Status:        entity.TransferDraft,
+		Note:          req.Note,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := u.repo.Create(ctx, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (u *transferUsecase) warehouse(ctx context.Context, id string) (*entity.Warehouse, error) {
+	w, err := u.warehouses.GetByID(ctx, id)
+	if errors.Is(err, repository.ErrWarehouseNotFound) {
+		return nil, fmt.Errorf("%w: unknown warehouse %s", ErrInvalidTransfer, id)
+	}
+	return w, err
+}
+
+func (u *transferUsecase) GetTransfer(ctx context.Context, id string) (*entity.Transfer, error) {
+	t, err := u.repo.GetByID(ctx, id)
+	return t, mapTransferErr(err)
+}
+
+func (u *transferUsecase) ListTransfers(ctx context.Context, filter entity.TransferFilter) ([]entity.Transfer, error) {
+	if filter.Limit <= 0 || filter.Limit > maxPageSize {
+		filter.Limit = maxPageSize
+	}
+	return u.repo.List(ctx, filter)
+}
+
+func (u *transferUsecase) CancelTransfer(ctx context.Context, id string) (*entity.Transfer, error) {
+	t, err := u.repo.Cancel(ctx, id)
+	return t, mapTransferErr(err)
+}
+
+func (u *transferUsecase) DispatchTransfer(ctx context.Context, id string) (*entity.Transfer, error) {
+	t, err := u.repo.Dispatch(ctx, id)
+	return t, mapTransferErr(err)
+}
+
+func (u *transferUsecase) ReceiveTransfer(ctx context.Context, id string, req *entity.ReceiveTransferRequest) (*entity.Transfer, error) {
+	var receipt []entity.ReceiptLine
+	if len(req.Lines) > 0 {
+		receipt = req.Lines
+	}
+	t, err := u.repo.Receive(ctx, id, receipt)
+	return t, mapTransferErr(err)
+}
+
+func mapTransferErr(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrTransferNotFound):
+		return ErrTransferNotFound
+	case errors.Is(err, repository.ErrTransferState):
+		return ErrTransferState
+	case errors.Is(err, repository.ErrOverReceipt), errors.Is(err, repository.ErrProductNotFound):
+		return fmt.Errorf("%w: %v", ErrInvalidTransfer, err)
+	case errors.Is(err, repository.ErrInsufficientStock):
+		return fmt.Errorf("%w: %v", ErrInsufficientStock, err)
+	default:
+		return err
+	}
+}
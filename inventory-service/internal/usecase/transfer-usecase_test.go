@@ -0,0 +1,280 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	whNorth = primitive.ObjectID{1}
+	whSouth = primitive.ObjectID{2}
+	drill   = primitive.ObjectID{10}
+	saw     = primitive.ObjectID{11}
+)
+
+// stockAt keys on-hand stock by product and warehouse.
+type stockAt struct {
+	product   string
+	warehouse primitive.ObjectID
+}
+
+// memTransfers moves stock like the transfer repository does: dispatch
+// takes every line out of the source or nothing, receipts put what arrived
+// into the destination. The other methods are not used.
+type memTransfers struct {
+	repository.TransferRepository
+	stock map[stockAt]int
+	byID  map[primitive.ObjectID]*entity.Transfer
+}
+
+func (r *memTransfers) Create(ctx context.Context, t *entity.Transfer) error {
+	t.ID = primitive.NewObjectID()
+	stored := *t
+	stored.Lines = append([]entity.TransferLine(nil), t.Lines...)
+	r.byID[t.ID] = &stored
+	return nil
+}
+
+func (r *memTransfers) find(id string) (*entity.Transfer, error) {
+	objID, _ := primitive.ObjectIDFromHex(id)
+	t, ok := r.byID[objID]
+	if !ok {
+		return nil, repository.ErrTransferNotFound
+	}
+	return t, nil
+}
+
+func (r *memTransfers) snapshot(t *entity.Transfer) *entity.Transfer {
+	cp := *t
+	cp.Lines = append([]entity.TransferLine(nil), t.Lines...)
+	return &cp
+}
+
+func (r *memTransfers) GetByID(ctx context.Context, id string) (*entity.Transfer, error) {
+	t, err := r.find(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.snapshot(t), nil
+}
+
+func (r *memTransfers) Cancel(ctx context.Context, id string) (*entity.Transfer, error) {
+	t, err := r.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Status != entity.TransferDraft {
+		return nil, repository.ErrTransferState
+	}
+	t.Status = entity.TransferCancelled
+	return r.snapshot(t), nil
+}
+
+func (r *memTransfers) Dispatch(ctx context.Context, id string) (*entity.Transfer, error) {
+	t, err := r.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Status != entity.TransferDraft {
+		return nil, repository.ErrTransferState
+	}
+	for _, l := range t.Lines {
+		if r.stock[stockAt{l.ProductID, t.SourceID}] < l.Quantity {
+			return nil, repository.ErrInsufficientStock
+		}
+	}
+	for _, l := range t.Lines {
+		r.stock[stockAt{l.ProductID, t.SourceID}] -= l.Quantity
+	}
+	t.Status = entity.TransferInTransit
+	return r.snapshot(t), nil
+}
+
+func (r *memTransfers) Receive(ctx context.Context, id string, receipt []entity.ReceiptLine) (*entity.Transfer, error) {
+	t, err := r.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Status != entity.TransferInTransit && t.Status != entity.TransferPartiallyReceived {
+		return nil, repository.ErrTransferState
+	}
+	arrived := map[string]int{}
+	for _, l := range t.Lines {
+		if receipt == nil {
+			arrived[l.ProductID] = l.Outstanding()
+		}
+	}
+	for _, rl := range receipt {
+		arrived[rl.ProductID] += rl.Quantity
+	}
+	for i := range t.Lines {
+		if arrived[t.Lines[i].ProductID] > t.Lines[i].Outstanding() {
+			return nil, repository.ErrOverReceipt
+		}
+	}
+	done := true
+	for i := range t.Lines {
+		l := &t.Lines[i]
+		l.Received += arrived[l.ProductID]
+		r.stock[stockAt{l.ProductID, t.DestinationID}] += arrived[l.ProductID]
+		if l.Outstanding() > 0 {
+			done = false
+		}
+	}
+	t.Status = entity.TransferPartiallyReceived
+	if done {
+		t.Status = entity.TransferReceived
+	}
+	return r.snapshot(t), nil
+}
+
+// knownProducts finds the products it lists; the other methods are not used.
+type knownProducts struct {
+	repository.ProductRepository
+	ids []primitive.ObjectID
+}
+
+func (r knownProducts) GetByIDs(ctx context.Context, ids []primitive.ObjectID) ([]entity.Product, error) {
+	var out []entity.Product
+	for _, id := range ids {
+		for _, known := range r.ids {
+			if id == known {
+				out = append(out, entity.Product{ID: id})
+			}
+		}
+	}
+	return out, nil
+}
+
+// knownWarehouses finds the warehouses it lists; the other methods are not
+// used.
+type knownWarehouses struct {
+	repository.WarehouseRepository
+	ids []primitive.ObjectID
+}
+
+func (r knownWarehouses) GetByID(ctx context.Context, id string) (*entity.Warehouse, error) {
+	for _, known := range r.ids {
+		if known.Hex() == id {
+			return &entity.Warehouse{ID: known, Active: true}, nil
+		}
+	}
+	return nil, repository.ErrWarehouseNotFound
+}
+
+func newTransfers(stock map[stockAt]int) (*memTransfers, TransferUsecase) {
+	repo := &memTransfers{stock: stock, byID: map[primitive.ObjectID]*entity.Transfer{}}
+	uc := NewTransferUsecase(repo, knownProducts{ids: []primitive.ObjectID{drill, saw}}, knownWarehouses{ids: []primitive.ObjectID{whNorth, whSouth}})
+	return repo, uc
+}
+
+func draft(lines ...entity.TransferLine) *entity.CreateTransferRequest {
+	return &entity.CreateTransferRequest{SourceID: whNorth.Hex(), DestinationID: whSouth.Hex(), Lines: lines}
+}
+
+func TestCreateTransfer(t *testing.T) {
+	_, uc := newTransfers(map[stockAt]int{})
+	tr, err := uc.CreateTransfer(context.Background(), draft(
+		entity.TransferLine{ProductID: drill.Hex(), Quantity: 2},
+		entity.TransferLine{ProductID: saw.Hex(), Quantity: 1},
+		entity.TransferLine{ProductID: drill.Hex(), Quantity: 3},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Status != entity.TransferDraft || len(tr.Lines) != 2 || tr.Lines[0].Quantity != 5 {
+		t.Errorf("drafted %+v, want the drill lines folded into 5", tr)
+	}
+
+	tests := []struct {
+		name string
+		req  *entity.CreateTransferRequest
+	}{
+		{"same warehouse", &entity.CreateTransferRequest{SourceID: whNorth.Hex(), DestinationID: whNorth.Hex(), Lines: []entity.TransferLine{{ProductID: drill.Hex(), Quantity: 1}}}},
+		{"unknown warehouse", &entity.CreateTransferRequest{SourceID: whNorth.Hex(), DestinationID: primitive.NewObjectID().Hex(), Lines: []entity.TransferLine{{ProductID: drill.Hex(), Quantity: 1}}}},
+		{"unknown product", draft(entity.TransferLine{ProductID: primitive.NewObjectID().Hex(), Quantity: 1})},
+		{"malformed product", draft(entity.TransferLine{ProductID: "drill", Quantity: 1})},
+		{"no quantity", draft(entity.TransferLine{ProductID: drill.Hex()})},
+	}
+	for _, tt := range tests {
+		if _, err := uc.CreateTransfer(context.Background(), tt.req); !errors.Is(err, ErrInvalidTransfer) {
+			t.Errorf("%s: err = %v, want ErrInvalidTransfer", tt.name, err)
+		}
+	}
+}
+
+func TestTransferMovesStock(t *testing.T) {
+	ctx := context.Background()
+	repo, uc := newTransfers(map[stockAt]int{{drill.Hex(), whNorth}: 5, {saw.Hex(), whNorth}: 1})
+	tr, err := uc.CreateTransfer(ctx, draft(entity.TransferLine{ProductID: drill.Hex(), Quantity: 4}, entity.TransferLine{ProductID: saw.Hex(), Quantity: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := tr.ID.Hex()
+
+	if tr, err = uc.DispatchTransfer(ctx, id); err != nil || tr.Status != entity.TransferInTransit {
+		t.Fatalf("dispatch: %v %+v", err, tr)
+	}
+	if got := repo.stock[stockAt{drill.Hex(), whNorth}]; got != 1 {
+		t.Errorf("drills left at the source = %d, want 1", got)
+	}
+	if _, err := uc.CancelTransfer(ctx, id); !errors.Is(err, ErrTransferState) {
+		t.Errorf("cancel in transit: err = %v, want ErrTransferState", err)
+	}
+
+	tr, err = uc.ReceiveTransfer(ctx, id, &entity.ReceiveTransferRequest{Lines: []entity.ReceiptLine{{ProductID: drill.Hex(), Quantity: 3}}})
+	if err != nil || tr.Status != entity.TransferPartiallyReceived {
+		t.Fatalf("receive part: %v %+v", err, tr)
+	}
+	if _, err := uc.ReceiveTransfer(ctx, id, &entity.ReceiveTransferRequest{Lines: []entity.ReceiptLine{{ProductID: drill.Hex(), Quantity: 2}}}); !errors.Is(err, ErrInvalidTransfer) {
+		t.Errorf("receive more than outstanding: err = %v, want ErrInvalidTransfer", err)
+	}
+
+	// no lines takes the rest
+	if tr, err = uc.ReceiveTransfer(ctx, id, &entity.ReceiveTransferRequest{}); err != nil || tr.Status != entity.TransferReceived {
+		t.Fatalf("receive the rest: %v %+v", err, tr)
+	}
+	if got := repo.stock[stockAt{drill.Hex(), whSouth}]; got != 4 {
+		t.Errorf("drills at the destination = %d, want 4", got)
+	}
+	if got := repo.stock[stockAt{saw.Hex(), whSouth}]; got != 1 {
+		t.Errorf("saws at the destination = %d, want 1", got)
+	}
+	if _, err := uc.ReceiveTransfer(ctx, id, &entity.ReceiveTransferRequest{}); !errors.Is(err, ErrTransferState) {
+		t.Errorf("receive a received transfer: err = %v, want ErrTransferState", err)
+	}
+}
+
+func TestTransferDispatchNeedsEveryLine(t *testing.T) {
+	ctx := context.Background()
+	repo, uc := newTransfers(map[stockAt]int{{drill.Hex(), whNorth}: 5})
+	tr, err := uc.CreateTransfer(ctx, draft(entity.TransferLine{ProductID: drill.Hex(), Quantity: 2}, entity.TransferLine{ProductID: saw.Hex(), Quantity: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uc.DispatchTransfer(ctx, tr.ID.Hex()); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("err = %v, want ErrInsufficientStock", err)
+	}
+	if got := repo.stock[stockAt{drill.Hex(), whNorth}]; got != 5 {
+		t.Errorf("drills at the source = %d, a failed dispatch took some", got)
+	}
+	if _, err := uc.ReceiveTransfer(ctx, tr.ID.Hex(), &entity.ReceiveTransferRequest{}); !errors.Is(err, ErrTransferState) {
+		t.Errorf("receive a draft: err = %v, want ErrTransferState", err)
+	}
+
+	// a draft can still be cancelled, once
+	if tr, err := uc.CancelTransfer(ctx, tr.ID.Hex()); err != nil || tr.Status != entity.TransferCancelled {
+		t.Fatalf("cancel: %v %+v", err, tr)
+	}
+	if _, err := uc.DispatchTransfer(ctx, tr.ID.Hex()); !errors.Is(err, ErrTransferState) {
+		t.Errorf("dispatch cancelled: err = %v, want ErrTransferState", err)
+	}
+	if _, err := uc.GetTransfer(ctx, primitive.NewObjectID().Hex()); !errors.Is(err, ErrTransferNotFound) {
+		t.Errorf("get unknown: err = %v, want ErrTransferNotFound", err)
+	}
+}
@@ -0,0 +1,164 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrWarehouseNotFound  = errors.New("warehouse not found")
+	ErrWarehouseCodeTaken = errors.New("warehouse code already exists")
+	ErrWarehouseInUse     = errors.New("warehouse still holds stock or has open transfers")
+	ErrInvalidWarehouse   = errors.New("invalid warehouse")
+)
+
+type WarehouseUsecase interface {
+	CreateWarehouse(ctx context.Context, req *entity.CreateWarehouseRequest) (*entity.Warehouse, error)
+	GetWarehouse(ctx context.Context, id string) (*entity.Warehouse, error)
+	UpdateWarehouse(ctx context.Context, id string, req *entity.UpdateWarehouseRequest) (*entity.Warehouse, error)
+	DeleteWarehouse(ctx context.Context, id string) error
+	ListWarehouses(ctx context.Context) ([]entity.Warehouse, error)
+	// EnsureDefault returns the warehouse with code, creating it if needed.
+	EnsureDefault(ctx context.Context, code string) (*entity.Warehouse, error)
+}
+
+type warehouseUsecase struct {
+	repo repository.WarehouseRepository
+}
+
+func NewWarehouseUsecase(r repository.WarehouseRepository) WarehouseUsecase {
+	return &warehouseUsecase{repo: r}
+}
+
+func (u *warehouseUsecase) CreateWarehouse(ctx context.Context, req *entity.CreateWarehouseRequest) (*entity.Warehouse, error) {
+	code := entity.Slugify(req.Code)
+	if code == "" || req.Name == "" {
+		return nil, ErrInvalidWarehouse
+	}
+	now := time.Now().UTC()
+	w := &entity.Warehouse{
+		Code:      code,
+		Name:      req.Name,
+		Priority:  req.Priority,
+		Active:    req.Active == nil || *req.Active,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := u.repo.Create(ctx, w); err != nil {
+		return nil, mapWarehouseErr(err)
+	}
+	return w, nil
+}
+
+func (u *warehouseUsecase) GetWarehouse(ctx context.Context, id string) (*entity.Warehouse, error) {
+	w, err := u.repo.GetByID(ctx, id)
+	return w, mapWarehouseErr(err)
+}
+
+// UpdateWarehouse refuses to deactivate the default warehouse, which takes
+// stock that arrives without a location.
+func (u *warehouseUsecase) UpdateWarehouse(ctx context.Context, id string, req *entity.UpdateWarehouseRequest) (*entity.Warehouse, error) {
+	w, err := u.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, mapWarehouseErr(err)
+	}
+	if req.Name != nil {
+		if *req.Name == "" {
+			return nil, ErrInvalidWarehouse
+		}
+		w.Name = *req.Name
+	}
+	if req.Priority != nil {
+		w.Priority = *req.Priority
+	}
+	if req.Active != nil {
+		if !*req.Active && w.ID == entity.DefaultWarehouseID {
+			return nil, fmt.Errorf("%w: the default warehouse cannot be deactivated", ErrInvalidWarehouse)
+		}
+		w.Active = *req.Active
+	}
+	w.UpdatedAt = time.Now().UTC()
+	if err := u.repo.Update(ctx, w); err != nil {
+		return nil, mapWarehouseErr(err)
+	}
+	return w, nil
+}
+
+func (u *warehouseUsecase) DeleteWarehouse(ctx context.Context, id string) error {
+	w, err := u.repo.GetByID(ctx, id)
+	if err != nil {
+		return mapWarehouseErr(err)
+	}
+	if w.ID == entity.DefaultWarehouseID {
+		return fmt.Errorf("%w: the default warehouse cannot be deleted", ErrInvalidWarehouse)
+	}
+	return mapWarehouseErr(u.repo.Delete(ctx, w.ID))
+}
+
+func (u *warehouseUsecase) ListWarehouses(ctx context.Context) ([]entity.Warehouse, error) {
+	return u.repo.List(ctx, false)
+}
+
+func (u *warehouseUsecase) EnsureDefault(ctx context.Context, code string) (*entity.Warehouse, error) {
+	w, err := u.repo.GetByCode(ctx, code)
+	if err == nil {
+		return w, nil
+	}
+	if !errors.Is(err, repository.ErrWarehouseNotFound) {
+		return nil, err
+	}
+	w, err = u.CreateWarehouse(ctx, &entity.CreateWarehouseRequest{Code: code, Name: code})
+	if errors.Is(err, ErrWarehouseCodeTaken) {
+		// another replica created it first
+		return u.repo.GetByCode(ctx, code)
+	}
+	return w, err
+}
+
+// newAllocator returns an allocator drawing from the active warehouses.
+func newAllocator(ctx context.Context, warehouses repository.WarehouseRepository, rule entity.AllocationRule) (entity.Allocator, error) {
+	active, err := warehouses.List(ctx, true)
+	if err != nil {
+		return entity.Allocator{}, err
+	}
+	order := make([]primitive.ObjectID, 0, len(active))
+	for _, w := range active {
+		order = append(order, w.ID)
+	}
+	return entity.Allocator{Rule: rule, Order: order}, nil
+}
+
+// resolveWarehouse returns the id of the warehouse named by id, or the
+// default warehouse when id is empty.
+func resolveWarehouse(ctx context.Context, warehouses repository.WarehouseRepository, id string) (primitive.ObjectID, error) {
+	if id == "" {
+		return entity.DefaultWarehouseID, nil
+	}
+	w, err := warehouses.GetByID(ctx, id)
+	if errors.Is(err, repository.ErrWarehouseNotFound) {
+		return primitive.NilObjectID, fmt.Errorf("%w: unknown warehouse %s", ErrInvalidWarehouse, id)
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return w.ID, nil
+}
+
+func mapWarehouseErr(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrWarehouseNotFound):
+		return ErrWarehouseNotFound
+	case errors.Is(err, repository.ErrWarehouseCodeTaken):
+		return ErrWarehouseCodeTaken
+	case errors.Is(err, repository.ErrWarehouseInUse):
+		return ErrWarehouseInUse
+	default:
+		return err
+	}
+}
@@ -0,0 +1,232 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/entity"
+	"github.com/Nurda-zh/a1/inventory-service/internal/repository"
+	"github.com/Nurda-zh/a1/pkg/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrWebhookNotFound    = errors.New("webhook subscription not found")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	ErrInvalidWebhook     = webhook.ErrInvalidSubscription
+)
+
+const (
+	// webhookBatchSize caps the movements one EnqueueStockEvents call and
+	// the deliveries one DeliverDue call handle.
+	webhookBatchSize = 100
+	// webhookLease hides a claimed delivery from other replicas while it is
+	// being sent.
+	webhookLease = time.Minute
+)
+
+// webhookEventTypes are the event types a subscription may ask for.
+var webhookEventTypes = map[string]bool{
+	entity.EventStockChanged: true,
+}
+
+type WebhookUsecase interface {
+	CreateSubscription(ctx context.Context, req *entity.CreateWebhookRequest) (*entity.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id string) (*entity.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	ListDeadLetters(ctx context.Context, subscriptionID string) ([]entity.WebhookDelivery, error)
+	Redeliver(ctx context.Context, deadLetterID string) (*entity.WebhookDelivery, error)
+	// EnqueueStockEvents queues a stock.changed event for every new stock
+	// movement and returns how many movements it handled.
+	EnqueueStockEvents(ctx context.Context) (int, error)
+	// DeliverDue sends the deliveries that are due and returns how many
+	// went through.
+	DeliverDue(ctx context.Context) (int, error)
+}
+
+type webhookUsecase struct {
+	repo        repository.WebhookRepository
+	movements   repository.MovementRepository
+	sender      *webhook.Sender
+	maxAttempts int
+}
+
+// NewWebhookUsecase returns a usecase that gives up on a delivery after
+// maxAttempts failed attempts and moves it to the dead letters.
+func NewWebhookUsecase(r repository.WebhookRepository, movements repository.MovementRepository, sender *webhook.Sender, maxAttempts int) WebhookUsecase {
+	return &webhookUsecase{repo: r, movements: movements, sender: sender, maxAttempts: maxAttempts}
+}
+
+// CreateSubscription returns the subscription with its secret; later reads
+// leave the secret out.
+func (u *webhookUsecase) CreateSubscription(ctx context.Context, req *entity.CreateWebhookRequest) (*entity.WebhookSubscription, error) {
+	types, secret, err := webhook.CheckSubscription(req.URL, req.EventTypes, req.Secret, webhookEventTypes)
+	if err != nil {
+		return nil, err
+	}
+	s := &entity.WebhookSubscription{URL: req.URL, EventTypes: types, Secret: secret}
+	if err := u.repo.CreateSubscription(ctx, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (u *webhookUsecase) GetSubscription(ctx context.Context, id string) (*entity.WebhookSubscription, error) {
+	s, err := u.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, mapWebhookErr(err)
+	}
+	s.Secret = ""
+	return s, nil
+}
+
+func (u *webhookUsecase) ListSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	subs, err := u.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	return subs, nil
+}
+
+func (u *webhookUsecase) DeleteSubscription(ctx context.Context, id string) error {
+	return mapWebhookErr(u.repo.DeleteSubscription(ctx, id))
+}
+
+func (u *webhookUsecase) ListDeadLetters(ctx context.Context, subscriptionID string) ([]entity.WebhookDelivery, error) {
+	return u.repo.ListDeadLetters(ctx, subscriptionID, maxPageSize)
+}
+
+func (u *webhookUsecase) Redeliver(ctx context.Context, deadLetterID string) (*entity.WebhookDelivery, error) {
+	d, err := u.repo.Redeliver(ctx, deadLetterID)
+	return d, mapWebhookErr(err)
+}
+
+// EnqueueStockEvents marks movements notified only after their deliveries
+// are queued; a crash in between queues them again, which Enqueue skips.
+func (u *webhookUsecase) EnqueueStockEvents(ctx context.Context) (int, error) {
+	movements, err := u.movements.ListUnnotified(ctx, webhookBatchSize)
+	if err != nil || len(movements) == 0 {
+		return 0, err
+	}
+	subs, err := u.repo.SubscriptionsFor(ctx, entity.EventStockChanged)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	var deliveries []entity.WebhookDelivery
+	ids := make([]primitive.ObjectID, 0, len(movements))
+	for i := range movements {
+		m := &movements[i]
+		ids = append(ids, m.ID)
+		if len(subs) == 0 {
+			continue
+		}
+		payload, err := json.Marshal(webhook.Event{
+			ID:         m.ID.Hex(),
+			Type:       entity.EventStockChanged,
+			OccurredAt: m.CreatedAt,
+			Data:       m,
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, s := range subs {
+			deliveries = append(deliveries, entity.WebhookDelivery{
+				SubscriptionID: s.ID,
+				EventID:        m.ID.Hex(),
+				EventType:      entity.EventStockChanged,
+				Payload:        payload,
+				Status:         entity.DeliveryPending,
+				NextAttemptAt:  now,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			})
+		}
+	}
+	if err := u.repo.Enqueue(ctx, deliveries); err != nil {
+		return 0, err
+	}
+	if err := u.movements.MarkNotified(ctx, ids); err != nil {
+		return 0, err
+	}
+	return len(movements), nil
+}
+
+func (u *webhookUsecase) DeliverDue(ctx context.Context) (int, error) {
+	delivered := 0
+	for i := 0; i < webhookBatchSize; i++ {
+		d, err := u.repo.ClaimDue(ctx, time.Now().UTC(), webhookLease)
+		if err != nil {
+			return delivered, err
+		}
+		if d == nil {
+			break
+		}
+		if u.deliver(ctx, d) {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// deliver makes one attempt at d and records it: as delivered, for a retry
+// after webhook.Retry, or as a dead letter once maxAttempts ran out.
+func (u *webhookUsecase) deliver(ctx context.Context, d *entity.WebhookDelivery) bool {
+	d.Attempts++
+	s, err := u.repo.GetSubscription(ctx, d.SubscriptionID.Hex())
+	switch {
+	case errors.Is(err, repository.ErrWebhookNotFound):
+		d.LastError = "subscription was deleted"
+		d.Attempts = max(d.Attempts, u.maxAttempts)
+	case err != nil:
+		d.LastError = err.Error()
+	default:
+		d.LastStatusCode, err = u.sender.Send(ctx, s.URL, s.Secret, d.ID.Hex(), d.EventType, d.Payload)
+		if err == nil {
+			now := time.Now().UTC()
+			d.Status = entity.DeliveryDelivered
+			d.DeliveredAt = &now
+			d.LastError = ""
+			u.saveAttempt(ctx, d)
+			return true
+		}
+		d.LastError = err.Error()
+	}
+
+	next, retry := webhook.Retry(d.Attempts, u.maxAttempts, time.Now().UTC())
+	if !retry {
+		log.Printf("webhook delivery %s: giving up after %d attempts: %s", d.ID.Hex(), d.Attempts, d.LastError)
+		if err := u.repo.DeadLetter(ctx, d); err != nil {
+			log.Printf("webhook delivery %s: dead letter: %v", d.ID.Hex(), err)
+		}
+		return false
+	}
+	d.NextAttemptAt = next
+	u.saveAttempt(ctx, d)
+	return false
+}
+
+func (u *webhookUsecase) saveAttempt(ctx context.Context, d *entity.WebhookDelivery) {
+	if err := u.repo.SaveAttempt(ctx, d); err != nil {
+		// the claim runs out and the delivery is sent again
+		log.Printf("webhook delivery %s: save attempt: %v", d.ID.Hex(), err)
+	}
+}
+
+func mapWebhookErr(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrWebhookNotFound):
+		return ErrWebhookNotFound
+	case errors.Is(err, repository.ErrDeadLetterNotFound):
+		return ErrDeadLetterNotFound
+	default:
+		return err
+	}
+}
@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+)
+
+// ReservationSweeper periodically returns expired holds to stock.
+type ReservationSweeper struct {
+	uc       usecase.ReservationUsecase
+	interval time.Duration
+}
+
+func NewReservationSweeper(uc usecase.ReservationUsecase, interval time.Duration) *ReservationSweeper {
+	return &ReservationSweeper{uc: uc, interval: interval}
+}
+
+// Run blocks until ctx is cancelled.
+func (s *ReservationSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *ReservationSweeper) sweep(ctx context.Context) {
+	n, err := s.uc.ReleaseExpired(ctx)
+	if err != nil {
+		log.Printf("reservation sweeper: %v", err)
+	}
+	if n > 0 {
+		log.Printf("reservation sweeper: released %d expired holds", n)
+	}
+}
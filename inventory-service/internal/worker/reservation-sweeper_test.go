@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+)
+
+// countingSweeps reports each ReleaseExpired call on swept and answers with
+// err; the other methods are not used.
+type countingSweeps struct {
+	usecase.ReservationUsecase
+	swept chan struct{}
+	err   error
+}
+
+func (u *countingSweeps) ReleaseExpired(ctx context.Context) (int, error) {
+	u.swept <- struct{}{}
+	return 1, u.err
+}
+
+func TestReservationSweeperSweepsUntilCancelled(t *testing.T) {
+	// a failed sweep does not stop the next one
+	uc := &countingSweeps{swept: make(chan struct{}), err: errors.New("connection reset")}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewReservationSweeper(uc, time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-uc.swept:
+		case <-time.After(time.Second):
+			t.Fatalf("sweep %d did not happen", i+1)
+		}
+	}
+	cancel()
+	for {
+		select {
+		case <-uc.swept:
+			// a tick that raced the cancel
+		case <-done:
+			return
+		case <-time.After(time.Second):
+			t.Fatal("Run did not return after cancel")
+		}
+	}
+}
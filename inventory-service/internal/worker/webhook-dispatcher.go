@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Nurda-zh/a1/inventory-service/internal/usecase"
+)
+
+// WebhookDispatcher periodically queues events for new stock movements and
+// sends due webhook deliveries. Replicas claim deliveries one by one, so
+// every replica can run one.
+type WebhookDispatcher struct {
+	uc       usecase.WebhookUsecase
+	interval time.Duration
+}
+
+func NewWebhookDispatcher(uc usecase.WebhookUsecase, interval time.Duration) *WebhookDispatcher {
+	return &WebhookDispatcher{uc: uc, interval: interval}
+}
+
+// Run blocks until ctx is cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatch(ctx)
+		}
+	}
+}
+
+func (d *WebhookDispatcher) dispatch(ctx context.Context) {
+	if _, err := d.uc.EnqueueStockEvents(ctx); err != nil {
+		log.Printf("webhook dispatcher: queue stock events: %v", err)
+	}
+	n, err := d.uc.DeliverDue(ctx)
+	if err != nil {
+		log.Printf("webhook dispatcher: %v", err)
+	}
+	if n > 0 {
+		log.Printf("webhook dispatcher: delivered %d webhooks", n)
+	}
+}
@@ -2,19 +2,31 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
 	"time"
 
 	config "github.com/Nurda-zh/a1/order-service/configs"
 	"github.com/Nurda-zh/a1/order-service/internal/delivery/http/handler"
+	"github.com/Nurda-zh/a1/order-service/internal/delivery/http/middleware"
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
 	infra "github.com/Nurda-zh/a1/order-service/internal/infra"
+	"github.com/Nurda-zh/a1/order-service/internal/inventory"
+	"github.com/Nurda-zh/a1/order-service/internal/outbox"
+	"github.com/Nurda-zh/a1/order-service/internal/payment"
 	"github.com/Nurda-zh/a1/order-service/internal/repository"
 	"github.com/Nurda-zh/a1/order-service/internal/usecase"
+	"github.com/Nurda-zh/a1/order-service/internal/worker"
+	"github.com/Nurda-zh/a1/pkg/auth"
+	"github.com/Nurda-zh/a1/pkg/idempotency"
+	"github.com/Nurda-zh/a1/pkg/webhook"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 	cfg := config.LoadConfig()
+	domain.DefaultCurrency = cfg.DefaultCurrency
 
 	client, err := infra.NewMongoClient(cfg.MongoURI)
 	if err != nil {
@@ -27,17 +39,157 @@ func main() {
 	}()
 
 	db := client.Database(cfg.Database)
+	timeouts := repository.Timeouts{Query: cfg.DBQueryTimeout, Batch: cfg.DBBatchTimeout}
+
+	orderRepo := repository.NewMongoOrderRepo(db, timeouts)
+	if err := orderRepo.EnsureIndexes(); err != nil {
+		log.Fatalf("order indexes: %v", err)
+	}
+	sagaRepo := repository.NewMongoSagaRepo(db, timeouts)
+	paymentRepo := repository.NewMongoPaymentRepo(db, timeouts)
+	if err := paymentRepo.EnsureIndexes(); err != nil {
+		log.Fatalf("payment indexes: %v", err)
+	}
+	refundRepo := repository.NewMongoRefundRepo(db, timeouts)
+	if err := refundRepo.EnsureIndexes(); err != nil {
+		log.Fatalf("refund indexes: %v", err)
+	}
+	var provider payment.Provider
+	switch cfg.PaymentProvider {
+	case "fake":
+		provider = payment.NewFake()
+	default:
+		log.Fatalf("unknown PAYMENT_PROVIDER %q", cfg.PaymentProvider)
+	}
+	inventoryTokens, err := newInventoryTokens(cfg)
+	if err != nil {
+		log.Fatalf("inventory auth: %v", err)
+	}
+	orderUC := usecase.NewOrderUsecase(orderRepo, sagaRepo, paymentRepo, refundRepo, provider, inventory.NewHTTPClient(cfg.InventoryServiceURL, inventoryTokens, cfg.InventoryTimeout))
+	lockRepo := repository.NewMongoLockRepo(db, timeouts)
+	owner := fmt.Sprintf("%s-%d", hostname(), os.Getpid())
+	// sagas left behind by a crashed replica are finished or compensated here
+	go worker.NewSagaRecoverer(orderUC, lockRepo, owner, time.Minute).Run(context.Background())
+	if cfg.PendingOrderMaxAge > 0 {
+		go worker.NewStaleOrderCanceller(orderUC, lockRepo, owner, cfg.PendingOrderMaxAge, cfg.StaleOrderSweepInterval).Run(context.Background())
+	}
+
+	webhookRepo := repository.NewMongoWebhookRepo(db, timeouts)
+	if err := webhookRepo.EnsureIndexes(); err != nil {
+		log.Fatalf("webhook indexes: %v", err)
+	}
+	webhookUC := usecase.NewWebhookUsecase(webhookRepo, webhook.NewSender("order-service-webhooks", cfg.WebhookTimeout), cfg.WebhookMaxAttempts)
+	go worker.NewWebhookDispatcher(webhookUC, cfg.WebhookPollInterval).Run(context.Background())
+
+	outboxRepo := repository.NewMongoOutboxRepo(db, timeouts)
+	if err := outboxRepo.EnsureIndexes(); err != nil {
+		log.Fatalf("outbox indexes: %v", err)
+	}
+	var sinks []outbox.Sink
+	for _, name := range cfg.OutboxSinks {
+		switch name {
+		case "log":
+			sinks = append(sinks, outbox.NewLogSink())
+		case "subscriptions":
+			sinks = append(sinks, outbox.NewSubscriptionSink(webhookUC))
+		case "webhook":
+			if cfg.OutboxWebhookURL == "" {
+				log.Fatalf("OUTBOX_WEBHOOK_URL is required for the webhook sink")
+			}
+			sinks = append(sinks, outbox.NewWebhookSink(cfg.OutboxWebhookURL))
+		case "nats":
+			sinks = append(sinks, outbox.NewNATSSink(cfg.NATSURL, cfg.NATSSubjectPrefix))
+		default:
+			log.Fatalf("unknown outbox sink %q", name)
+		}
+	}
+	if len(sinks) > 0 {
+		go worker.NewOutboxRelay(outboxRepo, lockRepo, sinks, owner, cfg.OutboxPollInterval).Run(context.Background())
+	}
 
-	orderRepo := repository.NewMongoOrderRepo(db)
-	orderUC := usecase.NewOrderUsecase(orderRepo, cfg.InventoryServiceURL)
 	orderHandler := handler.NewOrderHandler(orderUC)
 
+	idemStore := idempotency.NewMongoStore(db.Collection("idempotency_keys"), timeouts.Query)
+	idemCtx, cancelIdem := context.WithTimeout(context.Background(), timeouts.Batch)
+	err = idemStore.EnsureIndexes(idemCtx)
+	cancelIdem()
+	if err != nil {
+		log.Fatalf("idempotency indexes: %v", err)
+	}
+
+	verifier, err := newVerifier(cfg)
+	if err != nil {
+		log.Fatalf("auth: %v", err)
+	}
+
 	r := gin.Default()
-	api := r.Group("/api")
-	orderHandler.RegisterRoutes(api)
+	api := r.Group("/api", middleware.Auth(verifier))
+	orderHandler.RegisterRoutes(api, idempotency.Middleware(idemStore, cfg.IdempotencyTTL))
+	// subscriptions see the events of every order
+	handler.NewWebhookHandler(webhookUC).RegisterRoutes(api.Group("", middleware.RequireAdmin()))
 
 	log.Printf("Order service running on port %s", cfg.ServerPort)
 	if err := r.Run(":" + cfg.ServerPort); err != nil {
 		log.Fatalf("server error: %v", err)
 	}
 }
+
+// hostname identifies this replica as a lock owner.
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "order-service"
+	}
+	return h
+}
+
+// newVerifier trusts every token signing key the config names.
+func newVerifier(cfg *config.Config) (*auth.Verifier, error) {
+	keys := &auth.KeySet{}
+	if cfg.JWTHS256Secret != "" {
+		keys.AddHS256([]byte(cfg.JWTHS256Secret))
+	}
+	if cfg.JWTRS256PublicKeyFile != "" {
+		if err := keys.AddRS256PEMFile(cfg.JWTRS256PublicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.JWTJWKSFile != "" {
+		if err := keys.AddJWKSFile(cfg.JWTJWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	return auth.NewVerifier(auth.Config{
+		Keys:      keys,
+		Issuer:    cfg.JWTIssuer,
+		Audience:  cfg.JWTAudience,
+		AdminRole: cfg.JWTAdminRole,
+	})
+}
+
+// inventoryRole lets the service reserve, commit and return stock.
+const inventoryRole = "stock-clerk"
+
+// newInventoryTokens mints short-lived tokens for inventory when a secret is
+// configured and falls back to the static INVENTORY_TOKEN otherwise.
+func newInventoryTokens(cfg *config.Config) (inventory.TokenSource, error) {
+	if cfg.InventoryJWTSecret == "" {
+		if cfg.InventoryToken == "" {
+			return nil, nil
+		}
+		return inventory.StaticToken(cfg.InventoryToken), nil
+	}
+	m, err := auth.NewMinter(auth.MintConfig{
+		Secret:   []byte(cfg.InventoryJWTSecret),
+		KeyID:    cfg.InventoryJWTKeyID,
+		Subject:  "order-service",
+		Roles:    []string{inventoryRole},
+		Issuer:   cfg.InventoryJWTIssuer,
+		Audience: cfg.InventoryJWTAudience,
+		TTL:      cfg.InventoryJWTTTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationsMustBePositive(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		get   func(*Config) time.Duration
+		want  time.Duration
+	}{
+		{"STALE_ORDER_SWEEP_INTERVAL", "0", func(c *Config) time.Duration { return c.StaleOrderSweepInterval }, time.Minute},
+		{"STALE_ORDER_SWEEP_INTERVAL", "-5s", func(c *Config) time.Duration { return c.StaleOrderSweepInterval }, time.Minute},
+		{"STALE_ORDER_SWEEP_INTERVAL", "30s", func(c *Config) time.Duration { return c.StaleOrderSweepInterval }, 30 * time.Second},
+		{"OUTBOX_POLL_INTERVAL", "0s", func(c *Config) time.Duration { return c.OutboxPollInterval }, time.Second},
+		{"WEBHOOK_POLL_INTERVAL", "0", func(c *Config) time.Duration { return c.WebhookPollInterval }, time.Second},
+		{"DB_QUERY_TIMEOUT", "0", func(c *Config) time.Duration { return c.DBQueryTimeout }, 5 * time.Second},
+		{"DB_BATCH_TIMEOUT", "-1m", func(c *Config) time.Duration { return c.DBBatchTimeout }, 10 * time.Second},
+		{"INVENTORY_TIMEOUT", "soon", func(c *Config) time.Duration { return c.InventoryTimeout }, 5 * time.Second},
+		{"INVENTORY_JWT_TTL", "0", func(c *Config) time.Duration { return c.InventoryJWTTTL }, 5 * time.Minute},
+		// zero turns auto-cancel off, below zero means nothing
+		{"PENDING_ORDER_MAX_AGE", "0", func(c *Config) time.Duration { return c.PendingOrderMaxAge }, 0},
+		{"PENDING_ORDER_MAX_AGE", "-1h", func(c *Config) time.Duration { return c.PendingOrderMaxAge }, 30 * time.Minute},
+		{"PENDING_ORDER_MAX_AGE", "2h", func(c *Config) time.Duration { return c.PendingOrderMaxAge }, 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if got := tt.get(LoadConfig()); got != tt.want {
+				t.Errorf("%s=%s gives %v, want %v", tt.key, tt.value, got, tt.want)
+			}
+		})
+	}
+}
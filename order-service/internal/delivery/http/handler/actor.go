@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"github.com/Nurda-zh/a1/pkg/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// actor returns who is making the request, as recorded in an order's status
+// history: the subject of the caller's token, or "anonymous" without one.
+func actor(c *gin.Context) string {
+	if p, ok := auth.FromContext(c.Request.Context()); ok {
+		return p.Subject
+	}
+	return "anonymous"
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -17,12 +18,20 @@ func NewOrderHandler(uc usecase.OrderUsecase) *OrderHandler {
 	return &OrderHandler{uc: uc}
 }
 
-func (h *OrderHandler) RegisterRoutes(rg *gin.RouterGroup) {
+// RegisterRoutes mounts the order routes on rg; idempotent guards order
+// creation so retried requests with an Idempotency-Key place one order.
+func (h *OrderHandler) RegisterRoutes(rg *gin.RouterGroup, idempotent gin.HandlerFunc) {
 	r := rg.Group("/orders")
-	r.POST("", h.createOrder)
+	r.POST("", idempotent, h.createOrder)
+	r.POST("/quote", h.quoteOrder)
 	r.GET("", h.listOrders)
 	r.GET("/:id", h.getOrder)
+	r.GET("/:id/history", h.getOrderHistory)
+	r.GET("/:id/payment", h.getPayment)
+	r.POST("/:id/refunds", h.createRefund)
+	r.GET("/:id/refunds", h.listRefunds)
 	r.PATCH("/:id", h.patchOrder)
+	r.PUT("/:id/items", h.updateItems)
 }
 
 func (h *OrderHandler) createOrder(c *gin.Context) {
@@ -31,12 +40,32 @@ func (h *OrderHandler) createOrder(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	id, err := h.uc.CreateOrder(&req)
+	id, err := h.uc.CreateOrder(c.Request.Context(), &req)
 	if err != nil {
 		if err == usecase.ErrStockInsufficient {
 			c.JSON(http.StatusConflict, gin.H{"error": "stock insufficient"})
 			return
 		}
+		if errors.Is(err, usecase.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if paymentError(c, err) {
+			return
+		}
+		if errors.Is(err, usecase.ErrInventoryUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		var priceErr *usecase.PriceChangedError
+		if errors.As(err, &priceErr) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      "price changed",
+				"mismatches": priceErr.Mismatches,
+				"quote":      priceErr.Quote,
+			})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -44,9 +73,27 @@ func (h *OrderHandler) createOrder(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"id": id})
 }
 
+func (h *OrderHandler) quoteOrder(c *gin.Context) {
+	var req domain.QuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	quote, err := h.uc.QuoteOrder(c.Request.Context(), req.Items)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInventoryUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, quote)
+}
+
 func (h *OrderHandler) getOrder(c *gin.Context) {
 	id := c.Param("id")
-	o, err := h.uc.GetOrder(id)
+	o, err := h.uc.GetOrder(c.Request.Context(), id, c.Query("include") == "history")
 	if err != nil {
 		if err == usecase.ErrOrderNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
@@ -55,42 +102,214 @@ func (h *OrderHandler) getOrder(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	setETag(c, o.Version)
 	c.JSON(http.StatusOK, o)
 }
 
+func (h *OrderHandler) getOrderHistory(c *gin.Context) {
+	id := c.Param("id")
+	history, err := h.uc.GetOrderHistory(c.Request.Context(), id)
+	if err != nil {
+		if err == usecase.ErrOrderNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"order_id": id, "history": history})
+}
+
+func (h *OrderHandler) getPayment(c *gin.Context) {
+	p, err := h.uc.GetPayment(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == usecase.ErrPaymentNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *OrderHandler) createRefund(c *gin.Context) {
+	var req domain.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	refund, err := h.uc.RefundOrder(c.Request.Context(), c.Param("id"), &req, actor(c))
+	if err != nil {
+		refundError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, refund)
+}
+
+func (h *OrderHandler) listRefunds(c *gin.Context) {
+	refunds, err := h.uc.ListRefunds(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		refundError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": refunds})
+}
+
+func refundError(c *gin.Context, err error) {
+	switch {
+	case err == usecase.ErrOrderNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	case errors.Is(err, usecase.ErrIllegalTransition), err == usecase.ErrVersionConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidRefund):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrRefundExceedsCapture):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case paymentError(c, err):
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// paymentError answers payment failures and reports whether err was one.
+func paymentError(c *gin.Context, err error) bool {
+	switch {
+	case err == usecase.ErrPaymentDeclined:
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrPaymentMethod):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrPaymentFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
+
 type patchStatusReq struct {
 	Status string `json:"status" binding:"required"`
+	Reason string `json:"reason"`
 }
 
 func (h *OrderHandler) patchOrder(c *gin.Context) {
 	id := c.Param("id")
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
 	var req patchStatusReq
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	status := domain.OrderStatus(req.Status)
-	if err := h.uc.UpdateStatus(id, status); err != nil {
+	change := domain.StatusChange{
+		To:     domain.OrderStatus(req.Status),
+		Actor:  actor(c),
+		Reason: req.Reason,
+	}
+	if err := h.uc.UpdateStatus(c.Request.Context(), id, change, version); err != nil {
 		if err == usecase.ErrOrderNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 			return
 		}
+		if err == usecase.ErrVersionConflict {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, usecase.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, usecase.ErrIllegalTransition) || err == usecase.ErrHoldLost || errors.Is(err, usecase.ErrInvalidRefund) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, usecase.ErrRefundExceedsCapture) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if paymentError(c, err) {
+			return
+		}
+		if errors.Is(err, usecase.ErrInventoryUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	c.Status(http.StatusOK)
 }
 
+func (h *OrderHandler) updateItems(c *gin.Context) {
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+	var req domain.UpdateItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	o, err := h.uc.UpdateItems(c.Request.Context(), c.Param("id"), req.Items, version)
+	if err != nil {
+		if err == usecase.ErrOrderNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		if err == usecase.ErrVersionConflict {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+			return
+		}
+		if err == usecase.ErrOrderNotEditable || err == usecase.ErrHoldLost {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err == usecase.ErrStockInsufficient {
+			c.JSON(http.StatusConflict, gin.H{"error": "stock insufficient"})
+			return
+		}
+		if paymentError(c, err) {
+			return
+		}
+		if errors.Is(err, usecase.ErrInventoryUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		var priceErr *usecase.PriceChangedError
+		if errors.As(err, &priceErr) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      "price changed",
+				"mismatches": priceErr.Mismatches,
+				"quote":      priceErr.Quote,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setETag(c, o.Version)
+	c.JSON(http.StatusOK, o)
+}
+
+// listOrders lists the caller's orders; admins may pass user_id to list
+// someone else's.
 func (h *OrderHandler) listOrders(c *gin.Context) {
 	userID := c.Query("user_id")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id required"})
-		return
+		userID = actor(c)
 	}
 	page, _ := strconv.ParseInt(c.Query("page"), 10, 64)
 	pageSize, _ := strconv.ParseInt(c.Query("page_size"), 10, 64)
-	items, total, err := h.uc.ListOrdersByUser(userID, page, pageSize)
+	items, total, err := h.uc.ListOrdersByUser(c.Request.Context(), userID, page, pageSize)
 	if err != nil {
+		if errors.Is(err, usecase.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+// statusOrders serves UpdateStatus with err and records what it was asked;
+// the other methods are not used.
+type statusOrders struct {
+	usecase.OrderUsecase
+	err     error
+	change  domain.StatusChange
+	version int64
+}
+
+func (u *statusOrders) UpdateStatus(ctx context.Context, id string, change domain.StatusChange, version int64) error {
+	u.change, u.version = change, version
+	return u.err
+}
+
+func patchOrder(t *testing.T, uc usecase.OrderUsecase, ifMatch, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PATCH("/orders/:id", NewOrderHandler(uc).patchOrder)
+	req := httptest.NewRequest(http.MethodPatch, "/orders/o1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPatchOrderStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"moved", nil, http.StatusOK},
+		{"illegal transition", fmt.Errorf("%w: pending to shipped", usecase.ErrIllegalTransition), http.StatusConflict},
+		{"hold lost", usecase.ErrHoldLost, http.StatusConflict},
+		{"stale version", usecase.ErrVersionConflict, http.StatusPreconditionFailed},
+		{"unknown order", usecase.ErrOrderNotFound, http.StatusNotFound},
+		{"not the caller's to move", fmt.Errorf("%w: only admins can move an order to shipped", usecase.ErrForbidden), http.StatusForbidden},
+		{"unknown status", fmt.Errorf("%w: %q", usecase.ErrInvalidStatus, "lost"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := &statusOrders{err: tt.err}
+			w := patchOrder(t, uc, `"3"`, `{"status":"shipped","reason":"picked up"}`)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.err != nil && !strings.Contains(w.Body.String(), "error") {
+				t.Errorf("body = %s, want an error", w.Body)
+			}
+			if uc.change.To != domain.StatusShipped || uc.change.Reason != "picked up" || uc.version != 3 {
+				t.Errorf("asked to move to %+v at version %d", uc.change, uc.version)
+			}
+		})
+	}
+}
+
+func TestPatchOrderIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		err     error
+		want    int
+	}{
+		{"missing", "", nil, http.StatusPreconditionRequired},
+		{"weak tag", `W/"3"`, nil, http.StatusPreconditionFailed},
+		{"stale tag", `"2"`, usecase.ErrVersionConflict, http.StatusPreconditionFailed},
+		{"malformed", "3", nil, http.StatusBadRequest},
+		{"any version", "*", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := &statusOrders{err: tt.err, version: -2}
+			w := patchOrder(t, uc, tt.ifMatch, `{"status":"shipped"}`)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			asked := uc.version != -2
+			if wantAsked := tt.want == http.StatusOK || tt.err != nil; asked != wantAsked {
+				t.Errorf("usecase asked = %v, want %v", asked, wantAsked)
+			}
+			if tt.ifMatch == "*" && uc.version != domain.AnyVersion {
+				t.Errorf("If-Match: * asked for version %d", uc.version)
+			}
+		})
+	}
+}
+
+// historyOrders serves GetOrderHistory from history, or ErrOrderNotFound for
+// other orders; the other methods are not used.
+type historyOrders struct {
+	usecase.OrderUsecase
+	history []domain.StatusChange
+}
+
+func (u *historyOrders) GetOrderHistory(ctx context.Context, id string) ([]domain.StatusChange, error) {
+	if id != "o1" {
+		return nil, usecase.ErrOrderNotFound
+	}
+	return u.history, nil
+}
+
+func TestGetOrderHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/orders/:id/history", NewOrderHandler(&historyOrders{history: []domain.StatusChange{
+		{To: domain.StatusPending, Actor: "u1"},
+		{From: domain.StatusPending, To: domain.StatusCancelled, Actor: "u1", Reason: "changed my mind"},
+	}}).getOrderHistory)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/o1/history", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var body struct {
+		OrderID string                `json:"order_id"`
+		History []domain.StatusChange `json:"history"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.OrderID != "o1" || len(body.History) != 2 || body.History[1].From != domain.StatusPending || body.History[1].Reason != "changed my mind" {
+		t.Errorf("body = %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/o2/history", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown order: status = %d, want 404", w.Code)
+	}
+}
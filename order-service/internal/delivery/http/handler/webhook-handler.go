@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	uc usecase.WebhookUsecase
+}
+
+func NewWebhookHandler(uc usecase.WebhookUsecase) *WebhookHandler {
+	return &WebhookHandler{uc: uc}
+}
+
+func (h *WebhookHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	r := rg.Group("/webhooks")
+	r.POST("", h.createSubscription)
+	r.GET("", h.listSubscriptions)
+	r.GET("/dead-letters", h.listDeadLetters)
+	r.POST("/dead-letters/:id/redeliver", h.redeliver)
+	r.GET("/:id", h.getSubscription)
+	r.DELETE("/:id", h.deleteSubscription)
+}
+
+func (h *WebhookHandler) createSubscription(c *gin.Context) {
+	var req domain.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s, err := h.uc.CreateSubscription(c.Request.Context(), &req)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.Header("Location", "/api/webhooks/"+s.ID)
+	c.JSON(http.StatusCreated, s)
+}
+
+func (h *WebhookHandler) listSubscriptions(c *gin.Context) {
+	subs, err := h.uc.ListSubscriptions(c.Request.Context())
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": subs})
+}
+
+func (h *WebhookHandler) getSubscription(c *gin.Context) {
+	s, err := h.uc.GetSubscription(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func (h *WebhookHandler) deleteSubscription(c *gin.Context) {
+	if err := h.uc.DeleteSubscription(c.Request.Context(), c.Param("id")); err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) listDeadLetters(c *gin.Context) {
+	letters, err := h.uc.ListDeadLetters(c.Request.Context(), c.Query("subscription_id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": letters})
+}
+
+func (h *WebhookHandler) redeliver(c *gin.Context) {
+	d, err := h.uc.Redeliver(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, d)
+}
+
+func webhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrWebhookNotFound), errors.Is(err, usecase.ErrDeadLetterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidWebhook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventOrderCreated       EventType = "order.created"
+	EventOrderStatusChanged EventType = "order.status_changed"
+	EventOrderItemsUpdated  EventType = "order.items_updated"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxPending   OutboxStatus = "pending"
+	OutboxPublished OutboxStatus = "published"
+)
+
+// OutboxEvent is a domain event written to the outbox in the same
+// transaction as the order change it describes. Seq is the order version the
+// change produced, so a consumer can order and deduplicate the events of one
+// order. Its JSON form is what sinks publish.
+type OutboxEvent struct {
+	ID         string          `json:"id" bson:"_id"`
+	Type       EventType       `json:"type" bson:"type"`
+	OrderID    string          `json:"order_id" bson:"order_id"`
+	Seq        int64           `json:"seq" bson:"seq"`
+	Data       json.RawMessage `json:"data" bson:"data"`
+	OccurredAt time.Time       `json:"occurred_at" bson:"occurred_at"`
+
+	// delivery state, not part of the event
+	Status        OutboxStatus `json:"-" bson:"status"`
+	Attempts      int          `json:"-" bson:"attempts"`
+	NextAttemptAt time.Time    `json:"-" bson:"next_attempt_at"`
+	LastError     string       `json:"-" bson:"last_error,omitempty"`
+	PublishedAt   *time.Time   `json:"-" bson:"published_at,omitempty"`
+}
+
+// OrderCreatedData is the data of an order.created event.
+type OrderCreatedData struct {
+	UserID        string      `json:"user_id"`
+	Items         []OrderItem `json:"items"`
+	Total         Money       `json:"total"`
+	Status        OrderStatus `json:"status"`
+	PaymentMethod string      `json:"payment_method,omitempty"`
+}
+
+// OrderItemsUpdatedData is the data of an order.items_updated event.
+// order.status_changed carries the StatusChange.
+type OrderItemsUpdatedData struct {
+	Items []OrderItem `json:"items"`
+	Total Money       `json:"total"`
+}
@@ -1,33 +1,154 @@
 package domain
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
 
 type OrderStatus string
 
 const (
-	StatusPending   OrderStatus = "pending"
-	StatusCompleted OrderStatus = "completed"
-	StatusCancelled OrderStatus = "cancelled"
+	StatusPending    OrderStatus = "pending"
+	StatusPaid       OrderStatus = "paid"
+	StatusProcessing OrderStatus = "processing"
+	StatusShipped    OrderStatus = "shipped"
+	StatusDelivered  OrderStatus = "delivered"
+	StatusCompleted  OrderStatus = "completed"
+	StatusCancelled  OrderStatus = "cancelled"
+	StatusRefunded   OrderStatus = "refunded"
+	// StatusPartiallyRefunded is only reached through refunds.
+	StatusPartiallyRefunded OrderStatus = "partially_refunded"
 )
 
+// transitions lists the statuses an order may move to from each status.
+// Cancelled and refunded are final.
+var transitions = map[OrderStatus][]OrderStatus{
+	StatusPending:    {StatusPaid, StatusCancelled},
+	StatusPaid:       {StatusProcessing, StatusCancelled},
+	StatusProcessing: {StatusShipped, StatusCancelled},
+	StatusShipped:    {StatusDelivered},
+	StatusDelivered:  {StatusCompleted, StatusPartiallyRefunded, StatusRefunded},
+	StatusCompleted:  {StatusPartiallyRefunded, StatusRefunded},
+	StatusCancelled:  nil,
+	StatusRefunded:   nil,
+
+	StatusPartiallyRefunded: {StatusRefunded},
+}
+
+// Valid tells whether s is a known order status.
+func (s OrderStatus) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// CanTransition tells whether an order in status from may move to status to.
+func CanTransition(from, to OrderStatus) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
 type OrderItem struct {
-	ProductID  string `json:"product_id" bson:"product_id"`
-	Quantity   int    `json:"quantity" bson:"quantity"`
-	PriceCents int64  `json:"price_cents" bson:"price_cents"` // snapshot
+	ProductID string `json:"product_id" bson:"product_id"`
+	Quantity  int    `json:"quantity" bson:"quantity"`
+	Price     Money  `json:"price" bson:"price"` // unit price snapshot; on requests, the price the client expects
 }
 
 type Order struct {
-	ID         string      `json:"id" bson:"_id,omitempty"`
-	UserID     string      `json:"user_id" bson:"user_id"`
-	Items      []OrderItem `json:"items" bson:"items"`
-	TotalCents int64       `json:"total_cents" bson:"total_cents"`
-	Status     OrderStatus `json:"status" bson:"status"`
-	CreatedAt  time.Time   `json:"created_at" bson:"created_at"`
-	UpdatedAt  time.Time   `json:"updated_at" bson:"updated_at"`
+	ID     string      `json:"id" bson:"_id,omitempty"`
+	UserID string      `json:"user_id" bson:"user_id"`
+	Items  []OrderItem `json:"items" bson:"items"`
+	Total  Money       `json:"total" bson:"total"`
+	Status OrderStatus `json:"status" bson:"status"`
+	// ReservationID is the inventory hold backing this order's items.
+	ReservationID string `json:"reservation_id,omitempty" bson:"reservation_id,omitempty"`
+	// PaymentMethod is what the order is paid with; orders placed without
+	// one are paid outside the service.
+	PaymentMethod string `json:"payment_method,omitempty" bson:"payment_method,omitempty"`
+	// Version is bumped on every write and guards status updates against
+	// lost updates.
+	Version   int64     `json:"version" bson:"version"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	// History lists every status the order went through, oldest first. It
+	// is only loaded when asked for.
+	History []StatusChange `json:"history,omitempty" bson:"history,omitempty"`
+}
+
+var errLegacyPriceMismatch = errors.New("price and price_cents disagree")
+
+// MarshalJSON also writes price_cents, the field clients read before prices
+// had a currency. It stays until every client has moved to price.
+func (it OrderItem) MarshalJSON() ([]byte, error) {
+	type plain OrderItem
+	return json.Marshal(struct {
+		plain
+		PriceCents int64 `json:"price_cents"`
+	}{plain(it), it.Price.Amount})
 }
 
+// UnmarshalJSON takes price_cents when no price is given. It has no currency,
+// so it is checked against the catalog price in the catalog's currency.
+func (it *OrderItem) UnmarshalJSON(data []byte) error {
+	type plain OrderItem
+	var v struct {
+		plain
+		PriceCents *int64 `json:"price_cents"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*it = OrderItem(v.plain)
+	switch {
+	case v.PriceCents == nil:
+	case it.Price == (Money{}):
+		it.Price = Money{Amount: *v.PriceCents}
+	case it.Price.Amount != *v.PriceCents:
+		return errLegacyPriceMismatch
+	}
+	return nil
+}
+
+// MarshalJSON also writes total_cents, see OrderItem.
+func (o Order) MarshalJSON() ([]byte, error) {
+	type plain Order
+	return json.Marshal(struct {
+		plain
+		TotalCents int64 `json:"total_cents"`
+	}{plain(o), o.Total.Amount})
+}
+
+// StatusChange is one entry of an order's status history. The entry written
+// on creation has no From.
+type StatusChange struct {
+	From   OrderStatus `json:"from,omitempty" bson:"from,omitempty"`
+	To     OrderStatus `json:"to" bson:"to"`
+	Actor  string      `json:"actor" bson:"actor"`
+	Reason string      `json:"reason,omitempty" bson:"reason,omitempty"`
+	At     time.Time   `json:"at" bson:"at"`
+}
+
+// SystemActor is recorded for status changes nobody asked for, such as those
+// finished by saga recovery.
+const SystemActor = "system"
+
+// AnyVersion skips the version check, as for "If-Match: *".
+const AnyVersion int64 = -1
+
+// CreateOrderRequest places an order for the caller. Only admins may set
+// UserID to place it for someone else.
 type CreateOrderRequest struct {
-	UserID        string      `json:"user_id" binding:"required"`
+	UserID        string      `json:"user_id"`
 	Items         []OrderItem `json:"items" binding:"required"`
 	PaymentMethod string      `json:"payment_method"`
 }
+
+// UpdateItemsRequest replaces the items of a pending order. Prices are
+// checked like on creation.
+type UpdateItemsRequest struct {
+	Items []OrderItem `json:"items" binding:"required"`
+}
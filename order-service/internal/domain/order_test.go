@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestOrderItemJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    OrderItem
+		wantErr bool
+	}{
+		{"price", `{"product_id":"p1","quantity":2,"price":{"amount":1250,"currency":"EUR"}}`,
+			OrderItem{ProductID: "p1", Quantity: 2, Price: Money{Amount: 1250, Currency: "EUR"}}, false},
+		{"legacy price_cents", `{"product_id":"p1","quantity":2,"price_cents":1250}`,
+			OrderItem{ProductID: "p1", Quantity: 2, Price: Money{Amount: 1250}}, false},
+		{"both agreeing", `{"product_id":"p1","quantity":1,"price":{"amount":1250,"currency":"USD"},"price_cents":1250}`,
+			OrderItem{ProductID: "p1", Quantity: 1, Price: Money{Amount: 1250, Currency: "USD"}}, false},
+		{"both disagreeing", `{"product_id":"p1","quantity":1,"price":{"amount":1250,"currency":"USD"},"price_cents":999}`,
+			OrderItem{}, true},
+		{"no price", `{"product_id":"p1","quantity":1}`,
+			OrderItem{ProductID: "p1", Quantity: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got OrderItem
+			err := json.Unmarshal([]byte(tt.in), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderJSONCarriesLegacyCents(t *testing.T) {
+	o := Order{
+		ID:    "o1",
+		Items: []OrderItem{{ProductID: "p1", Quantity: 2, Price: Money{Amount: 1250, Currency: "USD"}}},
+		Total: Money{Amount: 2500, Currency: "USD"},
+	}
+	raw, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		ID         string `json:"id"`
+		Total      Money  `json:"total"`
+		TotalCents int64  `json:"total_cents"`
+		Items      []struct {
+			Price      Money `json:"price"`
+			PriceCents int64 `json:"price_cents"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "o1" || got.Total != o.Total || got.TotalCents != 2500 {
+		t.Errorf("order = %s", raw)
+	}
+	if len(got.Items) != 1 || got.Items[0].Price != o.Items[0].Price || got.Items[0].PriceCents != 1250 {
+		t.Errorf("items = %s", raw)
+	}
+
+	var back Order
+	if err := json.Unmarshal(raw, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back.Items, o.Items) || back.Total != o.Total {
+		t.Errorf("round trip = %+v, want %+v", back, o)
+	}
+}
+
+func TestQuoteJSONCarriesLegacyCents(t *testing.T) {
+	raw, err := json.Marshal(Quote{Total: Money{Amount: 700, Currency: "USD"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got["total_cents"]) != "700" || got["total"] == nil {
+		t.Errorf("quote = %s", raw)
+	}
+
+	raw, err = json.Marshal(PriceMismatch{ProductID: "p1", Expected: Money{Amount: 500, Currency: "USD"}, Current: Money{Amount: 600, Currency: "USD"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got["expected_cents"]) != "500" || string(got["current_cents"]) != "600" {
+		t.Errorf("mismatch = %s", raw)
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	allowed := map[[2]OrderStatus]bool{
+		{StatusPending, StatusPaid}:                true,
+		{StatusPending, StatusCancelled}:           true,
+		{StatusPaid, StatusProcessing}:             true,
+		{StatusPaid, StatusCancelled}:              true,
+		{StatusProcessing, StatusShipped}:          true,
+		{StatusProcessing, StatusCancelled}:        true,
+		{StatusShipped, StatusDelivered}:           true,
+		{StatusDelivered, StatusCompleted}:         true,
+		{StatusDelivered, StatusPartiallyRefunded}: true,
+		{StatusDelivered, StatusRefunded}:          true,
+		{StatusCompleted, StatusPartiallyRefunded}: true,
+		{StatusCompleted, StatusRefunded}:          true,
+		{StatusPartiallyRefunded, StatusRefunded}:  true,
+	}
+	all := []OrderStatus{
+		StatusPending, StatusPaid, StatusProcessing, StatusShipped, StatusDelivered,
+		StatusCompleted, StatusCancelled, StatusRefunded, StatusPartiallyRefunded,
+	}
+	for _, from := range all {
+		if !from.Valid() {
+			t.Errorf("%s is not valid", from)
+		}
+		for _, to := range all {
+			if got, want := CanTransition(from, to), allowed[[2]OrderStatus{from, to}]; got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+	// a few illegal ones spelled out, with statuses the table does not know
+	for _, tt := range []struct{ from, to OrderStatus }{
+		{StatusPending, StatusShipped},
+		{StatusShipped, StatusCancelled},
+		{StatusCancelled, StatusPending},
+		{StatusRefunded, StatusPartiallyRefunded},
+		{StatusPending, "lost"},
+		{"lost", StatusPending},
+	} {
+		if CanTransition(tt.from, tt.to) {
+			t.Errorf("CanTransition(%s, %s) = true", tt.from, tt.to)
+		}
+	}
+	if OrderStatus("lost").Valid() {
+		t.Error(`"lost" is valid`)
+	}
+}
@@ -0,0 +1,52 @@
+package domain
+
+import "time"
+
+type PaymentStatus string
+
+const (
+	PaymentPending           PaymentStatus = "pending"
+	PaymentAuthorized        PaymentStatus = "authorized"
+	PaymentCaptured          PaymentStatus = "captured"
+	PaymentVoided            PaymentStatus = "voided"
+	PaymentRefunded          PaymentStatus = "refunded"
+	PaymentPartiallyRefunded PaymentStatus = "partially_refunded"
+	PaymentFailed            PaymentStatus = "failed"
+)
+
+type PaymentOperation string
+
+const (
+	OpAuthorize PaymentOperation = "authorize"
+	OpCapture   PaymentOperation = "capture"
+	OpVoid      PaymentOperation = "void"
+	OpRefund    PaymentOperation = "refund"
+)
+
+// Payment is the money side of an order: an authorization placed when the
+// order is created, captured when it is paid and voided or refunded when it
+// is cancelled or refunded. Every call to the provider is kept in Attempts.
+type Payment struct {
+	ID       string        `json:"id" bson:"_id,omitempty"`
+	OrderID  string        `json:"order_id" bson:"order_id"`
+	Provider string        `json:"provider" bson:"provider"`
+	Method   string        `json:"method" bson:"method"`
+	Status   PaymentStatus `json:"status" bson:"status"`
+	Amount   Money         `json:"amount" bson:"amount"`
+	Captured Money         `json:"captured" bson:"captured"`
+	Refunded Money         `json:"refunded" bson:"refunded"`
+	// ProviderRef is the provider's id for the authorization.
+	ProviderRef string           `json:"provider_ref,omitempty" bson:"provider_ref,omitempty"`
+	Attempts    []PaymentAttempt `json:"attempts" bson:"attempts"`
+	CreatedAt   time.Time        `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at" bson:"updated_at"`
+}
+
+// PaymentAttempt is one call to the payment provider and its outcome.
+type PaymentAttempt struct {
+	Operation PaymentOperation `json:"operation" bson:"operation"`
+	Amount    Money            `json:"amount" bson:"amount"`
+	Succeeded bool             `json:"succeeded" bson:"succeeded"`
+	Error     string           `json:"error,omitempty" bson:"error,omitempty"`
+	At        time.Time        `json:"at" bson:"at"`
+}
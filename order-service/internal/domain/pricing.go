@@ -0,0 +1,40 @@
+package domain
+
+import "encoding/json"
+
+// PriceMismatch reports an item whose client supplied price no longer matches
+// the catalog price.
+type PriceMismatch struct {
+	ProductID string `json:"product_id"`
+	Expected  Money  `json:"expected"`
+	Current   Money  `json:"current"`
+}
+
+// Quote is the authoritative pricing of a set of items at a point in time.
+type Quote struct {
+	Items []OrderItem `json:"items"`
+	Total Money       `json:"total"`
+}
+
+// MarshalJSON also writes expected_cents and current_cents, see OrderItem.
+func (m PriceMismatch) MarshalJSON() ([]byte, error) {
+	type plain PriceMismatch
+	return json.Marshal(struct {
+		plain
+		ExpectedCents int64 `json:"expected_cents"`
+		CurrentCents  int64 `json:"current_cents"`
+	}{plain(m), m.Expected.Amount, m.Current.Amount})
+}
+
+// MarshalJSON also writes total_cents, see Order.
+func (q Quote) MarshalJSON() ([]byte, error) {
+	type plain Quote
+	return json.Marshal(struct {
+		plain
+		TotalCents int64 `json:"total_cents"`
+	}{plain(q), q.Total.Amount})
+}
+
+type QuoteRequest struct {
+	Items []OrderItem `json:"items" binding:"required"`
+}
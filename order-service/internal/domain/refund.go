@@ -0,0 +1,50 @@
+package domain
+
+import "time"
+
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"
+	RefundSucceeded RefundStatus = "succeeded"
+	RefundFailed    RefundStatus = "failed"
+)
+
+// Refund gives back the money for some or all of an order's items and,
+// if Restock is set, puts the items back in stock.
+type Refund struct {
+	ID      string `json:"id" bson:"_id,omitempty"`
+	OrderID string `json:"order_id" bson:"order_id"`
+	// Seq numbers an order's refunds from 1, so two refunds worked out from
+	// the same state cannot both be written.
+	Seq     int          `json:"seq" bson:"seq"`
+	Items   []RefundItem `json:"items" bson:"items"`
+	Amount  Money        `json:"amount" bson:"amount"`
+	Restock bool         `json:"restock" bson:"restock"`
+	Reason  string       `json:"reason,omitempty" bson:"reason,omitempty"`
+	Actor   string       `json:"actor" bson:"actor"`
+	Status  RefundStatus `json:"status" bson:"status"`
+	// Error says why the refund failed, or why restocking did.
+	Error     string    `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type RefundItem struct {
+	ProductID string `json:"product_id" bson:"product_id"`
+	Quantity  int    `json:"quantity" bson:"quantity"`
+	Amount    Money  `json:"amount" bson:"amount"`
+}
+
+// RefundRequest refunds the listed quantities, or everything not refunded
+// yet when Items is empty.
+type RefundRequest struct {
+	Items   []RefundItemRequest `json:"items" binding:"dive"`
+	Restock bool                `json:"restock"`
+	Reason  string              `json:"reason"`
+}
+
+type RefundItemRequest struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,gt=0"`
+}
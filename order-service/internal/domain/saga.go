@@ -0,0 +1,65 @@
+package domain
+
+import "time"
+
+type SagaType string
+
+const (
+	SagaCreateOrder SagaType = "create_order"
+	SagaCancelOrder SagaType = "cancel_order"
+	SagaEditOrder   SagaType = "edit_order"
+	SagaPayOrder    SagaType = "pay_order"
+)
+
+type SagaStatus string
+
+const (
+	SagaRunning      SagaStatus = "running"
+	SagaCompleted    SagaStatus = "completed"
+	SagaCompensating SagaStatus = "compensating"
+	SagaCompensated  SagaStatus = "compensated"
+)
+
+// SagaStep is the last step a saga finished. It is persisted before moving on
+// so a restarted process knows where to resume or what to undo.
+type SagaStep string
+
+const (
+	StepStarted           SagaStep = "started"
+	StepStockReserved     SagaStep = "stock_reserved"
+	StepPaymentAuthorized SagaStep = "payment_authorized"
+	StepStockAmended      SagaStep = "stock_amended"
+	StepOrderUpdated      SagaStep = "order_updated"
+	StepOrderCreated      SagaStep = "order_created"
+	StepOrderCancelled    SagaStep = "order_cancelled"
+	StepStockReleased     SagaStep = "stock_released"
+	StepPaymentReleased   SagaStep = "payment_released"
+	StepPaymentCaptured   SagaStep = "payment_captured"
+	StepStockCommitted    SagaStep = "stock_committed"
+	StepOrderPaid         SagaStep = "order_paid"
+)
+
+type Saga struct {
+	ID            string        `json:"id" bson:"_id,omitempty"`
+	Type          SagaType      `json:"type" bson:"type"`
+	OrderID       string        `json:"order_id" bson:"order_id"`
+	Step          SagaStep      `json:"step" bson:"step"`
+	Status        SagaStatus    `json:"status" bson:"status"`
+	ReservationID string        `json:"reservation_id,omitempty" bson:"reservation_id,omitempty"`
+	OrderVersion  int64         `json:"order_version" bson:"order_version"`       // version the saga's first write expects
+	Order         *Order        `json:"order,omitempty" bson:"order,omitempty"`   // create_order payload
+	Change        *StatusChange `json:"change,omitempty" bson:"change,omitempty"` // cancel_order and pay_order payload
+	Edit          *OrderEdit    `json:"edit,omitempty" bson:"edit,omitempty"`     // edit_order payload
+	Error         string        `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt     time.Time     `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at" bson:"updated_at"`
+}
+
+// OrderEdit is what an edit_order saga changes. PaymentRef is the
+// authorization for NewTotal once it is placed.
+type OrderEdit struct {
+	OldItems   []OrderItem `json:"old_items" bson:"old_items"`
+	NewItems   []OrderItem `json:"new_items" bson:"new_items"`
+	NewTotal   Money       `json:"new_total" bson:"new_total"`
+	PaymentRef string      `json:"payment_ref,omitempty" bson:"payment_ref,omitempty"`
+}
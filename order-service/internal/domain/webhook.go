@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Nurda-zh/a1/pkg/webhook"
+)
+
+// WebhookAllEvents subscribes to every event type.
+const WebhookAllEvents = webhook.AllEvents
+
+// WebhookSubscription asks for events of EventTypes to be POSTed to URL.
+// Secret keys the signature of every delivery; it is only shown when the
+// subscription is created.
+type WebhookSubscription struct {
+	ID         string    `json:"id" bson:"_id"`
+	URL        string    `json:"url" bson:"url"`
+	EventTypes []string  `json:"event_types" bson:"event_types"`
+	Secret     string    `json:"secret,omitempty" bson:"secret"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Wants tells whether the subscription asked for events of type t.
+func (s *WebhookSubscription) Wants(t string) bool {
+	for _, et := range s.EventTypes {
+		if et == t || et == WebhookAllEvents {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateWebhookRequest registers a subscription. A secret is generated when
+// none is given.
+type CreateWebhookRequest struct {
+	URL        string   `json:"url" binding:"required,url"`
+	EventTypes []string `json:"event_types" binding:"required,min=1"`
+	Secret     string   `json:"secret"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliveryDelivered WebhookDeliveryStatus = "delivered"
+	// DeliveryDead marks a delivery that ran out of attempts and was moved
+	// to the dead letters.
+	DeliveryDead WebhookDeliveryStatus = "dead"
+)
+
+// WebhookDelivery is one event on its way to one subscription. Payload is
+// the exact body that is signed and sent.
+type WebhookDelivery struct {
+	ID             string                `json:"id" bson:"_id"`
+	SubscriptionID string                `json:"subscription_id" bson:"subscription_id"`
+	EventID        string                `json:"event_id" bson:"event_id"`
+	EventType      string                `json:"event_type" bson:"event_type"`
+	Payload        json.RawMessage       `json:"payload" bson:"payload"`
+	Status         WebhookDeliveryStatus `json:"status" bson:"status"`
+	Attempts       int                   `json:"attempts" bson:"attempts"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at" bson:"next_attempt_at"`
+	LastError      string                `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	LastStatusCode int                   `json:"last_status_code,omitempty" bson:"last_status_code,omitempty"`
+	CreatedAt      time.Time             `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at" bson:"updated_at"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+}
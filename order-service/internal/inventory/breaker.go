@@ -0,0 +1,62 @@
+package inventory
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker stops calls to inventory after threshold transient failures in a
+// row. After cooldown it lets a single trial call through: its success closes
+// the breaker again, its failure keeps it open for another cooldown.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time // zero while closed
+	trial    bool      // a trial call is in flight
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may go out. Every allowed call must be followed
+// by record or, if the caller gave up on it, abandon.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record counts the outcome of an allowed call; failed means it failed
+// transiently.
+func (b *breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if !failed {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return
+	}
+	b.failures++
+	if !b.openedAt.IsZero() || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// abandon ends an allowed call whose outcome says nothing about inventory.
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
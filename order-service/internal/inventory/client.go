@@ -0,0 +1,129 @@
+// Package inventory talks to the inventory service on behalf of orders.
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+var (
+	ErrNotFound = errors.New("inventory resource not found")
+	// ErrInsufficientStock means a reservation could not be placed or amended
+	// because some items are short. Nothing was held.
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrReservationClosed means inventory refused to act on a reservation
+	// because it is in a different state, e.g. it expired or was released.
+	ErrReservationClosed = errors.New("reservation is no longer held")
+	ErrTimeout           = errors.New("inventory request timed out")
+	// ErrUnauthorized means inventory answered 401 or 403: the service's own
+	// token expired, lacks a role or is signed with a key inventory does not
+	// trust. No call succeeds until that is fixed.
+	ErrUnauthorized = errors.New("inventory refused the service's credentials")
+	// ErrUnavailable is returned without calling inventory while the circuit
+	// breaker is open.
+	ErrUnavailable = errors.New("inventory service unavailable")
+)
+
+// StatusError is an answer inventory gave that has no error of its own, e.g.
+// a 400 or a 500.
+type StatusError struct {
+	Op         string
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("inventory %s: status %d", e.Op, e.StatusCode)
+	}
+	return fmt.Sprintf("inventory %s: status %d: %s", e.Op, e.StatusCode, e.Message)
+}
+
+// IsTransient reports whether err says nothing about the request itself:
+// inventory timed out, could not be reached, failed with a 5xx or was not
+// called because the breaker is open. The same request may succeed later.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrUnavailable) {
+		return true
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= 500
+	}
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
+// retryable reports whether an idempotent call that failed with err is worth
+// repeating.
+func retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return IsTransient(err) && !errors.Is(err, ErrUnavailable)
+}
+
+// Item is a quantity of a product to hold or return.
+type Item struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Reservation statuses inventory reports.
+const (
+	ReservationHeld      = "held"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+	ReservationReturned  = "returned"
+)
+
+// Reservation is a hold as inventory reports it.
+type Reservation struct {
+	ID        string `json:"id"`
+	Reference string `json:"reference"`
+	Status    string `json:"status"`
+}
+
+type Product struct {
+	ID       string      `json:"id"`
+	Name     string      `json:"name"`
+	Price    json.Number `json:"price"` // major units
+	Currency string      `json:"currency"`
+}
+
+// Client holds and moves stock in inventory. Reservations hold stock for an
+// order until they are committed, which takes it off hand, or released. Calls
+// give up when ctx is done.
+type Client interface {
+	// BatchGetProducts returns the products among ids. Ids inventory does
+	// not know are returned in missing.
+	BatchGetProducts(ctx context.Context, ids []string) (products []Product, missing []string, err error)
+	// CreateReservation holds items under reference and returns the
+	// reservation id.
+	CreateReservation(ctx context.Context, reference string, items []Item) (string, error)
+	// ReservationsByReference returns the reservations placed under
+	// reference, to find a hold whose create answer was lost.
+	ReservationsByReference(ctx context.Context, reference string) ([]Reservation, error)
+	// AmendReservation moves a held reservation to items. Inventory swaps the
+	// whole hold at once, so on failure it is left as it was.
+	AmendReservation(ctx context.Context, id string, items []Item) error
+	CommitReservation(ctx context.Context, id string) error
+	// ReleaseReservation gives held stock back. Releasing an already released
+	// or expired reservation succeeds.
+	ReleaseReservation(ctx context.Context, id string) error
+	// ReturnReservation puts all stock of a committed reservation back on
+	// hand. Returning it again succeeds.
+	ReturnReservation(ctx context.Context, id string) error
+	// ReturnStock puts items of a committed reservation back on hand.
+	// Inventory applies a reference once, so repeating it is safe.
+	ReturnStock(ctx context.Context, id, reference string, items []Item) error
+}
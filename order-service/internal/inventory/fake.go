@@ -0,0 +1,325 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+const (
+	fakeHeld      = ReservationHeld
+	fakeCommitted = ReservationCommitted
+	fakeReleased  = ReservationReleased
+	fakeReturned  = ReservationReturned
+)
+
+type fakeReservation struct {
+	reference string
+	status    string
+	items     map[string]int
+	returned  map[string]bool // references of partial returns
+}
+
+// Op names a Client call, to inject a failure into with Fake.FailNext.
+type Op string
+
+const (
+	OpBatchGetProducts   Op = "batch_get_products"
+	OpCreateReservation  Op = "create_reservation"
+	OpFindReservations   Op = "find_reservations"
+	OpAmendReservation   Op = "amend_reservation"
+	OpCommitReservation  Op = "commit_reservation"
+	OpReleaseReservation Op = "release_reservation"
+	OpReturnReservation  Op = "return_reservation"
+	OpReturnStock        Op = "return_stock"
+)
+
+// fault is a failure queued for the next call of an operation. A lost fault
+// lets the call take effect and only fails its answer.
+type fault struct {
+	err  error
+	lost bool
+}
+
+// Fake is an in-memory Client for tests. It keeps a catalog and available
+// stock per product and moves stock between them and its reservations like
+// inventory would. Products are added with SetProduct. FailNext and LoseNext
+// fail a single call, SetError every call, to try out the unhappy paths.
+type Fake struct {
+	mu           sync.Mutex
+	err          error
+	faults       map[Op][]fault
+	products     map[string]Product
+	available    map[string]int
+	reservations map[string]*fakeReservation
+	nextID       int
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		faults:       make(map[Op][]fault),
+		products:     make(map[string]Product),
+		available:    make(map[string]int),
+		reservations: make(map[string]*fakeReservation),
+	}
+}
+
+// SetProduct adds or replaces a product priced at price (major units) with
+// available units of stock.
+func (f *Fake) SetProduct(id, price, currency string, available int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.products[id] = Product{ID: id, Name: id, Price: json.Number(price), Currency: currency}
+	f.available[id] = available
+}
+
+// SetError makes every call return err until it is called again with nil.
+func (f *Fake) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// FailNext makes the next call of op return err without doing anything.
+// Faults queue up, so calling it twice fails the next two calls.
+func (f *Fake) FailNext(op Op, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults[op] = append(f.faults[op], fault{err: err})
+}
+
+// LoseNext lets the next call of op go through but return err, as if the
+// answer was lost on its way back, e.g. to a timeout.
+func (f *Fake) LoseNext(op Op, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults[op] = append(f.faults[op], fault{err: err, lost: true})
+}
+
+// Available returns the stock of id that is neither held nor sold.
+func (f *Fake) Available(id string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.available[id]
+}
+
+// ReservationStatus returns held, committed, released or returned, or ""
+// for an unknown reservation.
+func (f *Fake) ReservationStatus(id string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r, ok := f.reservations[id]; ok {
+		return r.status
+	}
+	return ""
+}
+
+// run performs call for op under the lock, failing it as SetError, FailNext
+// and LoseNext asked.
+func (f *Fake) run(op Op, call func() error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	if queued := f.faults[op]; len(queued) > 0 {
+		next := queued[0]
+		f.faults[op] = queued[1:]
+		if !next.lost {
+			return next.err
+		}
+		if err := call(); err != nil {
+			return err
+		}
+		return next.err
+	}
+	return call()
+}
+
+func (f *Fake) BatchGetProducts(ctx context.Context, ids []string) ([]Product, []string, error) {
+	var products []Product
+	var missing []string
+	err := f.run(OpBatchGetProducts, func() error {
+		for _, id := range ids {
+			if p, ok := f.products[id]; ok {
+				products = append(products, p)
+			} else {
+				missing = append(missing, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return products, missing, nil
+}
+
+func (f *Fake) CreateReservation(ctx context.Context, reference string, items []Item) (string, error) {
+	var id string
+	err := f.run(OpCreateReservation, func() error {
+		held, err := f.take(items)
+		if err != nil {
+			return err
+		}
+		f.nextID++
+		id = fmt.Sprintf("fake_res_%d", f.nextID)
+		f.reservations[id] = &fakeReservation{reference: reference, status: fakeHeld, items: held, returned: make(map[string]bool)}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (f *Fake) ReservationsByReference(ctx context.Context, reference string) ([]Reservation, error) {
+	var out []Reservation
+	err := f.run(OpFindReservations, func() error {
+		for id, r := range f.reservations {
+			if r.reference == reference {
+				out = append(out, Reservation{ID: id, Reference: reference, Status: r.status})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (f *Fake) AmendReservation(ctx context.Context, id string, items []Item) error {
+	return f.run(OpAmendReservation, func() error {
+		r, ok := f.reservations[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if r.status != fakeHeld {
+			return ErrReservationClosed
+		}
+		f.put(r.items)
+		held, err := f.take(items)
+		if err != nil {
+			// take left nothing behind; hold the old items again
+			_, _ = f.take(toItems(r.items))
+			return err
+		}
+		r.items = held
+		return nil
+	})
+}
+
+func (f *Fake) CommitReservation(ctx context.Context, id string) error {
+	return f.run(OpCommitReservation, func() error {
+		r, ok := f.reservations[id]
+		if !ok {
+			return ErrNotFound
+		}
+		switch r.status {
+		case fakeCommitted:
+			return nil
+		case fakeHeld:
+			r.status = fakeCommitted
+			return nil
+		}
+		return ErrReservationClosed
+	})
+}
+
+func (f *Fake) ReleaseReservation(ctx context.Context, id string) error {
+	return f.run(OpReleaseReservation, func() error {
+		r, ok := f.reservations[id]
+		if !ok {
+			return ErrNotFound
+		}
+		switch r.status {
+		case fakeReleased:
+			return nil
+		case fakeHeld:
+			f.put(r.items)
+			r.status = fakeReleased
+			return nil
+		}
+		return ErrReservationClosed
+	})
+}
+
+func (f *Fake) ReturnReservation(ctx context.Context, id string) error {
+	return f.run(OpReturnReservation, func() error {
+		r, ok := f.reservations[id]
+		if !ok {
+			return ErrNotFound
+		}
+		switch r.status {
+		case fakeReturned:
+			return nil
+		case fakeCommitted:
+			f.put(r.items)
+			r.status = fakeReturned
+			return nil
+		}
+		return ErrReservationClosed
+	})
+}
+
+func (f *Fake) ReturnStock(ctx context.Context, id, reference string, items []Item) error {
+	return f.run(OpReturnStock, func() error {
+		r, ok := f.reservations[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if r.status != fakeCommitted {
+			return ErrReservationClosed
+		}
+		if r.returned[reference] {
+			return nil
+		}
+		for _, it := range items {
+			if it.Quantity <= 0 || it.Quantity > r.items[it.ProductID] {
+				return &StatusError{Op: "return", StatusCode: http.StatusBadRequest, Message: "cannot return more than was sold"}
+			}
+		}
+		for _, it := range items {
+			r.items[it.ProductID] -= it.Quantity
+			f.available[it.ProductID] += it.Quantity
+		}
+		r.returned[reference] = true
+		return nil
+	})
+}
+
+// take moves items from available stock into a hold, all or nothing.
+func (f *Fake) take(items []Item) (map[string]int, error) {
+	held := make(map[string]int, len(items))
+	for _, it := range items {
+		held[it.ProductID] += it.Quantity
+	}
+	for pid, qty := range held {
+		if _, ok := f.products[pid]; !ok || f.available[pid] < qty {
+			return nil, ErrInsufficientStock
+		}
+	}
+	for pid, qty := range held {
+		f.available[pid] -= qty
+	}
+	return held, nil
+}
+
+func (f *Fake) put(held map[string]int) {
+	for pid, qty := range held {
+		f.available[pid] += qty
+	}
+}
+
+func toItems(held map[string]int) []Item {
+	items := make([]Item, 0, len(held))
+	for pid, qty := range held {
+		items = append(items, Item{ProductID: pid, Quantity: qty})
+	}
+	return items
+}
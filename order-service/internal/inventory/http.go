@@ -0,0 +1,236 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	maxAttempts      = 3
+	retryBaseDelay   = 100 * time.Millisecond
+	retryMaxDelay    = 2 * time.Second
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+type reservationReq struct {
+	Reference string `json:"reference,omitempty"`
+	Items     []Item `json:"items"`
+}
+
+type reservationResp struct {
+	ID string `json:"id"`
+}
+
+type errorResp struct {
+	Error    string            `json:"error"`
+	Failures []json.RawMessage `json:"failures"`
+}
+
+type batchGetReq struct {
+	IDs []string `json:"ids"`
+}
+
+type batchGetResp struct {
+	Items   []Product `json:"items"`
+	Missing []string  `json:"missing"`
+}
+
+// HTTPClient is the Client for the inventory service's HTTP API. Calls that
+// are safe to repeat are retried with jittered backoff on transient failures;
+// creating and committing a reservation are sent once. A circuit breaker
+// fails calls fast while inventory keeps failing, see breaker.
+type HTTPClient struct {
+	baseURL string
+	tokens  TokenSource
+	timeout time.Duration
+	http    *http.Client
+	breaker *breaker
+}
+
+// TokenSource hands out the bearer token for the next call, see auth.Minter.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// StaticToken is a token configured by hand. Calls fail with ErrUnauthorized
+// once it expires.
+type StaticToken string
+
+func (t StaticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// NewHTTPClient bounds every attempt of a call by timeout, on top of the
+// caller's context. Calls carry a bearer token from tokens when it is set.
+func NewHTTPClient(baseURL string, tokens TokenSource, timeout time.Duration) *HTTPClient {
+	return &HTTPClient{
+		baseURL: baseURL,
+		tokens:  tokens,
+		timeout: timeout,
+		http:    &http.Client{},
+		breaker: newBreaker(breakerThreshold, breakerCooldown),
+	}
+}
+
+func (c *HTTPClient) BatchGetProducts(ctx context.Context, ids []string) ([]Product, []string, error) {
+	var res batchGetResp
+	if err := c.call(ctx, "price lookup", http.MethodPost, "/products/batch", batchGetReq{IDs: ids}, &res, true); err != nil {
+		return nil, nil, err
+	}
+	return res.Items, res.Missing, nil
+}
+
+func (c *HTTPClient) CreateReservation(ctx context.Context, reference string, items []Item) (string, error) {
+	var res reservationResp
+	if err := c.call(ctx, "reserve", http.MethodPost, "/reservations", reservationReq{Reference: reference, Items: items}, &res, false); err != nil {
+		return "", err
+	}
+	return res.ID, nil
+}
+
+func (c *HTTPClient) ReservationsByReference(ctx context.Context, reference string) ([]Reservation, error) {
+	var res []Reservation
+	if err := c.call(ctx, "find reservations", http.MethodGet, "/reservations?reference="+url.QueryEscape(reference), nil, &res, true); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *HTTPClient) AmendReservation(ctx context.Context, id string, items []Item) error {
+	return c.call(ctx, "amend", http.MethodPost, "/reservations/"+id+"/amend", reservationReq{Items: items}, nil, true)
+}
+
+func (c *HTTPClient) CommitReservation(ctx context.Context, id string) error {
+	return c.call(ctx, "commit", http.MethodPost, "/reservations/"+id+"/commit", nil, nil, false)
+}
+
+func (c *HTTPClient) ReleaseReservation(ctx context.Context, id string) error {
+	return c.call(ctx, "release", http.MethodPost, "/reservations/"+id+"/release", nil, nil, true)
+}
+
+func (c *HTTPClient) ReturnReservation(ctx context.Context, id string) error {
+	return c.call(ctx, "return", http.MethodPost, "/reservations/"+id+"/return", nil, nil, true)
+}
+
+func (c *HTTPClient) ReturnStock(ctx context.Context, id, reference string, items []Item) error {
+	return c.call(ctx, "return", http.MethodPost, "/reservations/"+id+"/return", reservationReq{Reference: reference, Items: items}, nil, true)
+}
+
+// call sends body to path through the breaker, up to maxAttempts times when
+// idempotent is set and the failure is retryable. Once ctx is done it stops
+// and returns ctx's error.
+func (c *HTTPClient) call(ctx context.Context, op, method, path string, body, out interface{}, idempotent bool) error {
+	attempts := 1
+	if idempotent {
+		attempts = maxAttempts
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			t := time.NewTimer(backoff(i))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return fmt.Errorf("inventory %s: %w", op, ctx.Err())
+			case <-t.C:
+			}
+		}
+		if !c.breaker.allow() {
+			return fmt.Errorf("inventory %s: %w", op, ErrUnavailable)
+		}
+		err = c.send(ctx, op, method, path, body, out)
+		if ctx.Err() != nil {
+			// the caller gave up; that says nothing about inventory
+			c.breaker.abandon()
+			return fmt.Errorf("inventory %s: %w", op, ctx.Err())
+		}
+		c.breaker.record(IsTransient(err))
+		if err == nil || !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// backoff is the full-jitter wait before retry n (from 1).
+func backoff(n int) time.Duration {
+	d := retryMaxDelay
+	if shift := n - 1; shift < 16 {
+		d = min(retryBaseDelay<<shift, retryMaxDelay)
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// send sends body, if any, as JSON and decodes a 2xx response into out when
+// out is non-nil. Any other answer is turned into an error.
+func (c *HTTPClient) send(ctx context.Context, op, method, path string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.tokens != nil {
+		token, err := c.tokens.Token()
+		if err != nil {
+			return fmt.Errorf("inventory %s: token: %w", op, err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("inventory %s: %w: %v", op, ErrTimeout, err)
+		}
+		return fmt.Errorf("inventory %s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("inventory %s: decode response: %w", op, err)
+		}
+		return nil
+	}
+
+	// best effort: the status alone already says what went wrong
+	var e errorResp
+	_ = json.NewDecoder(resp.Body).Decode(&e)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("inventory %s: %w: status %d: %s", op, ErrUnauthorized, resp.StatusCode, e.Error)
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("inventory %s: %w", op, ErrNotFound)
+	case resp.StatusCode == http.StatusConflict && len(e.Failures) > 0:
+		return fmt.Errorf("inventory %s: %w", op, ErrInsufficientStock)
+	case resp.StatusCode == http.StatusConflict:
+		return fmt.Errorf("inventory %s: %w", op, ErrReservationClosed)
+	}
+	return &StatusError{Op: op, StatusCode: resp.StatusCode, Message: e.Error}
+}
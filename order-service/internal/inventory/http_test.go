@@ -0,0 +1,346 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// server answers every request with handler and counts the requests.
+func server(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, n int)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, int(hits.Add(1)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func status(code int, body string) func(http.ResponseWriter, *http.Request, int) {
+	return func(w http.ResponseWriter, r *http.Request, n int) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func TestRetriesIdempotentCallsOnTransientFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		handler func(http.ResponseWriter, *http.Request, int)
+		hits    int32
+	}{
+		{
+			name:    "5xx",
+			timeout: time.Second,
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				if n < 3 {
+					status(http.StatusServiceUnavailable, `{"error":"busy"}`)(w, r, n)
+					return
+				}
+				status(http.StatusOK, `{}`)(w, r, n)
+			},
+			hits: 3,
+		},
+		{
+			name:    "timeout",
+			timeout: 50 * time.Millisecond,
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				if n == 1 {
+					select {
+					case <-r.Context().Done():
+					case <-time.After(time.Second):
+					}
+					return
+				}
+				status(http.StatusOK, `{}`)(w, r, n)
+			},
+			hits: 2,
+		},
+		{
+			name:    "429",
+			timeout: time.Second,
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				if n == 1 {
+					status(http.StatusTooManyRequests, `{}`)(w, r, n)
+					return
+				}
+				status(http.StatusOK, `{}`)(w, r, n)
+			},
+			hits: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, hits := server(t, tt.handler)
+			c := NewHTTPClient(srv.URL, nil, tt.timeout)
+			if err := c.ReleaseReservation(context.Background(), "r1"); err != nil {
+				t.Fatalf("release: %v", err)
+			}
+			if got := hits.Load(); got != tt.hits {
+				t.Errorf("requests = %d, want %d", got, tt.hits)
+			}
+		})
+	}
+}
+
+func TestGivesUpAfterMaxAttempts(t *testing.T) {
+	srv, hits := server(t, status(http.StatusInternalServerError, `{"error":"boom"}`))
+	c := NewHTTPClient(srv.URL, nil, time.Second)
+
+	err := c.ReleaseReservation(context.Background(), "r1")
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusInternalServerError || !IsTransient(err) {
+		t.Fatalf("err = %v, want a transient 500", err)
+	}
+	if got := hits.Load(); got != maxAttempts {
+		t.Errorf("requests = %d, want %d", got, maxAttempts)
+	}
+}
+
+func TestDoesNotRetryCreateOrCommit(t *testing.T) {
+	calls := map[string]func(*HTTPClient) error{
+		"create": func(c *HTTPClient) error {
+			_, err := c.CreateReservation(context.Background(), "o1", []Item{{ProductID: "p1", Quantity: 1}})
+			return err
+		},
+		"commit": func(c *HTTPClient) error {
+			return c.CommitReservation(context.Background(), "r1")
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			srv, hits := server(t, status(http.StatusBadGateway, `{}`))
+			c := NewHTTPClient(srv.URL, nil, time.Second)
+			if err := call(c); !IsTransient(err) {
+				t.Fatalf("err = %v, want transient", err)
+			}
+			if got := hits.Load(); got != 1 {
+				t.Errorf("requests = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestMapsErrorAnswers(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   int
+		body   string
+		want   error
+		status int
+	}{
+		{name: "not found", code: http.StatusNotFound, body: `{"error":"reservation not found"}`, want: ErrNotFound},
+		{name: "short stock", code: http.StatusConflict, body: `{"error":"insufficient stock","failures":[{"product_id":"p1"}]}`, want: ErrInsufficientStock},
+		{name: "closed", code: http.StatusConflict, body: `{"error":"reservation is committed"}`, want: ErrReservationClosed},
+		{name: "bad request", code: http.StatusBadRequest, body: `{"error":"bad items"}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, hits := server(t, status(tt.code, tt.body))
+			c := NewHTTPClient(srv.URL, nil, time.Second)
+			err := c.AmendReservation(context.Background(), "r1", []Item{{ProductID: "p1", Quantity: 2}})
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.status != 0 {
+				var se *StatusError
+				if !errors.As(err, &se) || se.StatusCode != tt.status {
+					t.Fatalf("err = %v, want status %d", err, tt.status)
+				}
+			}
+			if IsTransient(err) {
+				t.Errorf("err = %v is transient", err)
+			}
+			if got := hits.Load(); got != 1 {
+				t.Errorf("requests = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestSendsBearerToken(t *testing.T) {
+	var got atomic.Value
+	srv, _ := server(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		got.Store(r.Header.Get("Authorization"))
+		status(http.StatusOK, `{}`)(w, r, n)
+	})
+	c := NewHTTPClient(srv.URL, StaticToken("tok"), time.Second)
+	if err := c.CommitReservation(context.Background(), "r1"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Load() != "Bearer tok" {
+		t.Errorf("Authorization = %q", got.Load())
+	}
+}
+
+func TestMapsRefusedCredentials(t *testing.T) {
+	for _, code := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		srv, hits := server(t, status(code, `{"error":"token expired"}`))
+		c := NewHTTPClient(srv.URL, StaticToken("old"), time.Second)
+		err := c.ReleaseReservation(context.Background(), "r1")
+		if !errors.Is(err, ErrUnauthorized) || IsTransient(err) {
+			t.Errorf("%d: err = %v, want ErrUnauthorized", code, err)
+		}
+		if got := hits.Load(); got != 1 {
+			t.Errorf("%d: requests = %d, want 1", code, got)
+		}
+	}
+}
+
+func TestAsksTokenSourceForEveryCall(t *testing.T) {
+	var got []string
+	var mu sync.Mutex
+	srv, _ := server(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		mu.Lock()
+		got = append(got, r.Header.Get("Authorization"))
+		mu.Unlock()
+		status(http.StatusOK, `{}`)(w, r, n)
+	})
+	tokens := &countingTokens{}
+	c := NewHTTPClient(srv.URL, tokens, time.Second)
+	for i := 0; i < 2; i++ {
+		if err := c.CommitReservation(context.Background(), "r1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got) != 2 || got[0] != "Bearer t1" || got[1] != "Bearer t2" {
+		t.Errorf("Authorization = %q", got)
+	}
+
+	tokens.err = errors.New("no secret")
+	if err := c.CommitReservation(context.Background(), "r1"); !errors.Is(err, tokens.err) {
+		t.Errorf("err = %v, want the token source's", err)
+	}
+}
+
+type countingTokens struct {
+	n   int
+	err error
+}
+
+func (c *countingTokens) Token() (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	c.n++
+	return fmt.Sprintf("t%d", c.n), nil
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	srv, hits := server(t, status(http.StatusInternalServerError, `{}`))
+	c := NewHTTPClient(srv.URL, nil, time.Second)
+
+	// commits are sent once, so every call is one failure
+	for i := 0; i < breakerThreshold; i++ {
+		if err := c.CommitReservation(context.Background(), "r1"); errors.Is(err, ErrUnavailable) {
+			t.Fatalf("call %d: breaker opened early", i+1)
+		}
+	}
+	err := c.CommitReservation(context.Background(), "r1")
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("err = %v, want ErrUnavailable", err)
+	}
+	if got := hits.Load(); got != breakerThreshold {
+		t.Errorf("requests = %d, want %d", got, breakerThreshold)
+	}
+}
+
+func TestBreakerIgnoresCallerCancellation(t *testing.T) {
+	srv, _ := server(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		<-r.Context().Done()
+	})
+	c := NewHTTPClient(srv.URL, nil, time.Second)
+	c.breaker = newBreaker(1, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.CommitReservation(ctx, "r1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the caller's deadline", err)
+	}
+	if !c.breaker.allow() {
+		t.Error("breaker opened on a call the caller gave up on")
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	var fail atomic.Bool
+	release := make(chan struct{})
+	srv, hits := server(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		if r.URL.Path == "/reservations/slow/commit" {
+			<-release
+		}
+		if fail.Load() {
+			status(http.StatusInternalServerError, `{}`)(w, r, n)
+			return
+		}
+		status(http.StatusOK, `{}`)(w, r, n)
+	})
+	c := NewHTTPClient(srv.URL, nil, time.Second)
+	c.breaker = newBreaker(1, cooldown)
+	open := func() {
+		t.Helper()
+		fail.Store(true)
+		if err := c.CommitReservation(context.Background(), "r1"); errors.Is(err, ErrUnavailable) {
+			t.Fatal("breaker already open")
+		}
+		if err := c.CommitReservation(context.Background(), "r1"); !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("err = %v, want ErrUnavailable", err)
+		}
+	}
+
+	t.Run("failed trial keeps it open", func(t *testing.T) {
+		open()
+		time.Sleep(cooldown)
+		before := hits.Load()
+		if err := c.CommitReservation(context.Background(), "r1"); errors.Is(err, ErrUnavailable) {
+			t.Fatal("trial call was not let through")
+		}
+		if err := c.CommitReservation(context.Background(), "r1"); !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("err = %v after a failed trial, want ErrUnavailable", err)
+		}
+		if got := hits.Load() - before; got != 1 {
+			t.Errorf("requests = %d, want only the trial", got)
+		}
+	})
+
+	t.Run("one trial at a time, success closes it", func(t *testing.T) {
+		time.Sleep(cooldown)
+		fail.Store(false)
+		done := make(chan error)
+		go func() { done <- c.CommitReservation(context.Background(), "slow") }()
+		// wait for the trial to reach the server
+		for deadline := time.Now().Add(time.Second); !c.breakerTrial(); {
+			if time.Now().After(deadline) {
+				t.Fatal("trial never started")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if err := c.CommitReservation(context.Background(), "r1"); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("err = %v during the trial, want ErrUnavailable", err)
+		}
+		close(release)
+		if err := <-done; err != nil {
+			t.Fatalf("trial: %v", err)
+		}
+		if err := c.CommitReservation(context.Background(), "r1"); err != nil {
+			t.Errorf("err = %v after a good trial, want the breaker closed", err)
+		}
+	})
+}
+
+// breakerTrial tells whether a trial call is in flight.
+func (c *HTTPClient) breakerTrial() bool {
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	return c.breaker.trial
+}
@@ -0,0 +1,37 @@
+// Package outbox publishes order events from the outbox to other systems.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+)
+
+// Sink delivers an event somewhere. Publish must only return nil once the
+// event was handed over; the relay then marks it published. Events can be
+// published more than once, consumers deduplicate by event id or by order id
+// and seq.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, e *domain.OutboxEvent) error
+}
+
+// LogSink writes events to the service log.
+type LogSink struct{}
+
+func NewLogSink() *LogSink {
+	return &LogSink{}
+}
+
+func (s *LogSink) Name() string { return "log" }
+
+func (s *LogSink) Publish(ctx context.Context, e *domain.OutboxEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	log.Printf("event %s: %s", e.Type, body)
+	return nil
+}
@@ -0,0 +1,28 @@
+package outbox
+
+import (
+	"context"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+)
+
+// Enqueuer queues an event for the webhook subscriptions that want it.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, e *domain.OutboxEvent) error
+}
+
+// SubscriptionSink hands events to the webhook subscriptions. It only
+// queues them; the webhook dispatcher delivers them with its own retries.
+type SubscriptionSink struct {
+	subs Enqueuer
+}
+
+func NewSubscriptionSink(subs Enqueuer) *SubscriptionSink {
+	return &SubscriptionSink{subs: subs}
+}
+
+func (s *SubscriptionSink) Name() string { return "subscriptions" }
+
+func (s *SubscriptionSink) Publish(ctx context.Context, e *domain.OutboxEvent) error {
+	return s.subs.Enqueue(ctx, e)
+}
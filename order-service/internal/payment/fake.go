@@ -0,0 +1,112 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+)
+
+// FakeDeclineMethod is always declined by the fake provider, to try out the
+// unhappy path locally.
+const FakeDeclineMethod = "declined_card"
+
+// fakeMethods are the methods the fake provider accepts.
+var fakeMethods = map[string]bool{"card": true, "wallet": true, FakeDeclineMethod: true}
+
+type fakeAuthorization struct {
+	amount   domain.Money
+	captured int64
+	refunded int64
+	voided   bool
+}
+
+// Fake is an in-memory provider for local use. It keeps authorizations until
+// the process exits and checks amounts like a real provider would.
+type Fake struct {
+	mu    sync.Mutex
+	auths map[string]*fakeAuthorization
+}
+
+func NewFake() *Fake {
+	return &Fake{auths: make(map[string]*fakeAuthorization)}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Authorize(ctx context.Context, orderID, method string, amount domain.Money) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if !fakeMethods[method] {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedMethod, method)
+	}
+	if method == FakeDeclineMethod {
+		return "", ErrDeclined
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	ref := "fake_" + hex.EncodeToString(b)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auths[ref] = &fakeAuthorization{amount: amount}
+	return ref, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, ref string, amount domain.Money) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a, ok := f.auths[ref]
+	if !ok {
+		return ErrUnknownReference
+	}
+	if a.voided || amount.Currency != a.amount.Currency || a.captured+amount.Amount > a.amount.Amount {
+		return ErrInvalidAmount
+	}
+	a.captured += amount.Amount
+	return nil
+}
+
+func (f *Fake) Void(ctx context.Context, ref string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a, ok := f.auths[ref]
+	if !ok {
+		return ErrUnknownReference
+	}
+	if a.captured > 0 {
+		return fmt.Errorf("%w: authorization was captured", ErrInvalidAmount)
+	}
+	a.voided = true
+	return nil
+}
+
+func (f *Fake) Refund(ctx context.Context, ref string, amount domain.Money) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a, ok := f.auths[ref]
+	if !ok {
+		return ErrUnknownReference
+	}
+	if amount.Currency != a.amount.Currency || a.refunded+amount.Amount > a.captured {
+		return ErrInvalidAmount
+	}
+	a.refunded += amount.Amount
+	return nil
+}
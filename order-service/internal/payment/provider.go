@@ -0,0 +1,34 @@
+// Package payment talks to payment providers on behalf of orders.
+package payment
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+)
+
+var (
+	// ErrDeclined means the provider refused the operation for the customer's
+	// method, e.g. insufficient funds. Retrying will not help.
+	ErrDeclined          = errors.New("payment declined")
+	ErrUnsupportedMethod = errors.New("unsupported payment method")
+	ErrUnknownReference  = errors.New("unknown payment reference")
+	// ErrInvalidAmount means a capture or refund exceeds what the
+	// authorization or capture left.
+	ErrInvalidAmount = errors.New("invalid payment amount")
+)
+
+// Provider moves money through a payment provider. Capture, Void and Refund
+// act on the authorization Authorize returned a reference for. Calls give up
+// when ctx is done; the operation may then still have gone through.
+type Provider interface {
+	Name() string
+	// Authorize reserves amount on the customer's method and returns the
+	// provider's reference for the authorization.
+	Authorize(ctx context.Context, orderID, method string, amount domain.Money) (string, error)
+	Capture(ctx context.Context, ref string, amount domain.Money) error
+	// Void drops an authorization that was not captured.
+	Void(ctx context.Context, ref string) error
+	Refund(ctx context.Context, ref string, amount domain.Money) error
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// LockRepo hands out named leases so a job runs on one replica at a time.
+type LockRepo interface {
+	// Acquire takes the lock name for owner until ttl from now, or extends
+	// owner's lease. It reports false while another owner holds an unexpired
+	// lease.
+	Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	// Release gives up owner's lease early. Releasing a lock owner does not
+	// hold does nothing.
+	Release(ctx context.Context, name, owner string) error
+}
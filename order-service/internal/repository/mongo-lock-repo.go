@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoLockRepo keeps one document per lock in the locks collection, keyed
+// by the lock name.
+type MongoLockRepo struct {
+	coll     *mongo.Collection
+	timeouts Timeouts
+}
+
+func NewMongoLockRepo(db *mongo.Database, t Timeouts) *MongoLockRepo {
+	return &MongoLockRepo{
+		coll:     db.Collection("locks"),
+		timeouts: t,
+	}
+}
+
+func (r *MongoLockRepo) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	// the filter only matches a lock that is ours or has run out; when a
+	// live lease of someone else exists the upsert collides on _id
+	_, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": name, "$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expires_at": bson.M{"$lte": now}},
+		}},
+		bson.M{
+			"$set":         bson.M{"owner": owner, "expires_at": now.Add(ttl), "renewed_at": now},
+			"$setOnInsert": bson.M{"created_at": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *MongoLockRepo) Release(ctx context.Context, name, owner string) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	_, err := r.coll.DeleteOne(ctx, bson.M{"_id": name, "owner": owner})
+	return err
+}
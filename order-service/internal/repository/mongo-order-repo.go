@@ -13,50 +13,106 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var ErrOrderNotFound = errors.New("order not found")
+var (
+	ErrOrderNotFound   = errors.New("order not found")
+	ErrVersionConflict = errors.New("version mismatch")
+)
 
+// MongoOrderRepo writes an outbox event in the same transaction as every
+// order change other services care about: creation, status changes and
+// edited items.
 type MongoOrderRepo struct {
-	coll *mongo.Collection
+	db       *mongo.Database
+	coll     *mongo.Collection
+	outbox   *mongo.Collection
+	timeouts Timeouts
 }
 
-func NewMongoOrderRepo(db *mongo.Database) *MongoOrderRepo {
+func NewMongoOrderRepo(db *mongo.Database, t Timeouts) *MongoOrderRepo {
 	return &MongoOrderRepo{
-		coll: db.Collection("orders"),
+		db:       db,
+		coll:     db.Collection("orders"),
+		outbox:   db.Collection("outbox"),
+		timeouts: t,
 	}
 }
 
-func (r *MongoOrderRepo) Create(order *domain.Order) (string, error) {
+func (r *MongoOrderRepo) EnsureIndexes() error {
+	ctx, cancel := r.timeouts.batch(context.Background())
+	defer cancel()
+	// ListStalePending
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	return err
+}
+
+// NextID hands out an id for an order that will be created later, so other
+// services can reference the order before it is written.
+func (r *MongoOrderRepo) NextID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+func (r *MongoOrderRepo) Create(ctx context.Context, order *domain.Order) (string, error) {
 	now := time.Now().UTC()
 	order.CreatedAt = now
 	order.UpdatedAt = now
+	order.Version = 1
 	if order.Status == "" {
 		order.Status = domain.StatusPending
 	}
+	// the history starts with the user placing the order
+	order.History = []domain.StatusChange{{To: order.Status, Actor: order.UserID, At: now}}
 	oid := primitive.NewObjectID()
+	if order.ID != "" {
+		var err error
+		if oid, err = primitive.ObjectIDFromHex(order.ID); err != nil {
+			return "", err
+		}
+	}
 	doc := bson.M{
-		"_id":         oid,
-		"user_id":     order.UserID,
-		"items":       order.Items,
-		"total_cents": order.TotalCents,
-		"status":      order.Status,
-		"created_at":  order.CreatedAt,
-		"updated_at":  order.UpdatedAt,
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		"_id":        oid,
+		"user_id":    order.UserID,
+		"items":      order.Items,
+		"total":      order.Total,
+		"status":     order.Status,
+		"version":    order.Version,
+		"history":    order.History,
+		"created_at": order.CreatedAt,
+		"updated_at": order.UpdatedAt,
+	}
+	if order.ReservationID != "" {
+		doc["reservation_id"] = order.ReservationID
+	}
+	if order.PaymentMethod != "" {
+		doc["payment_method"] = order.PaymentMethod
+	}
+	ctx, cancel := r.timeouts.batch(ctx)
 	defer cancel()
-	_, err := r.coll.InsertOne(ctx, doc)
+	err := withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		if _, err := r.coll.InsertOne(sc, doc); err != nil {
+			return err
+		}
+		return insertEvent(sc, r.outbox, oid.Hex(), domain.EventOrderCreated, order.Version, domain.OrderCreatedData{
+			UserID:        order.UserID,
+			Items:         order.Items,
+			Total:         order.Total,
+			Status:        order.Status,
+			PaymentMethod: order.PaymentMethod,
+		}, now)
+	})
 	if err != nil {
 		return "", err
 	}
 	return oid.Hex(), nil
 }
 
-func (r *MongoOrderRepo) GetByID(id string) (*domain.Order, error) {
+func (r *MongoOrderRepo) GetByID(ctx context.Context, id string) (*domain.Order, error) {
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, ErrOrderNotFound
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := r.timeouts.query(ctx)
 	defer cancel()
 	var res bson.M
 	if err := r.coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&res); err != nil {
@@ -65,74 +121,166 @@ func (r *MongoOrderRepo) GetByID(id string) (*domain.Order, error) {
 		}
 		return nil, err
 	}
-	o := &domain.Order{}
-	if idv, ok := res["_id"].(primitive.ObjectID); ok {
-		o.ID = idv.Hex()
-	} else {
-		o.ID = fmt.Sprintf("%v", res["_id"])
-	}
-	if v, ok := res["user_id"].(string); ok {
-		o.UserID = v
+	return decodeOrder(res), nil
+}
+
+// UpdateStatus moves the order to change.To and appends change to its
+// history if the order is still at version and not being edited, and bumps
+// the version. Orders written before versioning count as version 0. The
+// order.status_changed event carries the new version as its Seq.
+func (r *MongoOrderRepo) UpdateStatus(ctx context.Context, id string, change domain.StatusChange, version int64) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrOrderNotFound
 	}
-	if items, ok := res["items"].(primitive.A); ok {
-		// decode using bson -> marshal/unmarshal is simpler but to avoid import, iterate
-		var parsed []domain.OrderItem
-		for _, it := range items {
-			if m, ok := it.(bson.M); ok {
-				parsed = append(parsed, domain.OrderItem{
-					ProductID:  getString(m["product_id"]),
-					Quantity:   getInt(m["quantity"]),
-					PriceCents: getInt64(m["price_cents"]),
-				})
-			}
-		}
-		o.Items = parsed
-	} else if items, ok := res["items"].([]interface{}); ok {
-		var parsed []domain.OrderItem
-		for _, it := range items {
-			if m, ok := it.(bson.M); ok {
-				parsed = append(parsed, domain.OrderItem{
-					ProductID:  getString(m["product_id"]),
-					Quantity:   getInt(m["quantity"]),
-					PriceCents: getInt64(m["price_cents"]),
-				})
-			}
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	filter := versionFilter(oid, version)
+	filter["edit_saga"] = bson.M{"$exists": false}
+	return withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		newVersion, err := r.updateVersioned(sc, oid, filter, bson.M{
+			"$set":  bson.M{"status": change.To, "updated_at": change.At},
+			"$push": bson.M{"history": change},
+			"$inc":  bson.M{"version": 1},
+		})
+		if err != nil {
+			return err
 		}
-		o.Items = parsed
+		return insertEvent(sc, r.outbox, id, domain.EventOrderStatusChanged, newVersion, change, change.At)
+	})
+}
+
+func (r *MongoOrderRepo) BeginEdit(ctx context.Context, id string, version int64, sagaID string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrOrderNotFound
 	}
-	o.TotalCents = getInt64(res["total_cents"])
-	if s, ok := res["status"].(string); ok {
-		o.Status = domain.OrderStatus(s)
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	filter := versionFilter(oid, version)
+	filter["status"] = domain.StatusPending
+	filter["edit_saga"] = bson.M{"$exists": false}
+	res, err := r.coll.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"edit_saga": sagaID, "updated_at": time.Now().UTC()},
+		"$inc": bson.M{"version": 1},
+	})
+	if err != nil {
+		return err
 	}
-	if t, ok := res["created_at"].(primitive.DateTime); ok {
-		o.CreatedAt = t.Time()
+	if res.MatchedCount == 0 {
+		return r.missOrConflict(ctx, oid)
 	}
-	if t, ok := res["updated_at"].(primitive.DateTime); ok {
-		o.UpdatedAt = t.Time()
+	return nil
+}
+
+// FinishEdit writes the new items and total of an order locked by sagaID and
+// unlocks it.
+func (r *MongoOrderRepo) FinishEdit(ctx context.Context, id, sagaID string, items []domain.OrderItem, total domain.Money) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrOrderNotFound
 	}
-	return o, nil
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	now := time.Now().UTC()
+	return withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		newVersion, err := r.updateVersioned(sc, oid, bson.M{"_id": oid, "edit_saga": sagaID}, bson.M{
+			"$set":   bson.M{"items": items, "total": total, "updated_at": now},
+			"$unset": bson.M{"edit_saga": ""},
+			"$inc":   bson.M{"version": 1},
+		})
+		if err != nil {
+			return err
+		}
+		return insertEvent(sc, r.outbox, id, domain.EventOrderItemsUpdated, newVersion,
+			domain.OrderItemsUpdatedData{Items: items, Total: total}, now)
+	})
 }
 
-func (r *MongoOrderRepo) UpdateStatus(id string, status domain.OrderStatus) error {
+func (r *MongoOrderRepo) FinishPay(ctx context.Context, id, sagaID string, change domain.StatusChange) error {
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return ErrOrderNotFound
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := r.timeouts.batch(ctx)
 	defer cancel()
-	res, err := r.coll.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{
-		"$set": bson.M{"status": status, "updated_at": time.Now().UTC()},
+	return withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		newVersion, err := r.updateVersioned(sc, oid, bson.M{"_id": oid, "edit_saga": sagaID}, bson.M{
+			"$set":   bson.M{"status": change.To, "updated_at": change.At},
+			"$push":  bson.M{"history": change},
+			"$unset": bson.M{"edit_saga": ""},
+			"$inc":   bson.M{"version": 1},
+		})
+		if err != nil {
+			return err
+		}
+		return insertEvent(sc, r.outbox, id, domain.EventOrderStatusChanged, newVersion, change, change.At)
 	})
+}
+
+// AbortEdit unlocks an order locked by sagaID without changing it. An order
+// no longer locked by sagaID is left alone.
+func (r *MongoOrderRepo) AbortEdit(ctx context.Context, id, sagaID string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrOrderNotFound
+	}
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	_, err = r.updateVersioned(ctx, oid, bson.M{"_id": oid, "edit_saga": sagaID}, bson.M{
+		"$set":   bson.M{"updated_at": time.Now().UTC()},
+		"$unset": bson.M{"edit_saga": ""},
+	})
+	if err == ErrVersionConflict {
+		return nil
+	}
+	return err
+}
+
+// updateVersioned applies update to the order matched by filter and returns
+// the order's version after it. A miss is explained by missOrConflict.
+func (r *MongoOrderRepo) updateVersioned(ctx context.Context, oid primitive.ObjectID, filter, update bson.M) (int64, error) {
+	var after bson.M
+	err := r.coll.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"version": 1}),
+	).Decode(&after)
+	if err == mongo.ErrNoDocuments {
+		return 0, r.missOrConflict(ctx, oid)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return getInt64(after["version"]), nil
+}
+
+func versionFilter(oid primitive.ObjectID, version int64) bson.M {
+	switch version {
+	case domain.AnyVersion:
+		return bson.M{"_id": oid}
+	case 0:
+		return bson.M{"_id": oid, "$or": bson.A{
+			bson.M{"version": 0},
+			bson.M{"version": bson.M{"$exists": false}},
+		}}
+	default:
+		return bson.M{"_id": oid, "version": version}
+	}
+}
+
+// missOrConflict explains why a versioned write matched nothing.
+func (r *MongoOrderRepo) missOrConflict(ctx context.Context, oid primitive.ObjectID) error {
+	n, err := r.coll.CountDocuments(ctx, bson.M{"_id": oid}, options.Count().SetLimit(1))
 	if err != nil {
 		return err
 	}
-	if res.MatchedCount == 0 {
+	if n == 0 {
 		return ErrOrderNotFound
 	}
-	return nil
+	return ErrVersionConflict
 }
 
-func (r *MongoOrderRepo) ListByUser(userID string, page, pageSize int64) ([]*domain.Order, int64, error) {
+func (r *MongoOrderRepo) ListByUser(ctx context.Context, userID string, page, pageSize int64) ([]*domain.Order, int64, error) {
 	if page <= 0 {
 		page = 1
 	}
@@ -140,13 +288,14 @@ func (r *MongoOrderRepo) ListByUser(userID string, page, pageSize int64) ([]*dom
 		pageSize = 20
 	}
 	f := bson.M{"user_id": userID}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := r.timeouts.batch(ctx)
 	defer cancel()
 	total, err := r.coll.CountDocuments(ctx, f)
 	if err != nil {
 		return nil, 0, err
 	}
-	opts := options.Find().SetSkip((page - 1) * pageSize).SetLimit(pageSize).SetSort(bson.D{{Key: "created_at", Value: -1}})
+	opts := options.Find().SetSkip((page - 1) * pageSize).SetLimit(pageSize).SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetProjection(bson.M{"history": 0})
 	cur, err := r.coll.Find(ctx, f, opts)
 	if err != nil {
 		return nil, 0, err
@@ -158,45 +307,98 @@ func (r *MongoOrderRepo) ListByUser(userID string, page, pageSize int64) ([]*dom
 		if err := cur.Decode(&res); err != nil {
 			return nil, 0, err
 		}
-		o := &domain.Order{}
-		if idv, ok := res["_id"].(primitive.ObjectID); ok {
-			o.ID = idv.Hex()
-		} else {
-			o.ID = fmt.Sprintf("%v", res["_id"])
-		}
-		if v, ok := res["user_id"].(string); ok {
-			o.UserID = v
-		}
-		o.TotalCents = getInt64(res["total_cents"])
-		if s, ok := res["status"].(string); ok {
-			o.Status = domain.OrderStatus(s)
-		}
-		if t, ok := res["created_at"].(primitive.DateTime); ok {
-			o.CreatedAt = t.Time()
+		out = append(out, decodeOrder(res))
+	}
+	if err := cur.Err(); err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+func (r *MongoOrderRepo) ListStalePending(ctx context.Context, placedBefore time.Time, limit int64) ([]*domain.Order, error) {
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	f := bson.M{
+		"status":     domain.StatusPending,
+		"created_at": bson.M{"$lt": placedBefore},
+		"edit_saga":  bson.M{"$exists": false},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(limit).
+		SetProjection(bson.M{"history": 0})
+	cur, err := r.coll.Find(ctx, f, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []*domain.Order
+	for cur.Next(ctx) {
+		var res bson.M
+		if err := cur.Decode(&res); err != nil {
+			return nil, err
 		}
-		if t, ok := res["updated_at"].(primitive.DateTime); ok {
-			o.UpdatedAt = t.Time()
+		out = append(out, decodeOrder(res))
+	}
+	return out, cur.Err()
+}
+
+// decodeOrder maps a raw order document onto domain.Order, tolerating the
+// numeric types and cents-only prices older documents were written with.
+func decodeOrder(res bson.M) *domain.Order {
+	o := &domain.Order{}
+	if idv, ok := res["_id"].(primitive.ObjectID); ok {
+		o.ID = idv.Hex()
+	} else {
+		o.ID = fmt.Sprintf("%v", res["_id"])
+	}
+	if v, ok := res["user_id"].(string); ok {
+		o.UserID = v
+	}
+	var items []interface{}
+	switch v := res["items"].(type) {
+	case primitive.A:
+		items = v
+	case []interface{}:
+		items = v
+	}
+	for _, it := range items {
+		if m, ok := it.(bson.M); ok {
+			o.Items = append(o.Items, domain.OrderItem{
+				ProductID: getString(m["product_id"]),
+				Quantity:  getInt(m["quantity"]),
+				Price:     getMoney(m["price"], m["price_cents"]),
+			})
 		}
-		// items parse (similar to GetByID)
-		if items, ok := res["items"].(primitive.A); ok {
-			var parsed []domain.OrderItem
-			for _, it := range items {
-				if m, ok := it.(bson.M); ok {
-					parsed = append(parsed, domain.OrderItem{
-						ProductID:  getString(m["product_id"]),
-						Quantity:   getInt(m["quantity"]),
-						PriceCents: getInt64(m["price_cents"]),
-					})
+	}
+	o.Total = getMoney(res["total"], res["total_cents"])
+	if s, ok := res["status"].(string); ok {
+		o.Status = domain.OrderStatus(s)
+	}
+	o.ReservationID = getString(res["reservation_id"])
+	o.PaymentMethod = getString(res["payment_method"])
+	o.Version = getInt64(res["version"])
+	if t, ok := res["created_at"].(primitive.DateTime); ok {
+		o.CreatedAt = t.Time()
+	}
+	if t, ok := res["updated_at"].(primitive.DateTime); ok {
+		o.UpdatedAt = t.Time()
+	}
+	if history, ok := res["history"].(primitive.A); ok {
+		for _, h := range history {
+			if m, ok := h.(bson.M); ok {
+				change := domain.StatusChange{
+					From:   domain.OrderStatus(getString(m["from"])),
+					To:     domain.OrderStatus(getString(m["to"])),
+					Actor:  getString(m["actor"]),
+					Reason: getString(m["reason"]),
 				}
+				if t, ok := m["at"].(primitive.DateTime); ok {
+					change.At = t.Time()
+				}
+				o.History = append(o.History, change)
 			}
-			o.Items = parsed
 		}
-		out = append(out, o)
-	}
-	if err := cur.Err(); err != nil {
-		return nil, 0, err
 	}
-	return out, total, nil
+	return o
 }
 
 // helpers (same as inventory repo utils)
@@ -245,3 +447,12 @@ func getInt64(v interface{}) int64 {
 		return 0
 	}
 }
+
+// getMoney reads an {amount, currency} subdocument, falling back to a legacy
+// plain cents value in DefaultCurrency.
+func getMoney(v interface{}, legacyCents interface{}) domain.Money {
+	if m, ok := v.(bson.M); ok {
+		return domain.Money{Amount: getInt64(m["amount"]), Currency: getString(m["currency"])}
+	}
+	return domain.Money{Amount: getInt64(legacyCents), Currency: domain.DefaultCurrency}
+}
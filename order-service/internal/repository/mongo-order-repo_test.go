@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDecodeOrderHistory(t *testing.T) {
+	placed := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	paid := placed.Add(time.Hour)
+	doc := bson.M{
+		"_id":    "order_1",
+		"status": "paid",
+		"history": primitive.A{
+			bson.M{"to": "pending", "actor": "u1", "at": primitive.NewDateTimeFromTime(placed)},
+			bson.M{"from": "pending", "to": "paid", "actor": "a1", "reason": "wire arrived", "at": primitive.NewDateTimeFromTime(paid)},
+		},
+	}
+	want := []domain.StatusChange{
+		{To: domain.StatusPending, Actor: "u1", At: placed},
+		{From: domain.StatusPending, To: domain.StatusPaid, Actor: "a1", Reason: "wire arrived", At: paid},
+	}
+	got := decodeOrder(doc).History
+	if len(got) != len(want) {
+		t.Fatalf("history = %+v, want %+v", got, want)
+	}
+	for i := range got {
+		if !got[i].At.Equal(want[i].At) {
+			t.Errorf("entry %d at %v, want %v", i, got[i].At, want[i].At)
+		}
+		got[i].At = want[i].At
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// orders from before history was kept have none
+	delete(doc, "history")
+	if got := decodeOrder(doc).History; got != nil {
+		t.Errorf("history = %+v, want none", got)
+	}
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// publishedEventTTL is how long published events are kept for inspection.
+const publishedEventTTL = 7 * 24 * time.Hour
+
+type MongoOutboxRepo struct {
+	coll     *mongo.Collection
+	timeouts Timeouts
+}
+
+func NewMongoOutboxRepo(db *mongo.Database, t Timeouts) *MongoOutboxRepo {
+	return &MongoOutboxRepo{
+		coll:     db.Collection("outbox"),
+		timeouts: t,
+	}
+}
+
+func (r *MongoOutboxRepo) EnsureIndexes() error {
+	ctx, cancel := r.timeouts.batch(context.Background())
+	defer cancel()
+	_, err := r.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "seq", Value: 1}}},
+		// pending events have no published_at and are never expired
+		{
+			Keys:    bson.D{{Key: "published_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(publishedEventTTL.Seconds())),
+		},
+	})
+	return err
+}
+
+func (r *MongoOutboxRepo) ListDue(ctx context.Context, now time.Time, limit int64) ([]domain.OutboxEvent, error) {
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "occurred_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit)
+	cur, err := r.coll.Find(ctx, bson.M{
+		"status":          domain.OutboxPending,
+		"next_attempt_at": bson.M{"$lte": now},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	events := []domain.OutboxEvent{}
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *MongoOutboxRepo) HasEarlierPending(ctx context.Context, orderID string, seq int64) (bool, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	n, err := r.coll.CountDocuments(ctx, bson.M{
+		"order_id": orderID,
+		"status":   domain.OutboxPending,
+		"seq":      bson.M{"$lt": seq},
+	}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+func (r *MongoOutboxRepo) MarkPublished(ctx context.Context, id string, at time.Time) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	_, err := r.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":   bson.M{"status": domain.OutboxPublished, "published_at": at},
+		"$unset": bson.M{"last_error": ""},
+	})
+	return err
+}
+
+func (r *MongoOutboxRepo) MarkFailed(ctx context.Context, id string, attempts int, nextAttemptAt time.Time, lastError string) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	_, err := r.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}})
+	return err
+}
+
+// insertEvent writes an event into the outbox collection. Called inside the
+// transaction of the order write it describes.
+func insertEvent(sc mongo.SessionContext, outbox *mongo.Collection, orderID string, typ domain.EventType, seq int64, data interface{}, at time.Time) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = outbox.InsertOne(sc, domain.OutboxEvent{
+		ID:            primitive.NewObjectID().Hex(),
+		Type:          typ,
+		OrderID:       orderID,
+		Seq:           seq,
+		Data:          raw,
+		OccurredAt:    at,
+		Status:        domain.OutboxPending,
+		NextAttemptAt: at,
+	})
+	return err
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrPaymentNotFound = errors.New("payment not found")
+
+type MongoPaymentRepo struct {
+	coll     *mongo.Collection
+	timeouts Timeouts
+}
+
+func NewMongoPaymentRepo(db *mongo.Database, t Timeouts) *MongoPaymentRepo {
+	return &MongoPaymentRepo{
+		coll:     db.Collection("payments"),
+		timeouts: t,
+	}
+}
+
+// EnsureIndexes allows one payment per order.
+func (r *MongoPaymentRepo) EnsureIndexes() error {
+	ctx, cancel := r.timeouts.batch(context.Background())
+	defer cancel()
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "order_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (r *MongoPaymentRepo) Create(ctx context.Context, p *domain.Payment) error {
+	now := time.Now().UTC()
+	p.ID = primitive.NewObjectID().Hex()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	_, err := r.coll.InsertOne(ctx, p)
+	return err
+}
+
+func (r *MongoPaymentRepo) GetByOrderID(ctx context.Context, orderID string) (*domain.Payment, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	var p domain.Payment
+	if err := r.coll.FindOne(ctx, bson.M{"order_id": orderID}).Decode(&p); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *MongoPaymentRepo) Save(ctx context.Context, p *domain.Payment) error {
+	p.UpdatedAt = time.Now().UTC()
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	res, err := r.coll.UpdateOne(ctx, bson.M{"_id": p.ID}, bson.M{
+		"$set": bson.M{
+			"status":       p.Status,
+			"captured":     p.Captured,
+			"refunded":     p.Refunded,
+			"provider_ref": p.ProviderRef,
+			"attempts":     p.Attempts,
+			"updated_at":   p.UpdatedAt,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrPaymentNotFound
+	}
+	return nil
+}
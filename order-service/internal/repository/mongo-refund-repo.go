@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrRefundConflict = errors.New("order was refunded concurrently")
+
+type MongoRefundRepo struct {
+	coll     *mongo.Collection
+	timeouts Timeouts
+}
+
+func NewMongoRefundRepo(db *mongo.Database, t Timeouts) *MongoRefundRepo {
+	return &MongoRefundRepo{
+		coll:     db.Collection("refunds"),
+		timeouts: t,
+	}
+}
+
+func (r *MongoRefundRepo) EnsureIndexes() error {
+	ctx, cancel := r.timeouts.batch(context.Background())
+	defer cancel()
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "order_id", Value: 1}, {Key: "seq", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (r *MongoRefundRepo) Create(ctx context.Context, refund *domain.Refund) error {
+	now := time.Now().UTC()
+	refund.ID = primitive.NewObjectID().Hex()
+	refund.CreatedAt = now
+	refund.UpdatedAt = now
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	_, err := r.coll.InsertOne(ctx, refund)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrRefundConflict
+	}
+	return err
+}
+
+func (r *MongoRefundRepo) Save(ctx context.Context, refund *domain.Refund) error {
+	refund.UpdatedAt = time.Now().UTC()
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	_, err := r.coll.UpdateOne(ctx, bson.M{"_id": refund.ID}, bson.M{
+		"$set": bson.M{
+			"status":     refund.Status,
+			"error":      refund.Error,
+			"updated_at": refund.UpdatedAt,
+		},
+	})
+	return err
+}
+
+// ListByOrder returns the order's refunds, oldest first.
+func (r *MongoRefundRepo) ListByOrder(ctx context.Context, orderID string) ([]domain.Refund, error) {
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	cur, err := r.coll.Find(ctx, bson.M{"order_id": orderID}, options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	refunds := []domain.Refund{}
+	if err := cur.All(ctx, &refunds); err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoSagaRepo struct {
+	coll     *mongo.Collection
+	timeouts Timeouts
+}
+
+func NewMongoSagaRepo(db *mongo.Database, t Timeouts) *MongoSagaRepo {
+	return &MongoSagaRepo{
+		coll:     db.Collection("sagas"),
+		timeouts: t,
+	}
+}
+
+func (r *MongoSagaRepo) Create(ctx context.Context, saga *domain.Saga) error {
+	now := time.Now().UTC()
+	saga.ID = primitive.NewObjectID().Hex()
+	saga.CreatedAt = now
+	saga.UpdatedAt = now
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	_, err := r.coll.InsertOne(ctx, saga)
+	return err
+}
+
+// Save persists the saga's progress. It is called after every step.
+func (r *MongoSagaRepo) Save(ctx context.Context, saga *domain.Saga) error {
+	saga.UpdatedAt = time.Now().UTC()
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	_, err := r.coll.UpdateOne(ctx, bson.M{"_id": saga.ID}, bson.M{
+		"$set": bson.M{
+			"step":           saga.Step,
+			"status":         saga.Status,
+			"reservation_id": saga.ReservationID,
+			"error":          saga.Error,
+			"edit":           saga.Edit,
+			"updated_at":     saga.UpdatedAt,
+		},
+	})
+	return err
+}
+
+// ListUnfinished returns sagas that are running or compensating and have not
+// moved since notUpdatedSince, oldest first.
+func (r *MongoSagaRepo) ListUnfinished(ctx context.Context, notUpdatedSince time.Time) ([]*domain.Saga, error) {
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	cur, err := r.coll.Find(ctx, bson.M{
+		"status":     bson.M{"$in": bson.A{domain.SagaRunning, domain.SagaCompensating}},
+		"updated_at": bson.M{"$lt": notUpdatedSince},
+	}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []*domain.Saga
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
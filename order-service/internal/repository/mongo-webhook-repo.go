@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrWebhookNotFound    = errors.New("webhook subscription not found")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+const duplicateKeyCode = 11000
+
+// deliveredTTL is how long delivered deliveries are kept for inspection.
+const deliveredTTL = 7 * 24 * time.Hour
+
+type MongoWebhookRepo struct {
+	db          *mongo.Database
+	subs        *mongo.Collection
+	deliveries  *mongo.Collection
+	deadLetters *mongo.Collection
+	timeouts    Timeouts
+}
+
+func NewMongoWebhookRepo(db *mongo.Database, t Timeouts) *MongoWebhookRepo {
+	return &MongoWebhookRepo{
+		db:          db,
+		subs:        db.Collection("webhook_subscriptions"),
+		deliveries:  db.Collection("webhook_deliveries"),
+		deadLetters: db.Collection("webhook_dead_letters"),
+		timeouts:    t,
+	}
+}
+
+func (r *MongoWebhookRepo) EnsureIndexes() error {
+	ctx, cancel := r.timeouts.batch(context.Background())
+	defer cancel()
+	_, err := r.subs.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "event_types", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.deliveries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "subscription_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "delivered_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(deliveredTTL.Seconds())),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.deadLetters.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "subscription_id", Value: 1}, {Key: "updated_at", Value: -1}},
+	})
+	return err
+}
+
+func (r *MongoWebhookRepo) CreateSubscription(ctx context.Context, s *domain.WebhookSubscription) error {
+	now := time.Now().UTC()
+	s.ID = primitive.NewObjectID().Hex()
+	s.CreatedAt = now
+	s.UpdatedAt = now
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	_, err := r.subs.InsertOne(ctx, s)
+	return err
+}
+
+func (r *MongoWebhookRepo) GetSubscription(ctx context.Context, id string) (*domain.WebhookSubscription, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	var s domain.WebhookSubscription
+	if err := r.subs.FindOne(ctx, bson.M{"_id": id}).Decode(&s); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *MongoWebhookRepo) ListSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	return r.findSubscriptions(ctx, bson.M{})
+}
+
+func (r *MongoWebhookRepo) SubscriptionsFor(ctx context.Context, eventType string) ([]domain.WebhookSubscription, error) {
+	return r.findSubscriptions(ctx, bson.M{"event_types": bson.M{"$in": bson.A{eventType, domain.WebhookAllEvents}}})
+}
+
+func (r *MongoWebhookRepo) findSubscriptions(ctx context.Context, filter bson.M) ([]domain.WebhookSubscription, error) {
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	cur, err := r.subs.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	subs := []domain.WebhookSubscription{}
+	if err := cur.All(ctx, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (r *MongoWebhookRepo) DeleteSubscription(ctx context.Context, id string) error {
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	return withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		res, err := r.subs.DeleteOne(sc, bson.M{"_id": id})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return ErrWebhookNotFound
+		}
+		_, err = r.deliveries.DeleteMany(sc, bson.M{"subscription_id": id, "status": domain.DeliveryPending})
+		return err
+	})
+}
+
+func (r *MongoWebhookRepo) Enqueue(ctx context.Context, deliveries []domain.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, 0, len(deliveries))
+	for i := range deliveries {
+		docs = append(docs, &deliveries[i])
+	}
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	_, err := r.deliveries.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if onlyDuplicates(err) {
+		return nil
+	}
+	return err
+}
+
+// onlyDuplicates tells whether err is a bulk insert error every part of
+// which is a duplicate key.
+func onlyDuplicates(err error) bool {
+	var bulk mongo.BulkWriteException
+	if !errors.As(err, &bulk) || bulk.WriteConcernError != nil {
+		return false
+	}
+	for _, we := range bulk.WriteErrors {
+		if we.Code != duplicateKeyCode {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *MongoWebhookRepo) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*domain.WebhookDelivery, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	var d domain.WebhookDelivery
+	err := r.deliveries.FindOneAndUpdate(ctx,
+		bson.M{"status": domain.DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&d)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *MongoWebhookRepo) SaveAttempt(ctx context.Context, d *domain.WebhookDelivery) error {
+	d.UpdatedAt = time.Now().UTC()
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+	_, err := r.deliveries.UpdateOne(ctx, bson.M{"_id": d.ID}, bson.M{"$set": bson.M{
+		"status":           d.Status,
+		"attempts":         d.Attempts,
+		"next_attempt_at":  d.NextAttemptAt,
+		"last_error":       d.LastError,
+		"last_status_code": d.LastStatusCode,
+		"delivered_at":     d.DeliveredAt,
+		"updated_at":       d.UpdatedAt,
+	}})
+	return err
+}
+
+func (r *MongoWebhookRepo) DeadLetter(ctx context.Context, d *domain.WebhookDelivery) error {
+	d.Status = domain.DeliveryDead
+	d.UpdatedAt = time.Now().UTC()
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	return withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		if _, err := r.deliveries.DeleteOne(sc, bson.M{"_id": d.ID}); err != nil {
+			return err
+		}
+		_, err := r.deadLetters.ReplaceOne(sc, bson.M{"_id": d.ID}, d, options.Replace().SetUpsert(true))
+		return err
+	})
+}
+
+func (r *MongoWebhookRepo) ListDeadLetters(ctx context.Context, subscriptionID string, limit int64) ([]domain.WebhookDelivery, error) {
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	filter := bson.M{}
+	if subscriptionID != "" {
+		filter["subscription_id"] = subscriptionID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}).SetLimit(limit)
+	cur, err := r.deadLetters.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []domain.WebhookDelivery{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *MongoWebhookRepo) Redeliver(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	ctx, cancel := r.timeouts.batch(ctx)
+	defer cancel()
+	var d domain.WebhookDelivery
+	err := withTransaction(ctx, r.db, func(sc mongo.SessionContext) error {
+		d = domain.WebhookDelivery{}
+		if err := r.deadLetters.FindOneAndDelete(sc, bson.M{"_id": id}).Decode(&d); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrDeadLetterNotFound
+			}
+			return err
+		}
+		now := time.Now().UTC()
+		d.Status = domain.DeliveryPending
+		d.Attempts = 0
+		d.NextAttemptAt = now
+		d.UpdatedAt = now
+		_, err := r.deliveries.InsertOne(sc, &d)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
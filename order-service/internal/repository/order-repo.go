@@ -1,12 +1,29 @@
 package repository
 
 import (
+	"context"
+	"time"
+
 	"github.com/Nurda-zh/a1/order-service/internal/domain"
 )
 
 type OrderRepo interface {
-	Create(order *domain.Order) (string, error)
-	GetByID(id string) (*domain.Order, error)
-	UpdateStatus(id string, status domain.OrderStatus) error
-	ListByUser(userID string, page, pageSize int64) ([]*domain.Order, int64, error)
+	EnsureIndexes() error
+	NextID() string
+	Create(ctx context.Context, order *domain.Order) (string, error)
+	GetByID(ctx context.Context, id string) (*domain.Order, error)
+	UpdateStatus(ctx context.Context, id string, change domain.StatusChange, version int64) error
+	// BeginEdit locks a pending order at version for the edit_order or
+	// pay_order saga sagaID; other versioned writes fail until FinishEdit,
+	// FinishPay or AbortEdit.
+	BeginEdit(ctx context.Context, id string, version int64, sagaID string) error
+	FinishEdit(ctx context.Context, id, sagaID string, items []domain.OrderItem, total domain.Money) error
+	// FinishPay moves an order locked by sagaID to change.To like
+	// UpdateStatus and unlocks it.
+	FinishPay(ctx context.Context, id, sagaID string, change domain.StatusChange) error
+	AbortEdit(ctx context.Context, id, sagaID string) error
+	ListByUser(ctx context.Context, userID string, page, pageSize int64) ([]*domain.Order, int64, error)
+	// ListStalePending returns up to limit pending orders placed before
+	// placedBefore that are not being edited, oldest first.
+	ListStalePending(ctx context.Context, placedBefore time.Time, limit int64) ([]*domain.Order, error)
 }
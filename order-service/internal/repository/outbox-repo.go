@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+)
+
+// OutboxRepo is the relay's view of the outbox. Events are written by
+// MongoOrderRepo together with the order changes they describe.
+type OutboxRepo interface {
+	EnsureIndexes() error
+	// ListDue returns up to limit pending events whose next attempt is due,
+	// oldest first.
+	ListDue(ctx context.Context, now time.Time, limit int64) ([]domain.OutboxEvent, error)
+	// HasEarlierPending tells whether an event of the order with a lower Seq
+	// is still unpublished.
+	HasEarlierPending(ctx context.Context, orderID string, seq int64) (bool, error)
+	MarkPublished(ctx context.Context, id string, at time.Time) error
+	MarkFailed(ctx context.Context, id string, attempts int, nextAttemptAt time.Time, lastError string) error
+}
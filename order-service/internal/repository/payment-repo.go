@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+)
+
+type PaymentRepo interface {
+	EnsureIndexes() error
+	Create(ctx context.Context, p *domain.Payment) error
+	GetByOrderID(ctx context.Context, orderID string) (*domain.Payment, error)
+	// Save writes the payment's status, amounts and attempts.
+	Save(ctx context.Context, p *domain.Payment) error
+}
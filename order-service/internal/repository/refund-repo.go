@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+)
+
+type RefundRepo interface {
+	EnsureIndexes() error
+	// Create fails with ErrRefundConflict when the order already has a
+	// refund with the same Seq.
+	Create(ctx context.Context, r *domain.Refund) error
+	Save(ctx context.Context, r *domain.Refund) error
+	ListByOrder(ctx context.Context, orderID string) ([]domain.Refund, error)
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+)
+
+type SagaRepo interface {
+	Create(ctx context.Context, saga *domain.Saga) error
+	Save(ctx context.Context, saga *domain.Saga) error
+	ListUnfinished(ctx context.Context, notUpdatedSince time.Time) ([]*domain.Saga, error)
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bound every database call of the Mongo repos. They only ever
+// shorten the deadline of the caller's context, never extend it.
+type Timeouts struct {
+	// Query bounds single-document reads and writes.
+	Query time.Duration
+	// Batch bounds transactions, listings and index builds.
+	Batch time.Duration
+}
+
+func (t Timeouts) query(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, t.Query)
+}
+
+func (t Timeouts) batch(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, t.Batch)
+}
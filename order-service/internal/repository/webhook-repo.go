@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+)
+
+type WebhookRepo interface {
+	EnsureIndexes() error
+	CreateSubscription(ctx context.Context, s *domain.WebhookSubscription) error
+	GetSubscription(ctx context.Context, id string) (*domain.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error)
+	// DeleteSubscription drops the subscription and its queued deliveries.
+	DeleteSubscription(ctx context.Context, id string) error
+	// SubscriptionsFor returns the subscriptions that want eventType.
+	SubscriptionsFor(ctx context.Context, eventType string) ([]domain.WebhookSubscription, error)
+
+	// Enqueue queues deliveries, skipping any already queued for the same
+	// subscription and event.
+	Enqueue(ctx context.Context, deliveries []domain.WebhookDelivery) error
+	// ClaimDue takes the longest due pending delivery and hides it from
+	// other claims until lease runs out. It returns nil when none is due.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*domain.WebhookDelivery, error)
+	// SaveAttempt stores the outcome of an attempt on d: its status,
+	// attempts, next attempt and last error and status code.
+	SaveAttempt(ctx context.Context, d *domain.WebhookDelivery) error
+	// DeadLetter moves d out of the queue into the dead letters.
+	DeadLetter(ctx context.Context, d *domain.WebhookDelivery) error
+	ListDeadLetters(ctx context.Context, subscriptionID string, limit int64) ([]domain.WebhookDelivery, error)
+	// Redeliver moves a dead letter back into the queue, due now and with a
+	// fresh set of attempts.
+	Redeliver(ctx context.Context, id string) (*domain.WebhookDelivery, error)
+}
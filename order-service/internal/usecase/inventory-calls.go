@@ -0,0 +1,136 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/inventory"
+	"github.com/Nurda-zh/a1/pkg/money"
+)
+
+// errHoldClosed means inventory refused to commit, release or return a hold
+// because it is in a different state.
+var errHoldClosed = errors.New("inventory reservation is no longer held")
+
+// fetchPrices returns the current catalog price for every id, keyed by
+// product id. Ids inventory does not know are returned in missing.
+func (u *orderUsecase) fetchPrices(ctx context.Context, ids []string) (map[string]domain.Money, []string, error) {
+	products, missing, err := u.inventory.BatchGetProducts(ctx, ids)
+	if err != nil {
+		return nil, nil, inventoryErr(err)
+	}
+	prices := make(map[string]domain.Money, len(products))
+	for _, p := range products {
+		currency := p.Currency
+		if currency == "" {
+			currency = domain.DefaultCurrency
+		}
+		price, err := money.Parse(p.Price.String(), currency)
+		if err != nil {
+			return nil, nil, fmt.Errorf("inventory price for %s: %w", p.ID, err)
+		}
+		prices[p.ID] = price
+	}
+	return prices, missing, nil
+}
+
+// createHold places a reservation in inventory for the order's items and
+// returns its id. The order id is passed as the reservation reference.
+func (u *orderUsecase) createHold(ctx context.Context, orderID string, items []inventory.Item) (string, error) {
+	id, err := u.inventory.CreateReservation(ctx, orderID, items)
+	return id, inventoryErr(err)
+}
+
+// amendHold moves a held reservation to items. Inventory swaps the whole hold
+// in one transaction, so on failure it is left as it was.
+func (u *orderUsecase) amendHold(ctx context.Context, reservationID string, items []inventory.Item) error {
+	return inventoryErr(u.inventory.AmendReservation(ctx, reservationID, items))
+}
+
+func reserveItems(items []domain.OrderItem) []inventory.Item {
+	out := make([]inventory.Item, 0, len(items))
+	for _, it := range items {
+		out = append(out, inventory.Item{ProductID: it.ProductID, Quantity: it.Quantity})
+	}
+	return out
+}
+
+func (u *orderUsecase) commitHold(ctx context.Context, reservationID string) error {
+	return inventoryErr(u.inventory.CommitReservation(ctx, reservationID))
+}
+
+// releaseHold is safe to repeat: releasing an already released, expired or
+// unknown hold succeeds.
+func (u *orderUsecase) releaseHold(ctx context.Context, reservationID string) error {
+	err := u.inventory.ReleaseReservation(ctx, reservationID)
+	if errors.Is(err, inventory.ErrNotFound) {
+		return nil
+	}
+	return inventoryErr(err)
+}
+
+// releaseHoldsOf releases every hold still placed under reference, for when
+// the answer to a create was lost and its id is unknown.
+func (u *orderUsecase) releaseHoldsOf(ctx context.Context, reference string) error {
+	holds, err := u.inventory.ReservationsByReference(ctx, reference)
+	if err != nil {
+		return inventoryErr(err)
+	}
+	for _, h := range holds {
+		if h.Status != inventory.ReservationHeld {
+			continue
+		}
+		if err := u.releaseHold(ctx, h.ID); err != nil && err != errHoldClosed {
+			return err
+		}
+	}
+	return nil
+}
+
+// holdMayExist tells whether a failed createHold may still have placed the
+// hold: inventory refusing it is an answer, a timeout or a 5xx is not.
+func holdMayExist(err error) bool {
+	var se *inventory.StatusError
+	switch {
+	case errors.Is(err, ErrStockInsufficient), errors.Is(err, inventory.ErrUnauthorized):
+		return false
+	case errors.As(err, &se) && se.StatusCode < 500:
+		return false
+	}
+	return true
+}
+
+// returnHold puts the stock of a committed hold back on hand. Returning an
+// already returned hold succeeds.
+func (u *orderUsecase) returnHold(ctx context.Context, reservationID string) error {
+	return inventoryErr(u.inventory.ReturnReservation(ctx, reservationID))
+}
+
+// returnStock puts items of a committed hold back on hand. Inventory applies
+// a reference once, so a retry does not return the items twice.
+func (u *orderUsecase) returnStock(ctx context.Context, reservationID, reference string, items []inventory.Item) error {
+	return inventoryErr(u.inventory.ReturnStock(ctx, reservationID, reference, items))
+}
+
+// inventoryErr maps inventory client errors onto the usecase's own. Transient
+// failures become ErrInventoryUnavailable and keep the cause in the message,
+// as do refused credentials: they are this service's fault, not the caller's.
+func inventoryErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, inventory.ErrUnauthorized):
+		log.Printf("ERROR: inventory rejects this service's token, every call to it fails until that is fixed: %v", err)
+		return fmt.Errorf("%w: %w", ErrInventoryUnavailable, err)
+	case errors.Is(err, inventory.ErrInsufficientStock):
+		return ErrStockInsufficient
+	case errors.Is(err, inventory.ErrReservationClosed):
+		return errHoldClosed
+	case inventory.IsTransient(err):
+		return fmt.Errorf("%w: %v", ErrInventoryUnavailable, err)
+	}
+	return err
+}
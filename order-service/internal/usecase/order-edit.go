@@ -0,0 +1,215 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/repository"
+)
+
+var ErrOrderNotEditable = errors.New("only pending orders can be edited")
+
+// UpdateItems replaces the items of a pending order, priced at current
+// catalog prices like on creation, and moves its stock hold and payment
+// authorization along, see editOrderSaga. It only succeeds while the order is
+// still at version, see domain.AnyVersion to skip the check.
+func (u *orderUsecase) UpdateItems(ctx context.Context, id string, items []domain.OrderItem, version int64) (*domain.Order, error) {
+	o, err := u.GetOrder(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if version != domain.AnyVersion && o.Version != version {
+		return nil, ErrVersionConflict
+	}
+	if o.Status != domain.StatusPending {
+		return nil, ErrOrderNotEditable
+	}
+	quote, mismatches, err := u.priceItems(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	if len(mismatches) > 0 {
+		return nil, &PriceChangedError{Mismatches: mismatches, Quote: quote}
+	}
+	if sameItems(o.Items, quote.Items) {
+		return o, nil
+	}
+	if err := u.editOrderSaga(ctx, o, quote); err != nil {
+		return nil, err
+	}
+	return u.GetOrder(ctx, id, false)
+}
+
+// editOrderSaga locks the order against other writes, authorizes the new
+// total, moves the hold to the new items and then writes them, which also
+// unlocks the order. Last the old authorization is voided. A failure before
+// the write undoes the earlier steps; after it the rest is retried forward.
+//
+// Steps: started [-> payment_authorized] -> stock_amended -> order_updated ->
+// payment_released.
+func (u *orderUsecase) editOrderSaga(ctx context.Context, o *domain.Order, quote *domain.Quote) error {
+	s := &domain.Saga{
+		Type:          domain.SagaEditOrder,
+		OrderID:       o.ID,
+		Step:          domain.StepStarted,
+		Status:        domain.SagaRunning,
+		ReservationID: o.ReservationID,
+		OrderVersion:  o.Version,
+		Edit: &domain.OrderEdit{
+			OldItems: o.Items,
+			NewItems: quote.Items,
+			NewTotal: quote.Total,
+		},
+	}
+	if err := u.sagas.Create(ctx, s); err != nil {
+		return err
+	}
+	if err := u.repo.BeginEdit(ctx, o.ID, o.Version, s.ID); err != nil {
+		s.Status = domain.SagaCompensated
+		s.Error = err.Error()
+		u.saveSaga(ctx, s)
+		return mapOrderErr(err)
+	}
+
+	ref, err := u.reauthorizePayment(ctx, o.ID, quote.Total)
+	if err != nil {
+		return u.compensateEditOrder(ctx, s, err, false)
+	}
+	if ref != "" {
+		s.Edit.PaymentRef = ref
+		s.Step = domain.StepPaymentAuthorized
+		if err := u.sagas.Save(ctx, s); err != nil {
+			return u.compensateEditOrder(ctx, s, err, false)
+		}
+	}
+
+	if s.ReservationID != "" {
+		if err := u.amendHold(ctx, s.ReservationID, reserveItems(quote.Items)); err != nil {
+			switch err {
+			case ErrStockInsufficient:
+				return u.compensateEditOrder(ctx, s, err, false)
+			case errHoldClosed:
+				return u.compensateEditOrder(ctx, s, ErrHoldLost, false)
+			}
+			// the hold may or may not have moved
+			return u.compensateEditOrder(ctx, s, err, true)
+		}
+	}
+	s.Step = domain.StepStockAmended
+	if err := u.sagas.Save(ctx, s); err != nil {
+		return u.compensateEditOrder(ctx, s, err, true)
+	}
+
+	if err := u.repo.FinishEdit(ctx, o.ID, s.ID, quote.Items, quote.Total); err != nil {
+		// only the answer may have been lost; edited items are kept
+		cur, gerr := u.repo.GetByID(context.WithoutCancel(ctx), o.ID)
+		switch {
+		case gerr == nil && sameItems(cur.Items, quote.Items):
+		case gerr == nil || gerr == repository.ErrOrderNotFound:
+			return u.compensateEditOrder(ctx, s, mapOrderErr(err), true)
+		default:
+			// leave the saga running for RecoverSagas to finish or undo
+			// once it can tell
+			s.Error = err.Error()
+			u.saveSaga(ctx, s)
+			return mapOrderErr(err)
+		}
+	}
+	s.Step = domain.StepOrderUpdated
+	u.saveSaga(ctx, s)
+	u.finishEditOrder(ctx, s)
+	return nil
+}
+
+// finishEditOrder voids the authorization the edit replaced. The order itself
+// is already updated, so this runs even if the caller went away; a failure
+// leaves the saga running for RecoverSagas.
+func (u *orderUsecase) finishEditOrder(ctx context.Context, s *domain.Saga) {
+	ctx = context.WithoutCancel(ctx)
+	if s.Edit.PaymentRef != "" {
+		if err := u.swapAuthorization(ctx, s.OrderID, s.Edit.PaymentRef, s.Edit.NewTotal); err != nil {
+			log.Printf("saga %s: swap authorization: %v", s.ID, err)
+			s.Error = err.Error()
+			u.saveSaga(ctx, s)
+			return
+		}
+	}
+	s.Step = domain.StepPaymentReleased
+	s.Status = domain.SagaCompleted
+	u.saveSaga(ctx, s)
+}
+
+// compensateEditOrder puts the hold back on the old items when it may have
+// moved, voids the new authorization, unlocks the order and returns cause. If
+// any of it fails the saga stays compensating and is retried by
+// RecoverSagas.
+func (u *orderUsecase) compensateEditOrder(ctx context.Context, s *domain.Saga, cause error, restoreHold bool) error {
+	// undoing must not stop because the caller went away
+	ctx = context.WithoutCancel(ctx)
+	s.Status = domain.SagaCompensating
+	if s.Error == "" {
+		s.Error = cause.Error()
+	}
+	u.saveSaga(ctx, s)
+	if restoreHold && s.ReservationID != "" {
+		err := u.amendHold(ctx, s.ReservationID, reserveItems(s.Edit.OldItems))
+		switch err {
+		case nil:
+		case ErrStockInsufficient, errHoldClosed:
+			// nothing better to restore to: the order keeps its old items
+			// and paying it finds out whether the hold still covers them
+			log.Printf("saga %s: restore reservation %s: %v", s.ID, s.ReservationID, err)
+		default:
+			log.Printf("saga %s: restore reservation %s: %v", s.ID, s.ReservationID, err)
+			return cause
+		}
+	}
+	if s.Edit.PaymentRef != "" {
+		if err := u.voidAuthorization(ctx, s.OrderID, s.Edit.PaymentRef, s.Edit.NewTotal); err != nil {
+			log.Printf("saga %s: void new authorization: %v", s.ID, err)
+			return cause
+		}
+	}
+	if err := u.repo.AbortEdit(ctx, s.OrderID, s.ID); err != nil {
+		log.Printf("saga %s: unlock order: %v", s.ID, err)
+		return cause
+	}
+	s.Status = domain.SagaCompensated
+	u.saveSaga(ctx, s)
+	return cause
+}
+
+// recoverEditOrder finishes an edit_order saga whose items made it to the
+// order and compensates any other.
+func (u *orderUsecase) recoverEditOrder(ctx context.Context, s *domain.Saga) {
+	if s.Status == domain.SagaRunning && s.Step != domain.StepOrderUpdated {
+		o, err := u.repo.GetByID(ctx, s.OrderID)
+		if err != nil {
+			log.Printf("saga %s: recover: %v", s.ID, err)
+			return
+		}
+		if sameItems(o.Items, s.Edit.NewItems) {
+			s.Step = domain.StepOrderUpdated
+			u.saveSaga(ctx, s)
+		}
+	}
+	if s.Status == domain.SagaRunning && s.Step == domain.StepOrderUpdated {
+		u.finishEditOrder(ctx, s)
+		return
+	}
+	_ = u.compensateEditOrder(ctx, s, errSagaInterrupted, true)
+}
+
+func sameItems(a, b []domain.OrderItem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
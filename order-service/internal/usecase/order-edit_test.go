@@ -0,0 +1,218 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/inventory"
+)
+
+// edit moves the first order to qty of p1.
+func (f *sagaFixture) edit(qty int) error {
+	_, err := f.uc.UpdateItems(context.Background(), firstOrder, []domain.OrderItem{{ProductID: "p1", Quantity: qty}}, domain.AnyVersion)
+	return err
+}
+
+func TestEditOrderSaga(t *testing.T) {
+	tests := []struct {
+		name    string
+		qty     int
+		inject  func(t *testing.T, f *sagaFixture)
+		wantErr error
+		status  domain.SagaStatus
+		// the order's quantity, the stock left and the total the payment
+		// authorizes once the request returned
+		items, available int
+		authorized       int64
+		// newVoided is whether an authorization for the new total was
+		// placed and voided again
+		newVoided bool
+		// holdLost orders cannot be paid any more
+		holdLost bool
+	}{
+		{
+			name:       "all steps go through",
+			qty:        3,
+			status:     domain.SagaCompleted,
+			items:      3,
+			available:  2,
+			authorized: 3000,
+		},
+		{
+			name:       "not enough stock for the new items",
+			qty:        6,
+			wantErr:    ErrStockInsufficient,
+			status:     domain.SagaCompensated,
+			items:      2,
+			available:  3,
+			authorized: 2000,
+			newVoided:  true,
+		},
+		{
+			name: "hold lost",
+			qty:  3,
+			inject: func(t *testing.T, f *sagaFixture) {
+				holds, err := f.inv.ReservationsByReference(context.Background(), firstOrder)
+				if err != nil || len(holds) != 1 {
+					t.Fatalf("holds = %v, %v", holds, err)
+				}
+				if err := f.inv.ReleaseReservation(context.Background(), holds[0].ID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:    ErrHoldLost,
+			status:     domain.SagaCompensated,
+			items:      2,
+			available:  5,
+			authorized: 2000,
+			newVoided:  true,
+			holdLost:   true,
+		},
+		{
+			name: "reauthorization fails",
+			qty:  3,
+			inject: func(t *testing.T, f *sagaFixture) {
+				f.provider.faults.failNext("Authorize", errors.New("provider down"))
+			},
+			wantErr:    ErrPaymentFailed,
+			status:     domain.SagaCompensated,
+			items:      2,
+			available:  3,
+			authorized: 2000,
+		},
+		{
+			name: "items write fails after the hold moved",
+			qty:  3,
+			inject: func(t *testing.T, f *sagaFixture) {
+				f.orders.faults.failNext("FinishEdit", errDB)
+			},
+			wantErr:    errDB,
+			status:     domain.SagaCompensated,
+			items:      2,
+			available:  3,
+			authorized: 2000,
+			newVoided:  true,
+		},
+		{
+			name: "items written but the answer lost",
+			qty:  3,
+			inject: func(t *testing.T, f *sagaFixture) {
+				f.orders.faults.loseNext("FinishEdit", errDB)
+			},
+			status:     domain.SagaCompleted,
+			items:      3,
+			available:  2,
+			authorized: 3000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture()
+			ctx := context.Background()
+			if _, err := f.place("card"); err != nil {
+				t.Fatalf("place: %v", err)
+			}
+			before, err := f.payments.GetByOrderID(ctx, firstOrder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.inject != nil {
+				tt.inject(t, f)
+			}
+			if err := f.edit(tt.qty); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			s, _ := f.sagas.byOrder(firstOrder, domain.SagaEditOrder)
+			if s.Status != tt.status {
+				t.Errorf("saga is %s at %s, want %s", s.Status, s.Step, tt.status)
+			}
+			if by := f.orders.lockedBy(firstOrder); by != "" {
+				t.Errorf("order still locked by %s", by)
+			}
+			o, err := f.orders.GetByID(ctx, firstOrder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.Items[0].Quantity != tt.items || o.Total.Amount != int64(tt.items)*1000 {
+				t.Errorf("order has %d items for %d, want %d", o.Items[0].Quantity, o.Total.Amount, tt.items)
+			}
+			if got := f.inv.Available("p1"); got != tt.available {
+				t.Errorf("available = %d, want %d", got, tt.available)
+			}
+			p, err := f.payments.GetByOrderID(ctx, firstOrder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Amount.Amount != tt.authorized || p.Status != domain.PaymentAuthorized {
+				t.Errorf("payment is %s for %d, want authorized for %d", p.Status, p.Amount.Amount, tt.authorized)
+			}
+			if kept := p.ProviderRef == before.ProviderRef; kept != (tt.authorized == before.Amount.Amount) {
+				t.Errorf("authorization %s, was %s", p.ProviderRef, before.ProviderRef)
+			}
+			voided := false
+			for _, a := range p.Attempts {
+				if a.Operation == domain.OpVoid && a.Amount.Amount == int64(tt.qty)*1000 && a.Succeeded {
+					voided = true
+				}
+			}
+			if voided != tt.newVoided {
+				t.Errorf("new authorization voided = %v, want %v", voided, tt.newVoided)
+			}
+
+			// the authorization left is the one paying captures
+			err = f.uc.UpdateStatus(ctx, firstOrder, domain.StatusChange{To: domain.StatusPaid}, domain.AnyVersion)
+			if tt.holdLost {
+				if !errors.Is(err, ErrHoldLost) {
+					t.Errorf("pay: err = %v, want ErrHoldLost", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pay: %v", err)
+			}
+			if p, _ := f.payments.GetByOrderID(ctx, firstOrder); p.Captured.Amount != tt.authorized {
+				t.Errorf("captured %d, want %d", p.Captured.Amount, tt.authorized)
+			}
+		})
+	}
+}
+
+func TestEditOrderSagaLeavesUnknownWriteToRecovery(t *testing.T) {
+	f := newSagaFixture()
+	ctx := context.Background()
+	if _, err := f.place("card"); err != nil {
+		t.Fatalf("place: %v", err)
+	}
+	f.orders.faults.failNext("FinishEdit", errDB)
+	f.orders.faults.skip("GetByID") // UpdateItems reads the order first
+	f.orders.faults.failNext("GetByID", errDB)
+	if err := f.edit(3); !errors.Is(err, errDB) {
+		t.Fatalf("err = %v, want errDB", err)
+	}
+	s, _ := f.sagas.byOrder(firstOrder, domain.SagaEditOrder)
+	if s.Status != domain.SagaRunning || s.Step != domain.StepStockAmended {
+		t.Errorf("saga is %s at %s, want running at stock_amended", s.Status, s.Step)
+	}
+	if f.orders.lockedBy(firstOrder) == "" {
+		t.Error("order unlocked before it is known whether the items were written")
+	}
+
+	f.recover(t)
+	s, _ = f.sagas.byOrder(firstOrder, domain.SagaEditOrder)
+	if s.Status != domain.SagaCompensated {
+		t.Errorf("saga is %s after recovery, want compensated", s.Status)
+	}
+	if by := f.orders.lockedBy(firstOrder); by != "" {
+		t.Errorf("order still locked by %s after recovery", by)
+	}
+	if got := f.inv.Available("p1"); got != 3 {
+		t.Errorf("available = %d, want the old hold back", got)
+	}
+	holds, _ := f.inv.ReservationsByReference(ctx, firstOrder)
+	if len(holds) != 1 || holds[0].Status != inventory.ReservationHeld {
+		t.Errorf("holds = %+v", holds)
+	}
+}
@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+)
+
+// staleBatchSize caps how many orders one CancelStaleOrders call cancels.
+const staleBatchSize = 100
+
+// CancelStaleOrders cancels orders that have been pending for longer than
+// maxAge through the normal cancel path, so their stock and authorization
+// are given back and the reason is kept in their history. It returns how many
+// it cancelled. An order touched since it was listed is left for the next
+// run.
+func (u *orderUsecase) CancelStaleOrders(ctx context.Context, maxAge time.Duration) (int, error) {
+	orders, err := u.repo.ListStalePending(ctx, time.Now().UTC().Add(-maxAge), staleBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	cancelled := 0
+	for _, o := range orders {
+		change := domain.StatusChange{
+			To:     domain.StatusCancelled,
+			Actor:  domain.SystemActor,
+			Reason: fmt.Sprintf("pending for longer than %s", maxAge),
+		}
+		if err := u.UpdateStatus(ctx, o.ID, change, o.Version); err != nil {
+			if err != ErrVersionConflict && err != ErrOrderNotFound {
+				log.Printf("order %s: auto-cancel: %v", o.ID, err)
+			}
+			continue
+		}
+		cancelled++
+	}
+	return cancelled, nil
+}
@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/inventory"
+)
+
+func TestCancelStaleOrders(t *testing.T) {
+	f := newSagaFixture()
+	for i := 0; i < 2; i++ {
+		if _, err := f.place("card"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.orders.backdate(firstOrder, 2*time.Hour)
+
+	n, err := f.uc.CancelStaleOrders(context.Background(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("cancelled %d, want 1", n)
+	}
+	if got := f.orders.status("order_2"); got != domain.StatusPending {
+		t.Errorf("fresh order is %q, want it left pending", got)
+	}
+	// the stale one went through the cancel saga: stock and money are back
+	f.check(t, domain.SagaCancelOrder, sagaEnd{domain.SagaCompleted, domain.StepPaymentReleased, domain.StatusCancelled, inventory.ReservationReleased, domain.PaymentVoided, 3})
+
+	history, err := f.uc.GetOrderHistory(as("u1", false), firstOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := history[len(history)-1]
+	want := domain.StatusChange{From: domain.StatusPending, To: domain.StatusCancelled, Actor: domain.SystemActor, Reason: "pending for longer than 1h0m0s"}
+	if last.At = want.At; last != want {
+		t.Errorf("last entry = %+v, want %+v", last, want)
+	}
+
+	// a second run finds nothing left to do
+	if n, err := f.uc.CancelStaleOrders(context.Background(), time.Hour); err != nil || n != 0 {
+		t.Errorf("second run cancelled %d (err %v), want 0", n, err)
+	}
+}
+
+func TestCancelStaleOrdersSkipsOrdersInUse(t *testing.T) {
+	f := newSagaFixture()
+	if _, err := f.place("card"); err != nil {
+		t.Fatal(err)
+	}
+	f.orders.backdate(firstOrder, 2*time.Hour)
+	o, err := f.orders.GetByID(context.Background(), firstOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.orders.BeginEdit(context.Background(), firstOrder, o.Version, "edit_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := f.uc.CancelStaleOrders(context.Background(), time.Hour)
+	if err != nil || n != 0 {
+		t.Fatalf("cancelled %d (err %v), want an order being edited left alone", n, err)
+	}
+	if got := f.orders.status(firstOrder); got != domain.StatusPending {
+		t.Errorf("order is %q, want pending", got)
+	}
+	if got := f.orders.lockedBy(firstOrder); got != "edit_1" {
+		t.Errorf("order is locked by %q, want the edit to keep it", got)
+	}
+}
+
+// payingOrders pays every order it lists as stale, as a customer paying
+// between the listing and the cancel would.
+type payingOrders struct {
+	*memOrderRepo
+}
+
+func (r payingOrders) ListStalePending(ctx context.Context, placedBefore time.Time, limit int64) ([]*domain.Order, error) {
+	orders, err := r.memOrderRepo.ListStalePending(ctx, placedBefore, limit)
+	for _, o := range orders {
+		change := domain.StatusChange{To: domain.StatusPaid, Actor: o.UserID}
+		if err := r.memOrderRepo.UpdateStatus(ctx, o.ID, change, o.Version); err != nil {
+			return nil, err
+		}
+	}
+	return orders, err
+}
+
+func TestCancelStaleOrdersLeavesOrdersChangedSinceListed(t *testing.T) {
+	f := newSagaFixture()
+	if _, err := f.place("card"); err != nil {
+		t.Fatal(err)
+	}
+	f.orders.backdate(firstOrder, 2*time.Hour)
+	uc := NewOrderUsecase(payingOrders{f.orders}, f.sagas, f.payments, f.refunds, f.provider, f.inv)
+
+	n, err := uc.CancelStaleOrders(context.Background(), time.Hour)
+	if err != nil || n != 0 {
+		t.Fatalf("cancelled %d (err %v), want 0", n, err)
+	}
+	if got := f.orders.status(firstOrder); got != domain.StatusPaid {
+		t.Errorf("order is %q, want the payment to win", got)
+	}
+	if _, ok := f.sagas.byOrder(firstOrder, domain.SagaCancelOrder); ok {
+		t.Error("a cancel saga was started for an order that moved on")
+	}
+}
+
+func TestCancelStaleOrdersListError(t *testing.T) {
+	f := newSagaFixture()
+	boom := errors.New("boom")
+	f.orders.faults.failNext("ListStalePending", boom)
+	if _, err := f.uc.CancelStaleOrders(context.Background(), time.Hour); !errors.Is(err, boom) {
+		t.Errorf("err = %v, want %v", err, boom)
+	}
+}
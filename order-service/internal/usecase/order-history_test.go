@@ -0,0 +1,118 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/pkg/auth"
+)
+
+func as(subject string, admin bool) context.Context {
+	return auth.WithPrincipal(context.Background(), &auth.Principal{Subject: subject, Admin: admin})
+}
+
+func TestStatusHistory(t *testing.T) {
+	f := newSagaFixture()
+	if _, err := f.place("card"); err != nil {
+		t.Fatal(err)
+	}
+	admin := as("a1", true)
+	move := func(ctx context.Context, change domain.StatusChange) error {
+		return f.uc.UpdateStatus(ctx, firstOrder, change, domain.AnyVersion)
+	}
+	if err := move(admin, domain.StatusChange{To: domain.StatusPaid, Actor: "a1"}); err != nil {
+		t.Fatal(err)
+	}
+	// repeats and refused moves leave no entry
+	if err := move(admin, domain.StatusChange{To: domain.StatusPaid, Actor: "a1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := move(admin, domain.StatusChange{To: domain.StatusPending, Actor: "a1"}); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("err = %v, want ErrIllegalTransition", err)
+	}
+	if err := move(as("u1", false), domain.StatusChange{To: domain.StatusShipped, Actor: "u1"}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("err = %v, want ErrForbidden", err)
+	}
+	// without an actor the change is the system's
+	if err := move(context.Background(), domain.StatusChange{To: domain.StatusProcessing}); err != nil {
+		t.Fatal(err)
+	}
+	if err := move(admin, domain.StatusChange{To: domain.StatusShipped, Actor: "a1", Reason: "picked up"}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := f.uc.GetOrderHistory(as("u1", false), firstOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []domain.StatusChange{
+		{To: domain.StatusPending, Actor: "u1"},
+		{From: domain.StatusPending, To: domain.StatusPaid, Actor: "a1"},
+		{From: domain.StatusPaid, To: domain.StatusProcessing, Actor: domain.SystemActor},
+		{From: domain.StatusProcessing, To: domain.StatusShipped, Actor: "a1", Reason: "picked up"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history = %+v, want %d entries", history, len(want))
+	}
+	for i, h := range history {
+		at := h.At
+		h.At = want[i].At
+		if h != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, h, want[i])
+		}
+		if at.IsZero() || (i > 0 && at.Before(history[i-1].At)) {
+			t.Errorf("entry %d at %v, want a time not before the one before it", i, at)
+		}
+	}
+}
+
+func TestCancelIsKeptInHistory(t *testing.T) {
+	f := newSagaFixture()
+	if _, err := f.place("card"); err != nil {
+		t.Fatal(err)
+	}
+	owner := as("u1", false)
+	change := domain.StatusChange{To: domain.StatusCancelled, Actor: "u1", Reason: "changed my mind"}
+	if err := f.uc.UpdateStatus(owner, firstOrder, change, domain.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	history, err := f.uc.GetOrderHistory(owner, firstOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := history[len(history)-1]
+	if len(history) != 2 || last.From != domain.StatusPending || last.To != domain.StatusCancelled || last.Actor != "u1" || last.Reason != "changed my mind" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestHistoryIsOnlyReturnedWhenAsked(t *testing.T) {
+	f := newSagaFixture()
+	if _, err := f.place(""); err != nil {
+		t.Fatal(err)
+	}
+	ctx := as("u1", false)
+	if o, err := f.uc.GetOrder(ctx, firstOrder, false); err != nil || o.History != nil {
+		t.Errorf("GetOrder without history: %v, history %+v", err, o.History)
+	}
+	if o, err := f.uc.GetOrder(ctx, firstOrder, true); err != nil || len(o.History) != 1 {
+		t.Errorf("GetOrder with history: %v, history %+v", err, o.History)
+	}
+	if _, err := f.uc.GetOrderHistory(as("u2", false), firstOrder); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("another user's history: err = %v, want ErrOrderNotFound", err)
+	}
+	if _, err := f.uc.GetOrderHistory(ctx, "order_9"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("unknown order: err = %v, want ErrOrderNotFound", err)
+	}
+
+	// orders from before history was kept have an empty one
+	o := f.orders.orders[firstOrder]
+	o.History = nil
+	f.orders.orders[firstOrder] = o
+	history, err := f.uc.GetOrderHistory(ctx, firstOrder)
+	if err != nil || history == nil || len(history) != 0 {
+		t.Errorf("history = %#v, %v, want an empty list", history, err)
+	}
+}
@@ -0,0 +1,263 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/payment"
+	"github.com/Nurda-zh/a1/order-service/internal/repository"
+)
+
+var (
+	ErrPaymentNotFound = errors.New("payment not found")
+	ErrPaymentDeclined = errors.New("payment declined")
+	ErrPaymentMethod   = errors.New("unsupported payment method")
+	// ErrPaymentFailed means the provider could not be reached or refused
+	// the operation for a reason other than the customer's method.
+	ErrPaymentFailed = errors.New("payment failed")
+)
+
+func (u *orderUsecase) GetPayment(ctx context.Context, orderID string) (*domain.Payment, error) {
+	if _, err := u.GetOrder(ctx, orderID, false); err != nil {
+		return nil, err
+	}
+	p, err := u.payments.GetByOrderID(ctx, orderID)
+	if err == repository.ErrPaymentNotFound {
+		return nil, ErrPaymentNotFound
+	}
+	return p, err
+}
+
+// authorizePayment records a payment for o and authorizes the order total
+// with the provider. A failed authorization is kept with its attempt.
+func (u *orderUsecase) authorizePayment(ctx context.Context, o *domain.Order) error {
+	zero := domain.Money{Currency: o.Total.Currency}
+	p := &domain.Payment{
+		OrderID:  o.ID,
+		Provider: u.provider.Name(),
+		Method:   o.PaymentMethod,
+		Status:   domain.PaymentPending,
+		Amount:   o.Total,
+		Captured: zero,
+		Refunded: zero,
+		Attempts: []domain.PaymentAttempt{},
+	}
+	if err := u.payments.Create(ctx, p); err != nil {
+		return err
+	}
+	err := u.callProvider(p, domain.OpAuthorize, o.Total, func() (err error) {
+		p.ProviderRef, err = u.provider.Authorize(ctx, o.ID, o.PaymentMethod, o.Total)
+		return err
+	})
+	p.Status = domain.PaymentAuthorized
+	if err != nil {
+		p.Status = domain.PaymentFailed
+	}
+	if serr := u.payments.Save(ctx, p); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// capturePayment captures the order's authorization in full. Orders placed
+// without a payment method have nothing to capture and a captured payment,
+// refunded in part or not, is left alone, so the call can be repeated.
+func (u *orderUsecase) capturePayment(ctx context.Context, orderID string) error {
+	p, err := u.payments.GetByOrderID(ctx, orderID)
+	if err == repository.ErrPaymentNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch p.Status {
+	case domain.PaymentCaptured, domain.PaymentPartiallyRefunded, domain.PaymentRefunded:
+		return nil
+	case domain.PaymentAuthorized:
+	default:
+		return fmt.Errorf("%w: payment is %s", ErrPaymentFailed, p.Status)
+	}
+	err = u.callProvider(p, domain.OpCapture, p.Amount, func() error {
+		return u.provider.Capture(ctx, p.ProviderRef, p.Amount)
+	})
+	if err == nil {
+		p.Status = domain.PaymentCaptured
+		p.Captured = p.Amount
+	}
+	if serr := u.payments.Save(ctx, p); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// refundPayment refunds amount of the order's captured payment. Orders paid
+// outside the service have no payment to refund.
+func (u *orderUsecase) refundPayment(ctx context.Context, orderID string, amount domain.Money) error {
+	if amount.Amount == 0 {
+		return nil
+	}
+	p, err := u.payments.GetByOrderID(ctx, orderID)
+	if err == repository.ErrPaymentNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return u.refundCaptured(ctx, p, amount)
+}
+
+func (u *orderUsecase) refundCaptured(ctx context.Context, p *domain.Payment, amount domain.Money) error {
+	if p.Status != domain.PaymentCaptured && p.Status != domain.PaymentPartiallyRefunded {
+		return fmt.Errorf("%w: payment is %s", ErrPaymentFailed, p.Status)
+	}
+	if amount.Amount > p.Captured.Amount-p.Refunded.Amount {
+		return ErrRefundExceedsCapture
+	}
+	err := u.callProvider(p, domain.OpRefund, amount, func() error {
+		return u.provider.Refund(ctx, p.ProviderRef, amount)
+	})
+	if err == nil {
+		p.Refunded.Amount += amount.Amount
+		p.Status = domain.PaymentPartiallyRefunded
+		if p.Refunded.Amount == p.Captured.Amount {
+			p.Status = domain.PaymentRefunded
+		}
+	}
+	if serr := u.payments.Save(ctx, p); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// releasePayment gives the order's money back: an authorization is voided and
+// whatever was captured and not yet refunded is refunded. Like capture it is
+// safe to repeat.
+func (u *orderUsecase) releasePayment(ctx context.Context, orderID string) error {
+	p, err := u.payments.GetByOrderID(ctx, orderID)
+	if err == repository.ErrPaymentNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch p.Status {
+	case domain.PaymentAuthorized:
+		err = u.callProvider(p, domain.OpVoid, p.Amount, func() error {
+			return u.provider.Void(ctx, p.ProviderRef)
+		})
+		if err == nil {
+			p.Status = domain.PaymentVoided
+		}
+	case domain.PaymentCaptured, domain.PaymentPartiallyRefunded:
+		left := domain.Money{Amount: p.Captured.Amount - p.Refunded.Amount, Currency: p.Captured.Currency}
+		return u.refundCaptured(ctx, p, left)
+	default:
+		return nil
+	}
+	if serr := u.payments.Save(ctx, p); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// callProvider runs call, records it as an attempt on p and maps provider
+// errors to usecase errors.
+func (u *orderUsecase) callProvider(p *domain.Payment, op domain.PaymentOperation, amount domain.Money, call func() error) error {
+	err := call()
+	attempt := domain.PaymentAttempt{Operation: op, Amount: amount, Succeeded: err == nil, At: time.Now().UTC()}
+	if err != nil {
+		attempt.Error = err.Error()
+		log.Printf("payment %s: %s for order %s: %v", p.ID, op, p.OrderID, err)
+	}
+	p.Attempts = append(p.Attempts, attempt)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, payment.ErrDeclined):
+		return ErrPaymentDeclined
+	case errors.Is(err, payment.ErrUnsupportedMethod):
+		return fmt.Errorf("%w: %s", ErrPaymentMethod, p.Method)
+	default:
+		return fmt.Errorf("%w: %v", ErrPaymentFailed, err)
+	}
+}
+
+// reauthorizePayment authorizes amount for an order whose total changes,
+// next to its current authorization, and returns the new reference. Orders
+// without an authorized payment, or whose total stays the same, need nothing
+// and get "".
+func (u *orderUsecase) reauthorizePayment(ctx context.Context, orderID string, amount domain.Money) (string, error) {
+	p, err := u.payments.GetByOrderID(ctx, orderID)
+	if err == repository.ErrPaymentNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if p.Status != domain.PaymentAuthorized || p.Amount == amount {
+		return "", nil
+	}
+	var ref string
+	err = u.callProvider(p, domain.OpAuthorize, amount, func() (err error) {
+		ref, err = u.provider.Authorize(ctx, orderID, p.Method, amount)
+		return err
+	})
+	if serr := u.payments.Save(ctx, p); err == nil {
+		err = serr
+	}
+	return ref, err
+}
+
+// swapAuthorization voids the order's current authorization and makes ref,
+// for amount, the one to capture. Repeating it after it went through does
+// nothing.
+func (u *orderUsecase) swapAuthorization(ctx context.Context, orderID, ref string, amount domain.Money) error {
+	p, err := u.payments.GetByOrderID(ctx, orderID)
+	if err == repository.ErrPaymentNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if p.ProviderRef == ref {
+		return nil
+	}
+	err = u.callProvider(p, domain.OpVoid, p.Amount, func() error {
+		return u.provider.Void(ctx, p.ProviderRef)
+	})
+	if err == nil {
+		p.ProviderRef = ref
+		p.Amount = amount
+	}
+	if serr := u.payments.Save(ctx, p); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// voidAuthorization voids ref, an authorization of amount placed for an edit
+// that did not go through. Once swapAuthorization made ref the order's own it
+// is left alone.
+func (u *orderUsecase) voidAuthorization(ctx context.Context, orderID, ref string, amount domain.Money) error {
+	p, err := u.payments.GetByOrderID(ctx, orderID)
+	if err == repository.ErrPaymentNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if p.ProviderRef == ref {
+		return nil
+	}
+	err = u.callProvider(p, domain.OpVoid, amount, func() error {
+		return u.provider.Void(ctx, ref)
+	})
+	if serr := u.payments.Save(ctx, p); err == nil {
+		err = serr
+	}
+	return err
+}
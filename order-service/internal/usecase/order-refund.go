@@ -0,0 +1,217 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/inventory"
+	"github.com/Nurda-zh/a1/order-service/internal/repository"
+	"github.com/Nurda-zh/a1/pkg/auth"
+)
+
+var (
+	ErrInvalidRefund        = errors.New("invalid refund")
+	ErrRefundExceedsCapture = errors.New("refund exceeds the captured amount")
+)
+
+// RefundOrder refunds items of a delivered or completed order and moves it
+// to partially_refunded, or to refunded once every item is refunded.
+func (u *orderUsecase) RefundOrder(ctx context.Context, orderID string, req *domain.RefundRequest, actor string) (*domain.Refund, error) {
+	o, err := u.GetOrder(ctx, orderID, false)
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := auth.FromContext(ctx); ok && !p.Admin {
+		return nil, fmt.Errorf("%w: only admins can refund orders", ErrForbidden)
+	}
+	if o.Status != domain.StatusPartiallyRefunded && !domain.CanTransition(o.Status, domain.StatusPartiallyRefunded) {
+		return nil, fmt.Errorf("%w: a %s order cannot be refunded", ErrIllegalTransition, o.Status)
+	}
+	return u.refund(ctx, o, req, actor)
+}
+
+func (u *orderUsecase) ListRefunds(ctx context.Context, orderID string) ([]domain.Refund, error) {
+	if _, err := u.GetOrder(ctx, orderID, false); err != nil {
+		return nil, err
+	}
+	return u.refunds.ListByOrder(ctx, orderID)
+}
+
+// refund works out what req refunds from what earlier refunds left, gives
+// the money back, restocks if asked and then moves the order on. Refunds that
+// did not fail count as done, since their money may have moved.
+func (u *orderUsecase) refund(ctx context.Context, o *domain.Order, req *domain.RefundRequest, actor string) (*domain.Refund, error) {
+	earlier, err := u.refunds.ListByOrder(ctx, o.ID)
+	if err != nil {
+		return nil, err
+	}
+	left := make(map[string]int, len(o.Items))
+	prices := make(map[string]domain.Money, len(o.Items))
+	var products []string
+	for _, it := range o.Items {
+		if _, ok := left[it.ProductID]; !ok {
+			products = append(products, it.ProductID)
+			prices[it.ProductID] = it.Price
+		}
+		left[it.ProductID] += it.Quantity
+	}
+	refunded := domain.Money{Currency: o.Total.Currency}
+	for _, r := range earlier {
+		if r.Status == domain.RefundFailed {
+			continue
+		}
+		for _, it := range r.Items {
+			left[it.ProductID] -= it.Quantity
+		}
+		refunded.Amount += r.Amount.Amount
+	}
+
+	want := make(map[string]int)
+	if len(req.Items) == 0 {
+		for _, id := range products {
+			if left[id] > 0 {
+				want[id] = left[id]
+			}
+		}
+		if len(want) == 0 {
+			return nil, fmt.Errorf("%w: nothing left to refund", ErrInvalidRefund)
+		}
+	}
+	for _, it := range req.Items {
+		if _, ok := left[it.ProductID]; !ok {
+			return nil, fmt.Errorf("%w: product %s is not part of the order", ErrInvalidRefund, it.ProductID)
+		}
+		want[it.ProductID] += it.Quantity
+	}
+
+	r := &domain.Refund{
+		OrderID: o.ID,
+		Seq:     len(earlier) + 1,
+		Amount:  domain.Money{Currency: o.Total.Currency},
+		Restock: req.Restock,
+		Reason:  req.Reason,
+		Actor:   actor,
+		Status:  domain.RefundPending,
+	}
+	everything := true
+	for _, id := range products {
+		qty := want[id]
+		if qty > left[id] {
+			return nil, fmt.Errorf("%w: %d of product %s requested, %d left to refund", ErrInvalidRefund, qty, id, left[id])
+		}
+		if qty < left[id] {
+			everything = false
+		}
+		if qty == 0 {
+			continue
+		}
+		amount := prices[id].Times(qty)
+		r.Items = append(r.Items, domain.RefundItem{ProductID: id, Quantity: qty, Amount: amount})
+		if r.Amount, err = r.Amount.Add(amount); err != nil {
+			return nil, err
+		}
+	}
+
+	refundable, err := u.refundable(ctx, o, refunded)
+	if err != nil {
+		return nil, err
+	}
+	if r.Amount.Amount > refundable.Amount {
+		return nil, fmt.Errorf("%w: %s requested, %s refundable", ErrRefundExceedsCapture, r.Amount.Decimal(), refundable.Decimal())
+	}
+
+	if err := u.refunds.Create(ctx, r); err != nil {
+		if err == repository.ErrRefundConflict {
+			return nil, ErrVersionConflict
+		}
+		return nil, err
+	}
+	if err := u.refundPayment(ctx, o.ID, r.Amount); err != nil {
+		r.Status = domain.RefundFailed
+		r.Error = err.Error()
+		u.saveRefund(ctx, r)
+		return nil, err
+	}
+	r.Status = domain.RefundSucceeded
+	// the money has moved: record it even if the caller went away
+	ctx = context.WithoutCancel(ctx)
+	if req.Restock && o.ReservationID != "" {
+		items := make([]inventory.Item, 0, len(r.Items))
+		for _, it := range r.Items {
+			items = append(items, inventory.Item{ProductID: it.ProductID, Quantity: it.Quantity})
+		}
+		if err := u.returnStock(ctx, o.ReservationID, r.ID, items); err != nil {
+			// the money is back either way; the stock can be booked by hand
+			log.Printf("refund %s: restock: %v", r.ID, err)
+			r.Error = "restock: " + err.Error()
+		}
+	}
+	u.saveRefund(ctx, r)
+
+	change := domain.StatusChange{
+		From:   o.Status,
+		To:     domain.StatusPartiallyRefunded,
+		Actor:  actor,
+		Reason: req.Reason,
+		At:     time.Now().UTC(),
+	}
+	if everything {
+		change.To = domain.StatusRefunded
+	}
+	if err := u.moveAfterRefund(ctx, o.ID, change, o.Version); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// maxRefundMoves bounds how often moveAfterRefund retries a write that lost
+// a race.
+const maxRefundMoves = 5
+
+// moveAfterRefund writes change for a refund whose money already moved. The
+// status cannot be given up, so a write that lost a race is repeated on the
+// order as it is now, unless a later refund already took it to refunded.
+func (u *orderUsecase) moveAfterRefund(ctx context.Context, id string, change domain.StatusChange, version int64) error {
+	for i := 0; ; i++ {
+		err := u.repo.UpdateStatus(ctx, id, change, version)
+		if err != repository.ErrVersionConflict || i == maxRefundMoves {
+			return mapOrderErr(err)
+		}
+		o, err := u.repo.GetByID(ctx, id)
+		if err != nil {
+			return mapOrderErr(err)
+		}
+		switch {
+		case o.Status == domain.StatusRefunded:
+			return nil
+		case o.Status == domain.StatusPartiallyRefunded, domain.CanTransition(o.Status, change.To):
+		default:
+			return fmt.Errorf("%w: %s to %s", ErrIllegalTransition, o.Status, change.To)
+		}
+		change.From, version = o.Status, o.Version
+	}
+}
+
+// refundable is what can still be refunded: what was captured and not
+// refunded, or for orders paid outside the service, the total less earlier
+// refunds.
+func (u *orderUsecase) refundable(ctx context.Context, o *domain.Order, refunded domain.Money) (domain.Money, error) {
+	p, err := u.payments.GetByOrderID(ctx, o.ID)
+	if err == repository.ErrPaymentNotFound {
+		return domain.Money{Amount: o.Total.Amount - refunded.Amount, Currency: o.Total.Currency}, nil
+	}
+	if err != nil {
+		return domain.Money{}, err
+	}
+	return domain.Money{Amount: p.Captured.Amount - p.Refunded.Amount, Currency: p.Captured.Currency}, nil
+}
+
+func (u *orderUsecase) saveRefund(ctx context.Context, r *domain.Refund) {
+	if err := u.refunds.Save(context.WithoutCancel(ctx), r); err != nil {
+		log.Printf("refund %s: save %s: %v", r.ID, r.Status, err)
+	}
+}
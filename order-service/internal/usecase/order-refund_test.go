@@ -0,0 +1,245 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/inventory"
+)
+
+// deliver places an order for 2 of p1, paid by card, and walks it to
+// delivered.
+func (f *sagaFixture) deliver(t *testing.T) {
+	t.Helper()
+	if _, err := f.place("card"); err != nil {
+		t.Fatalf("place: %v", err)
+	}
+	for _, to := range []domain.OrderStatus{domain.StatusPaid, domain.StatusProcessing, domain.StatusShipped, domain.StatusDelivered} {
+		if err := f.uc.UpdateStatus(context.Background(), firstOrder, domain.StatusChange{To: to}, domain.AnyVersion); err != nil {
+			t.Fatalf("move to %s: %v", to, err)
+		}
+	}
+}
+
+func (f *sagaFixture) refundOne(restock bool) (*domain.Refund, error) {
+	return f.uc.RefundOrder(context.Background(), firstOrder, &domain.RefundRequest{
+		Items:   []domain.RefundItemRequest{{ProductID: "p1", Quantity: 1}},
+		Restock: restock,
+	}, "admin")
+}
+
+// refunded returns the amount the order's payment has refunded.
+func (f *sagaFixture) refunded(t *testing.T) int64 {
+	t.Helper()
+	p, err := f.payments.GetByOrderID(context.Background(), firstOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Refunded.Amount
+}
+
+func TestRefundPartialThenFull(t *testing.T) {
+	f := newSagaFixture()
+	f.deliver(t)
+
+	r, err := f.refundOne(true)
+	if err != nil {
+		t.Fatalf("partial: %v", err)
+	}
+	if r.Seq != 1 || r.Amount.Amount != 1000 || r.Status != domain.RefundSucceeded {
+		t.Errorf("partial refund = %+v", r)
+	}
+	if got := f.orders.status(firstOrder); got != domain.StatusPartiallyRefunded {
+		t.Errorf("order is %s after a partial refund", got)
+	}
+	if got := f.payments.status(firstOrder); got != domain.PaymentPartiallyRefunded {
+		t.Errorf("payment is %s after a partial refund", got)
+	}
+	if got := f.inv.Available("p1"); got != 4 {
+		t.Errorf("available = %d, want the restocked item back", got)
+	}
+
+	// everything left: the other item
+	r, err = f.uc.RefundOrder(context.Background(), firstOrder, &domain.RefundRequest{}, "admin")
+	if err != nil {
+		t.Fatalf("full: %v", err)
+	}
+	if r.Seq != 2 || r.Amount.Amount != 1000 || len(r.Items) != 1 || r.Items[0].Quantity != 1 {
+		t.Errorf("full refund = %+v", r)
+	}
+	if got := f.orders.status(firstOrder); got != domain.StatusRefunded {
+		t.Errorf("order is %s after refunding everything", got)
+	}
+	if got := f.payments.status(firstOrder); got != domain.PaymentRefunded {
+		t.Errorf("payment is %s after refunding everything", got)
+	}
+	if got := f.refunded(t); got != 2000 {
+		t.Errorf("refunded %d, want 2000", got)
+	}
+
+	if _, err := f.refundOne(false); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("refund of a refunded order: err = %v", err)
+	}
+}
+
+func TestRefundRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     domain.RefundRequest
+		wantErr error
+	}{
+		{"more than was ordered", domain.RefundRequest{Items: []domain.RefundItemRequest{{ProductID: "p1", Quantity: 3}}}, ErrInvalidRefund},
+		{"a product not in the order", domain.RefundRequest{Items: []domain.RefundItemRequest{{ProductID: "p2", Quantity: 1}}}, ErrInvalidRefund},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture()
+			f.deliver(t)
+			if _, err := f.uc.RefundOrder(context.Background(), firstOrder, &tt.req, "admin"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := f.orders.status(firstOrder); got != domain.StatusDelivered {
+				t.Errorf("order is %s", got)
+			}
+		})
+	}
+}
+
+func TestRefundAboveCapture(t *testing.T) {
+	f := newSagaFixture()
+	f.deliver(t)
+	// 15.00 of the 20.00 captured went back outside the service
+	ctx := context.Background()
+	p, err := f.payments.GetByOrderID(ctx, firstOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Refunded.Amount = 1500
+	if err := f.payments.Save(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.refundOne(false); !errors.Is(err, ErrRefundExceedsCapture) {
+		t.Fatalf("err = %v, want ErrRefundExceedsCapture", err)
+	}
+	if got := f.refunded(t); got != 1500 {
+		t.Errorf("refunded %d, want nothing more", got)
+	}
+	if refunds, _ := f.refunds.ListByOrder(ctx, firstOrder); len(refunds) != 0 {
+		t.Errorf("refunds = %+v, want none recorded", refunds)
+	}
+	if got := f.orders.status(firstOrder); got != domain.StatusDelivered {
+		t.Errorf("order is %s", got)
+	}
+}
+
+func TestRefundsRacingOnSeq(t *testing.T) {
+	f := newSagaFixture()
+	f.deliver(t)
+	if _, err := f.refundOne(false); err != nil {
+		t.Fatal(err)
+	}
+	// the second refund was worked out before the first was written, so
+	// it takes the same Seq
+	f.refunds.stale = 1
+	if _, err := f.refundOne(false); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("err = %v, want ErrVersionConflict", err)
+	}
+	if got := f.refunded(t); got != 1000 {
+		t.Errorf("refunded %d, want only the first refund's 1000", got)
+	}
+	if refunds, _ := f.refunds.ListByOrder(context.Background(), firstOrder); len(refunds) != 1 {
+		t.Errorf("%d refunds recorded, want 1", len(refunds))
+	}
+}
+
+func TestRefundStatusAfterConcurrentWrites(t *testing.T) {
+	tests := []struct {
+		name string
+		// meanwhile runs once the first refund's money moved, before its
+		// status is written
+		meanwhile func(t *testing.T, f *sagaFixture)
+		want      domain.OrderStatus
+		history   []domain.OrderStatus
+		refunded  int64
+	}{
+		{
+			name: "a later refund takes the rest",
+			meanwhile: func(t *testing.T, f *sagaFixture) {
+				if _, err := f.uc.RefundOrder(context.Background(), firstOrder, &domain.RefundRequest{}, "admin"); err != nil {
+					t.Fatalf("second refund: %v", err)
+				}
+			},
+			want:     domain.StatusRefunded,
+			history:  []domain.OrderStatus{domain.StatusDelivered, domain.StatusRefunded},
+			refunded: 2000,
+		},
+		{
+			name: "the order is completed",
+			meanwhile: func(t *testing.T, f *sagaFixture) {
+				if err := f.uc.UpdateStatus(context.Background(), firstOrder, domain.StatusChange{To: domain.StatusCompleted}, domain.AnyVersion); err != nil {
+					t.Fatalf("complete: %v", err)
+				}
+			},
+			want:     domain.StatusPartiallyRefunded,
+			history:  []domain.OrderStatus{domain.StatusDelivered, domain.StatusCompleted, domain.StatusPartiallyRefunded},
+			refunded: 1000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture()
+			f.deliver(t)
+			f.refunds.onSave = func(rf domain.Refund) {
+				f.refunds.onSave = nil
+				tt.meanwhile(t, f)
+			}
+			if _, err := f.refundOne(false); err != nil {
+				t.Fatalf("refund: %v", err)
+			}
+			o, err := f.orders.GetByID(context.Background(), firstOrder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.Status != tt.want {
+				t.Errorf("order is %s, want %s", o.Status, tt.want)
+			}
+			// the history from delivered on
+			var got []domain.OrderStatus
+			for _, h := range o.History {
+				if h.To == domain.StatusDelivered || got != nil {
+					got = append(got, h.To)
+				}
+			}
+			if len(got) != len(tt.history) {
+				t.Fatalf("history = %v, want %v", got, tt.history)
+			}
+			for i := range got {
+				if got[i] != tt.history[i] {
+					t.Fatalf("history = %v, want %v", got, tt.history)
+				}
+			}
+			if got := f.refunded(t); got != tt.refunded {
+				t.Errorf("refunded %d, want %d", got, tt.refunded)
+			}
+		})
+	}
+}
+
+func TestRefundRestockFailureKeepsTheRefund(t *testing.T) {
+	f := newSagaFixture()
+	f.deliver(t)
+	f.inv.FailNext(inventory.OpReturnStock, inventory.ErrTimeout)
+	r, err := f.refundOne(true)
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if r.Status != domain.RefundSucceeded || r.Error == "" {
+		t.Errorf("refund = %+v, want succeeded with the restock error", r)
+	}
+	if got := f.inv.Available("p1"); got != 3 {
+		t.Errorf("available = %d, want nothing restocked", got)
+	}
+}
@@ -0,0 +1,413 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/repository"
+)
+
+// sagaRecoveryGrace keeps RecoverSagas away from sagas another replica may
+// still be driving.
+const sagaRecoveryGrace = time.Minute
+
+var errSagaInterrupted = errors.New("saga interrupted before completion")
+
+// createOrderSaga holds stock in inventory, authorizes the payment and then
+// writes the order. If a later step fails the earlier ones are undone.
+//
+// Steps: started -> stock_reserved [-> payment_authorized] -> order_created.
+func (u *orderUsecase) createOrderSaga(ctx context.Context, o *domain.Order) (string, error) {
+	o.ID = u.repo.NextID()
+	s := &domain.Saga{
+		Type:    domain.SagaCreateOrder,
+		OrderID: o.ID,
+		Step:    domain.StepStarted,
+		Status:  domain.SagaRunning,
+		Order:   o,
+	}
+	if err := u.sagas.Create(ctx, s); err != nil {
+		return "", err
+	}
+
+	resID, err := u.createHold(ctx, o.ID, reserveItems(o.Items))
+	if err != nil {
+		s.Error = err.Error()
+		if !holdMayExist(err) {
+			s.Status = domain.SagaCompensated
+			u.saveSaga(ctx, s)
+			return "", err
+		}
+		// Inventory may have placed the hold and only the answer got lost, or
+		// may still be placing it. Release what is held under the order's id
+		// now and leave the saga compensating, so RecoverSagas looks again
+		// once a late hold would be there.
+		s.Status = domain.SagaCompensating
+		u.saveSaga(ctx, s)
+		if rerr := u.releaseHoldsOf(context.WithoutCancel(ctx), o.ID); rerr != nil {
+			log.Printf("saga %s: release holds of order %s: %v", s.ID, o.ID, rerr)
+		}
+		return "", err
+	}
+	s.ReservationID = resID
+	s.Step = domain.StepStockReserved
+	if err := u.sagas.Save(ctx, s); err != nil {
+		return "", u.compensateCreateOrder(ctx, s, err)
+	}
+
+	if o.PaymentMethod != "" {
+		if err := u.authorizePayment(ctx, o); err != nil {
+			return "", u.compensateCreateOrder(ctx, s, err)
+		}
+		s.Step = domain.StepPaymentAuthorized
+		if err := u.sagas.Save(ctx, s); err != nil {
+			return "", u.compensateCreateOrder(ctx, s, err)
+		}
+	}
+
+	o.ReservationID = resID
+	if _, err := u.repo.Create(ctx, o); err != nil {
+		// only the answer may have been lost; an order that exists is kept
+		_, gerr := u.repo.GetByID(context.WithoutCancel(ctx), o.ID)
+		if errors.Is(gerr, repository.ErrOrderNotFound) {
+			return "", u.compensateCreateOrder(ctx, s, err)
+		}
+		if gerr != nil {
+			// the order may be there all the same: leave the saga running
+			// for RecoverSagas to complete or undo once it can tell
+			s.Error = err.Error()
+			u.saveSaga(ctx, s)
+			return "", err
+		}
+	}
+	s.Step = domain.StepOrderCreated
+	s.Status = domain.SagaCompleted
+	// a lost save is harmless: recovery finds the order and completes the saga
+	u.saveSaga(ctx, s)
+	return o.ID, nil
+}
+
+// compensateCreateOrder releases the hold of a failed create_order saga, found
+// by the order's id if its own was never recorded, voids its payment and
+// returns cause. If either fails the saga stays compensating
+// and is retried by RecoverSagas.
+func (u *orderUsecase) compensateCreateOrder(ctx context.Context, s *domain.Saga, cause error) error {
+	// undoing must not stop because the caller went away
+	ctx = context.WithoutCancel(ctx)
+	s.Status = domain.SagaCompensating
+	if s.Error == "" {
+		s.Error = cause.Error()
+	}
+	u.saveSaga(ctx, s)
+	if s.ReservationID != "" {
+		if err := u.releaseHold(ctx, s.ReservationID); err != nil {
+			log.Printf("saga %s: release reservation %s: %v", s.ID, s.ReservationID, err)
+			return cause
+		}
+	} else if err := u.releaseHoldsOf(ctx, s.OrderID); err != nil {
+		// the hold's id was never recorded, but it may exist all the same
+		log.Printf("saga %s: release holds of order %s: %v", s.ID, s.OrderID, err)
+		return cause
+	}
+	if err := u.releasePayment(ctx, s.OrderID); err != nil {
+		log.Printf("saga %s: void payment: %v", s.ID, err)
+		return cause
+	}
+	s.Status = domain.SagaCompensated
+	u.saveSaga(ctx, s)
+	return cause
+}
+
+// cancelOrderSaga marks the order cancelled and then gives its stock back:
+// the hold is released, or returned if payment already committed it. Last
+// the payment is voided or refunded. The status change is the point of no
+// return; the rest is retried forward.
+//
+// Steps: started -> order_cancelled -> stock_released -> payment_released.
+func (u *orderUsecase) cancelOrderSaga(ctx context.Context, o *domain.Order, change domain.StatusChange) error {
+	s := &domain.Saga{
+		Type:          domain.SagaCancelOrder,
+		OrderID:       o.ID,
+		Step:          domain.StepStarted,
+		Status:        domain.SagaRunning,
+		ReservationID: o.ReservationID,
+		OrderVersion:  o.Version,
+		Change:        &change,
+	}
+	if err := u.sagas.Create(ctx, s); err != nil {
+		return err
+	}
+	return u.runCancelOrder(ctx, s)
+}
+
+func (u *orderUsecase) runCancelOrder(ctx context.Context, s *domain.Saga) error {
+	if s.Step == domain.StepStarted {
+		change := domain.StatusChange{To: domain.StatusCancelled, Actor: domain.SystemActor}
+		if s.Change != nil {
+			change = *s.Change
+		}
+		change.At = time.Now().UTC()
+		if err := u.repo.UpdateStatus(ctx, s.OrderID, change, s.OrderVersion); err != nil && !u.alreadyCancelled(ctx, s, err) {
+			s.Error = err.Error()
+			if err != repository.ErrVersionConflict && err != repository.ErrOrderNotFound {
+				// the write may still have gone through: leave the saga
+				// running, recovery repeats it and finds out
+				u.saveSaga(ctx, s)
+				return err
+			}
+			s.Status = domain.SagaCompensated
+			u.saveSaga(ctx, s)
+			return mapOrderErr(err)
+		}
+		s.Step = domain.StepOrderCancelled
+		u.saveSaga(ctx, s)
+	}
+	// past the point of no return the rest runs even if the caller went away
+	ctx = context.WithoutCancel(ctx)
+
+	if s.Step == domain.StepOrderCancelled {
+		if !u.giveBackStock(ctx, s) {
+			return nil
+		}
+		s.Step = domain.StepStockReleased
+		u.saveSaga(ctx, s)
+	}
+
+	if err := u.releasePayment(ctx, s.OrderID); err != nil {
+		// retried on recovery like the stock
+		log.Printf("saga %s: release payment: %v", s.ID, err)
+		s.Error = err.Error()
+		u.saveSaga(ctx, s)
+		return nil
+	}
+	s.Step = domain.StepPaymentReleased
+	s.Status = domain.SagaCompleted
+	u.saveSaga(ctx, s)
+	return nil
+}
+
+// giveBackStock releases or returns the cancelled order's hold. It reports
+// false when that has to be retried later.
+func (u *orderUsecase) giveBackStock(ctx context.Context, s *domain.Saga) bool {
+	if s.ReservationID != "" {
+		err := u.releaseHold(ctx, s.ReservationID)
+		if err == errHoldClosed {
+			// committed when the order was paid
+			err = u.returnHold(ctx, s.ReservationID)
+		}
+		if err != nil {
+			if err != errHoldClosed {
+				// the order is cancelled either way; giving the stock back
+				// is retried on recovery and, for a hold, its TTL is the
+				// last resort
+				log.Printf("saga %s: release reservation %s: %v", s.ID, s.ReservationID, err)
+				s.Error = err.Error()
+				u.saveSaga(ctx, s)
+				return false
+			}
+			// neither held nor committed: there is no stock to give back
+			s.Error = err.Error()
+		}
+	}
+	return true
+}
+
+// payOrderSaga locks the order at the version it was read at, captures the
+// payment, commits the stock hold and then marks the order paid, which also
+// unlocks it. Concurrent writes fail while the order is locked, so money only
+// moves for the version the caller saw. A failed capture unlocks the order
+// untouched; once the money moved the rest is retried forward, unless the
+// hold is gone, which refunds the payment.
+//
+// Steps: started -> payment_captured -> stock_committed -> order_paid.
+func (u *orderUsecase) payOrderSaga(ctx context.Context, o *domain.Order, change domain.StatusChange) error {
+	s := &domain.Saga{
+		Type:          domain.SagaPayOrder,
+		OrderID:       o.ID,
+		Step:          domain.StepStarted,
+		Status:        domain.SagaRunning,
+		ReservationID: o.ReservationID,
+		OrderVersion:  o.Version,
+		Change:        &change,
+	}
+	if err := u.sagas.Create(ctx, s); err != nil {
+		return err
+	}
+	if err := u.repo.BeginEdit(ctx, o.ID, o.Version, s.ID); err != nil {
+		s.Status = domain.SagaCompensated
+		s.Error = err.Error()
+		u.saveSaga(ctx, s)
+		return mapOrderErr(err)
+	}
+	return u.runPayOrder(ctx, s)
+}
+
+func (u *orderUsecase) runPayOrder(ctx context.Context, s *domain.Saga) error {
+	if s.Step == domain.StepStarted {
+		if err := u.capturePayment(ctx, s.OrderID); err != nil {
+			return u.compensatePayOrder(ctx, s, err)
+		}
+		s.Step = domain.StepPaymentCaptured
+		u.saveSaga(ctx, s)
+	}
+	// the money has moved: finish the sale even if the caller went away
+	ctx = context.WithoutCancel(ctx)
+
+	if s.Step == domain.StepPaymentCaptured {
+		// the sale is final: turn the hold into a stock decrement
+		if s.ReservationID != "" {
+			if err := u.commitHold(ctx, s.ReservationID); err != nil {
+				if err == errHoldClosed {
+					// the stock is gone, so is the sale
+					return u.compensatePayOrder(ctx, s, ErrHoldLost)
+				}
+				// the order stays locked until RecoverSagas commits it
+				s.Error = err.Error()
+				u.saveSaga(ctx, s)
+				return err
+			}
+		}
+		s.Step = domain.StepStockCommitted
+		u.saveSaga(ctx, s)
+	}
+
+	change := *s.Change
+	change.At = time.Now().UTC()
+	if err := u.repo.FinishPay(ctx, s.OrderID, s.ID, change); err != nil && !u.alreadyPaid(ctx, s, err) {
+		s.Error = err.Error()
+		u.saveSaga(ctx, s)
+		return mapOrderErr(err)
+	}
+	s.Step = domain.StepOrderPaid
+	s.Status = domain.SagaCompleted
+	u.saveSaga(ctx, s)
+	return nil
+}
+
+// compensatePayOrder refunds the payment if it was captured, unlocks the
+// order and returns cause. If either fails the saga stays compensating and is
+// retried by RecoverSagas.
+func (u *orderUsecase) compensatePayOrder(ctx context.Context, s *domain.Saga, cause error) error {
+	// undoing must not stop because the caller went away
+	ctx = context.WithoutCancel(ctx)
+	s.Status = domain.SagaCompensating
+	if s.Error == "" {
+		s.Error = cause.Error()
+	}
+	u.saveSaga(ctx, s)
+	if s.Step == domain.StepPaymentCaptured {
+		if err := u.releasePayment(ctx, s.OrderID); err != nil {
+			log.Printf("saga %s: refund after lost hold: %v", s.ID, err)
+			return cause
+		}
+	}
+	if err := u.repo.AbortEdit(ctx, s.OrderID, s.ID); err != nil {
+		log.Printf("saga %s: unlock order: %v", s.ID, err)
+		return cause
+	}
+	s.Status = domain.SagaCompensated
+	u.saveSaga(ctx, s)
+	return cause
+}
+
+// recoverPayOrder resumes a pay_order saga forward once its payment is
+// captured and compensates any other, since its caller never got an answer.
+func (u *orderUsecase) recoverPayOrder(ctx context.Context, s *domain.Saga) {
+	if s.Status == domain.SagaRunning && s.Step == domain.StepStarted {
+		p, err := u.payments.GetByOrderID(ctx, s.OrderID)
+		switch {
+		case err == nil && p.Status == domain.PaymentCaptured:
+			s.Step = domain.StepPaymentCaptured
+			u.saveSaga(ctx, s)
+		case err != nil && err != repository.ErrPaymentNotFound:
+			log.Printf("saga %s: recover: %v", s.ID, err)
+			return
+		}
+	}
+	if s.Status == domain.SagaRunning && s.Step != domain.StepStarted {
+		if err := u.runPayOrder(ctx, s); err != nil {
+			log.Printf("saga %s: recover: %v", s.ID, err)
+		}
+		return
+	}
+	_ = u.compensatePayOrder(ctx, s, errSagaInterrupted)
+}
+
+// alreadyPaid tells whether a failed paid write is this saga's own, whose
+// answer got lost. Only the saga holding the lock can have paid the order.
+func (u *orderUsecase) alreadyPaid(ctx context.Context, s *domain.Saga, err error) bool {
+	if err == repository.ErrOrderNotFound {
+		return false
+	}
+	o, err := u.repo.GetByID(ctx, s.OrderID)
+	return err == nil && o.Status == s.Change.To
+}
+
+// alreadyCancelled tells whether a failed cancel write is only this saga's
+// own earlier write that was never recorded as a step, or one whose answer
+// got lost.
+func (u *orderUsecase) alreadyCancelled(ctx context.Context, s *domain.Saga, err error) bool {
+	if err == repository.ErrOrderNotFound {
+		return false
+	}
+	o, err := u.repo.GetByID(ctx, s.OrderID)
+	return err == nil && o.Status == domain.StatusCancelled
+}
+
+// RecoverSagas drives sagas left unfinished by a crashed process to an end
+// state. A create_order saga whose order made it to the database is
+// completed; any other is compensated, since its caller never got an answer.
+// cancel_order sagas are resumed forward, edit_order sagas forward once the
+// order holds the new items and pay_order sagas once the payment is captured.
+// Once ctx is done no further saga is started.
+func (u *orderUsecase) RecoverSagas(ctx context.Context) error {
+	sagas, err := u.sagas.ListUnfinished(ctx, time.Now().UTC().Add(-sagaRecoveryGrace))
+	if err != nil {
+		return err
+	}
+	// ctx only bounds the pass: a saga once picked up is driven to the end
+	run := context.WithoutCancel(ctx)
+	for _, s := range sagas {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ctx := run
+		switch s.Type {
+		case domain.SagaCreateOrder:
+			if s.Status == domain.SagaRunning && (s.Step == domain.StepStockReserved || s.Step == domain.StepPaymentAuthorized) {
+				_, err := u.repo.GetByID(ctx, s.OrderID)
+				if err == nil {
+					s.Step = domain.StepOrderCreated
+					s.Status = domain.SagaCompleted
+					u.saveSaga(ctx, s)
+					continue
+				}
+				if err != repository.ErrOrderNotFound {
+					log.Printf("saga %s: recover: %v", s.ID, err)
+					continue
+				}
+			}
+			_ = u.compensateCreateOrder(ctx, s, errSagaInterrupted)
+		case domain.SagaCancelOrder:
+			if err := u.runCancelOrder(ctx, s); err != nil {
+				log.Printf("saga %s: recover: %v", s.ID, err)
+			}
+		case domain.SagaEditOrder:
+			u.recoverEditOrder(ctx, s)
+		case domain.SagaPayOrder:
+			u.recoverPayOrder(ctx, s)
+		}
+	}
+	return nil
+}
+
+// saveSaga records a step that already happened, so it runs even if the
+// caller went away.
+func (u *orderUsecase) saveSaga(ctx context.Context, s *domain.Saga) {
+	if err := u.sagas.Save(context.WithoutCancel(ctx), s); err != nil {
+		log.Printf("saga %s: save step %s/%s: %v", s.ID, s.Step, s.Status, err)
+	}
+}
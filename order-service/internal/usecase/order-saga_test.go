@@ -0,0 +1,608 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/inventory"
+	"github.com/Nurda-zh/a1/order-service/internal/payment"
+	"github.com/Nurda-zh/a1/order-service/internal/repository"
+)
+
+// firstOrder is the id the first order of a fixture gets.
+const firstOrder = "order_1"
+
+var errDB = errors.New("database unreachable")
+
+type sagaFixture struct {
+	uc       *orderUsecase
+	orders   *memOrderRepo
+	sagas    *memSagaRepo
+	payments *memPaymentRepo
+	refunds  *memRefundRepo
+	provider *flakyProvider
+	inv      *inventory.Fake
+}
+
+// newSagaFixture sells one product, p1, at 10.00 USD with 5 in stock.
+func newSagaFixture() *sagaFixture {
+	f := &sagaFixture{
+		orders:   newMemOrderRepo(),
+		sagas:    newMemSagaRepo(),
+		payments: newMemPaymentRepo(),
+		refunds:  &memRefundRepo{},
+		provider: &flakyProvider{Fake: payment.NewFake()},
+		inv:      inventory.NewFake(),
+	}
+	f.inv.SetProduct("p1", "10.00", "USD", 5)
+	f.uc = NewOrderUsecase(f.orders, f.sagas, f.payments, f.refunds, f.provider, f.inv).(*orderUsecase)
+	return f
+}
+
+// place orders 2 of p1, paid with method.
+func (f *sagaFixture) place(method string) (string, error) {
+	return f.uc.CreateOrder(context.Background(), &domain.CreateOrderRequest{
+		UserID:        "u1",
+		Items:         []domain.OrderItem{{ProductID: "p1", Quantity: 2}},
+		PaymentMethod: method,
+	})
+}
+
+// recover runs saga recovery as if the grace period had passed.
+func (f *sagaFixture) recover(t *testing.T) {
+	t.Helper()
+	f.sagas.age(2 * sagaRecoveryGrace)
+	if err := f.uc.RecoverSagas(context.Background()); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+}
+
+// sagaEnd is the state a saga leaves behind: its own, that of the order's
+// hold and payment, and the stock of p1 still available.
+type sagaEnd struct {
+	status    domain.SagaStatus
+	step      domain.SagaStep
+	order     domain.OrderStatus
+	hold      string
+	payment   domain.PaymentStatus
+	available int
+}
+
+func (f *sagaFixture) check(t *testing.T, typ domain.SagaType, want sagaEnd) {
+	t.Helper()
+	s, ok := f.sagas.byOrder(firstOrder, typ)
+	if !ok {
+		t.Fatalf("no %s saga", typ)
+	}
+	if s.Status != want.status || s.Step != want.step {
+		t.Errorf("saga is %s at %s, want %s at %s", s.Status, s.Step, want.status, want.step)
+	}
+	if got := f.orders.status(firstOrder); got != want.order {
+		t.Errorf("order is %q, want %q", got, want.order)
+	}
+	holds, err := f.inv.ReservationsByReference(context.Background(), firstOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hold := ""
+	if len(holds) > 1 {
+		t.Errorf("%d holds, want at most one", len(holds))
+	}
+	if len(holds) > 0 {
+		hold = holds[0].Status
+	}
+	if hold != want.hold {
+		t.Errorf("hold is %q, want %q", hold, want.hold)
+	}
+	if got := f.payments.status(firstOrder); got != want.payment {
+		t.Errorf("payment is %q, want %q", got, want.payment)
+	}
+	if got := f.inv.Available("p1"); got != want.available {
+		t.Errorf("available = %d, want %d", got, want.available)
+	}
+}
+
+func TestCreateOrderSaga(t *testing.T) {
+	var (
+		placed = sagaEnd{domain.SagaCompleted, domain.StepOrderCreated, domain.StatusPending, inventory.ReservationHeld, domain.PaymentAuthorized, 3}
+		undone = sagaEnd{domain.SagaCompensated, domain.StepPaymentAuthorized, "", inventory.ReservationReleased, domain.PaymentVoided, 5}
+	)
+	tests := []struct {
+		name    string
+		method  string
+		inject  func(f *sagaFixture)
+		wantErr error
+		// end is the state once the request returned, recovered once
+		// RecoverSagas ran after it
+		end, recovered sagaEnd
+	}{
+		{
+			name:      "all steps go through",
+			end:       placed,
+			recovered: placed,
+		},
+		{
+			name: "stock refused",
+			inject: func(f *sagaFixture) {
+				f.inv.FailNext(inventory.OpCreateReservation, inventory.ErrInsufficientStock)
+			},
+			wantErr:   ErrStockInsufficient,
+			end:       sagaEnd{domain.SagaCompensated, domain.StepStarted, "", "", "", 5},
+			recovered: sagaEnd{domain.SagaCompensated, domain.StepStarted, "", "", "", 5},
+		},
+		{
+			name: "inventory refuses our token",
+			inject: func(f *sagaFixture) {
+				f.inv.FailNext(inventory.OpCreateReservation, fmt.Errorf("inventory reserve: %w", inventory.ErrUnauthorized))
+			},
+			wantErr:   ErrInventoryUnavailable,
+			end:       sagaEnd{domain.SagaCompensated, domain.StepStarted, "", "", "", 5},
+			recovered: sagaEnd{domain.SagaCompensated, domain.StepStarted, "", "", "", 5},
+		},
+		{
+			name: "hold placed but its answer lost",
+			inject: func(f *sagaFixture) {
+				f.inv.LoseNext(inventory.OpCreateReservation, inventory.ErrTimeout)
+			},
+			wantErr:   ErrInventoryUnavailable,
+			end:       sagaEnd{domain.SagaCompensating, domain.StepStarted, "", inventory.ReservationReleased, "", 5},
+			recovered: sagaEnd{domain.SagaCompensated, domain.StepStarted, "", inventory.ReservationReleased, "", 5},
+		},
+		{
+			name: "hold answer lost and not found in time",
+			inject: func(f *sagaFixture) {
+				f.inv.LoseNext(inventory.OpCreateReservation, inventory.ErrTimeout)
+				f.inv.FailNext(inventory.OpFindReservations, inventory.ErrTimeout)
+			},
+			wantErr:   ErrInventoryUnavailable,
+			end:       sagaEnd{domain.SagaCompensating, domain.StepStarted, "", inventory.ReservationHeld, "", 3},
+			recovered: sagaEnd{domain.SagaCompensated, domain.StepStarted, "", inventory.ReservationReleased, "", 5},
+		},
+		{
+			name: "saga save after the hold fails",
+			inject: func(f *sagaFixture) {
+				f.sagas.faults.failNext("Save", errDB)
+			},
+			wantErr:   errDB,
+			end:       sagaEnd{domain.SagaCompensated, domain.StepStockReserved, "", inventory.ReservationReleased, "", 5},
+			recovered: sagaEnd{domain.SagaCompensated, domain.StepStockReserved, "", inventory.ReservationReleased, "", 5},
+		},
+		{
+			name:      "payment declined",
+			method:    payment.FakeDeclineMethod,
+			wantErr:   ErrPaymentDeclined,
+			end:       sagaEnd{domain.SagaCompensated, domain.StepStockReserved, "", inventory.ReservationReleased, domain.PaymentFailed, 5},
+			recovered: sagaEnd{domain.SagaCompensated, domain.StepStockReserved, "", inventory.ReservationReleased, domain.PaymentFailed, 5},
+		},
+		{
+			name: "provider fails the authorization",
+			inject: func(f *sagaFixture) {
+				f.provider.faults.failNext("Authorize", errors.New("provider down"))
+			},
+			wantErr:   ErrPaymentFailed,
+			end:       sagaEnd{domain.SagaCompensated, domain.StepStockReserved, "", inventory.ReservationReleased, domain.PaymentFailed, 5},
+			recovered: sagaEnd{domain.SagaCompensated, domain.StepStockReserved, "", inventory.ReservationReleased, domain.PaymentFailed, 5},
+		},
+		{
+			name: "saga save after the payment fails",
+			inject: func(f *sagaFixture) {
+				f.sagas.faults.skip("Save")
+				f.sagas.faults.failNext("Save", errDB)
+			},
+			wantErr:   errDB,
+			end:       undone,
+			recovered: undone,
+		},
+		{
+			name: "order write fails",
+			inject: func(f *sagaFixture) {
+				f.orders.faults.failNext("Create", errDB)
+			},
+			wantErr:   errDB,
+			end:       undone,
+			recovered: undone,
+		},
+		{
+			name: "order written but its answer lost",
+			inject: func(f *sagaFixture) {
+				f.orders.faults.loseNext("Create", errDB)
+			},
+			end:       placed,
+			recovered: placed,
+		},
+		{
+			name: "order write fails and its lookup too",
+			inject: func(f *sagaFixture) {
+				f.orders.faults.failNext("Create", errDB)
+				f.orders.faults.failNext("GetByID", errDB)
+			},
+			wantErr:   errDB,
+			end:       sagaEnd{domain.SagaRunning, domain.StepPaymentAuthorized, "", inventory.ReservationHeld, domain.PaymentAuthorized, 3},
+			recovered: undone,
+		},
+		{
+			name: "order written but its answer and lookup lost",
+			inject: func(f *sagaFixture) {
+				f.orders.faults.loseNext("Create", errDB)
+				f.orders.faults.failNext("GetByID", errDB)
+			},
+			wantErr:   errDB,
+			end:       sagaEnd{domain.SagaRunning, domain.StepPaymentAuthorized, domain.StatusPending, inventory.ReservationHeld, domain.PaymentAuthorized, 3},
+			recovered: placed,
+		},
+		{
+			name: "completion of the saga not recorded",
+			inject: func(f *sagaFixture) {
+				f.sagas.faults.skip("Save")
+				f.sagas.faults.skip("Save")
+				f.sagas.faults.failNext("Save", errDB)
+			},
+			end:       sagaEnd{domain.SagaRunning, domain.StepPaymentAuthorized, domain.StatusPending, inventory.ReservationHeld, domain.PaymentAuthorized, 3},
+			recovered: placed,
+		},
+		{
+			name: "release fails while undoing",
+			inject: func(f *sagaFixture) {
+				f.orders.faults.failNext("Create", errDB)
+				f.inv.FailNext(inventory.OpReleaseReservation, inventory.ErrTimeout)
+			},
+			wantErr:   errDB,
+			end:       sagaEnd{domain.SagaCompensating, domain.StepPaymentAuthorized, "", inventory.ReservationHeld, domain.PaymentAuthorized, 3},
+			recovered: undone,
+		},
+		{
+			name: "void fails while undoing",
+			inject: func(f *sagaFixture) {
+				f.orders.faults.failNext("Create", errDB)
+				f.provider.faults.failNext("Void", errors.New("provider down"))
+			},
+			wantErr:   errDB,
+			end:       sagaEnd{domain.SagaCompensating, domain.StepPaymentAuthorized, "", inventory.ReservationReleased, domain.PaymentAuthorized, 5},
+			recovered: undone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture()
+			if tt.inject != nil {
+				tt.inject(f)
+			}
+			method := tt.method
+			if method == "" {
+				method = "card"
+			}
+			id, err := f.place(method)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && id != firstOrder {
+				t.Fatalf("id = %q, want %q", id, firstOrder)
+			}
+			f.check(t, domain.SagaCreateOrder, tt.end)
+			f.recover(t)
+			f.check(t, domain.SagaCreateOrder, tt.recovered)
+		})
+	}
+}
+
+func TestCancelOrderSaga(t *testing.T) {
+	var (
+		cancelled = sagaEnd{domain.SagaCompleted, domain.StepPaymentReleased, domain.StatusCancelled, inventory.ReservationReleased, domain.PaymentVoided, 5}
+		refunded  = sagaEnd{domain.SagaCompleted, domain.StepPaymentReleased, domain.StatusCancelled, inventory.ReservationReturned, domain.PaymentRefunded, 5}
+		untouched = sagaEnd{domain.SagaCompensated, domain.StepStarted, domain.StatusPending, inventory.ReservationHeld, domain.PaymentAuthorized, 3}
+	)
+	tests := []struct {
+		name           string
+		paid           bool
+		inject         func(f *sagaFixture)
+		wantErr        error
+		end, recovered sagaEnd
+	}{
+		{
+			name:      "pending order",
+			end:       cancelled,
+			recovered: cancelled,
+		},
+		{
+			name:      "paid order",
+			paid:      true,
+			end:       refunded,
+			recovered: refunded,
+		},
+		{
+			name: "cancel write conflicts",
+			inject: func(f *sagaFixture) {
+				f.orders.faults.failNext("UpdateStatus", repository.ErrVersionConflict)
+			},
+			wantErr:   ErrVersionConflict,
+			end:       untouched,
+			recovered: untouched,
+		},
+		{
+			name: "cancel write fails",
+			inject: func(f *sagaFixture) {
+				f.orders.faults.failNext("UpdateStatus", errDB)
+			},
+			wantErr:   errDB,
+			end:       sagaEnd{domain.SagaRunning, domain.StepStarted, domain.StatusPending, inventory.ReservationHeld, domain.PaymentAuthorized, 3},
+			recovered: cancelled,
+		},
+		{
+			name: "cancel written but its answer lost",
+			inject: func(f *sagaFixture) {
+				f.orders.faults.loseNext("UpdateStatus", errDB)
+			},
+			end:       cancelled,
+			recovered: cancelled,
+		},
+		{
+			name: "release fails",
+			inject: func(f *sagaFixture) {
+				f.inv.FailNext(inventory.OpReleaseReservation, inventory.ErrTimeout)
+			},
+			end:       sagaEnd{domain.SagaRunning, domain.StepOrderCancelled, domain.StatusCancelled, inventory.ReservationHeld, domain.PaymentAuthorized, 3},
+			recovered: cancelled,
+		},
+		{
+			name: "return fails",
+			paid: true,
+			inject: func(f *sagaFixture) {
+				f.inv.FailNext(inventory.OpReturnReservation, inventory.ErrTimeout)
+			},
+			end:       sagaEnd{domain.SagaRunning, domain.StepOrderCancelled, domain.StatusCancelled, inventory.ReservationCommitted, domain.PaymentCaptured, 3},
+			recovered: refunded,
+		},
+		{
+			name: "void fails",
+			inject: func(f *sagaFixture) {
+				f.provider.faults.failNext("Void", errors.New("provider down"))
+			},
+			end:       sagaEnd{domain.SagaRunning, domain.StepStockReleased, domain.StatusCancelled, inventory.ReservationReleased, domain.PaymentAuthorized, 5},
+			recovered: cancelled,
+		},
+		{
+			name: "refund fails",
+			paid: true,
+			inject: func(f *sagaFixture) {
+				f.provider.faults.failNext("Refund", errors.New("provider down"))
+			},
+			end:       sagaEnd{domain.SagaRunning, domain.StepStockReleased, domain.StatusCancelled, inventory.ReservationReturned, domain.PaymentCaptured, 5},
+			recovered: refunded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture()
+			ctx := context.Background()
+			if _, err := f.place("card"); err != nil {
+				t.Fatalf("place: %v", err)
+			}
+			if tt.paid {
+				if err := f.uc.UpdateStatus(ctx, firstOrder, domain.StatusChange{To: domain.StatusPaid}, domain.AnyVersion); err != nil {
+					t.Fatalf("pay: %v", err)
+				}
+			}
+			if tt.inject != nil {
+				tt.inject(f)
+			}
+			err := f.uc.UpdateStatus(ctx, firstOrder, domain.StatusChange{To: domain.StatusCancelled}, domain.AnyVersion)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			f.check(t, domain.SagaCancelOrder, tt.end)
+			f.recover(t)
+			f.check(t, domain.SagaCancelOrder, tt.recovered)
+		})
+	}
+}
+
+func TestRecoverSagasReleasesHoldOfInterruptedCreate(t *testing.T) {
+	f := newSagaFixture()
+	ctx := context.Background()
+	// the process died between placing the hold and recording it
+	s := &domain.Saga{Type: domain.SagaCreateOrder, OrderID: firstOrder, Step: domain.StepStarted, Status: domain.SagaRunning}
+	if err := f.sagas.Create(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.inv.CreateReservation(ctx, firstOrder, []inventory.Item{{ProductID: "p1", Quantity: 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	f.recover(t)
+	f.check(t, domain.SagaCreateOrder, sagaEnd{domain.SagaCompensated, domain.StepStarted, "", inventory.ReservationReleased, "", 5})
+}
+
+func TestRecoverSagasLeavesRecentSagasAlone(t *testing.T) {
+	f := newSagaFixture()
+	f.inv.LoseNext(inventory.OpCreateReservation, inventory.ErrTimeout)
+	f.inv.FailNext(inventory.OpFindReservations, inventory.ErrTimeout)
+	if _, err := f.place("card"); err == nil {
+		t.Fatal("place went through")
+	}
+
+	if err := f.uc.RecoverSagas(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	f.check(t, domain.SagaCreateOrder, sagaEnd{domain.SagaCompensating, domain.StepStarted, "", inventory.ReservationHeld, "", 3})
+}
+
+func TestRecoverSagasStopsWhenContextIsDone(t *testing.T) {
+	f := newSagaFixture()
+	f.inv.LoseNext(inventory.OpCreateReservation, inventory.ErrTimeout)
+	f.inv.FailNext(inventory.OpFindReservations, inventory.ErrTimeout)
+	if _, err := f.place("card"); err == nil {
+		t.Fatal("place went through")
+	}
+	f.sagas.age(2 * sagaRecoveryGrace)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := f.uc.RecoverSagas(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	f.check(t, domain.SagaCreateOrder, sagaEnd{domain.SagaCompensating, domain.StepStarted, "", inventory.ReservationHeld, "", 3})
+}
+
+func TestPayOrderSaga(t *testing.T) {
+	var (
+		paid      = sagaEnd{domain.SagaCompleted, domain.StepOrderPaid, domain.StatusPaid, inventory.ReservationCommitted, domain.PaymentCaptured, 3}
+		untouched = sagaEnd{domain.SagaCompensated, domain.StepStarted, domain.StatusPending, inventory.ReservationHeld, domain.PaymentAuthorized, 3}
+	)
+	tests := []struct {
+		name    string
+		inject  func(t *testing.T, f *sagaFixture)
+		wantErr error
+		// locked is whether the order is still locked once the request
+		// returned; recovery always unlocks it
+		locked         bool
+		end, recovered sagaEnd
+	}{
+		{
+			name:      "all steps go through",
+			end:       paid,
+			recovered: paid,
+		},
+		{
+			name: "order changed before it was locked",
+			inject: func(t *testing.T, f *sagaFixture) {
+				f.orders.faults.failNext("BeginEdit", repository.ErrVersionConflict)
+			},
+			wantErr:   ErrVersionConflict,
+			end:       untouched,
+			recovered: untouched,
+		},
+		{
+			name: "capture fails",
+			inject: func(t *testing.T, f *sagaFixture) {
+				f.provider.faults.failNext("Capture", errors.New("provider down"))
+			},
+			wantErr:   ErrPaymentFailed,
+			end:       untouched,
+			recovered: untouched,
+		},
+		{
+			name: "hold lost",
+			inject: func(t *testing.T, f *sagaFixture) {
+				holds, err := f.inv.ReservationsByReference(context.Background(), firstOrder)
+				if err != nil || len(holds) != 1 {
+					t.Fatalf("holds = %v, %v", holds, err)
+				}
+				if err := f.inv.ReleaseReservation(context.Background(), holds[0].ID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:   ErrHoldLost,
+			end:       sagaEnd{domain.SagaCompensated, domain.StepPaymentCaptured, domain.StatusPending, inventory.ReservationReleased, domain.PaymentRefunded, 5},
+			recovered: sagaEnd{domain.SagaCompensated, domain.StepPaymentCaptured, domain.StatusPending, inventory.ReservationReleased, domain.PaymentRefunded, 5},
+		},
+		{
+			name: "commit fails",
+			inject: func(t *testing.T, f *sagaFixture) {
+				f.inv.FailNext(inventory.OpCommitReservation, inventory.ErrTimeout)
+			},
+			wantErr:   ErrInventoryUnavailable,
+			locked:    true,
+			end:       sagaEnd{domain.SagaRunning, domain.StepPaymentCaptured, domain.StatusPending, inventory.ReservationHeld, domain.PaymentCaptured, 3},
+			recovered: paid,
+		},
+		{
+			name: "commit answer lost",
+			inject: func(t *testing.T, f *sagaFixture) {
+				f.inv.LoseNext(inventory.OpCommitReservation, inventory.ErrTimeout)
+			},
+			wantErr:   ErrInventoryUnavailable,
+			locked:    true,
+			end:       sagaEnd{domain.SagaRunning, domain.StepPaymentCaptured, domain.StatusPending, inventory.ReservationCommitted, domain.PaymentCaptured, 3},
+			recovered: paid,
+		},
+		{
+			name: "paid write fails",
+			inject: func(t *testing.T, f *sagaFixture) {
+				f.orders.faults.failNext("FinishPay", errDB)
+			},
+			wantErr:   errDB,
+			locked:    true,
+			end:       sagaEnd{domain.SagaRunning, domain.StepStockCommitted, domain.StatusPending, inventory.ReservationCommitted, domain.PaymentCaptured, 3},
+			recovered: paid,
+		},
+		{
+			name: "paid written but its answer lost",
+			inject: func(t *testing.T, f *sagaFixture) {
+				f.orders.faults.loseNext("FinishPay", errDB)
+			},
+			end:       paid,
+			recovered: paid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture()
+			ctx := context.Background()
+			if _, err := f.place("card"); err != nil {
+				t.Fatalf("place: %v", err)
+			}
+			if tt.inject != nil {
+				tt.inject(t, f)
+			}
+			err := f.uc.UpdateStatus(ctx, firstOrder, domain.StatusChange{To: domain.StatusPaid}, 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			f.check(t, domain.SagaPayOrder, tt.end)
+			if locked := f.orders.lockedBy(firstOrder) != ""; locked != tt.locked {
+				t.Errorf("order locked = %v, want %v", locked, tt.locked)
+			}
+			f.recover(t)
+			f.check(t, domain.SagaPayOrder, tt.recovered)
+			if by := f.orders.lockedBy(firstOrder); by != "" {
+				t.Errorf("order still locked by %s after recovery", by)
+			}
+		})
+	}
+}
+
+func TestPayOrderLocksOutConcurrentWrites(t *testing.T) {
+	f := newSagaFixture()
+	ctx := context.Background()
+	if _, err := f.place("card"); err != nil {
+		t.Fatalf("place: %v", err)
+	}
+	f.inv.FailNext(inventory.OpCommitReservation, inventory.ErrTimeout)
+	if err := f.uc.UpdateStatus(ctx, firstOrder, domain.StatusChange{To: domain.StatusPaid}, 1); !errors.Is(err, ErrInventoryUnavailable) {
+		t.Fatalf("pay: %v", err)
+	}
+
+	// a retry with the order's new version does not capture again
+	o, err := f.orders.GetByID(ctx, firstOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.uc.UpdateStatus(ctx, firstOrder, domain.StatusChange{To: domain.StatusPaid}, o.Version)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("second pay: err = %v, want ErrVersionConflict", err)
+	}
+	if err := f.uc.UpdateStatus(ctx, firstOrder, domain.StatusChange{To: domain.StatusCancelled}, o.Version); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("cancel while paying: err = %v, want ErrVersionConflict", err)
+	}
+	p, err := f.payments.GetByOrderID(ctx, firstOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	captures := 0
+	for _, a := range p.Attempts {
+		if a.Operation == domain.OpCapture {
+			captures++
+		}
+	}
+	if captures != 1 {
+		t.Errorf("%d captures, want 1", captures)
+	}
+
+	f.recover(t)
+	if got := f.orders.status(firstOrder); got != domain.StatusPaid {
+		t.Errorf("order is %q after recovery, want paid", got)
+	}
+}
@@ -1,137 +1,291 @@
 package usecase
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/inventory"
+	"github.com/Nurda-zh/a1/order-service/internal/payment"
 	"github.com/Nurda-zh/a1/order-service/internal/repository"
+	"github.com/Nurda-zh/a1/pkg/auth"
 )
 
 var (
 	ErrOrderNotFound     = errors.New("order not found")
 	ErrStockInsufficient = errors.New("stock insufficient")
+	ErrUnknownProduct    = errors.New("unknown product")
+	ErrVersionConflict   = errors.New("order was modified concurrently")
+	ErrInvalidStatus     = errors.New("invalid status")
+	ErrIllegalTransition = errors.New("illegal status transition")
+	ErrHoldLost          = errors.New("stock hold expired or was released")
+	// ErrForbidden means the caller may see the order but not do this to it.
+	ErrForbidden = errors.New("forbidden")
+	// ErrInventoryUnavailable means inventory could not be reached or failed;
+	// the same request may succeed later.
+	ErrInventoryUnavailable = errors.New("inventory service unavailable")
 )
 
-type OrderUsecase interface {
-	CreateOrder(req *domain.CreateOrderRequest) (string, error)
-	GetOrder(id string) (*domain.Order, error)
-	UpdateStatus(id string, status domain.OrderStatus) error
-	ListOrdersByUser(userID string, page, pageSize int64) ([]*domain.Order, int64, error)
+// PriceChangedError is returned by CreateOrder and UpdateItems when a price
+// sent by the client differs from the catalog. Quote holds the current prices
+// to retry with.
+type PriceChangedError struct {
+	Mismatches []domain.PriceMismatch
+	Quote      *domain.Quote
 }
 
-type orderUsecase struct {
-	repo         repository.OrderRepo
-	inventoryURL string
-	httpClient   *http.Client
+func (e *PriceChangedError) Error() string {
+	return "prices changed"
 }
 
-func NewOrderUsecase(r repository.OrderRepo, inventoryURL string) OrderUsecase {
-	return &orderUsecase{
-		repo:         r,
-		inventoryURL: inventoryURL,
-		httpClient:   &http.Client{Timeout: 5 * time.Second},
-	}
+type OrderUsecase interface {
+	CreateOrder(ctx context.Context, req *domain.CreateOrderRequest) (string, error)
+	QuoteOrder(ctx context.Context, items []domain.OrderItem) (*domain.Quote, error)
+	// GetOrder and the calls on a single order tell callers other than its
+	// owner and admins that it does not exist, see auth.FromContext.
+	GetOrder(ctx context.Context, id string, withHistory bool) (*domain.Order, error)
+	GetOrderHistory(ctx context.Context, id string) ([]domain.StatusChange, error)
+	// UpdateStatus moves the order to change.To; the usecase fills in From
+	// and At. Owners may only cancel.
+	UpdateStatus(ctx context.Context, id string, change domain.StatusChange, version int64) error
+	// UpdateItems replaces the items of a pending order and returns it.
+	UpdateItems(ctx context.Context, id string, items []domain.OrderItem, version int64) (*domain.Order, error)
+	ListOrdersByUser(ctx context.Context, userID string, page, pageSize int64) ([]*domain.Order, int64, error)
+	GetPayment(ctx context.Context, orderID string) (*domain.Payment, error)
+	RefundOrder(ctx context.Context, orderID string, req *domain.RefundRequest, actor string) (*domain.Refund, error)
+	ListRefunds(ctx context.Context, orderID string) ([]domain.Refund, error)
+	// CancelStaleOrders cancels orders pending for longer than maxAge and
+	// returns how many.
+	CancelStaleOrders(ctx context.Context, maxAge time.Duration) (int, error)
+	RecoverSagas(ctx context.Context) error
 }
 
-type reserveItem struct {
-	ProductID string `json:"product_id"`
-	Quantity  int    `json:"quantity"`
+type orderUsecase struct {
+	repo      repository.OrderRepo
+	sagas     repository.SagaRepo
+	payments  repository.PaymentRepo
+	refunds   repository.RefundRepo
+	provider  payment.Provider
+	inventory inventory.Client
 }
 
-type reserveReq struct {
-	Items []reserveItem `json:"items"`
+func NewOrderUsecase(r repository.OrderRepo, sagas repository.SagaRepo, payments repository.PaymentRepo, refunds repository.RefundRepo, provider payment.Provider, inv inventory.Client) OrderUsecase {
+	return &orderUsecase{
+		repo:      r,
+		sagas:     sagas,
+		payments:  payments,
+		refunds:   refunds,
+		provider:  provider,
+		inventory: inv,
+	}
 }
 
 // CreateOrder: basic flow:
-// 1. validate
-// 2. attempt to reserve stock via Inventory API (POST /products/reserve or similar). For assignment we call /products/stock-decrement endpoint (mock).
-// 3. if reserve ok, create order in DB and return id
-func (u *orderUsecase) CreateOrder(req *domain.CreateOrderRequest) (string, error) {
+// 1. validate and price items from the catalog (client price_cents is only checked, never trusted)
+// 2. hold stock via Inventory API (POST /reservations)
+// 3. authorize the total with the payment provider when a payment method is given
+// 4. if all went through, create order in DB and return id; otherwise undo what did
+// Steps 2 to 4 run as a saga, see createOrderSaga.
+func (u *orderUsecase) CreateOrder(ctx context.Context, req *domain.CreateOrderRequest) (string, error) {
+	if p, ok := auth.FromContext(ctx); ok {
+		switch {
+		case req.UserID == "":
+			req.UserID = p.Subject
+		case req.UserID != p.Subject && !p.Admin:
+			return "", fmt.Errorf("%w: orders can only be placed for yourself", ErrForbidden)
+		}
+	}
 	if req.UserID == "" {
 		return "", errors.New("user_id required")
 	}
-	if len(req.Items) == 0 {
-		return "", errors.New("items required")
+	quote, mismatches, err := u.priceItems(ctx, req.Items)
+	if err != nil {
+		return "", err
+	}
+	if len(mismatches) > 0 {
+		return "", &PriceChangedError{Mismatches: mismatches, Quote: quote}
 	}
 
-	// compute total (if price provided in items, use it; else 0)
-	var total int64
-	for _, it := range req.Items {
+	o := &domain.Order{
+		UserID:        req.UserID,
+		Items:         quote.Items,
+		Total:         quote.Total,
+		Status:        domain.StatusPending,
+		PaymentMethod: req.PaymentMethod,
+	}
+	return u.createOrderSaga(ctx, o)
+}
+
+// QuoteOrder prices items at current catalog prices without placing an order.
+func (u *orderUsecase) QuoteOrder(ctx context.Context, items []domain.OrderItem) (*domain.Quote, error) {
+	quote, _, err := u.priceItems(ctx, items)
+	return quote, err
+}
+
+// priceItems snapshots the catalog price of every item. Items that carry a
+// non-zero price different from the catalog are reported as mismatches. All
+// items of an order must be priced in the same currency.
+func (u *orderUsecase) priceItems(ctx context.Context, items []domain.OrderItem) (*domain.Quote, []domain.PriceMismatch, error) {
+	if len(items) == 0 {
+		return nil, nil, errors.New("items required")
+	}
+	ids := make([]string, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, it := range items {
 		if it.Quantity <= 0 {
-			return "", fmt.Errorf("invalid quantity for product %s", it.ProductID)
+			return nil, nil, fmt.Errorf("invalid quantity for product %s", it.ProductID)
+		}
+		if !seen[it.ProductID] {
+			seen[it.ProductID] = true
+			ids = append(ids, it.ProductID)
 		}
-		total += int64(it.Quantity) * it.PriceCents
 	}
 
-	// reserve stock via inventory (synchronous). We expect inventory to expose POST /products/reserve
-	reserve := reserveReq{}
-	for _, it := range req.Items {
-		reserve.Items = append(reserve.Items, reserveItem{
-			ProductID: it.ProductID,
-			Quantity:  it.Quantity,
-		})
-	}
-	body, _ := json.Marshal(reserve)
-	reserveURL := fmt.Sprintf("%s/products/reserve", u.inventoryURL) // e.g. http://inventory:8001/api/products/reserve
-	httpReq, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, reserveURL, bytes.NewReader(body))
-	httpReq.Header.Set("Content-Type", "application/json")
-	resp, err := u.httpClient.Do(httpReq)
+	prices, missing, err := u.fetchPrices(ctx, ids)
 	if err != nil {
-		// inventory unreachable — for assignment we treat as failure
-		return "", fmt.Errorf("inventory reserve failed: %w", err)
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		// failed to reserve
-		return "", ErrStockInsufficient
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownProduct, strings.Join(missing, ", "))
 	}
 
-	// build order entity
-	o := &domain.Order{
-		UserID:     req.UserID,
-		Items:      req.Items,
-		TotalCents: total,
-		Status:     domain.StatusPending,
-	}
-	id, err := u.repo.Create(o)
-	if err != nil {
-		// optionally revert reserve — omitted for simplicity
-		return "", err
+	quote := &domain.Quote{Items: make([]domain.OrderItem, 0, len(items))}
+	var mismatches []domain.PriceMismatch
+	for _, it := range items {
+		current, ok := prices[it.ProductID]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s", ErrUnknownProduct, it.ProductID)
+		}
+		if it.Price.Amount != 0 && (it.Price.Amount != current.Amount || !sameCurrency(it.Price, current)) {
+			mismatches = append(mismatches, domain.PriceMismatch{
+				ProductID: it.ProductID,
+				Expected:  it.Price,
+				Current:   current,
+			})
+		}
+		quote.Items = append(quote.Items, domain.OrderItem{
+			ProductID: it.ProductID,
+			Quantity:  it.Quantity,
+			Price:     current,
+		})
+		if quote.Total, err = quote.Total.Add(current.Times(it.Quantity)); err != nil {
+			return nil, nil, err
+		}
 	}
-	return id, nil
+	return quote, mismatches, nil
 }
 
-func (u *orderUsecase) GetOrder(id string) (*domain.Order, error) {
-	o, err := u.repo.GetByID(id)
+// sameCurrency treats a price sent without a currency as the catalog's.
+func sameCurrency(expected, current domain.Money) bool {
+	return expected.Currency == "" || strings.EqualFold(expected.Currency, current.Currency)
+}
+
+func (u *orderUsecase) GetOrder(ctx context.Context, id string, withHistory bool) (*domain.Order, error) {
+	o, err := u.repo.GetByID(ctx, id)
 	if err != nil {
 		if err == repository.ErrOrderNotFound {
 			return nil, ErrOrderNotFound
 		}
 		return nil, err
 	}
+	if !canAccess(ctx, o) {
+		return nil, ErrOrderNotFound
+	}
+	if !withHistory {
+		o.History = nil
+	}
 	return o, nil
 }
 
-func (u *orderUsecase) UpdateStatus(id string, status domain.OrderStatus) error {
-	// basic validation
-	if status != domain.StatusCancelled && status != domain.StatusCompleted && status != domain.StatusPending {
-		return errors.New("invalid status")
+// GetOrderHistory returns the order's status changes, oldest first. Orders
+// placed before history was kept start at their first later change.
+func (u *orderUsecase) GetOrderHistory(ctx context.Context, id string) ([]domain.StatusChange, error) {
+	o, err := u.GetOrder(ctx, id, true)
+	if err != nil {
+		return nil, err
 	}
-	if err := u.repo.UpdateStatus(id, status); err != nil {
-		if err == repository.ErrOrderNotFound {
-			return ErrOrderNotFound
+	if o.History == nil {
+		return []domain.StatusChange{}, nil
+	}
+	return o.History, nil
+}
+
+// UpdateStatus moves the order along the lifecycle in domain.CanTransition
+// and runs the side effects of the transition: paying captures the payment
+// and commits the stock hold, cancelling gives stock and money back and
+// refunding refunds whatever is left, see RefundOrder. It only succeeds
+// while the order is still at version, see domain.AnyVersion to skip the
+// check.
+func (u *orderUsecase) UpdateStatus(ctx context.Context, id string, change domain.StatusChange, version int64) error {
+	status := change.To
+	if !status.Valid() {
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, status)
+	}
+	o, err := u.GetOrder(ctx, id, false)
+	if err != nil {
+		return err
+	}
+	if version != domain.AnyVersion && o.Version != version {
+		return ErrVersionConflict
+	}
+	if p, ok := auth.FromContext(ctx); ok && !p.Admin && status != domain.StatusCancelled {
+		return fmt.Errorf("%w: only admins can move an order to %s", ErrForbidden, status)
+	}
+	if o.Status == status {
+		return nil
+	}
+	if status == domain.StatusPartiallyRefunded {
+		return fmt.Errorf("%w: partial refunds are made through the refunds API", ErrIllegalTransition)
+	}
+	if !domain.CanTransition(o.Status, status) {
+		return fmt.Errorf("%w: %s to %s", ErrIllegalTransition, o.Status, status)
+	}
+	change.From = o.Status
+	if change.Actor == "" {
+		change.Actor = domain.SystemActor
+	}
+	switch status {
+	case domain.StatusCancelled:
+		return u.cancelOrderSaga(ctx, o, change)
+	case domain.StatusPaid:
+		return u.payOrderSaga(ctx, o, change)
+	case domain.StatusCompleted:
+		// no-op unless the payment was somehow never captured
+		if err := u.capturePayment(ctx, o.ID); err != nil {
+			return err
 		}
+	case domain.StatusRefunded:
+		_, err := u.refund(ctx, o, &domain.RefundRequest{Reason: change.Reason}, change.Actor)
 		return err
 	}
-	return nil
+	change.At = time.Now().UTC()
+	return mapOrderErr(u.repo.UpdateStatus(ctx, id, change, o.Version))
+}
+
+func mapOrderErr(err error) error {
+	switch err {
+	case repository.ErrOrderNotFound:
+		return ErrOrderNotFound
+	case repository.ErrVersionConflict:
+		return ErrVersionConflict
+	default:
+		return err
+	}
+}
+
+func (u *orderUsecase) ListOrdersByUser(ctx context.Context, userID string, page, pageSize int64) ([]*domain.Order, int64, error) {
+	if p, ok := auth.FromContext(ctx); ok && !p.Admin && userID != p.Subject {
+		return nil, 0, fmt.Errorf("%w: only your own orders can be listed", ErrForbidden)
+	}
+	return u.repo.ListByUser(ctx, userID, page, pageSize)
 }
 
-func (u *orderUsecase) ListOrdersByUser(userID string, page, pageSize int64) ([]*domain.Order, int64, error) {
-	return u.repo.ListByUser(userID, page, pageSize)
+// canAccess reports whether the caller in ctx may see o: its owner and admins
+// may. Work the service starts itself has no caller and sees every order.
+func canAccess(ctx context.Context, o *domain.Order) bool {
+	p, ok := auth.FromContext(ctx)
+	return !ok || p.Admin || p.Subject == o.UserID
 }
@@ -0,0 +1,455 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/payment"
+	"github.com/Nurda-zh/a1/order-service/internal/repository"
+)
+
+// faults fails the next calls of a method, by name. A lost fault lets the
+// call take effect and only fails its answer.
+type faults struct {
+	next map[string][]fault
+}
+
+type fault struct {
+	err  error
+	lost bool
+}
+
+func (f *faults) failNext(method string, err error) {
+	if f.next == nil {
+		f.next = make(map[string][]fault)
+	}
+	f.next[method] = append(f.next[method], fault{err: err})
+}
+
+func (f *faults) loseNext(method string, err error) {
+	if f.next == nil {
+		f.next = make(map[string][]fault)
+	}
+	f.next[method] = append(f.next[method], fault{err: err, lost: true})
+}
+
+// skip lets the next call through untouched, to fail a later one.
+func (f *faults) skip(method string) {
+	f.loseNext(method, nil)
+}
+
+func (f *faults) run(method string, call func() error) error {
+	if queued := f.next[method]; len(queued) > 0 {
+		f.next[method] = queued[1:]
+		if !queued[0].lost {
+			return queued[0].err
+		}
+		if err := call(); err != nil {
+			return err
+		}
+		return queued[0].err
+	}
+	return call()
+}
+
+type memOrderRepo struct {
+	mu     sync.Mutex
+	faults faults
+	orders map[string]domain.Order
+	locks  map[string]string // saga holding each locked order
+	nextID int
+}
+
+func newMemOrderRepo() *memOrderRepo {
+	return &memOrderRepo{orders: make(map[string]domain.Order), locks: make(map[string]string)}
+}
+
+func (r *memOrderRepo) EnsureIndexes() error { return nil }
+
+func (r *memOrderRepo) NextID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	return fmt.Sprintf("order_%d", r.nextID)
+}
+
+func (r *memOrderRepo) Create(ctx context.Context, o *domain.Order) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.faults.run("Create", func() error {
+		now := time.Now().UTC()
+		o.CreatedAt, o.UpdatedAt, o.Version = now, now, 1
+		o.History = []domain.StatusChange{{To: o.Status, Actor: o.UserID, At: now}}
+		r.orders[o.ID] = *o
+		return nil
+	})
+	return o.ID, err
+}
+
+func (r *memOrderRepo) GetByID(ctx context.Context, id string) (*domain.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var o domain.Order
+	err := r.faults.run("GetByID", func() error {
+		var ok bool
+		if o, ok = r.orders[id]; !ok {
+			return repository.ErrOrderNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (r *memOrderRepo) UpdateStatus(ctx context.Context, id string, change domain.StatusChange, version int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.faults.run("UpdateStatus", func() error {
+		o, ok := r.orders[id]
+		if !ok {
+			return repository.ErrOrderNotFound
+		}
+		if (version != domain.AnyVersion && o.Version != version) || r.locks[id] != "" {
+			return repository.ErrVersionConflict
+		}
+		o.Status = change.To
+		o.History = append(o.History, change)
+		o.Version++
+		r.orders[id] = o
+		return nil
+	})
+}
+
+// status returns the order's status, or "" if it was never written.
+func (r *memOrderRepo) status(id string) domain.OrderStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.orders[id].Status
+}
+
+// lockedBy returns the saga holding the order's lock, or "".
+func (r *memOrderRepo) lockedBy(id string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.locks[id]
+}
+
+func (r *memOrderRepo) BeginEdit(ctx context.Context, id string, version int64, sagaID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.faults.run("BeginEdit", func() error {
+		o, ok := r.orders[id]
+		if !ok {
+			return repository.ErrOrderNotFound
+		}
+		if o.Version != version || o.Status != domain.StatusPending || r.locks[id] != "" {
+			return repository.ErrVersionConflict
+		}
+		o.Version++
+		r.orders[id] = o
+		r.locks[id] = sagaID
+		return nil
+	})
+}
+
+// locked applies change to an order locked by sagaID and unlocks it.
+func (r *memOrderRepo) locked(method, id, sagaID string, change func(o *domain.Order)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.faults.run(method, func() error {
+		o, ok := r.orders[id]
+		if !ok {
+			return repository.ErrOrderNotFound
+		}
+		if r.locks[id] != sagaID {
+			return repository.ErrVersionConflict
+		}
+		change(&o)
+		r.orders[id] = o
+		delete(r.locks, id)
+		return nil
+	})
+}
+
+func (r *memOrderRepo) FinishEdit(ctx context.Context, id, sagaID string, items []domain.OrderItem, total domain.Money) error {
+	return r.locked("FinishEdit", id, sagaID, func(o *domain.Order) {
+		o.Items, o.Total = items, total
+		o.Version++
+	})
+}
+
+func (r *memOrderRepo) FinishPay(ctx context.Context, id, sagaID string, change domain.StatusChange) error {
+	return r.locked("FinishPay", id, sagaID, func(o *domain.Order) {
+		o.Status = change.To
+		o.History = append(o.History, change)
+		o.Version++
+	})
+}
+
+func (r *memOrderRepo) AbortEdit(ctx context.Context, id, sagaID string) error {
+	err := r.locked("AbortEdit", id, sagaID, func(o *domain.Order) {})
+	if err == repository.ErrVersionConflict {
+		return nil
+	}
+	return err
+}
+
+func (r *memOrderRepo) ListByUser(ctx context.Context, userID string, page, pageSize int64) ([]*domain.Order, int64, error) {
+	return nil, 0, fmt.Errorf("memOrderRepo: ListByUser is not supported")
+}
+
+func (r *memOrderRepo) ListStalePending(ctx context.Context, placedBefore time.Time, limit int64) ([]*domain.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*domain.Order
+	err := r.faults.run("ListStalePending", func() error {
+		for id, o := range r.orders {
+			if o.Status == domain.StatusPending && o.CreatedAt.Before(placedBefore) && r.locks[id] == "" {
+				o := o
+				out = append(out, &o)
+			}
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+		if int64(len(out)) > limit {
+			out = out[:limit]
+		}
+		return nil
+	})
+	return out, err
+}
+
+// backdate moves the order's placement back by d.
+func (r *memOrderRepo) backdate(id string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o := r.orders[id]
+	o.CreatedAt = o.CreatedAt.Add(-d)
+	r.orders[id] = o
+}
+
+type memSagaRepo struct {
+	mu     sync.Mutex
+	faults faults
+	sagas  map[string]domain.Saga
+	nextID int
+}
+
+func newMemSagaRepo() *memSagaRepo {
+	return &memSagaRepo{sagas: make(map[string]domain.Saga)}
+}
+
+func (r *memSagaRepo) Create(ctx context.Context, s *domain.Saga) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.faults.run("Create", func() error {
+		r.nextID++
+		now := time.Now().UTC()
+		s.ID = fmt.Sprintf("saga_%d", r.nextID)
+		s.CreatedAt, s.UpdatedAt = now, now
+		r.sagas[s.ID] = *s
+		return nil
+	})
+}
+
+func (r *memSagaRepo) Save(ctx context.Context, s *domain.Saga) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.faults.run("Save", func() error {
+		s.UpdatedAt = time.Now().UTC()
+		r.sagas[s.ID] = *s
+		return nil
+	})
+}
+
+func (r *memSagaRepo) ListUnfinished(ctx context.Context, notUpdatedSince time.Time) ([]*domain.Saga, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*domain.Saga
+	for _, s := range r.sagas {
+		if (s.Status == domain.SagaRunning || s.Status == domain.SagaCompensating) && s.UpdatedAt.Before(notUpdatedSince) {
+			s := s
+			out = append(out, &s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+// byOrder returns the saga of type t for orderID as last saved.
+func (r *memSagaRepo) byOrder(orderID string, t domain.SagaType) (domain.Saga, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.sagas {
+		if s.OrderID == orderID && s.Type == t {
+			return s, true
+		}
+	}
+	return domain.Saga{}, false
+}
+
+// age moves every saga back by d, past the recovery grace.
+func (r *memSagaRepo) age(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, s := range r.sagas {
+		s.UpdatedAt = s.UpdatedAt.Add(-d)
+		r.sagas[id] = s
+	}
+}
+
+type memPaymentRepo struct {
+	mu       sync.Mutex
+	faults   faults
+	payments map[string]domain.Payment // by order id
+	nextID   int
+}
+
+func newMemPaymentRepo() *memPaymentRepo {
+	return &memPaymentRepo{payments: make(map[string]domain.Payment)}
+}
+
+func (r *memPaymentRepo) EnsureIndexes() error { return nil }
+
+func (r *memPaymentRepo) Create(ctx context.Context, p *domain.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.faults.run("Create", func() error {
+		r.nextID++
+		p.ID = fmt.Sprintf("pay_%d", r.nextID)
+		r.payments[p.OrderID] = *p
+		return nil
+	})
+}
+
+func (r *memPaymentRepo) GetByOrderID(ctx context.Context, orderID string) (*domain.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.payments[orderID]
+	if !ok {
+		return nil, repository.ErrPaymentNotFound
+	}
+	p.Attempts = append([]domain.PaymentAttempt(nil), p.Attempts...)
+	return &p, nil
+}
+
+func (r *memPaymentRepo) Save(ctx context.Context, p *domain.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.faults.run("Save", func() error {
+		if _, ok := r.payments[p.OrderID]; !ok {
+			return repository.ErrPaymentNotFound
+		}
+		r.payments[p.OrderID] = *p
+		return nil
+	})
+}
+
+// status returns the status of the order's payment, or "" if it has none.
+func (r *memPaymentRepo) status(orderID string) domain.PaymentStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.payments[orderID].Status
+}
+
+type memRefundRepo struct {
+	mu      sync.Mutex
+	refunds []domain.Refund
+	// onSave, when set, runs after each Save, e.g. to race another write
+	// against the refund
+	onSave func(rf domain.Refund)
+	// stale, when set, makes the next ListByOrder miss the newest refunds
+	stale int
+}
+
+func (r *memRefundRepo) EnsureIndexes() error { return nil }
+
+func (r *memRefundRepo) Create(ctx context.Context, rf *domain.Refund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.refunds {
+		if other.OrderID == rf.OrderID && other.Seq == rf.Seq {
+			return repository.ErrRefundConflict
+		}
+	}
+	rf.ID = fmt.Sprintf("refund_%d", len(r.refunds)+1)
+	r.refunds = append(r.refunds, *rf)
+	return nil
+}
+
+func (r *memRefundRepo) Save(ctx context.Context, rf *domain.Refund) error {
+	r.mu.Lock()
+	found := false
+	for i := range r.refunds {
+		if r.refunds[i].ID == rf.ID {
+			r.refunds[i] = *rf
+			found = true
+		}
+	}
+	onSave := r.onSave
+	r.mu.Unlock()
+	if !found {
+		return fmt.Errorf("refund %s not found", rf.ID)
+	}
+	if onSave != nil {
+		onSave(*rf)
+	}
+	return nil
+}
+
+func (r *memRefundRepo) ListByOrder(ctx context.Context, orderID string) ([]domain.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []domain.Refund
+	for _, rf := range r.refunds {
+		if rf.OrderID == orderID {
+			out = append(out, rf)
+		}
+	}
+	if r.stale > 0 {
+		out = out[:max(len(out)-r.stale, 0)]
+		r.stale = 0
+	}
+	return out, nil
+}
+
+// flakyProvider is payment.Fake with faults injected per call.
+type flakyProvider struct {
+	*payment.Fake
+	mu     sync.Mutex
+	faults faults
+}
+
+func (p *flakyProvider) Authorize(ctx context.Context, orderID, method string, amount domain.Money) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ref string
+	err := p.faults.run("Authorize", func() (err error) {
+		ref, err = p.Fake.Authorize(ctx, orderID, method, amount)
+		return err
+	})
+	return ref, err
+}
+
+func (p *flakyProvider) Capture(ctx context.Context, ref string, amount domain.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.faults.run("Capture", func() error { return p.Fake.Capture(ctx, ref, amount) })
+}
+
+func (p *flakyProvider) Void(ctx context.Context, ref string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.faults.run("Void", func() error { return p.Fake.Void(ctx, ref) })
+}
+
+func (p *flakyProvider) Refund(ctx context.Context, ref string, amount domain.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.faults.run("Refund", func() error { return p.Fake.Refund(ctx, ref, amount) })
+}
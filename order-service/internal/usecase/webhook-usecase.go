@@ -0,0 +1,210 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/repository"
+	"github.com/Nurda-zh/a1/pkg/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrWebhookNotFound    = errors.New("webhook subscription not found")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	ErrInvalidWebhook     = webhook.ErrInvalidSubscription
+)
+
+const (
+	// webhookBatchSize caps the deliveries one DeliverDue call sends.
+	webhookBatchSize = 50
+	// webhookLease hides a claimed delivery from other replicas while it is
+	// being sent.
+	webhookLease         = time.Minute
+	maxDeadLettersListed = 100
+)
+
+// webhookEventTypes are the event types a subscription may ask for.
+var webhookEventTypes = map[string]bool{
+	string(domain.EventOrderCreated):       true,
+	string(domain.EventOrderStatusChanged): true,
+	string(domain.EventOrderItemsUpdated):  true,
+}
+
+type WebhookUsecase interface {
+	CreateSubscription(ctx context.Context, req *domain.CreateWebhookRequest) (*domain.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id string) (*domain.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	ListDeadLetters(ctx context.Context, subscriptionID string) ([]domain.WebhookDelivery, error)
+	Redeliver(ctx context.Context, deadLetterID string) (*domain.WebhookDelivery, error)
+	// Enqueue queues e for every subscription that wants it.
+	Enqueue(ctx context.Context, e *domain.OutboxEvent) error
+	// DeliverDue sends the deliveries that are due and returns how many
+	// went through.
+	DeliverDue(ctx context.Context) (int, error)
+}
+
+type webhookUsecase struct {
+	repo        repository.WebhookRepo
+	sender      *webhook.Sender
+	maxAttempts int
+}
+
+// NewWebhookUsecase returns a usecase that gives up on a delivery after
+// maxAttempts failed attempts and moves it to the dead letters.
+func NewWebhookUsecase(r repository.WebhookRepo, sender *webhook.Sender, maxAttempts int) WebhookUsecase {
+	return &webhookUsecase{repo: r, sender: sender, maxAttempts: maxAttempts}
+}
+
+// CreateSubscription returns the subscription with its secret; later reads
+// leave the secret out.
+func (u *webhookUsecase) CreateSubscription(ctx context.Context, req *domain.CreateWebhookRequest) (*domain.WebhookSubscription, error) {
+	types, secret, err := webhook.CheckSubscription(req.URL, req.EventTypes, req.Secret, webhookEventTypes)
+	if err != nil {
+		return nil, err
+	}
+	s := &domain.WebhookSubscription{URL: req.URL, EventTypes: types, Secret: secret}
+	if err := u.repo.CreateSubscription(ctx, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (u *webhookUsecase) GetSubscription(ctx context.Context, id string) (*domain.WebhookSubscription, error) {
+	s, err := u.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, mapWebhookErr(err)
+	}
+	s.Secret = ""
+	return s, nil
+}
+
+func (u *webhookUsecase) ListSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	subs, err := u.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	return subs, nil
+}
+
+func (u *webhookUsecase) DeleteSubscription(ctx context.Context, id string) error {
+	return mapWebhookErr(u.repo.DeleteSubscription(ctx, id))
+}
+
+func (u *webhookUsecase) ListDeadLetters(ctx context.Context, subscriptionID string) ([]domain.WebhookDelivery, error) {
+	return u.repo.ListDeadLetters(ctx, subscriptionID, maxDeadLettersListed)
+}
+
+func (u *webhookUsecase) Redeliver(ctx context.Context, deadLetterID string) (*domain.WebhookDelivery, error) {
+	d, err := u.repo.Redeliver(ctx, deadLetterID)
+	return d, mapWebhookErr(err)
+}
+
+// Enqueue is safe to repeat for the same event, as the outbox relay does
+// after a failure.
+func (u *webhookUsecase) Enqueue(ctx context.Context, e *domain.OutboxEvent) error {
+	subs, err := u.repo.SubscriptionsFor(ctx, string(e.Type))
+	if err != nil || len(subs) == 0 {
+		return err
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	deliveries := make([]domain.WebhookDelivery, 0, len(subs))
+	for _, s := range subs {
+		deliveries = append(deliveries, domain.WebhookDelivery{
+			ID:             primitive.NewObjectID().Hex(),
+			SubscriptionID: s.ID,
+			EventID:        e.ID,
+			EventType:      string(e.Type),
+			Payload:        payload,
+			Status:         domain.DeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+	}
+	return u.repo.Enqueue(ctx, deliveries)
+}
+
+func (u *webhookUsecase) DeliverDue(ctx context.Context) (int, error) {
+	delivered := 0
+	for i := 0; i < webhookBatchSize; i++ {
+		d, err := u.repo.ClaimDue(ctx, time.Now().UTC(), webhookLease)
+		if err != nil {
+			return delivered, err
+		}
+		if d == nil {
+			break
+		}
+		if u.deliver(ctx, d) {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// deliver makes one attempt at d and records it: as delivered, for a retry
+// after webhook.Retry, or as a dead letter once maxAttempts ran out.
+func (u *webhookUsecase) deliver(ctx context.Context, d *domain.WebhookDelivery) bool {
+	d.Attempts++
+	s, err := u.repo.GetSubscription(ctx, d.SubscriptionID)
+	switch {
+	case errors.Is(err, repository.ErrWebhookNotFound):
+		d.LastError = "subscription was deleted"
+		d.Attempts = max(d.Attempts, u.maxAttempts)
+	case err != nil:
+		d.LastError = err.Error()
+	default:
+		d.LastStatusCode, err = u.sender.Send(ctx, s.URL, s.Secret, d.ID, d.EventType, d.Payload)
+		if err == nil {
+			now := time.Now().UTC()
+			d.Status = domain.DeliveryDelivered
+			d.DeliveredAt = &now
+			d.LastError = ""
+			u.saveAttempt(ctx, d)
+			return true
+		}
+		d.LastError = err.Error()
+	}
+
+	next, retry := webhook.Retry(d.Attempts, u.maxAttempts, time.Now().UTC())
+	if !retry {
+		log.Printf("webhook delivery %s: giving up after %d attempts: %s", d.ID, d.Attempts, d.LastError)
+		if err := u.repo.DeadLetter(ctx, d); err != nil {
+			log.Printf("webhook delivery %s: dead letter: %v", d.ID, err)
+		}
+		return false
+	}
+	d.NextAttemptAt = next
+	u.saveAttempt(ctx, d)
+	return false
+}
+
+func (u *webhookUsecase) saveAttempt(ctx context.Context, d *domain.WebhookDelivery) {
+	if err := u.repo.SaveAttempt(ctx, d); err != nil {
+		// the claim runs out and the delivery is sent again
+		log.Printf("webhook delivery %s: save attempt: %v", d.ID, err)
+	}
+}
+
+func mapWebhookErr(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrWebhookNotFound):
+		return ErrWebhookNotFound
+	case errors.Is(err, repository.ErrDeadLetterNotFound):
+		return ErrDeadLetterNotFound
+	default:
+		return err
+	}
+}
@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/domain"
+	"github.com/Nurda-zh/a1/order-service/internal/outbox"
+	"github.com/Nurda-zh/a1/order-service/internal/repository"
+)
+
+const (
+	outboxRelayLock = "outbox-relay"
+	// outboxLease is renewed while a batch is published, so a slow sink does
+	// not let a second replica publish the same orders out of order.
+	outboxLease      = 30 * time.Second
+	outboxBatchSize  = 100
+	outboxMinBackoff = time.Second
+	outboxMaxBackoff = 5 * time.Minute
+	// outboxPublishTimeout bounds publishing one event to all sinks.
+	outboxPublishTimeout = 10 * time.Second
+)
+
+// OutboxRelay publishes outbox events to its sinks, at least once and in Seq
+// order per order: an event waits while an earlier one of its order is still
+// unpublished. A failed event is retried with exponential backoff. Like the
+// stale order canceller only the replica holding the lock publishes.
+type OutboxRelay struct {
+	events   repository.OutboxRepo
+	locks    repository.LockRepo
+	sinks    []outbox.Sink
+	owner    string
+	interval time.Duration
+
+	leaseRenewed time.Time
+}
+
+func NewOutboxRelay(events repository.OutboxRepo, locks repository.LockRepo, sinks []outbox.Sink, owner string, interval time.Duration) *OutboxRelay {
+	return &OutboxRelay{events: events, locks: locks, sinks: sinks, owner: owner, interval: interval}
+}
+
+// Run blocks until ctx is cancelled, then hands the lock over.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	defer func() {
+		if err := r.locks.Release(context.WithoutCancel(ctx), outboxRelayLock, r.owner); err != nil {
+			log.Printf("outbox relay: release lock: %v", err)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.relay(ctx)
+		}
+	}
+}
+
+func (r *OutboxRelay) relay(ctx context.Context) {
+	if !r.renewLease(ctx) {
+		return
+	}
+	now := time.Now().UTC()
+	events, err := r.events.ListDue(ctx, now, outboxBatchSize)
+	if err != nil {
+		log.Printf("outbox relay: %v", err)
+		return
+	}
+	// orders with an event that could not go out in this pass
+	blocked := map[string]bool{}
+	for i := range events {
+		e := &events[i]
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(r.leaseRenewed) > outboxLease/2 && !r.renewLease(ctx) {
+			return
+		}
+		if blocked[e.OrderID] {
+			continue
+		}
+		earlier, err := r.events.HasEarlierPending(ctx, e.OrderID, e.Seq)
+		if err != nil {
+			log.Printf("outbox relay: event %s: %v", e.ID, err)
+			blocked[e.OrderID] = true
+			continue
+		}
+		if earlier {
+			blocked[e.OrderID] = true
+			continue
+		}
+		if err := r.publish(ctx, e); err != nil {
+			blocked[e.OrderID] = true
+			attempts := e.Attempts + 1
+			next := time.Now().UTC().Add(backoff(attempts))
+			log.Printf("outbox relay: event %s (%s, order %s) attempt %d: %v", e.ID, e.Type, e.OrderID, attempts, err)
+			if err := r.events.MarkFailed(ctx, e.ID, attempts, next, err.Error()); err != nil {
+				log.Printf("outbox relay: event %s: %v", e.ID, err)
+			}
+			continue
+		}
+		if err := r.events.MarkPublished(ctx, e.ID, time.Now().UTC()); err != nil {
+			// published again on the next pass; that is what at least once means
+			log.Printf("outbox relay: event %s: %v", e.ID, err)
+			blocked[e.OrderID] = true
+		}
+	}
+}
+
+// publish hands e to every sink. If one fails the event is retried on all of
+// them.
+func (r *OutboxRelay) publish(ctx context.Context, e *domain.OutboxEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, outboxPublishTimeout)
+	defer cancel()
+	for _, s := range r.sinks {
+		if err := s.Publish(ctx, e); err != nil {
+			return fmt.Errorf("%s: %w", s.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (r *OutboxRelay) renewLease(ctx context.Context) bool {
+	leader, err := r.locks.Acquire(ctx, outboxRelayLock, r.owner, outboxLease)
+	if err != nil {
+		log.Printf("outbox relay: acquire lock: %v", err)
+		return false
+	}
+	if leader {
+		r.leaseRenewed = time.Now()
+	}
+	return leader
+}
+
+// backoff doubles the wait after every failed attempt, up to
+// outboxMaxBackoff.
+func backoff(attempts int) time.Duration {
+	d := outboxMinBackoff
+	for i := 1; i < attempts && d < outboxMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, outboxMaxBackoff)
+}
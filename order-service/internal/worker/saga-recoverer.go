@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/repository"
+	"github.com/Nurda-zh/a1/order-service/internal/usecase"
+)
+
+const sagaRecoveryLock = "saga-recovery"
+
+// SagaRecoverer periodically finishes or compensates sagas left behind by a
+// crashed replica. Like StaleOrderCanceller only the lock holder works, so
+// two replicas never drive the same saga at once.
+type SagaRecoverer struct {
+	uc       usecase.OrderUsecase
+	locks    repository.LockRepo
+	owner    string
+	interval time.Duration
+}
+
+func NewSagaRecoverer(uc usecase.OrderUsecase, locks repository.LockRepo, owner string, interval time.Duration) *SagaRecoverer {
+	return &SagaRecoverer{uc: uc, locks: locks, owner: owner, interval: interval}
+}
+
+// Run blocks until ctx is cancelled, then hands the lock over. The first
+// pass runs right away.
+func (s *SagaRecoverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	defer func() {
+		if err := s.locks.Release(context.WithoutCancel(ctx), sagaRecoveryLock, s.owner); err != nil {
+			log.Printf("saga recovery: release lock: %v", err)
+		}
+	}()
+	for {
+		s.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *SagaRecoverer) tick(ctx context.Context) {
+	lease := 3 * s.interval
+	leader, err := s.locks.Acquire(ctx, sagaRecoveryLock, s.owner, lease)
+	if err != nil {
+		log.Printf("saga recovery: acquire lock: %v", err)
+		return
+	}
+	if !leader {
+		return
+	}
+	// stop picking up sagas well before the lease can run out under us
+	ctx, cancel := context.WithTimeout(ctx, lease/2)
+	defer cancel()
+	if err := s.uc.RecoverSagas(ctx); err != nil {
+		log.Printf("saga recovery: %v", err)
+	}
+}
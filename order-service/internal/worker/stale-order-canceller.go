@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/repository"
+	"github.com/Nurda-zh/a1/order-service/internal/usecase"
+)
+
+// staleOrderLock names the lock replicas compete for; only its holder runs
+// the job.
+const staleOrderLock = "stale-order-canceller"
+
+// StaleOrderCanceller periodically cancels orders left pending for longer
+// than maxAge. Every replica runs one, but only the replica holding the lock
+// does the work; the lease outlives a few intervals so a crashed leader is
+// replaced soon after.
+type StaleOrderCanceller struct {
+	uc       usecase.OrderUsecase
+	locks    repository.LockRepo
+	owner    string
+	maxAge   time.Duration
+	interval time.Duration
+}
+
+func NewStaleOrderCanceller(uc usecase.OrderUsecase, locks repository.LockRepo, owner string, maxAge, interval time.Duration) *StaleOrderCanceller {
+	return &StaleOrderCanceller{uc: uc, locks: locks, owner: owner, maxAge: maxAge, interval: interval}
+}
+
+// Run blocks until ctx is cancelled, then hands the lock over.
+func (s *StaleOrderCanceller) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	defer func() {
+		if err := s.locks.Release(context.WithoutCancel(ctx), staleOrderLock, s.owner); err != nil {
+			log.Printf("stale order canceller: release lock: %v", err)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.tick(ctx)
+		}
+	}
+}
+
+func (s *StaleOrderCanceller) tick(ctx context.Context) {
+	leader, err := s.locks.Acquire(ctx, staleOrderLock, s.owner, 3*s.interval)
+	if err != nil {
+		log.Printf("stale order canceller: acquire lock: %v", err)
+		return
+	}
+	if !leader {
+		return
+	}
+	n, err := s.uc.CancelStaleOrders(ctx, s.maxAge)
+	if err != nil {
+		log.Printf("stale order canceller: %v", err)
+	}
+	if n > 0 {
+		log.Printf("stale order canceller: cancelled %d stale orders", n)
+	}
+}
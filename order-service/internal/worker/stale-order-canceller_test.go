@@ -0,0 +1,165 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nurda-zh/a1/order-service/internal/usecase"
+)
+
+// leases is an in-memory LockRepo on a clock the test moves by hand.
+type leases struct {
+	mu    sync.Mutex
+	now   time.Time
+	held  map[string]lease
+	ttls  []time.Duration
+	err   error
+	freed []string
+}
+
+type lease struct {
+	owner   string
+	expires time.Time
+}
+
+func newLeases() *leases {
+	return &leases{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), held: make(map[string]lease)}
+}
+
+func (l *leases) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return false, l.err
+	}
+	l.ttls = append(l.ttls, ttl)
+	if cur, ok := l.held[name]; ok && cur.owner != owner && l.now.Before(cur.expires) {
+		return false, nil
+	}
+	l.held[name] = lease{owner: owner, expires: l.now.Add(ttl)}
+	return true, nil
+}
+
+func (l *leases) Release(ctx context.Context, name, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[name].owner == owner {
+		delete(l.held, name)
+	}
+	l.freed = append(l.freed, owner)
+	return nil
+}
+
+func (l *leases) advance(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = l.now.Add(d)
+}
+
+// countingCancels counts CancelStaleOrders calls; the other methods are not
+// used.
+type countingCancels struct {
+	usecase.OrderUsecase
+	mu     sync.Mutex
+	calls  int
+	maxAge time.Duration
+}
+
+func (u *countingCancels) CancelStaleOrders(ctx context.Context, maxAge time.Duration) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.calls++
+	u.maxAge = maxAge
+	return 1, nil
+}
+
+func (u *countingCancels) count() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.calls
+}
+
+func TestStaleOrderCancellerRunsOnTheLeaderOnly(t *testing.T) {
+	locks := newLeases()
+	uc := &countingCancels{}
+	a := NewStaleOrderCanceller(uc, locks, "a", time.Hour, time.Minute)
+	b := NewStaleOrderCanceller(uc, locks, "b", time.Hour, time.Minute)
+	ctx := context.Background()
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		replica *StaleOrderCanceller
+		calls   int
+	}{
+		{"first to ask leads", 0, a, 1},
+		{"the other waits", 0, b, 1},
+		{"the leader renews its lease", 2 * time.Minute, a, 2},
+		{"a renewed lease still holds", 2 * time.Minute, b, 2},
+		{"a lapsed lease is taken over", 3 * time.Minute, b, 3},
+		{"the old leader now waits", 0, a, 3},
+	}
+	for _, s := range steps {
+		locks.advance(s.advance)
+		s.replica.tick(ctx)
+		if got := uc.count(); got != s.calls {
+			t.Fatalf("%s: %d runs, want %d", s.name, got, s.calls)
+		}
+	}
+	if uc.maxAge != time.Hour {
+		t.Errorf("maxAge = %v, want %v", uc.maxAge, time.Hour)
+	}
+	for _, ttl := range locks.ttls {
+		if ttl != 3*time.Minute {
+			t.Fatalf("lease ttl = %v, want three intervals", ttl)
+		}
+	}
+}
+
+func TestStaleOrderCancellerHandsTheLockOverOnStop(t *testing.T) {
+	locks := newLeases()
+	uc := &countingCancels{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewStaleOrderCanceller(uc, locks, "a", time.Hour, time.Millisecond).Run(ctx)
+		close(done)
+	}()
+	deadline := time.After(time.Second)
+	for uc.count() == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("the canceller never ran")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if len(locks.freed) != 1 || locks.freed[0] != "a" {
+		t.Fatalf("released by %v, want a", locks.freed)
+	}
+
+	// the lease has not run out, yet the next replica takes over at once
+	before := uc.count()
+	NewStaleOrderCanceller(uc, locks, "b", time.Hour, time.Millisecond).tick(context.Background())
+	if uc.count() != before+1 {
+		t.Error("b did not take over the released lock")
+	}
+}
+
+func TestStaleOrderCancellerSkipsWorkWithoutTheLock(t *testing.T) {
+	locks := newLeases()
+	locks.err = errors.New("connection reset")
+	uc := &countingCancels{}
+	NewStaleOrderCanceller(uc, locks, "a", time.Hour, time.Minute).tick(context.Background())
+	if got := uc.count(); got != 0 {
+		t.Errorf("%d runs without the lock, want 0", got)
+	}
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// leeway absorbs clock skew between the token issuer and the service.
+const leeway = 30 * time.Second
+
+// Config says which tokens a Verifier accepts. Issuer and Audience are only
+// checked when set.
+type Config struct {
+	Keys      *KeySet
+	Issuer    string
+	Audience  string
+	AdminRole string
+}
+
+// Verifier checks compact JWS tokens signed with HS256 or RS256.
+type Verifier struct {
+	cfg Config
+	now func() time.Time
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	if cfg.Keys == nil || cfg.Keys.Empty() {
+		return nil, errors.New("no token signing keys configured")
+	}
+	return &Verifier{cfg: cfg, now: time.Now}, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// audience is the aud claim, which may be a string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+type claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+	Roles     []string `json:"roles"`
+}
+
+// Verify checks token's signature and claims and returns the caller it
+// names. Tokens must carry sub and exp.
+func (v *Verifier) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	if !v.signedBy(h, parts[0]+"."+parts[1], sig) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	now := v.now()
+	switch {
+	case c.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	case c.ExpiresAt == nil:
+		return nil, fmt.Errorf("%w: no expiry", ErrInvalidToken)
+	case now.After(time.Unix(*c.ExpiresAt, 0).Add(leeway)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case c.NotBefore != nil && now.Add(leeway).Before(time.Unix(*c.NotBefore, 0)):
+		return nil, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	case v.cfg.Issuer != "" && c.Issuer != v.cfg.Issuer:
+		return nil, fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	case v.cfg.Audience != "" && !contains(c.Audience, v.cfg.Audience):
+		return nil, fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	}
+	p := &Principal{Subject: c.Subject, Roles: c.Roles}
+	p.Admin = v.cfg.AdminRole != "" && p.HasRole(v.cfg.AdminRole)
+	return p, nil
+}
+
+// signedBy reports whether a trusted key of the header's algorithm signed
+// signed. The algorithm must match the key's, so an RSA public key is never
+// used as an HMAC secret.
+func (v *Verifier) signedBy(h header, signed string, sig []byte) bool {
+	if h.Alg != algHS256 && h.Alg != algRS256 {
+		return false
+	}
+	digest := sha256.Sum256([]byte(signed))
+	for _, k := range v.cfg.Keys.candidates(h.Alg, h.Kid) {
+		switch k.alg {
+		case algHS256:
+			mac := hmac.New(sha256.New, k.secret)
+			mac.Write([]byte(signed))
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return true
+			}
+		case algRS256:
+			if rsa.VerifyPKCS1v15(k.public, crypto.SHA256, digest[:], sig) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, out interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testNow    = time.Unix(1_700_000_000, 0)
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+	rsaOnce sync.Once
+	rsaKeys [3]*rsa.PrivateKey
+)
+
+// rsaKey returns one of three RSA keys shared by the tests.
+func rsaKey(t *testing.T, i int) *rsa.PrivateKey {
+	t.Helper()
+	rsaOnce.Do(func() {
+		for j := range rsaKeys {
+			k, err := rsa.GenerateKey(rand.Reader, minRSABits)
+			if err != nil {
+				panic(err)
+			}
+			rsaKeys[j] = k
+		}
+	})
+	return rsaKeys[i]
+}
+
+func segment(t *testing.T, v interface{}) string {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// sign builds a token with the given header and claims. key is an HMAC
+// secret, an RSA private key or nil for an empty signature.
+func sign(t *testing.T, hdr map[string]string, c map[string]interface{}, key interface{}) string {
+	t.Helper()
+	signed := segment(t, hdr) + "." + segment(t, c)
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// goodClaims is valid for a verifier from newTestVerifier at testNow.
+func goodClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   "u1",
+		"iss":   "issuer",
+		"aud":   "orders",
+		"exp":   testNow.Add(time.Hour).Unix(),
+		"roles": []string{"admin"},
+	}
+}
+
+func with(c map[string]interface{}, k string, v interface{}) map[string]interface{} {
+	if v == nil {
+		delete(c, k)
+	} else {
+		c[k] = v
+	}
+	return c
+}
+
+func writePublicPEM(t *testing.T, pub *rsa.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, "key.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func writeFile(t *testing.T, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestVerifier trusts testSecret and RSA key 0 and checks issuer,
+// audience "orders" and the admin role.
+func newTestVerifier(t *testing.T, keys *KeySet) *Verifier {
+	t.Helper()
+	if keys == nil {
+		keys = &KeySet{}
+		keys.AddHS256(testSecret)
+		if err := keys.AddRS256PEMFile(writePublicPEM(t, &rsaKey(t, 0).PublicKey)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v, err := NewVerifier(Config{Keys: keys, Issuer: "issuer", Audience: "orders", AdminRole: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return testNow }
+	return v
+}
+
+var (
+	hs = map[string]string{"alg": "HS256", "typ": "JWT"}
+	rs = map[string]string{"alg": "RS256", "typ": "JWT"}
+)
+
+func TestVerify(t *testing.T) {
+	v := newTestVerifier(t, nil)
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		// want is part of the error message, "" for a valid token
+		want string
+	}{
+		{
+			name:  "HS256",
+			token: func(t *testing.T) string { return sign(t, hs, goodClaims(), testSecret) },
+		},
+		{
+			name:  "RS256",
+			token: func(t *testing.T) string { return sign(t, rs, goodClaims(), rsaKey(t, 0)) },
+		},
+		{
+			name:  "alg none",
+			token: func(t *testing.T) string { return sign(t, map[string]string{"alg": "none"}, goodClaims(), nil) },
+			want:  "bad signature",
+		},
+		{
+			name: "alg none with a signature",
+			token: func(t *testing.T) string {
+				return sign(t, map[string]string{"alg": "none"}, goodClaims(), testSecret)
+			},
+			want: "bad signature",
+		},
+		{
+			name:  "alg in other case",
+			token: func(t *testing.T) string { return sign(t, map[string]string{"alg": "hs256"}, goodClaims(), testSecret) },
+			want:  "bad signature",
+		},
+		{
+			name:  "HS256 signed with another secret",
+			token: func(t *testing.T) string { return sign(t, hs, goodClaims(), []byte("guess")) },
+			want:  "bad signature",
+		},
+		{
+			name:  "RS256 signed with an untrusted key",
+			token: func(t *testing.T) string { return sign(t, rs, goodClaims(), rsaKey(t, 1)) },
+			want:  "bad signature",
+		},
+		{
+			name: "RS256 header on an HMAC signature",
+			token: func(t *testing.T) string {
+				return sign(t, rs, goodClaims(), testSecret)
+			},
+			want: "bad signature",
+		},
+		{
+			name: "tampered claims",
+			token: func(t *testing.T) string {
+				parts := strings.Split(sign(t, hs, goodClaims(), testSecret), ".")
+				parts[1] = segment(t, with(goodClaims(), "sub", "u2"))
+				return strings.Join(parts, ".")
+			},
+			want: "bad signature",
+		},
+		{
+			name: "tampered header",
+			token: func(t *testing.T) string {
+				parts := strings.Split(sign(t, rs, goodClaims(), rsaKey(t, 0)), ".")
+				parts[0] = segment(t, map[string]string{"alg": "RS256", "kid": "other"})
+				return strings.Join(parts, ".")
+			},
+			want: "bad signature",
+		},
+		{
+			name: "tampered signature",
+			token: func(t *testing.T) string {
+				parts := strings.Split(sign(t, hs, goodClaims(), testSecret), ".")
+				sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+				sig[0] ^= 1
+				parts[2] = base64.RawURLEncoding.EncodeToString(sig)
+				return strings.Join(parts, ".")
+			},
+			want: "bad signature",
+		},
+		{
+			name:  "two segments",
+			token: func(t *testing.T) string { return segment(t, hs) + "." + segment(t, goodClaims()) },
+			want:  "malformed",
+		},
+		{
+			name:  "claims not JSON",
+			token: func(t *testing.T) string { return signRaw(t, hs, "not json", testSecret) },
+			want:  "claims",
+		},
+		{
+			name:  "no subject",
+			token: func(t *testing.T) string { return sign(t, hs, with(goodClaims(), "sub", nil), testSecret) },
+			want:  "no subject",
+		},
+		{
+			name:  "no expiry",
+			token: func(t *testing.T) string { return sign(t, hs, with(goodClaims(), "exp", nil), testSecret) },
+			want:  "no expiry",
+		},
+		{
+			name: "expired within leeway",
+			token: func(t *testing.T) string {
+				return sign(t, hs, with(goodClaims(), "exp", testNow.Add(-leeway).Unix()), testSecret)
+			},
+		},
+		{
+			name: "expired past leeway",
+			token: func(t *testing.T) string {
+				return sign(t, hs, with(goodClaims(), "exp", testNow.Add(-leeway-time.Second).Unix()), testSecret)
+			},
+			want: "expired",
+		},
+		{
+			name: "not before within leeway",
+			token: func(t *testing.T) string {
+				return sign(t, hs, with(goodClaims(), "nbf", testNow.Add(leeway).Unix()), testSecret)
+			},
+		},
+		{
+			name: "not before past leeway",
+			token: func(t *testing.T) string {
+				return sign(t, hs, with(goodClaims(), "nbf", testNow.Add(leeway+time.Second).Unix()), testSecret)
+			},
+			want: "not valid yet",
+		},
+		{
+			name:  "wrong issuer",
+			token: func(t *testing.T) string { return sign(t, hs, with(goodClaims(), "iss", "other"), testSecret) },
+			want:  "wrong issuer",
+		},
+		{
+			name: "audience list",
+			token: func(t *testing.T) string {
+				return sign(t, hs, with(goodClaims(), "aud", []string{"billing", "orders"}), testSecret)
+			},
+		},
+		{
+			name:  "wrong audience",
+			token: func(t *testing.T) string { return sign(t, hs, with(goodClaims(), "aud", "billing"), testSecret) },
+			want:  "wrong audience",
+		},
+		{
+			name: "audience list without ours",
+			token: func(t *testing.T) string {
+				return sign(t, hs, with(goodClaims(), "aud", []string{"billing"}), testSecret)
+			},
+			want: "wrong audience",
+		},
+		{
+			name:  "no audience",
+			token: func(t *testing.T) string { return sign(t, hs, with(goodClaims(), "aud", nil), testSecret) },
+			want:  "wrong audience",
+		},
+		{
+			name:  "audience not a string",
+			token: func(t *testing.T) string { return sign(t, hs, with(goodClaims(), "aud", 42), testSecret) },
+			want:  "claims",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Verify(tt.token(t))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				if p.Subject != "u1" || !p.Admin {
+					t.Errorf("principal = %+v", p)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func signRaw(t *testing.T, hdr map[string]string, claims string, secret []byte) string {
+	t.Helper()
+	signed := segment(t, hdr) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// A verifier that only trusts an RSA key must not take its public key as an
+// HMAC secret, whichever encoding an attacker picks.
+func TestRejectsAlgorithmConfusion(t *testing.T) {
+	pub := &rsaKey(t, 0).PublicKey
+	path := writePublicPEM(t, pub)
+	keys := &KeySet{}
+	if err := keys.AddRS256PEMFile(path); err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVerifier(t, keys)
+
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := map[string][]byte{
+		"PEM":     pemBytes,
+		"PKIX":    der,
+		"PKCS1":   x509.MarshalPKCS1PublicKey(pub),
+		"modulus": pub.N.Bytes(),
+	}
+	for name, secret := range secrets {
+		t.Run(name, func(t *testing.T) {
+			if _, err := v.Verify(sign(t, hs, goodClaims(), secret)); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestPrincipalWithoutAdminRole(t *testing.T) {
+	v := newTestVerifier(t, nil)
+	p, err := v.Verify(sign(t, hs, with(goodClaims(), "roles", []string{"customer"}), testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Admin || !p.HasRole("customer") {
+		t.Errorf("principal = %+v", p)
+	}
+}
+
+func TestNewVerifierNeedsKeys(t *testing.T) {
+	for _, keys := range []*KeySet{nil, {}} {
+		if _, err := NewVerifier(Config{Keys: keys}); err == nil {
+			t.Errorf("NewVerifier(%v) succeeded", keys)
+		}
+	}
+}
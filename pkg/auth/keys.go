@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+const (
+	algHS256 = "HS256"
+	algRS256 = "RS256"
+)
+
+// key is a key tokens may be signed with. id is empty for keys that did not
+// come from a JWKS; they are tried for any token of their algorithm.
+type key struct {
+	id     string
+	alg    string
+	secret []byte         // HS256
+	public *rsa.PublicKey // RS256
+}
+
+// KeySet holds the keys a Verifier trusts.
+type KeySet struct {
+	keys []key
+}
+
+// AddHS256 trusts tokens signed with the shared secret.
+func (s *KeySet) AddHS256(secret []byte) {
+	s.keys = append(s.keys, key{alg: algHS256, secret: secret})
+}
+
+// AddRS256PEMFile trusts tokens signed with the private half of the RSA public
+// key in path, given as PKIX or PKCS #1 PEM or as a certificate.
+func (s *KeySet) AddRS256PEMFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return fmt.Errorf("%s: no PEM block", path)
+	}
+	var pub interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			pub = cert.PublicKey
+		}
+	default:
+		return fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	rsaKey, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%s: not an RSA public key", path)
+	}
+	if err := checkRSA(rsaKey); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	s.keys = append(s.keys, key{alg: algRS256, public: rsaKey})
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// AddJWKSFile trusts the signing keys of the JSON Web Key Set in path: RSA
+// keys for RS256 and symmetric (oct) keys for HS256. Encryption keys and keys
+// for other algorithms are skipped.
+func (s *KeySet) AddJWKSFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var added []key
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA" && (k.Alg == "" || k.Alg == algRS256):
+			pub, err := rsaFromJWK(k)
+			if err != nil {
+				return fmt.Errorf("%s: key %q: %w", path, k.Kid, err)
+			}
+			added = append(added, key{id: k.Kid, alg: algRS256, public: pub})
+		case k.Kty == "oct" && (k.Alg == "" || k.Alg == algHS256):
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) == 0 {
+				return fmt.Errorf("%s: key %q: bad k", path, k.Kid)
+			}
+			added = append(added, key{id: k.Kid, alg: algHS256, secret: secret})
+		}
+	}
+	if len(added) == 0 {
+		return fmt.Errorf("%s: no usable signing keys", path)
+	}
+	s.keys = append(s.keys, added...)
+	return nil
+}
+
+func rsaFromJWK(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("bad n")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("bad e")
+	}
+	exp := 0
+	for _, b := range e {
+		exp = exp<<8 | int(b)
+	}
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}
+	return pub, checkRSA(pub)
+}
+
+// minRSABits is the smallest modulus RS256 allows, see RFC 7518 section 3.3.
+const minRSABits = 2048
+
+func checkRSA(pub *rsa.PublicKey) error {
+	if pub.N.BitLen() < minRSABits {
+		return fmt.Errorf("bad n: RSA keys must have at least %d bits", minRSABits)
+	}
+	if pub.E < 3 || pub.E%2 == 0 {
+		return errors.New("bad e")
+	}
+	return nil
+}
+
+// candidates returns the keys of alg that may have signed a token naming kid:
+// the JWKS key with that id and any key without one.
+func (s *KeySet) candidates(alg, kid string) []key {
+	var out []key
+	for _, k := range s.keys {
+		if k.alg != alg {
+			continue
+		}
+		if kid != "" && k.id != "" && k.id != kid {
+			continue
+		}
+		out = append(out, k)
+	}
+	return out
+}
+
+func (s *KeySet) Empty() bool {
+	return len(s.keys) == 0
+}
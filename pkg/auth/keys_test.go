@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rsaJWK(kid string, pub *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func writeJWKS(t *testing.T, keys ...map[string]string) string {
+	t.Helper()
+	raw, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, "jwks.json", raw)
+}
+
+// Tokens naming a kid are checked against the JWKS key with that id and keys
+// that have none; tokens without a kid against every key of their algorithm.
+func TestKeySelectionByKid(t *testing.T) {
+	keys := &KeySet{}
+	if err := keys.AddJWKSFile(writeJWKS(t,
+		rsaJWK("k1", &rsaKey(t, 0).PublicKey),
+		rsaJWK("k2", &rsaKey(t, 1).PublicKey),
+		map[string]string{"kty": "oct", "kid": "h1", "k": base64.RawURLEncoding.EncodeToString(testSecret)},
+	)); err != nil {
+		t.Fatal(err)
+	}
+	// a key from a PEM file has no id
+	if err := keys.AddRS256PEMFile(writePublicPEM(t, &rsaKey(t, 2).PublicKey)); err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVerifier(t, keys)
+
+	tests := []struct {
+		name string
+		alg  string
+		kid  string
+		key  interface{}
+		ok   bool
+	}{
+		{name: "kid of its key", alg: "RS256", kid: "k1", key: rsaKey(t, 0), ok: true},
+		{name: "other JWKS key", alg: "RS256", kid: "k2", key: rsaKey(t, 1), ok: true},
+		{name: "kid of another key", alg: "RS256", kid: "k2", key: rsaKey(t, 0)},
+		{name: "unknown kid", alg: "RS256", kid: "k9", key: rsaKey(t, 0)},
+		{name: "no kid", alg: "RS256", key: rsaKey(t, 1), ok: true},
+		{name: "key without id under any kid", alg: "RS256", kid: "k1", key: rsaKey(t, 2), ok: true},
+		{name: "key without id and no kid", alg: "RS256", key: rsaKey(t, 2), ok: true},
+		{name: "oct key by kid", alg: "HS256", kid: "h1", key: testSecret, ok: true},
+		{name: "oct key under an RSA kid", alg: "HS256", kid: "k1", key: testSecret},
+		{name: "RSA kid on the oct key", alg: "RS256", kid: "h1", key: rsaKey(t, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr := map[string]string{"alg": tt.alg}
+			if tt.kid != "" {
+				hdr["kid"] = tt.kid
+			}
+			_, err := v.Verify(sign(t, hdr, goodClaims(), tt.key))
+			if tt.ok && err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestAddJWKSFile(t *testing.T) {
+	good := rsaJWK("k1", &rsaKey(t, 0).PublicKey)
+	changed := func(k, v string) map[string]string {
+		out := map[string]string{}
+		for key, val := range good {
+			out[key] = val
+		}
+		out[k] = v
+		return out
+	}
+	short, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		keys []map[string]string
+		// want is part of the error, "" when the set loads
+		want string
+	}{
+		{name: "RSA key", keys: []map[string]string{good}},
+		{name: "encryption keys skipped", keys: []map[string]string{good, changed("use", "enc")}},
+		{name: "only encryption keys", keys: []map[string]string{changed("use", "enc")}, want: "no usable signing keys"},
+		{name: "other algorithm skipped", keys: []map[string]string{changed("alg", "RS512")}, want: "no usable signing keys"},
+		{name: "e missing", keys: []map[string]string{changed("e", "")}, want: "bad e"},
+		{name: "e not base64url", keys: []map[string]string{changed("e", "AQ+B")}, want: "bad e"},
+		{name: "e too long", keys: []map[string]string{changed("e", "AQEBAQE")}, want: "bad e"},
+		{name: "e of one", keys: []map[string]string{changed("e", "AQ")}, want: "bad e"},
+		{name: "e even", keys: []map[string]string{changed("e", "AQAA")}, want: "bad e"},
+		{name: "n missing", keys: []map[string]string{changed("n", "")}, want: "bad n"},
+		{name: "n not base64url", keys: []map[string]string{changed("n", "!!")}, want: "bad n"},
+		{name: "n too short", keys: []map[string]string{rsaJWK("k1", &short.PublicKey)}, want: "bad n"},
+		{name: "oct key without k", keys: []map[string]string{{"kty": "oct", "kid": "h1"}}, want: "bad k"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := &KeySet{}
+			err := keys.AddJWKSFile(writeJWKS(t, tt.keys...))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+			if !keys.Empty() {
+				t.Error("keys added from a rejected set")
+			}
+		})
+	}
+}
+
+func TestAddRS256PEMFile(t *testing.T) {
+	key := rsaKey(t, 0)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "issuer"},
+		NotBefore:    testNow,
+		NotAfter:     testNow.Add(time.Hour),
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "issuer"}}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalPKIXPublicKey(&ec.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	short, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		block *pem.Block
+		want  string
+	}{
+		{name: "PKIX", block: &pem.Block{Type: "PUBLIC KEY", Bytes: der}},
+		{name: "PKCS1", block: &pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}},
+		{name: "certificate", block: &pem.Block{Type: "CERTIFICATE", Bytes: cert}},
+		{name: "no PEM", want: "no PEM block"},
+		{name: "private key", block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}, want: "unsupported PEM block"},
+		{name: "EC key", block: &pem.Block{Type: "PUBLIC KEY", Bytes: ecDER}, want: "not an RSA public key"},
+		{name: "short key", block: &pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&short.PublicKey)}, want: "bad n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := []byte("not a key")
+			if tt.block != nil {
+				content = pem.EncodeToMemory(tt.block)
+			}
+			keys := &KeySet{}
+			err := keys.AddRS256PEMFile(writeFile(t, "key.pem", content))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				v := newTestVerifier(t, keys)
+				if _, err := v.Verify(sign(t, rs, goodClaims(), key)); err != nil {
+					t.Fatalf("verify: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
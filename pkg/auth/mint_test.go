@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMintedTokensVerify(t *testing.T) {
+	m, err := NewMinter(MintConfig{
+		Secret:   testSecret,
+		KeyID:    "h1",
+		Subject:  "order-service",
+		Roles:    []string{"stock-clerk"},
+		Issuer:   "issuer",
+		Audience: "orders",
+		TTL:      5 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := testNow
+	m.now = func() time.Time { return now }
+
+	keys := &KeySet{}
+	if err := keys.AddJWKSFile(writeJWKS(t,
+		map[string]string{"kty": "oct", "kid": "h0", "k": base64.RawURLEncoding.EncodeToString([]byte("old secret"))},
+		map[string]string{"kty": "oct", "kid": "h1", "k": base64.RawURLEncoding.EncodeToString(testSecret)},
+	)); err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVerifier(t, keys)
+
+	first, err := m.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := v.Verify(first)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if p.Subject != "order-service" || !p.HasRole("stock-clerk") {
+		t.Errorf("principal = %+v", p)
+	}
+
+	now = testNow.Add(2 * time.Minute)
+	if again, _ := m.Token(); again != first {
+		t.Error("token renewed before half its lifetime passed")
+	}
+	now = testNow.Add(3 * time.Minute)
+	renewed, _ := m.Token()
+	if renewed == first {
+		t.Fatal("token not renewed after half its lifetime")
+	}
+
+	// the first token runs out, the renewed one is still good
+	v.now = func() time.Time { return testNow.Add(5*time.Minute + leeway + time.Second) }
+	if _, err := v.Verify(first); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("first token: err = %v, want expired", err)
+	}
+	if _, err := v.Verify(renewed); err != nil {
+		t.Errorf("renewed token: %v", err)
+	}
+}
+
+func TestNewMinterChecksConfig(t *testing.T) {
+	good := MintConfig{Secret: testSecret, Subject: "s", TTL: time.Minute}
+	bad := map[string]func(c *MintConfig){
+		"no secret":  func(c *MintConfig) { c.Secret = nil },
+		"no subject": func(c *MintConfig) { c.Subject = "" },
+		"no ttl":     func(c *MintConfig) { c.TTL = 0 },
+	}
+	if _, err := NewMinter(good); err != nil {
+		t.Fatalf("good config: %v", err)
+	}
+	for name, change := range bad {
+		cfg := good
+		change(&cfg)
+		if _, err := NewMinter(cfg); err == nil {
+			t.Errorf("%s: NewMinter succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Package etag formats the version ETags both services send on the resources
+// they let clients update, and reads the If-Match header those updates are
+// conditioned on.
+//
+// An ETag is the resource's version as a quoted decimal, e.g. "3". If-Match is
+// compared strongly (RFC 9110, section 13.1.1): weak tags never match.
+package etag
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Any is the version If-Match: * stands for; it matches every version.
+const Any int64 = -1
+
+var (
+	ErrMissing   = errors.New("If-Match header required")
+	ErrWeak      = errors.New("weak ETags never match If-Match")
+	ErrMalformed = errors.New("malformed If-Match header")
+)
+
+// Format returns the ETag of version.
+func Format(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ParseIfMatch returns the version an If-Match header value asks for, or Any
+// for "*".
+func ParseIfMatch(h string) (int64, error) {
+	h = strings.TrimSpace(h)
+	switch {
+	case h == "":
+		return 0, ErrMissing
+	case h == "*":
+		return Any, nil
+	case strings.HasPrefix(h, "W/"):
+		return 0, ErrWeak
+	}
+	tag, err := strconv.Unquote(h)
+	if err != nil || !strings.HasPrefix(h, `"`) {
+		return 0, ErrMalformed
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version < 0 {
+		return 0, ErrMalformed
+	}
+	return version, nil
+}
+
+// StatusCode is the status to answer a ParseIfMatch error with: 428 for a
+// missing header, 412 for a weak tag, which can never match, and 400
+// otherwise.
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrMissing):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, ErrWeak):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusBadRequest
+	}
+}
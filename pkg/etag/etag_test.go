@@ -0,0 +1,55 @@
+package etag
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		h       string
+		version int64
+		err     error
+	}{
+		{`"3"`, 3, nil},
+		{` "0" `, 0, nil},
+		{"*", Any, nil},
+		{"", 0, ErrMissing},
+		{"  ", 0, ErrMissing},
+		{`W/"3"`, 0, ErrWeak},
+		{`w/"3"`, 0, ErrMalformed},
+		{"3", 0, ErrMalformed},
+		{"`3`", 0, ErrMalformed},
+		{`"-1"`, 0, ErrMalformed},
+		{`"abc"`, 0, ErrMalformed},
+		{`"3", "4"`, 0, ErrMalformed},
+	}
+	for _, tt := range tests {
+		version, err := ParseIfMatch(tt.h)
+		if err != tt.err || version != tt.version {
+			t.Errorf("ParseIfMatch(%q) = %d, %v, want %d, %v", tt.h, version, err, tt.version, tt.err)
+		}
+	}
+}
+
+func TestFormatRoundTrips(t *testing.T) {
+	if got := Format(42); got != `"42"` {
+		t.Fatalf("Format(42) = %s", got)
+	}
+	if v, err := ParseIfMatch(Format(42)); err != nil || v != 42 {
+		t.Errorf("ParseIfMatch(Format(42)) = %d, %v", v, err)
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := map[error]int{
+		ErrMissing:   http.StatusPreconditionRequired,
+		ErrWeak:      http.StatusPreconditionFailed,
+		ErrMalformed: http.StatusBadRequest,
+	}
+	for err, want := range tests {
+		if got := StatusCode(err); got != want {
+			t.Errorf("StatusCode(%v) = %d, want %d", err, got, want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Package idempotency makes HTTP routes of both services safe to retry with
+// an Idempotency-Key header, so clients see the same contract from each of
+// them. Keys and the responses to replay live in a Store, see MongoStore.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Nurda-zh/a1/pkg/auth"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	KeyHeader = "Idempotency-Key"
+	// ReplayedHeader marks a response replayed from an earlier request.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	// MaxBodyBytes bounds the request body read to fingerprint a request.
+	MaxBodyBytes = 1 << 20
+
+	maxKeyLen = 255
+	// lockFor is how long a request owns its key before a retry may assume
+	// it died and run again.
+	lockFor = time.Minute
+)
+
+type State string
+
+const (
+	InProgress State = "in_progress"
+	Done       State = "done"
+)
+
+// Record remembers a request sent with an Idempotency-Key and, once it
+// finished, the response to replay when the key is sent again. Fingerprint
+// identifies the request the key was first used with.
+type Record struct {
+	Key         string          `json:"key" bson:"_id"`
+	Fingerprint string          `json:"fingerprint" bson:"fingerprint"`
+	State       State           `json:"state" bson:"state"`
+	Response    *StoredResponse `json:"response,omitempty" bson:"response,omitempty"`
+	// LockedUntil lets another request take over a key whose first request
+	// died before storing a response.
+	LockedUntil time.Time `json:"locked_until" bson:"locked_until"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+type StoredResponse struct {
+	Status int               `json:"status" bson:"status"`
+	Header map[string]string `json:"header,omitempty" bson:"header,omitempty"`
+	Body   []byte            `json:"body" bson:"body"`
+}
+
+// Store keeps the keys Middleware has seen.
+type Store interface {
+	// Begin claims key for the request with fingerprint until lock runs out
+	// and returns nil. If the key is already claimed or done, its record is
+	// returned instead and nothing is claimed.
+	Begin(ctx context.Context, key, fingerprint string, lock, ttl time.Duration) (*Record, error)
+	Complete(ctx context.Context, key string, resp *StoredResponse) error
+	// Abandon drops a claimed key so the request can be retried.
+	Abandon(ctx context.Context, key string) error
+}
+
+// replayedHeaders are the response headers stored with a response.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// Middleware makes a route safe to retry. The first request with an
+// Idempotency-Key runs and its response is kept for ttl; repeats with the
+// same key and body get that response back, repeats with a different body
+// get 422 and repeats while the first is still running get 409. Server
+// errors are not kept, so the request can be retried. Requests without the
+// header run as usual; bodies above MaxBodyBytes get 413.
+func Middleware(keys Store, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(KeyHeader))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body is too large"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// keys are scoped to the caller and the route, the request itself is
+		// the fingerprint
+		scoped := c.Request.Method + " " + c.FullPath() + " " + key
+		if p, ok := auth.FromContext(c.Request.Context()); ok {
+			scoped = p.Subject + " " + scoped
+		}
+		sum := sha256.New()
+		sum.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		sum.Write(body)
+		fingerprint := hex.EncodeToString(sum.Sum(nil))
+
+		rec, err := keys.Begin(c.Request.Context(), scoped, fingerprint, lockFor, ttl)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if rec != nil {
+			replay(c, rec, fingerprint)
+			return
+		}
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			// store with a fresh context: the request's may be cancelled
+			ctx := context.WithoutCancel(c.Request.Context())
+			status := w.Status()
+			if p := recover(); p != nil || status >= http.StatusInternalServerError {
+				if err := keys.Abandon(ctx, scoped); err != nil {
+					log.Printf("idempotency: abandon key %q: %v", key, err)
+				}
+				if p != nil {
+					panic(p)
+				}
+				return
+			}
+			resp := &StoredResponse{Status: status, Header: map[string]string{}, Body: w.body.Bytes()}
+			for _, h := range replayedHeaders {
+				if v := w.Header().Get(h); v != "" {
+					resp.Header[h] = v
+				}
+			}
+			if err := keys.Complete(ctx, scoped, resp); err != nil {
+				log.Printf("idempotency: store response for key %q: %v", key, err)
+			}
+		}()
+		c.Next()
+	}
+}
+
+func replay(c *gin.Context, rec *Record, fingerprint string) {
+	switch {
+	case rec.Fingerprint != fingerprint:
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+	case rec.State != Done || rec.Response == nil:
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still in progress"})
+	default:
+		for h, v := range rec.Response.Header {
+			c.Header(h, v)
+		}
+		c.Header(ReplayedHeader, "true")
+		c.Status(rec.Response.Status)
+		_, _ = c.Writer.Write(rec.Response.Body)
+		c.Abort()
+	}
+}
+
+// recordingWriter keeps a copy of the response body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,178 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memStore keeps records in a map, like MongoStore keeps documents.
+type memStore struct {
+	mu        sync.Mutex
+	records   map[string]*Record
+	abandoned int
+}
+
+func newMemStore() *memStore {
+	return &memStore{records: map[string]*Record{}}
+}
+
+func (s *memStore) Begin(ctx context.Context, key, fingerprint string, lock, ttl time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.records[key]; ok {
+		cp := *rec
+		return &cp, nil
+	}
+	s.records[key] = &Record{Key: key, Fingerprint: fingerprint, State: InProgress}
+	return nil, nil
+}
+
+func (s *memStore) Complete(ctx context.Context, key string, resp *StoredResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key].State = Done
+	s.records[key].Response = resp
+	return nil
+}
+
+func (s *memStore) Abandon(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	s.abandoned++
+	return nil
+}
+
+// orders is a route behind Middleware that counts how often it ran and
+// answers with status. When block is set it first reports on started and
+// waits until block is closed.
+type orders struct {
+	runs    int
+	status  int
+	started chan struct{}
+	block   chan struct{}
+	router  *gin.Engine
+}
+
+func newOrders(store Store) *orders {
+	gin.SetMode(gin.TestMode)
+	o := &orders{status: http.StatusCreated}
+	o.router = gin.New()
+	o.router.POST("/orders", Middleware(store, time.Hour), func(c *gin.Context) {
+		o.runs++
+		if o.block != nil {
+			o.started <- struct{}{}
+			<-o.block
+		}
+		c.Header("Location", "/orders/o1")
+		c.JSON(o.status, gin.H{"run": o.runs})
+	})
+	return o
+}
+
+func (o *orders) post(key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(KeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestReplaysTheStoredResponse(t *testing.T) {
+	o := newOrders(newMemStore())
+	first := o.post("k1", `{"qty":1}`)
+	if first.Code != http.StatusCreated || first.Header().Get(ReplayedHeader) != "" {
+		t.Fatalf("first: %d %v", first.Code, first.Header())
+	}
+	again := o.post("k1", `{"qty":1}`)
+	if again.Code != http.StatusCreated || again.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", again.Code, again.Body, first.Code, first.Body)
+	}
+	if again.Header().Get(ReplayedHeader) != "true" || again.Header().Get("Location") != "/orders/o1" {
+		t.Errorf("replay headers = %v", again.Header())
+	}
+	if o.runs != 1 {
+		t.Errorf("ran %d times, want once", o.runs)
+	}
+
+	// another key and requests without one run again
+	o.post("k2", `{"qty":1}`)
+	o.post("", `{"qty":1}`)
+	if o.runs != 3 {
+		t.Errorf("ran %d times, want 3", o.runs)
+	}
+}
+
+func TestRejectsTheKeyWithADifferentBody(t *testing.T) {
+	o := newOrders(newMemStore())
+	o.post("k1", `{"qty":1}`)
+	w := o.post("k1", `{"qty":2}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", w.Code, w.Body)
+	}
+	if o.runs != 1 {
+		t.Errorf("ran %d times, want once", o.runs)
+	}
+}
+
+func TestConflictsWhileTheFirstRequestRuns(t *testing.T) {
+	o := newOrders(newMemStore())
+	o.started, o.block = make(chan struct{}), make(chan struct{})
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- o.post("k1", `{"qty":1}`) }()
+	<-o.started
+
+	if w := o.post("k1", `{"qty":1}`); w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+	}
+	close(o.block)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Fatalf("first: %d %s", first.Code, first.Body)
+	}
+	if w := o.post("k1", `{"qty":1}`); w.Code != http.StatusCreated || w.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("after the first finished: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestAbandonsTheKeyOnServerErrors(t *testing.T) {
+	store := newMemStore()
+	o := newOrders(store)
+	o.status = http.StatusServiceUnavailable
+	if w := o.post("k1", `{"qty":1}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if store.abandoned != 1 || len(store.records) != 0 {
+		t.Fatalf("abandoned %d, records %v", store.abandoned, store.records)
+	}
+
+	// the retry runs and its answer is kept
+	o.status = http.StatusCreated
+	if w := o.post("k1", `{"qty":1}`); w.Code != http.StatusCreated || w.Header().Get(ReplayedHeader) != "" {
+		t.Fatalf("retry: %d %v", w.Code, w.Header())
+	}
+	if o.runs != 2 || store.records[strings.Join([]string{http.MethodPost, "/orders", "k1"}, " ")].State != Done {
+		t.Errorf("ran %d times, records %v", o.runs, store.records)
+	}
+}
+
+func TestRejectsBadRequests(t *testing.T) {
+	o := newOrders(newMemStore())
+	if w := o.post(strings.Repeat("k", maxKeyLen+1), `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("long key: status = %d, want 400", w.Code)
+	}
+	if w := o.post("k1", strings.Repeat(" ", MaxBodyBytes+1)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: status = %d, want 413", w.Code)
+	}
+	if o.runs != 0 {
+		t.Errorf("ran %d times, want never", o.runs)
+	}
+}
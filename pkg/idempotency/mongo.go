@@ -0,0 +1,91 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps one document per key in a collection.
+type MongoStore struct {
+	coll    *mongo.Collection
+	timeout time.Duration
+}
+
+// NewMongoStore keeps keys in coll; timeout bounds each read and write.
+func NewMongoStore(coll *mongo.Collection, timeout time.Duration) *MongoStore {
+	return &MongoStore{coll: coll, timeout: timeout}
+}
+
+// EnsureIndexes lets Mongo drop records once they expire.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *MongoStore) Begin(ctx context.Context, key, fingerprint string, lock, ttl time.Duration) (*Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	now := time.Now().UTC()
+	_, err := s.coll.InsertOne(ctx, &Record{
+		Key:         key,
+		Fingerprint: fingerprint,
+		State:       InProgress,
+		LockedUntil: now.Add(lock),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	})
+	if err == nil {
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	// take over a claim whose request never finished
+	res, err := s.coll.UpdateOne(ctx, bson.M{
+		"_id":          key,
+		"fingerprint":  fingerprint,
+		"state":        InProgress,
+		"locked_until": bson.M{"$lt": now},
+	}, bson.M{"$set": bson.M{"locked_until": now.Add(lock)}})
+	if err != nil {
+		return nil, err
+	}
+	if res.ModifiedCount == 1 {
+		return nil, nil
+	}
+
+	var rec Record
+	if err := s.coll.FindOne(ctx, bson.M{"_id": key}).Decode(&rec); err != nil {
+		if err == mongo.ErrNoDocuments {
+			// expired or abandoned in between; the caller may retry
+			return &Record{Key: key, Fingerprint: fingerprint, State: InProgress}, nil
+		}
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *MongoStore) Complete(ctx context.Context, key string, resp *StoredResponse) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	_, err := s.coll.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{
+		"state":    Done,
+		"response": resp,
+	}})
+	return err
+}
+
+func (s *MongoStore) Abandon(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	_, err := s.coll.DeleteOne(ctx, bson.M{"_id": key, "state": InProgress})
+	return err
+}
@@ -0,0 +1,114 @@
+// Package money is the representation of prices both services share: an
+// integer amount in the currency's minor unit and its ISO 4217 code, the
+// same shape in JSON, BSON and on the wire between the services.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidAmount    = errors.New("invalid money amount")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// Money is an amount in the currency's minor unit (cents for USD) together
+// with its ISO 4217 code.
+type Money struct {
+	Amount   int64  `bson:"amount" json:"amount"`
+	Currency string `bson:"currency" json:"currency"`
+}
+
+// MinorUnitExponent is the number of decimal places of currency's minor unit.
+func MinorUnitExponent(currency string) int {
+	switch strings.ToUpper(currency) {
+	case "BIF", "CLP", "DJF", "GNF", "ISK", "JPY", "KMF", "KRW", "PYG", "RWF", "UGX", "VND", "VUV", "XAF", "XOF", "XPF":
+		return 0
+	case "BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND":
+		return 3
+	default:
+		return 2
+	}
+}
+
+// Pow10 returns 10^exp; used to scale major units into minor units.
+func Pow10(exp int) int64 {
+	n := int64(1)
+	for i := 0; i < exp; i++ {
+		n *= 10
+	}
+	return n
+}
+
+// Parse converts a decimal amount in major units, such as "12.50", into
+// Money without going through float64. More decimals than the currency has
+// is an error rather than a silent rounding, as is any sign but one leading
+// minus.
+func Parse(decimal, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	exp := MinorUnitExponent(currency)
+	s := strings.TrimSpace(decimal)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	// strconv.ParseInt below would take a second sign
+	if whole == "" && frac == "" || strings.ContainsAny(s, "eE+-") {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, decimal)
+	}
+	if len(frac) > exp {
+		// allow trailing zeros such as 12.500 for USD
+		if strings.TrimRight(frac[exp:], "0") != "" {
+			return Money{}, fmt.Errorf("%w: %q has more than %d decimals", ErrInvalidAmount, decimal, exp)
+		}
+		frac = frac[:exp]
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, decimal)
+	}
+	if neg {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Decimal formats the amount in major units, e.g. 1250 USD as "12.50".
+func (m Money) Decimal() string {
+	exp := MinorUnitExponent(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if exp == 0 {
+		return sign + strconv.FormatInt(amount, 10)
+	}
+	digits := fmt.Sprintf("%0*d", exp+1, amount)
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+// Times multiplies the amount by a quantity.
+func (m Money) Times(n int) Money {
+	return Money{Amount: m.Amount * int64(n), Currency: m.Currency}
+}
+
+// Add sums two amounts of the same currency. A zero Money with no currency
+// adopts the other's currency.
+func (m Money) Add(o Money) (Money, error) {
+	switch {
+	case m.Currency == "":
+		m.Currency = o.Currency
+	case o.Currency != "" && o.Currency != m.Currency:
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
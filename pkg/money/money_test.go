@@ -0,0 +1,87 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in, currency string
+		want         Money
+		wantErr      bool
+	}{
+		{"12.50", "usd", Money{1250, "USD"}, false},
+		{"12.5", "USD", Money{1250, "USD"}, false},
+		{"12", "USD", Money{1200, "USD"}, false},
+		{".5", "USD", Money{50, "USD"}, false},
+		{"12.500", "USD", Money{1250, "USD"}, false},
+		{" 7.25 ", "USD", Money{725, "USD"}, false},
+		{"-5", "USD", Money{-500, "USD"}, false},
+		{"-0.01", "USD", Money{-1, "USD"}, false},
+		{"1200", "JPY", Money{1200, "JPY"}, false},
+		{"1.234", "KWD", Money{1234, "KWD"}, false},
+
+		{"12.345", "USD", Money{}, true},
+		{"1.5", "JPY", Money{}, true},
+		{"", "USD", Money{}, true},
+		{".", "USD", Money{}, true},
+		{"-", "USD", Money{}, true},
+		{"--5", "USD", Money{}, true},
+		{"-+5", "USD", Money{}, true},
+		{"+5", "USD", Money{}, true},
+		{"5-", "USD", Money{}, true},
+		{"1-2", "USD", Money{}, true},
+		{"1.-5", "USD", Money{}, true},
+		{"1e3", "USD", Money{}, true},
+		{"12.5.0", "USD", Money{}, true},
+		{"ten", "USD", Money{}, true},
+		{"99999999999999999999", "USD", Money{}, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in, tt.currency)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("Parse(%q) = %+v, %v; want ErrInvalidAmount", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q, %s) = %+v, %v; want %+v", tt.in, tt.currency, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{Money{1250, "USD"}, "12.50"},
+		{Money{5, "USD"}, "0.05"},
+		{Money{-1, "USD"}, "-0.01"},
+		{Money{1200, "JPY"}, "1200"},
+		{Money{1234, "KWD"}, "1.234"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Decimal(); got != tt.want {
+			t.Errorf("%+v.Decimal() = %q, want %q", tt.m, got, tt.want)
+		}
+		if back, err := Parse(tt.m.Decimal(), tt.m.Currency); err != nil || back != tt.m {
+			t.Errorf("Parse(Decimal(%+v)) = %+v, %v", tt.m, back, err)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	sum, err := Money{}.Add(Money{250, "EUR"})
+	if err != nil || sum != (Money{250, "EUR"}) {
+		t.Errorf("zero + 2.50 EUR = %+v, %v", sum, err)
+	}
+	if sum, err = sum.Add(Money{250, "EUR"}.Times(2)); err != nil || sum != (Money{750, "EUR"}) {
+		t.Errorf("2.50 + 2 x 2.50 EUR = %+v, %v", sum, err)
+	}
+	if _, err := sum.Add(Money{1, "USD"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("EUR + USD: err = %v, want ErrCurrencyMismatch", err)
+	}
+}
@@ -0,0 +1,177 @@
+// Package webhook signs, sends and schedules webhook deliveries for both
+// services, so subscribers see the same contract from each of them.
+//
+// Every request carries X-Webhook-Timestamp, the unix time it was signed at,
+// and X-Webhook-Signature, "sha256=" followed by the hex HMAC-SHA256 of the
+// timestamp, a dot and the raw body, keyed by the subscription's secret.
+// Receivers recompute it with Verify and should reject timestamps far from
+// their own clock, which stops replays.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// AllEvents subscribes to every event type.
+const AllEvents = "*"
+
+// MinSecretLen is the shortest secret a subscriber may choose.
+const MinSecretLen = 16
+
+const (
+	minBackoff = 10 * time.Second
+	maxBackoff = time.Hour
+)
+
+var (
+	ErrInvalidSubscription = errors.New("invalid webhook subscription")
+	ErrBadSignature        = errors.New("webhook signature does not match")
+	ErrStaleTimestamp      = errors.New("webhook timestamp is too far from now")
+)
+
+// Event is the body of a delivery for events that have no richer envelope
+// of their own.
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// CheckSubscription validates what a subscriber asked for against the event
+// types the service knows. It returns the event types without duplicates
+// and the secret, generated when none was given.
+func CheckSubscription(rawURL string, eventTypes []string, secret string, known map[string]bool) ([]string, string, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, "", fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidSubscription)
+	}
+	types := make([]string, 0, len(eventTypes))
+	seen := map[string]bool{}
+	for _, t := range eventTypes {
+		if t != AllEvents && !known[t] {
+			return nil, "", fmt.Errorf("%w: unknown event type %q", ErrInvalidSubscription, t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	if secret == "" {
+		if secret, err = NewSecret(); err != nil {
+			return nil, "", err
+		}
+	} else if len(secret) < MinSecretLen {
+		return nil, "", fmt.Errorf("%w: secret must be at least %d characters", ErrInvalidSubscription, MinSecretLen)
+	}
+	return types, secret, nil
+}
+
+// Sign returns the X-Webhook-Signature value for body sent at ts.
+func Sign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery the way a receiver should: the signature must
+// match and the timestamp must be within tolerance of now.
+func Verify(secret, timestamp, signature string, body []byte, now time.Time, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp %q", ErrStaleTimestamp, timestamp)
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return ErrStaleTimestamp
+	}
+	if !hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// NewSecret returns a random secret for a subscription created without one.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Backoff is how long to wait before the attempt after attempts failed
+// ones: it doubles from 10 seconds up to an hour.
+func Backoff(attempts int) time.Duration {
+	d := minBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// Retry decides what follows the failed attempt number attempts: another
+// one at the returned time, or none once maxAttempts are spent.
+func Retry(attempts, maxAttempts int, now time.Time) (time.Time, bool) {
+	if attempts >= maxAttempts {
+		return time.Time{}, false
+	}
+	return now.Add(Backoff(attempts)), true
+}
+
+// Sender POSTs signed deliveries.
+type Sender struct {
+	client    *http.Client
+	userAgent string
+	now       func() time.Time
+}
+
+func NewSender(userAgent string, timeout time.Duration) *Sender {
+	return &Sender{client: &http.Client{Timeout: timeout}, userAgent: userAgent, now: time.Now}
+}
+
+// Send POSTs body to url, signed with secret. It returns the response
+// status, 0 when there was none, and an error unless the status is 2xx.
+func (s *Sender) Send(ctx context.Context, url, secret, deliveryID, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := s.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", s.userAgent)
+	req.Header.Set(HeaderID, deliveryID)
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, ts, body))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1_700_000_000, 0)
+
+func TestSign(t *testing.T) {
+	// the documented scheme, as a receiver would compute it:
+	// printf '1700000000.{"id":"1"}' | openssl dgst -sha256 -hmac s3cret
+	const want = "sha256=2b9dee6c893e4bf012ad34ee7b89d492b9567b4f47740ccbf0f161ba3717dc08"
+	if got := Sign("s3cret", 1700000000, []byte(`{"id":"1"}`)); got != want {
+		t.Errorf("Sign = %q, want %q", got, want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	ts := testNow.Unix()
+	sig := Sign("s3cret", ts, body)
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      string
+		now       time.Time
+		want      error
+	}{
+		{"valid", "s3cret", strconv.FormatInt(ts, 10), sig, string(body), testNow, nil},
+		{"clock skew within tolerance", "s3cret", strconv.FormatInt(ts, 10), sig, string(body), testNow.Add(4 * time.Minute), nil},
+		{"replayed later", "s3cret", strconv.FormatInt(ts, 10), sig, string(body), testNow.Add(6 * time.Minute), ErrStaleTimestamp},
+		{"from the future", "s3cret", strconv.FormatInt(ts, 10), sig, string(body), testNow.Add(-6 * time.Minute), ErrStaleTimestamp},
+		{"not a timestamp", "s3cret", "yesterday", sig, string(body), testNow, ErrStaleTimestamp},
+		{"wrong secret", "other", strconv.FormatInt(ts, 10), sig, string(body), testNow, ErrBadSignature},
+		{"tampered body", "s3cret", strconv.FormatInt(ts, 10), sig, `{"id":"2"}`, testNow, ErrBadSignature},
+		{"moved timestamp", "s3cret", strconv.FormatInt(ts+1, 10), sig, string(body), testNow, ErrBadSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.timestamp, tt.signature, []byte(tt.body), tt.now, 5*time.Minute)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	next, ok := Retry(2, 5, testNow)
+	if !ok || !next.Equal(testNow.Add(20*time.Second)) {
+		t.Errorf("Retry(2, 5) = %v, %v; want a retry in 20s", next, ok)
+	}
+	if _, ok := Retry(5, 5, testNow); ok {
+		t.Error("Retry(5, 5) retries after the last attempt")
+	}
+}
+
+func TestCheckSubscription(t *testing.T) {
+	known := map[string]bool{"order.created": true, "order.status_changed": true}
+	tests := []struct {
+		name      string
+		url       string
+		types     []string
+		secret    string
+		wantTypes []string
+		wantErr   bool
+	}{
+		{"valid", "https://example.com/hook", []string{"order.created"}, "0123456789abcdef", []string{"order.created"}, false},
+		{"duplicates dropped", "http://example.com/hook", []string{"order.created", "order.created", AllEvents}, "0123456789abcdef", []string{"order.created", AllEvents}, false},
+		{"generated secret", "https://example.com/hook", []string{AllEvents}, "", []string{AllEvents}, false},
+		{"unknown type", "https://example.com/hook", []string{"order.deleted"}, "", nil, true},
+		{"relative url", "/hook", []string{AllEvents}, "", nil, true},
+		{"other scheme", "ftp://example.com/hook", []string{AllEvents}, "", nil, true},
+		{"short secret", "https://example.com/hook", []string{AllEvents}, "short", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types, secret, err := CheckSubscription(tt.url, tt.types, tt.secret, known)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSubscription) {
+					t.Fatalf("err = %v, want ErrInvalidSubscription", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(types) != len(tt.wantTypes) {
+				t.Fatalf("types = %v, want %v", types, tt.wantTypes)
+			}
+			for i := range types {
+				if types[i] != tt.wantTypes[i] {
+					t.Fatalf("types = %v, want %v", types, tt.wantTypes)
+				}
+			}
+			if tt.secret != "" && secret != tt.secret {
+				t.Errorf("secret = %q, want the given one", secret)
+			}
+			if len(secret) < MinSecretLen {
+				t.Errorf("secret %q is shorter than %d", secret, MinSecretLen)
+			}
+		})
+	}
+}
+
+func TestSenderSignsDeliveries(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	s := NewSender("test-agent", time.Second)
+	s.now = func() time.Time { return testNow }
+	body := []byte(`{"id":"e1"}`)
+	code, err := s.Send(context.Background(), srv.URL, "s3cret", "d1", "order.created", body)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("Send = %d, %v", code, err)
+	}
+	if got.Method != http.MethodPost || got.Header.Get(HeaderID) != "d1" || got.Header.Get(HeaderEvent) != "order.created" || got.UserAgent() != "test-agent" {
+		t.Errorf("request = %s %v", got.Method, got.Header)
+	}
+	if err := Verify("s3cret", got.Header.Get(HeaderTimestamp), got.Header.Get(HeaderSignature), gotBody, testNow, time.Minute); err != nil {
+		t.Errorf("delivery does not verify: %v", err)
+	}
+
+	status = http.StatusGone
+	if code, err := s.Send(context.Background(), srv.URL, "s3cret", "d2", "order.created", body); err == nil || code != http.StatusGone {
+		t.Errorf("Send to a failing endpoint = %d, %v; want 410 and an error", code, err)
+	}
+}
+
+func TestSenderReportsNoStatusWithoutResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+	code, err := NewSender("test-agent", time.Second).Send(context.Background(), url, "s3cret", "d1", "order.created", nil)
+	if err == nil || code != 0 {
+		t.Errorf("Send = %d, %v; want 0 and an error", code, err)
+	}
+}